@@ -4,20 +4,71 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"image"
+	"image/color"
 	"image/png"
 	"io"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/unrealandychan/rembg-go/pkg/backends"
+	"github.com/unrealandychan/rembg-go/pkg/engine"
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
 	"github.com/unrealandychan/rembg-go/pkg/processing"
+	"github.com/unrealandychan/rembg-go/pkg/quantize"
+	"github.com/unrealandychan/rembg-go/pkg/server"
+	"github.com/unrealandychan/rembg-go/pkg/tracing"
 	"github.com/unrealandychan/rembg-go/pkg/video"
 )
 
+// shutdownTracing flushes spans when --trace-exporter is set.
+var shutdownTracing func(context.Context) error
+
 var rootCmd = &cobra.Command{
 	Use:   "rembg",
 	Short: "rembg-go: minimal background removal CLI",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Expose Prometheus metrics for long-running video and batch jobs.
+		metricsAddr, _ := cmd.Flags().GetString("metrics-addr")
+		if metricsAddr != "" {
+			if _, err := metrics.Serve(metricsAddr); err != nil {
+				fmt.Fprintln(os.Stderr, "start metrics server failed:", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(os.Stderr, "serving metrics on", metricsAddr+"/metrics")
+		}
+
+		traceExporter, _ := cmd.Flags().GetString("trace-exporter")
+		if traceExporter != "" {
+			traceOutput, _ := cmd.Flags().GetString("trace-output")
+			shutdown, err := tracing.Setup(cmd.Context(), traceExporter, traceOutput)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "setup tracing failed:", err)
+				os.Exit(1)
+			}
+			shutdownTracing = shutdown
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		if shutdownTracing == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "flush traces failed:", err)
+		}
+	},
 }
 
 var imageCmd = &cobra.Command{
@@ -27,9 +78,11 @@ var imageCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		inPath := args[0]
 		outPath := args[1]
-		backendType, _ := cmd.Flags().GetString("backend")
-		backendAddr, _ := cmd.Flags().GetString("addr")
 		modelPath, _ := cmd.Flags().GetString("model")
+		if err := checkModelFlags(cmd); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
 		f, err := os.Open(inPath)
 		if err != nil {
@@ -43,20 +96,6 @@ var imageCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		var b backends.Backend
-		switch backendType {
-		case "sagemaker":
-			b = backends.NewSageMakerBackend(backendAddr)
-		case "triton_http":
-			// simple defaults; expects model "u2net" and input name "INPUT__0"
-			b = backends.NewTritonHTTPBackend(backendAddr, "u2net", "INPUT__0", []int{1, 3, 320, 320}, "UINT8")
-		case "triton_grpc":
-			b = backends.NewTritonGRPCBackend(backendAddr, "u2net", "INPUT__0", []int{1, 3, 320, 320}, "UINT8")
-		default:
-			fmt.Fprintln(os.Stderr, "unknown backend; choose sagemaker, triton_http or triton_grpc")
-			os.Exit(1)
-		}
-
 		// If modelPath is set, use local ONNX inference
 		if modelPath != "" {
 			img, err := png.Decode(bytes.NewReader(data))
@@ -67,7 +106,7 @@ var imageCmd = &cobra.Command{
 			opts := processing.RemoveBackgroundOptions{
 				ModelPath: modelPath,
 			}
-			outImg, err := processing.RemoveBackground(img, opts)
+			outImg, err := processing.RemoveBackgroundContext(cmd.Context(), img, opts)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "remove background failed:", err)
 				os.Exit(1)
@@ -83,20 +122,32 @@ var imageCmd = &cobra.Command{
 			return
 		}
 
+		b, backendName, err := openBackend(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if c, ok := b.(io.Closer); ok {
+			defer c.Close()
+		}
+
 		// Run inference asynchronously with a timeout so the command stays responsive.
-		reqCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		spanCtx, span := tracing.StartStage(cmd.Context(), "infer", tracing.AttrBackend.String(backendName))
+		reqCtx, cancel := context.WithTimeout(spanCtx, 15*time.Second)
 		defer cancel()
 
 		resCh := backends.InferAsync(reqCtx, b, data)
 		var resp []byte
 		select {
 		case r := <-resCh:
+			tracing.End(span, r.Err)
 			if r.Err != nil {
 				fmt.Fprintln(os.Stderr, "inference failed:", r.Err)
 				os.Exit(1)
 			}
 			resp = r.Data
 		case <-reqCtx.Done():
+			tracing.End(span, reqCtx.Err())
 			fmt.Fprintln(os.Stderr, "inference timeout or canceled:", reqCtx.Err())
 			os.Exit(1)
 		}
@@ -150,18 +201,11 @@ var videoRmbgCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		inputDir := args[0]
 		outputDir := args[1]
-		backendType, _ := cmd.Flags().GetString("backend")
-		backendAddr, _ := cmd.Flags().GetString("addr")
 		modelPath, _ := cmd.Flags().GetString("model")
-
-		var b backends.Backend
-		switch backendType {
-		case "sagemaker":
-			b = backends.NewSageMakerBackend(backendAddr)
-		case "triton_http":
-			b = backends.NewTritonHTTPBackend(backendAddr, "u2net", "INPUT__0", []int{1, 3, 320, 320}, "UINT8")
-		case "triton_grpc":
-			b = backends.NewTritonGRPCBackend(backendAddr, "u2net", "INPUT__0", []int{1, 3, 320, 320}, "UINT8")
+		batch, _ := cmd.Flags().GetInt("batch")
+		if err := checkModelFlags(cmd); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
 
 		opts := processing.RemoveBackgroundOptions{
@@ -174,9 +218,43 @@ var videoRmbgCmd = &cobra.Command{
 			ModelPath:       modelPath,
 		}
 
+		if modelPath != "" && batch > 0 {
+			// stack frames into batched forward passes of a local session;
+			// it runs one pass at a time, so there are no requests to limit
+			for _, flag := range []string{"rate", "burst", "max-in-flight", "adaptive", "latency-target"} {
+				if cmd.Flags().Changed(flag) {
+					fmt.Fprintf(os.Stderr, "--%s limits backend requests and cannot be used with --batch\n", flag)
+					os.Exit(1)
+				}
+			}
+			sessionOpts := sessionOptions(cmd)
+			sessionOpts.MaxBatch = batch
+			session, err := models.NewSessionWithOptions(modelPath, sessionOpts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "load model failed:", err)
+				os.Exit(1)
+			}
+			defer session.Close()
+			if err := video.RemoveBackgroundForVideoBatch(cmd.Context(), session, inputDir, outputDir, opts); err != nil {
+				fmt.Fprintln(os.Stderr, "video background removal failed:", err)
+				os.Exit(1)
+			}
+			fmt.Println("backgrounds removed for all frames in", inputDir, "and saved to", outputDir)
+			return
+		}
+
+		b, _, err := openBackend(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if c, ok := b.(io.Closer); ok {
+			defer c.Close()
+		}
+
 		if modelPath != "" {
 			// Use local ONNX inference for video frames
-			err := video.RemoveBackgroundForVideo(context.Background(), b, inputDir, outputDir, opts)
+			err := video.RemoveBackgroundForVideo(cmd.Context(), b, inputDir, outputDir, opts)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "video background removal failed:", err)
 				os.Exit(1)
@@ -259,15 +337,550 @@ var videoRmbgCmd = &cobra.Command{
 	},
 }
 
+var sagemakerServeCmd = &cobra.Command{
+	Use:     "sagemaker-serve",
+	Aliases: []string{"serve"},
+	Short:   "Serve the SageMaker container contract (GET /ping, POST /invocations) with a local model",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		modelPath, _ := cmd.Flags().GetString("model")
+		addr, _ := cmd.Flags().GetString("addr")
+		if port := os.Getenv("SAGEMAKER_BIND_TO_PORT"); port != "" && !cmd.Flags().Changed("addr") {
+			addr = ":" + port
+		}
+
+		session, err := models.NewSessionWithOptions(modelPath, sessionOptions(cmd))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "load model failed:", err)
+			os.Exit(1)
+		}
+		defer session.Close()
+		srv, err := server.NewSageMakerServer(session, processing.RemoveBackgroundOptions{PutAlpha: true})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "create server failed:", err)
+			os.Exit(1)
+		}
+
+		// SageMaker stops containers with SIGTERM; finish in-flight invocations first.
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintln(os.Stderr, "serving SageMaker invocations on", addr)
+		if err := server.ListenAndServe(ctx, addr, srv.Handler()); err != nil {
+			fmt.Fprintln(os.Stderr, "serve failed:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var kserveServeCmd = &cobra.Command{
+	Use:   "kserve-serve",
+	Short: "Serve local models over the Open Inference Protocol (KServe v2 / Triton HTTP)",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		specs, _ := cmd.Flags().GetStringArray("model")
+		addr, _ := cmd.Flags().GetString("addr")
+		if len(specs) == 0 {
+			fmt.Fprintln(os.Stderr, "at least one --model is required")
+			os.Exit(1)
+		}
+
+		sessions := make(map[string]*models.Session, len(specs))
+		for _, spec := range specs {
+			// name=path, or a bare path served under its file name
+			name, path, ok := strings.Cut(spec, "=")
+			if !ok {
+				path = spec
+				name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			}
+			session, err := models.NewSessionWithOptions(path, sessionOptions(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "load model failed:", err)
+				os.Exit(1)
+			}
+			defer session.Close()
+			sessions[name] = session
+		}
+		srv, err := server.NewKServeServer(sessions)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "create server failed:", err)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintln(os.Stderr, "serving v2 inference protocol on", addr)
+		if err := server.ListenAndServe(ctx, addr, srv.Handler()); err != nil {
+			fmt.Fprintln(os.Stderr, "serve failed:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var tritonCmd = &cobra.Command{
+	Use:   "triton",
+	Short: "Triton Inference Server utilities",
+}
+
+var tritonExportCmd = &cobra.Command{
+	Use:   "export <model.onnx> <repo-dir>",
+	Short: "Write an ONNX model and its config.pbtxt into a Triton model repository",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts backends.TritonExportOptions
+		opts.Name, _ = cmd.Flags().GetString("name")
+		opts.Version, _ = cmd.Flags().GetInt("version")
+		opts.MaxBatchSize, _ = cmd.Flags().GetInt("max-batch-size")
+		opts.MaxQueueDelay, _ = cmd.Flags().GetDuration("max-queue-delay")
+		opts.PreferredBatchSizes, _ = cmd.Flags().GetIntSlice("preferred-batch-size")
+		opts.Instances, _ = cmd.Flags().GetInt("instances")
+		opts.InstanceKind, _ = cmd.Flags().GetString("kind")
+		opts.Ensemble, _ = cmd.Flags().GetBool("ensemble")
+		for flag, dst := range map[string]*[3]float32{"mean": &opts.Mean, "std": &opts.Std} {
+			v, _ := cmd.Flags().GetFloat32Slice(flag)
+			if len(v) == 0 {
+				continue
+			}
+			if len(v) != 3 {
+				fmt.Fprintf(os.Stderr, "--%s needs 3 values (R,G,B)\n", flag)
+				os.Exit(1)
+			}
+			copy(dst[:], v)
+		}
+
+		meta, err := backends.ExportTritonModel(args[0], args[1], opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "export failed:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "wrote model %q to %s\n", meta.Name, args[1])
+		if uri, err := meta.BackendURI("triton+grpc", "localhost:8001"); err == nil {
+			fmt.Fprintf(os.Stderr, "client: --backend '%s'\n", uri)
+		}
+		if opts.Ensemble {
+			// the ensemble decodes encoded images sent as BYTES and returns
+			// the model's mask, the size of its input; a batching config
+			// adds the batch dimension to IMAGE's dims of [1]
+			shape := []int64{1}
+			if cfg, err := backends.TritonModelConfigFromMetadata(meta, opts); err == nil && cfg.MaxBatchSize > 0 {
+				shape = []int64{1, 1}
+			}
+			ens := backends.TritonModelMetadata{
+				Name:   meta.Name + "_ensemble",
+				Inputs: []backends.TritonTensorMetadata{{Name: "IMAGE", Datatype: "BYTES", Shape: shape}},
+			}
+			uri, _ := ens.BackendURI("triton+grpc", "localhost:8001")
+			if shape := meta.Inputs[0].Shape; len(shape) == 4 {
+				uri += fmt.Sprintf("&decoder=float32:%dx%d", shape[3], shape[2])
+			}
+			fmt.Fprintf(os.Stderr, "ensemble client: --backend '%s'\n", uri)
+		}
+	},
+}
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "Inspect local ONNX models",
+}
+
+var modelsCheckCmd = &cobra.Command{
+	Use:   "check <model.onnx>...",
+	Short: "List the operators of each model and any the local engine cannot run",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		for _, path := range args {
+			m, err := onnx.ReadFile(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: opset %d, operators: %s\n", path, m.Opset(""), strings.Join(m.Operators(), ", "))
+			if ops := engine.Unsupported(m); len(ops) > 0 {
+				fmt.Printf("%s: unsupported: %s\n", path, strings.Join(ops, ", "))
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var modelsBenchCmd = &cobra.Command{
+	Use:   "bench <model.onnx>",
+	Short: "Measure local background removal throughput in images/sec",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imagePath, _ := cmd.Flags().GetString("image")
+		size, _ := cmd.Flags().GetInt("size")
+		runs, _ := cmd.Flags().GetInt("runs")
+		warmup, _ := cmd.Flags().GetInt("warmup")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		sessionOpts := sessionOptions(cmd)
+		threads := sessionOpts.Threads
+		if threads <= 0 {
+			threads = runtime.GOMAXPROCS(0)
+		}
+
+		var img image.Image
+		if imagePath != "" {
+			data, err := os.ReadFile(imagePath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "read image failed:", err)
+				os.Exit(1)
+			}
+			if img, err = png.Decode(bytes.NewReader(data)); err != nil {
+				fmt.Fprintln(os.Stderr, "decode image failed:", err)
+				os.Exit(1)
+			}
+		} else {
+			// a gradient keeps the run deterministic without an input file
+			g := image.NewNRGBA(image.Rect(0, 0, size, size))
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					g.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / size), G: uint8(y * 255 / size), B: 128, A: 255})
+				}
+			}
+			img = g
+		}
+
+		loadStart := time.Now()
+		session, err := models.NewSessionWithOptions(args[0], sessionOpts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "load model failed:", err)
+			os.Exit(1)
+		}
+		defer session.Close()
+		fmt.Fprintf(os.Stderr, "loaded %s on %s in %s\n", args[0], models.Runtime, time.Since(loadStart).Round(time.Millisecond))
+
+		ctx := cmd.Context()
+		opts := processing.RemoveBackgroundOptions{PutAlpha: true}
+		for i := 0; i < warmup; i++ {
+			if _, err := processing.RemoveBackgroundWithSession(ctx, session, img, opts); err != nil {
+				fmt.Fprintln(os.Stderr, "inference failed:", err)
+				os.Exit(1)
+			}
+		}
+
+		concurrency = max(1, concurrency)
+		jobs := make(chan struct{}, runs)
+		for i := 0; i < runs; i++ {
+			jobs <- struct{}{}
+		}
+		close(jobs)
+		errs := make(chan error, concurrency)
+		start := time.Now()
+		for w := 0; w < concurrency; w++ {
+			go func() {
+				for range jobs {
+					if _, err := processing.RemoveBackgroundWithSession(ctx, session, img, opts); err != nil {
+						errs <- err
+						return
+					}
+				}
+				errs <- nil
+			}()
+		}
+		for w := 0; w < concurrency; w++ {
+			if err := <-errs; err != nil {
+				fmt.Fprintln(os.Stderr, "inference failed:", err)
+				os.Exit(1)
+			}
+		}
+		elapsed := time.Since(start)
+		b := img.Bounds()
+		fmt.Printf("%d images (%dx%d) in %s: %.2f images/sec, %s/image, %d threads, concurrency %d\n",
+			runs, b.Dx(), b.Dy(), elapsed.Round(time.Millisecond), float64(runs)/elapsed.Seconds(),
+			(elapsed / time.Duration(max(1, runs))).Round(time.Millisecond), threads, concurrency)
+	},
+}
+
+var modelsQuantizeCmd = &cobra.Command{
+	Use:   "quantize <in.onnx> <out.onnx>",
+	Short: "Quantize a model to INT8, shrinking its weights for local inference",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		mode, _ := cmd.Flags().GetString("mode")
+		dir, _ := cmd.Flags().GetString("calibration")
+		threads, _ := cmd.Flags().GetInt("threads")
+
+		m, err := onnx.ReadFile(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts := quantize.Options{Mode: quantize.Mode(mode), Threads: threads}
+		if opts.Mode == quantize.Static {
+			if dir == "" {
+				fmt.Fprintln(os.Stderr, "static quantization needs --calibration")
+				os.Exit(1)
+			}
+			paths, err := filepath.Glob(filepath.Join(dir, "*.png"))
+			if err != nil || len(paths) == 0 {
+				fmt.Fprintf(os.Stderr, "no PNG images in %s\n", dir)
+				os.Exit(1)
+			}
+			inputs := m.Graph.RuntimeInputs()
+			if len(inputs) != 1 {
+				fmt.Fprintf(os.Stderr, "calibration needs a model with one input, %s has %d\n", args[0], len(inputs))
+				os.Exit(1)
+			}
+			next := 0
+			opts.Calibration = func() (map[string]*engine.Tensor, error) {
+				if next == len(paths) {
+					return nil, io.EOF
+				}
+				path := paths[next]
+				next++
+				fmt.Fprintf(os.Stderr, "calibrating on %s (%d/%d)\n", path, next, len(paths))
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				img, err := png.Decode(bytes.NewReader(data))
+				if err != nil {
+					return nil, fmt.Errorf("decode %s: %w", path, err)
+				}
+				t, err := processing.PreprocessImage(img)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]*engine.Tensor{inputs[0].Name: engine.NewTensor(t.Shape, t.Data)}, nil
+			}
+		}
+
+		qm, err := quantize.Quantize(m, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "quantize failed:", err)
+			os.Exit(1)
+		}
+		if err := qm.WriteFile(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, "write model failed:", err)
+			os.Exit(1)
+		}
+		before, _ := os.Stat(args[0])
+		after, _ := os.Stat(args[1])
+		if before != nil && after != nil {
+			fmt.Printf("%s: %s quantization, %.1f MB -> %.1f MB\n", args[1], mode,
+				float64(before.Size())/1e6, float64(after.Size())/1e6)
+		}
+	},
+}
+
+// openBackend builds the backend selected by --backend, wrapped with
+// instrumentation and the limit flags, and returns it with its metrics name.
+// --backend is a backend URI (see backends.Open), or one of the older names
+// sagemaker, triton_http, triton_grpc and http combined with --addr. Without
+// --backend, --model selects in-process inference.
+func openBackend(cmd *cobra.Command) (backends.Backend, string, error) {
+	spec, _ := cmd.Flags().GetString("backend")
+	addr, _ := cmd.Flags().GetString("addr")
+	modelPath, _ := cmd.Flags().GetString("model")
+	configPath, _ := cmd.Flags().GetString("http-config")
+
+	name := spec
+	switch spec {
+	case "":
+		if configPath != "" {
+			break
+		}
+		if modelPath == "" && !models.HasEmbeddedModel() {
+			return nil, "", fmt.Errorf("--backend or --model required (backend schemes: %s)", strings.Join(backends.Schemes(), ", "))
+		}
+		// without --model, onnx: serves the model built into the binary
+		spec, name = "onnx:"+modelPath+sessionQuery(cmd), "onnx"
+	case "sagemaker":
+		spec = "sagemaker://" + addr
+	case "triton_http":
+		// the historical defaults: model "u2net" with a UINT8 input "INPUT__0"
+		spec = "triton+http://" + addr + "/u2net"
+	case "triton_grpc":
+		spec = "triton+grpc://" + addr + "/u2net"
+	case "http":
+		spec = addr
+	default:
+		if i := strings.Index(spec, ":"); i > 0 {
+			name = spec[:i]
+		}
+	}
+
+	var b backends.Backend
+	var err error
+	if configPath != "" && (spec == "" || strings.HasPrefix(spec, "http:") || strings.HasPrefix(spec, "https:")) {
+		// --http-config describes the request; a URL given with --backend wins
+		var opts backends.HTTPOptions
+		if opts, err = backends.LoadHTTPOptions(configPath); err != nil {
+			return nil, "", err
+		}
+		if spec != "" {
+			opts.URL = spec
+		}
+		name = "http"
+		b, err = backends.NewHTTPBackend(opts)
+	} else {
+		b, err = backends.Open(spec)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return limitBackend(cmd, backends.NewInstrumentedBackend(b, name)), name, nil
+}
+
+// checkModelFlags rejects --model together with the flags selecting a
+// backend, which --model would otherwise silently override.
+func checkModelFlags(cmd *cobra.Command) error {
+	if model, _ := cmd.Flags().GetString("model"); model == "" {
+		return nil
+	}
+	for _, flag := range []string{"backend", "http-config", "addr"} {
+		if cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--model and --%s both select the backend; use one of them", flag)
+		}
+	}
+	return nil
+}
+
+// limitBackend applies the --rate, --max-in-flight and --adaptive flags to b.
+func limitBackend(cmd *cobra.Command, b backends.Backend) backends.Backend {
+	rps, _ := cmd.Flags().GetFloat64("rate")
+	burst, _ := cmd.Flags().GetInt("burst")
+	maxInFlight, _ := cmd.Flags().GetInt("max-in-flight")
+	adaptive, _ := cmd.Flags().GetBool("adaptive")
+	latencyTarget, _ := cmd.Flags().GetDuration("latency-target")
+
+	if adaptive {
+		b = backends.NewAdaptiveBackend(b, backends.AdaptiveOptions{
+			Initial:       1,
+			Min:           1,
+			Max:           maxInFlight,
+			LatencyTarget: latencyTarget,
+		})
+	} else if maxInFlight > 0 {
+		b = backends.NewConcurrencyLimitedBackend(b, maxInFlight)
+	}
+	if rps > 0 {
+		b = backends.NewRateLimitedBackend(b, rps, burst)
+	}
+	return b
+}
+
+// sessionOptions reads the flags registered by addSessionFlags.
+func sessionOptions(cmd *cobra.Command) models.SessionOptions {
+	threads, _ := cmd.Flags().GetInt("threads")
+	interOp, _ := cmd.Flags().GetInt("inter-op-threads")
+	level, _ := cmd.Flags().GetString("optimization-level")
+	noFusion, _ := cmd.Flags().GetBool("no-fusion")
+	noArena, _ := cmd.Flags().GetBool("no-mem-arena")
+	mmap, _ := cmd.Flags().GetBool("mmap")
+	return models.SessionOptions{
+		Threads:           threads,
+		InterOpThreads:    interOp,
+		OptimizationLevel: level,
+		NoFusion:          noFusion,
+		NoMemArena:        noArena,
+		MemoryMap:         mmap,
+	}
+}
+
+// sessionQuery returns the onnx: URI parameters for the flags registered by
+// addSessionFlags, or "" if cmd has none set.
+func sessionQuery(cmd *cobra.Command) string {
+	if cmd.Flags().Lookup("threads") == nil {
+		return ""
+	}
+	opts := sessionOptions(cmd)
+	q := url.Values{}
+	for key, v := range map[string]int{"threads": opts.Threads, "inter_op_threads": opts.InterOpThreads} {
+		if v != 0 {
+			q.Set(key, strconv.Itoa(v))
+		}
+	}
+	if opts.OptimizationLevel != "" {
+		q.Set("optimization_level", opts.OptimizationLevel)
+	}
+	for key, v := range map[string]bool{"no_fusion": opts.NoFusion, "no_mem_arena": opts.NoMemArena, "mmap": opts.MemoryMap} {
+		if v {
+			q.Set(key, "true")
+		}
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// addSessionFlags registers the local inference tuning flags on cmd.
+func addSessionFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("threads", 0, "threads per operator (onnxruntime: intra-op threads; 0 = all CPUs)")
+	cmd.Flags().Int("inter-op-threads", 0, "onnxruntime inter-op threads (0 = onnxruntime default)")
+	cmd.Flags().String("optimization-level", "", "graph optimization level: disable|basic|extended|all (default all)")
+	cmd.Flags().Bool("no-fusion", false, "disable Conv+BatchNormalization+Relu fusion")
+	cmd.Flags().Bool("no-mem-arena", false, "disable the onnxruntime CPU memory arena")
+	cmd.Flags().Bool("mmap", false, "memory-map the model file instead of reading it onto the heap")
+}
+
+// addLimitFlags registers the rate limiting and concurrency flags on cmd.
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64("rate", 0, "max backend requests per second (0 = unlimited)")
+	cmd.Flags().Int("burst", 1, "token bucket burst size for --rate")
+	cmd.Flags().Int("max-in-flight", 0, "max concurrent backend requests (0 = unlimited); upper bound with --adaptive")
+	cmd.Flags().Bool("adaptive", false, "adapt concurrency with AIMD on throttling and latency")
+	cmd.Flags().Duration("latency-target", 0, "with --adaptive, back off when a request is slower than this")
+}
+
 func init() {
 	rootCmd.AddCommand(imageCmd)
 	rootCmd.AddCommand(videoCmd)
 	rootCmd.AddCommand(videoRmbgCmd)
-	imageCmd.Flags().String("backend", "sagemaker", "backend to use: sagemaker|triton_http|triton_grpc")
+	rootCmd.AddCommand(sagemakerServeCmd)
+	rootCmd.AddCommand(kserveServeCmd)
+	rootCmd.AddCommand(tritonCmd)
+	tritonCmd.AddCommand(tritonExportCmd)
+	rootCmd.AddCommand(modelsCmd)
+	modelsCmd.AddCommand(modelsCheckCmd)
+	modelsCmd.AddCommand(modelsBenchCmd)
+	modelsCmd.AddCommand(modelsQuantizeCmd)
+	rootCmd.PersistentFlags().String("metrics-addr", "", "serve Prometheus metrics on this address (e.g. :9090)")
+	rootCmd.PersistentFlags().String("trace-exporter", "", "export OpenTelemetry traces: stdout|otlp-file")
+	rootCmd.PersistentFlags().String("trace-output", "", "file to write traces to (default stdout)")
+	imageCmd.Flags().String("backend", "", "backend URI, e.g. triton+grpc://host:8001/u2net, sagemaker://endpoint, onnx:///path/model.onnx")
+	imageCmd.Flags().String("http-config", "", "JSON file configuring the http backend (URL, body, headers, response)")
+	imageCmd.Flags().String("addr", "", "backend address for the legacy --backend names (endpoint or host:port)")
 	imageCmd.Flags().String("model", "", "path to ONNX model for local inference")
-	videoRmbgCmd.Flags().String("backend", "sagemaker", "backend to use: sagemaker|triton_http|triton_grpc")
-	videoRmbgCmd.Flags().String("addr", "", "backend address (endpoint or host:port)")
+	videoRmbgCmd.Flags().String("backend", "", "backend URI, e.g. triton+grpc://host:8001/u2net, sagemaker://endpoint, onnx:///path/model.onnx")
+	videoRmbgCmd.Flags().String("http-config", "", "JSON file configuring the http backend (URL, body, headers, response)")
+	videoRmbgCmd.Flags().String("addr", "", "backend address for the legacy --backend names (endpoint or host:port)")
 	videoRmbgCmd.Flags().String("model", "", "path to ONNX model for local inference")
+	videoRmbgCmd.Flags().Int("batch", 0, "with --model, frames stacked into one forward pass (0 = one frame at a time; not with the rate and concurrency flags)")
+	sagemakerServeCmd.Flags().String("model", "/opt/ml/model/u2net.onnx", "path to the ONNX model served")
+	sagemakerServeCmd.Flags().String("addr", ":8080", "listen address (default honours SAGEMAKER_BIND_TO_PORT)")
+	kserveServeCmd.Flags().StringArray("model", nil, "model to serve as name=path.onnx (repeatable; name defaults to the file name)")
+	kserveServeCmd.Flags().String("addr", ":8000", "listen address")
+	tritonExportCmd.Flags().String("name", "", "model name in the repository (default: the file name)")
+	tritonExportCmd.Flags().Int("version", 1, "model version directory")
+	tritonExportCmd.Flags().Int("max-batch-size", -1, "max_batch_size; needs a dynamic batch dimension (-1 = 8 if the model has one, else 0)")
+	tritonExportCmd.Flags().Duration("max-queue-delay", 100*time.Microsecond, "dynamic batching max queue delay")
+	tritonExportCmd.Flags().IntSlice("preferred-batch-size", nil, "dynamic batching preferred batch sizes")
+	tritonExportCmd.Flags().Int("instances", 1, "model instances per device")
+	tritonExportCmd.Flags().String("kind", "", "instance kind: gpu|cpu (default: Triton decides)")
+	tritonExportCmd.Flags().Bool("ensemble", false, "also write a Python preprocessing model and an ensemble taking encoded images")
+	tritonExportCmd.Flags().Float32Slice("mean", nil, "preprocessing mean (R,G,B; default 0.485,0.456,0.406)")
+	tritonExportCmd.Flags().Float32Slice("std", nil, "preprocessing std (R,G,B; default 0.229,0.224,0.225)")
+	modelsBenchCmd.Flags().String("image", "", "PNG to process (default: a generated gradient)")
+	modelsBenchCmd.Flags().Int("size", 320, "side of the generated image")
+	modelsBenchCmd.Flags().Int("runs", 20, "images to process")
+	modelsBenchCmd.Flags().Int("warmup", 1, "untimed images processed first")
+	modelsBenchCmd.Flags().Int("concurrency", 1, "images processed in parallel")
+	modelsQuantizeCmd.Flags().String("mode", "dynamic", "dynamic (INT8 weights) or static (INT8 weights and activations)")
+	modelsQuantizeCmd.Flags().String("calibration", "", "folder of PNG images, resembling those to process, calibrating static quantization")
+	modelsQuantizeCmd.Flags().Int("threads", 0, "threads per operator while calibrating (0 = all CPUs)")
+	addSessionFlags(modelsBenchCmd)
+	addSessionFlags(sagemakerServeCmd)
+	addSessionFlags(kserveServeCmd)
+	addSessionFlags(videoRmbgCmd)
+	addLimitFlags(imageCmd)
+	addLimitFlags(videoRmbgCmd)
 }
 
 func main() {
@@ -6,7 +6,7 @@ import (
     "io/ioutil"
     "time"
 
-    "rembg-go/pkg/backends"
+    "github.com/unrealandychan/rembg-go/pkg/backends"
 )
 
 func main() {
@@ -20,30 +20,16 @@ func main() {
     // Create a backend (change to your endpoint/addr)
     b := backends.NewSageMakerBackend("my-endpoint")
 
-    // Fire multiple concurrent inferences using InferAsync
+    // Fire several inferences with at most 2 in flight; results arrive in input order.
     ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
     defer cancel()
 
-    ch1 := backends.InferAsync(ctx, b, payload)
-    ch2 := backends.InferAsync(ctx, b, payload)
-
-    for i := 0; i < 2; i++ {
-        select {
-        case r := <-ch1:
-            if r.Err != nil {
-                fmt.Println("infer1 failed:", r.Err)
-            } else {
-                fmt.Println("infer1 got bytes:", len(r.Data))
-            }
-        case r := <-ch2:
-            if r.Err != nil {
-                fmt.Println("infer2 failed:", r.Err)
-            } else {
-                fmt.Println("infer2 got bytes:", len(r.Data))
-            }
-        case <-ctx.Done():
-            fmt.Println("timed out waiting for inferences")
-            return
+    payloads := [][]byte{payload, payload, payload}
+    for i, r := range backends.InferManyStream(ctx, b, payloads, 2, false) {
+        if r.Err != nil {
+            fmt.Printf("infer%d failed: %v\n", i+1, r.Err)
+            continue
         }
+        fmt.Printf("infer%d got bytes: %d\n", i+1, len(r.Data))
     }
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+    "context"
     "fmt"
     "image/png"
     "os"
@@ -28,7 +29,7 @@ func main() {
     // create backend and pooled wrapper
     b := backends.NewTritonHTTPBackend("triton-host:8000", "u2net", "INPUT__0", []int{1, 3, 320, 320}, "UINT8")
     pool := backends.NewPooledBackend(b, 8)
-    defer pool.Close()
+    defer pool.Close(context.Background())
 
     mat := gocv.NewMat()
     defer mat.Close()
@@ -2,6 +2,11 @@ package backends
 
 import (
     "context"
+    "errors"
+    "io"
+    "sync"
+    "sync/atomic"
+    "time"
 )
 
 // InferResult holds an asynchronous inference result.
@@ -27,6 +32,9 @@ func InferAsync(ctx context.Context, b Backend, payload []byte) <-chan InferResu
     return ch
 }
 
+// ErrClosed is returned by PooledBackend.Infer and ExecBackend.Infer after Close has been called.
+var ErrClosed = errors.New("backends: backend closed")
+
 // pooledJob is an internal job submitted to the pool.
 type pooledJob struct {
     ctx     context.Context
@@ -34,60 +42,202 @@ type pooledJob struct {
     resp    chan InferResult
 }
 
+// PoolStats is a snapshot of a PooledBackend's state.
+type PoolStats struct {
+    Workers          int              // size of the pool
+    Busy             int              // workers currently running a job
+    Queued           int              // Infer calls waiting for a free worker
+    QueuedByPriority map[Priority]int // Queued broken down by priority class
+    Completed        int64            // jobs that finished without error
+    Failed           int64            // jobs that returned an error
+}
+
+// PoolOptions configures a PooledBackend.
+type PoolOptions struct {
+    // Workers is the number of worker goroutines (default 4).
+    Workers int
+    // TenantWeights sets the weighted fair queuing share of each tenant
+    // (see WithTenant) within a priority class. Unlisted tenants get DefaultWeight.
+    TenantWeights map[string]float64
+    // DefaultWeight is the weight of tenants missing from TenantWeights (default 1).
+    DefaultWeight float64
+    // StarvationAge, when non-zero, serves any job that has waited at least
+    // this long before newer higher-priority jobs.
+    StarvationAge time.Duration
+}
+
 // PooledBackend is a wrapper that runs underlying Backend.Infer calls
 // on a fixed-size pool of worker goroutines. It implements Backend.
+//
+// Waiting jobs are scheduled by priority class (WithPriority or InferPriority),
+// then fairly between tenants (WithTenant) according to PoolOptions.
 type PooledBackend struct {
-    jobs chan pooledJob
+    sched   *scheduler
+    workers int
+
+    // done is closed by Close to stop accepting work; abort cancels in-flight
+    // jobs when Close's context expires before they drain.
+    done      chan struct{}
+    closeOnce sync.Once
+    abortCtx  context.Context
+    abort     context.CancelFunc
+
+    // stopped is closed once every worker has exited and the wrapped backend
+    // has been closed; closeErr holds the error from closing it.
+    wg       sync.WaitGroup
+    stopped  chan struct{}
+    closeErr error
+
+    // busy counts workers running a job; exported as a gauge by InstrumentPool.
+    busy      atomic.Int64
+    completed atomic.Int64
+    failed    atomic.Int64
 }
 
 // NewPooledBackend wraps an existing Backend with a worker pool of size workers.
 // Use workers = runtime.GOMAXPROCS(0) or a tuned number for your workload.
+// If b implements io.Closer it is closed once the pool has shut down.
 func NewPooledBackend(b Backend, workers int) *PooledBackend {
+    return NewPooledBackendWithOptions(b, PoolOptions{Workers: workers})
+}
+
+// NewPooledBackendWithOptions is NewPooledBackend with scheduling options.
+func NewPooledBackendWithOptions(b Backend, opts PoolOptions) *PooledBackend {
+    workers := opts.Workers
     if workers <= 0 {
         workers = 4
     }
-    p := &PooledBackend{jobs: make(chan pooledJob)}
+    abortCtx, abort := context.WithCancel(context.Background())
+    p := &PooledBackend{
+        sched:    newScheduler(opts.TenantWeights, opts.DefaultWeight, opts.StarvationAge),
+        workers:  workers,
+        done:     make(chan struct{}),
+        abortCtx: abortCtx,
+        abort:    abort,
+        stopped:  make(chan struct{}),
+    }
 
     // start workers
+    p.wg.Add(workers)
     for i := 0; i < workers; i++ {
-        go func() {
-            for job := range p.jobs {
-                data, err := b.Infer(job.ctx, job.payload)
-                // try to deliver result, but respect job ctx
-                select {
-                case job.resp <- InferResult{Data: data, Err: err}:
-                case <-job.ctx.Done():
-                    job.resp <- InferResult{Data: nil, Err: job.ctx.Err()}
-                }
-            }
-        }()
+        go p.worker(b)
     }
+    go func() {
+        p.wg.Wait()
+        if c, ok := b.(io.Closer); ok {
+            p.closeErr = c.Close()
+        }
+        abort()
+        close(p.stopped)
+    }()
     return p
 }
 
+func (p *PooledBackend) worker(b Backend) {
+    defer p.wg.Done()
+    for {
+        it, ok := p.sched.pop()
+        if !ok {
+            return
+        }
+        p.run(b, it.job)
+    }
+}
+
+func (p *PooledBackend) run(b Backend, job pooledJob) {
+    p.busy.Add(1)
+    defer p.busy.Add(-1)
+
+    // in-flight jobs are cancelled when Close gives up draining
+    ctx, cancel := context.WithCancel(job.ctx)
+    defer cancel()
+    stop := context.AfterFunc(p.abortCtx, cancel)
+    defer stop()
+
+    data, err := b.Infer(ctx, job.payload)
+    if err != nil {
+        p.failed.Add(1)
+    } else {
+        p.completed.Add(1)
+    }
+    // resp is buffered so delivery never blocks the worker
+    job.resp <- InferResult{Data: data, Err: err}
+}
+
 // Infer submits the payload to the worker pool and blocks until a result is available
-// or the provided context is cancelled.
+// or the provided context is cancelled. It returns ErrClosed once Close has been called.
+// The job is scheduled with the priority and tenant attached to ctx, if any.
 func (p *PooledBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
-    resp := make(chan InferResult, 1)
-    job := pooledJob{ctx: ctx, payload: payload, resp: resp}
+    return p.InferPriority(ctx, PriorityFromContext(ctx), payload)
+}
 
+// InferPriority is Infer with an explicit priority class.
+func (p *PooledBackend) InferPriority(ctx context.Context, prio Priority, payload []byte) ([]byte, error) {
     select {
-    case p.jobs <- job:
-        // submitted
-    case <-ctx.Done():
-        return nil, ctx.Err()
+    case <-p.done:
+        return nil, ErrClosed
+    default:
+    }
+    if prio < PriorityBulk || prio > PriorityInteractive {
+        prio = PriorityNormal
+    }
+
+    resp := make(chan InferResult, 1)
+    it := &queueItem{
+        job:      pooledJob{ctx: ctx, payload: payload, resp: resp},
+        priority: prio,
+        tenant:   TenantFromContext(ctx),
+    }
+    if !p.sched.push(it) {
+        return nil, ErrClosed
     }
 
     select {
     case r := <-resp:
         return r.Data, r.Err
     case <-ctx.Done():
+        // if a worker already picked the job it sees the cancelled ctx itself
+        p.sched.remove(it)
         return nil, ctx.Err()
     }
 }
 
-// Close shuts down the worker pool by closing the jobs channel. After Close,
-// further Infer calls will panic; create a new pooled backend instead.
-func (p *PooledBackend) Close() {
-    close(p.jobs)
+// Stats returns a snapshot of the pool's workers, queue and job counters.
+func (p *PooledBackend) Stats() PoolStats {
+    byPrio := p.sched.lenByPriority()
+    st := PoolStats{
+        Workers:          p.workers,
+        Busy:             int(p.busy.Load()),
+        QueuedByPriority: make(map[Priority]int, len(byPrio)),
+        Completed:        p.completed.Load(),
+        Failed:           p.failed.Load(),
+    }
+    for prio, n := range byPrio {
+        st.QueuedByPriority[Priority(prio)] = n
+        st.Queued += n
+    }
+    return st
+}
+
+// Close stops accepting new work, fails queued jobs with ErrClosed and waits
+// for in-flight jobs to drain. If ctx expires first, in-flight jobs are
+// cancelled and ctx.Err() is returned once the workers have exited. The
+// wrapped backend is closed if it implements io.Closer. Close is safe to
+// call more than once; subsequent Infer calls return ErrClosed.
+func (p *PooledBackend) Close(ctx context.Context) error {
+    p.closeOnce.Do(func() {
+        close(p.done)
+        for _, it := range p.sched.close() {
+            it.job.resp <- InferResult{Err: ErrClosed}
+        }
+    })
+
+    select {
+    case <-p.stopped:
+        return p.closeErr
+    case <-ctx.Done():
+        p.abort()
+        <-p.stopped
+        return ctx.Err()
+    }
 }
@@ -0,0 +1,74 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type closingBackend struct {
+	funcBackend
+	closed chan struct{}
+}
+
+func (c *closingBackend) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestPooledBackendCloseDrains(t *testing.T) {
+	started := make(chan struct{})
+	b := &closingBackend{
+		funcBackend: func(ctx context.Context, payload []byte) ([]byte, error) {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			return payload, nil
+		},
+		closed: make(chan struct{}),
+	}
+	p := NewPooledBackend(b, 2)
+
+	res := InferAsync(context.Background(), p, []byte("frame"))
+	<-started
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-res; r.Err != nil || string(r.Data) != "frame" {
+		t.Fatalf("in-flight job not drained: %+v", r)
+	}
+	select {
+	case <-b.closed:
+	default:
+		t.Fatal("wrapped backend was not closed")
+	}
+	if _, err := p.Infer(context.Background(), nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("want ErrClosed, got %v", err)
+	}
+	if s := p.Stats(); s.Workers != 2 || s.Completed != 1 || s.Busy != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestPooledBackendCloseCancelsOnTimeout(t *testing.T) {
+	started := make(chan struct{})
+	p := NewPooledBackend(funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), 1)
+
+	res := InferAsync(context.Background(), p, nil)
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+	if r := <-res; !errors.Is(r.Err, context.Canceled) {
+		t.Fatalf("in-flight job not cancelled: %v", r.Err)
+	}
+	if s := p.Stats(); s.Failed != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
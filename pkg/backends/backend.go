@@ -3,11 +3,22 @@ package backends
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
 	"github.com/unrealandychan/rembg-go/pkg/processing"
+	"github.com/unrealandychan/rembg-go/pkg/tensor"
+	"github.com/unrealandychan/rembg-go/pkg/tracing"
+	"github.com/unrealandychan/rembg-go/pkg/utils"
 )
 
 // Backend is a generic inference backend used by the processing pipeline.
@@ -16,17 +27,92 @@ type Backend interface {
 	Infer(ctx context.Context, payload []byte) ([]byte, error)
 }
 
-// SageMakerBackend wraps a SageMaker endpoint.
-type SageMakerBackend struct {
-	Endpoint string
+// TritonOptions configures how the Triton backends reach the server.
+type TritonOptions struct {
+	// TLS, when set, connects over https or TLS gRPC (mutual TLS with a
+	// client certificate); nil connects in plaintext.
+	TLS *TLSOptions
+	// Headers are sent as HTTP headers or gRPC metadata with every request,
+	// and BearerToken as "Authorization: Bearer". Both may reference
+	// environment variables as $VAR or ${VAR}.
+	Headers     map[string]string
+	BearerToken string
+	// Client sends HTTP requests. When nil, a client is built from HTTP and
+	// TLS; gRPC ignores both.
+	Client *http.Client
+	HTTP   HTTPClientOptions
+	// SharedMemory, when set, passes the input and output tensors through
+	// POSIX shared memory; the server must run on the same host.
+	SharedMemory *SharedMemoryOptions
+	// Preprocess, when set, decodes each payload as an image and sends it
+	// as the [1,3,H,W] tensor of the backend's Shape and DType instead of
+	// the raw bytes.
+	Preprocess *PreprocessOptions
+}
+
+// PreprocessOptions configures client-side preprocessing. Mean and Std
+// normalise RGB values in [0,1] for floating-point inputs; the zero value
+// keeps them in [0,1], as local sessions do. Integer inputs receive raw
+// pixel values (see utils.NormalizeToTensor).
+type PreprocessOptions struct {
+	Mean, Std [3]float32
+}
+
+// tensor returns the contents of a [1,3,H,W] tensor of dtype for the
+// encoded image payload.
+func (o *PreprocessOptions) tensor(dtype string, shape []int, payload []byte) ([]byte, error) {
+	if len(shape) != 4 || shape[0] != 1 || shape[1] != 3 {
+		return nil, fmt.Errorf("preprocess needs a [1,3,H,W] input, got %v", shape)
+	}
+	img, _, err := image.Decode(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("preprocess: decode image: %w", err)
+	}
+	std := o.Std
+	if std == ([3]float32{}) {
+		std = [3]float32{1, 1, 1}
+	}
+	return utils.NormalizeToTensor(img, shape[3], shape[2], o.Mean, std, dtype)
 }
 
-func NewSageMakerBackend(endpoint string) *SageMakerBackend {
-	return &SageMakerBackend{Endpoint: endpoint}
+// httpClient returns o.Client, or the client for the TLS and HTTP options.
+// Clients are built once per distinct options and shared, so requests keep
+// their connections alive and certificates are read once.
+func (o TritonOptions) httpClient() (*http.Client, error) {
+	if o.Client != nil {
+		return o.Client, nil
+	}
+	if o.TLS == nil && o.HTTP == (HTTPClientOptions{}) {
+		return http.DefaultClient, nil
+	}
+	opts := o.HTTP
+	if opts.TLS == nil {
+		opts.TLS = o.TLS
+	}
+	key := httpClientKey{http: opts}
+	if opts.TLS != nil {
+		key.http.TLS, key.tls, key.hasTLS = nil, *opts.TLS, true
+	}
+	if c, ok := httpClients.Load(key); ok {
+		return c.(*http.Client), nil
+	}
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := httpClients.LoadOrStore(key, client)
+	return c.(*http.Client), nil
 }
 
-func (s *SageMakerBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
-	return InvokeSageMaker(ctx, s.Endpoint, payload)
+// httpClients maps an httpClientKey to the *http.Client built for it.
+var httpClients sync.Map
+
+// httpClientKey identifies HTTPClientOptions by the value of their TLS
+// options rather than the pointer.
+type httpClientKey struct {
+	http   HTTPClientOptions
+	tls    TLSOptions
+	hasTLS bool
 }
 
 // TritonHTTPBackend wraps the Triton HTTP v2 infer endpoint.
@@ -36,23 +122,84 @@ type TritonHTTPBackend struct {
 	InputName string
 	Shape     []int
 	DType     string
+	// Decoder, when set, turns the raw output tensor into PNG mask bytes
+	// (e.g. FloatTensorDecoder for a float32 mask).
+	Decoder MaskDecoder
+	Options TritonOptions
+
+	mu  sync.Mutex
+	shm *shmPool
 }
 
 func NewTritonHTTPBackend(addr, model, inputName string, shape []int, dtype string) *TritonHTTPBackend {
 	return &TritonHTTPBackend{Addr: addr, Model: model, InputName: inputName, Shape: shape, DType: dtype}
 }
 
+// NewTritonHTTPBackendWithOptions returns a backend using opts for TLS,
+// authentication and the HTTP client, which is built once and shared.
+func NewTritonHTTPBackendWithOptions(addr, model, inputName string, shape []int, dtype string, opts TritonOptions) (*TritonHTTPBackend, error) {
+	client, err := opts.httpClient()
+	if err != nil {
+		return nil, fmt.Errorf("triton http: %w", err)
+	}
+	opts.Client = client
+	b := NewTritonHTTPBackend(addr, model, inputName, shape, dtype)
+	b.Options = opts
+	return b, nil
+}
+
 func (t *TritonHTTPBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
-	return InferTritonHTTP(ctx, t.Addr, t.Model, t.InputName, payload, t.Shape, t.DType)
+	data, shape, err := tritonInput(t.DType, t.Shape, t.Options.Preprocess, payload)
+	if err != nil {
+		return nil, fmt.Errorf("triton http: input %q: %w", t.InputName, err)
+	}
+	var out []byte
+	if t.Options.SharedMemory != nil {
+		out, err = t.inferSharedMemory(ctx, data, shape)
+	} else {
+		out, err = InferTritonHTTPWithOptions(ctx, t.Addr, t.Model, t.InputName, data, shape, t.DType, t.Options)
+	}
+	if err != nil || t.Decoder == nil {
+		return out, err
+	}
+	return t.Decoder.DecodeMask(out, "")
+}
+
+// Close unregisters and removes the shared-memory regions, if any.
+func (t *TritonHTTPBackend) Close() error {
+	t.mu.Lock()
+	shm := t.shm
+	t.shm = nil
+	t.mu.Unlock()
+	if shm == nil {
+		return nil
+	}
+	return shm.Close()
 }
 
-// TritonGRPCBackend wraps a Triton gRPC connection. It uses the triton_grpc helper stub.
+// TritonGRPCBackend wraps a Triton gRPC connection, dialed on first use and
+// shared by all calls until Close.
 type TritonGRPCBackend struct {
 	Addr      string
 	Model     string
 	InputName string
 	Shape     []int
 	DType     string
+	// Decoder, when set, turns the raw output tensor into PNG mask bytes.
+	Decoder MaskDecoder
+	// Options configures TLS and the metadata sent with each call.
+	Options TritonOptions
+	// Streaming pipelines concurrent Infer calls over one ModelStreamInfer
+	// stream, matching responses to requests by ID. Servers without
+	// streaming are detected and served with unary ModelInfer calls.
+	Streaming bool
+
+	mu         sync.Mutex
+	conn       *grpc.ClientConn
+	stream     *tritonStream
+	noStream   bool
+	shm        *shmPool
+	requestIDs atomic.Uint64
 }
 
 func NewTritonGRPCBackend(addr, model, inputName string, shape []int, dtype string) *TritonGRPCBackend {
@@ -60,61 +207,149 @@ func NewTritonGRPCBackend(addr, model, inputName string, shape []int, dtype stri
 }
 
 func (t *TritonGRPCBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
-	conn, err := NewTritonGRPCConn(t.Addr)
+	data, shape, err := tritonInput(t.DType, t.Shape, t.Options.Preprocess, payload)
+	if err != nil {
+		return nil, fmt.Errorf("triton grpc: input %q: %w", t.InputName, err)
+	}
+	conn, err := t.connect()
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-	return InferTritonGRPCStub(ctx, conn, t.Model, t.InputName, payload, t.Shape, t.DType)
+	var out []byte
+	if t.Options.SharedMemory != nil {
+		out, err = t.inferSharedMemory(ctx, conn, data, shape)
+	} else {
+		var resp *modelInferResponse
+		if resp, err = t.infer(ctx, conn, newModelInferRequest(t.Model, t.InputName, data, shape, t.DType)); err == nil {
+			out, err = resp.firstOutput()
+		}
+	}
+	if err != nil || t.Decoder == nil {
+		return out, err
+	}
+	return t.Decoder.DecodeMask(out, "")
+}
+
+// tritonInput returns the tensor contents and shape sent for payload. A BYTES
+// input carries the payload, e.g. an encoded image for an ensemble that
+// decodes it on the server, as one length-prefixed element with shape [1]
+// unless shape is set. With pre set, other payloads are decoded as images
+// and preprocessed into the tensor; otherwise they are sent as is. Either
+// way the result must match shape and dtype.
+func tritonInput(dtype string, shape []int, pre *PreprocessOptions, payload []byte) ([]byte, []int, error) {
+	if pre != nil && dtype != "BYTES" {
+		var err error
+		if payload, err = pre.tensor(dtype, shape, payload); err != nil {
+			return nil, nil, err
+		}
+	}
+	if dtype == "BYTES" {
+		if len(shape) == 0 {
+			shape = []int{1}
+		}
+		payload = tensor.EncodeBytes(payload)
+	}
+	if err := tensor.Check(dtype, IntsToInt64s(shape), payload); err != nil {
+		return nil, nil, err
+	}
+	return payload, shape, nil
+}
+
+// infer sends req over the stream when streaming, or as a unary call.
+func (t *TritonGRPCBackend) infer(ctx context.Context, conn *grpc.ClientConn, req *modelInferRequest) (*modelInferResponse, error) {
+	if t.Streaming {
+		resp, err := t.inferStream(ctx, conn, req)
+		if !errors.Is(err, errStreamUnavailable) {
+			return resp, err
+		}
+	}
+	return inferTritonGRPC(ctx, conn, req)
+}
+
+// Close ends the stream, releases the shared-memory regions and closes the
+// connection.
+func (t *TritonGRPCBackend) Close() error {
+	// detach the resources under the lock but release them after, as
+	// unregistering the regions and closing the stream talk to the server
+	t.mu.Lock()
+	shm, stream, conn := t.shm, t.stream, t.conn
+	t.shm, t.stream, t.conn = nil, nil, nil
+	t.mu.Unlock()
+	var errs []error
+	if shm != nil {
+		errs = append(errs, shm.Close())
+	}
+	if stream != nil {
+		stream.close()
+	}
+	if conn != nil {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (t *TritonGRPCBackend) connect() (*grpc.ClientConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		conn, err := NewTritonGRPCConnWithOptions(t.Addr, t.Options)
+		if err != nil {
+			return nil, err
+		}
+		t.conn = conn
+	}
+	return t.conn, nil
 }
 
 // RemoveBackgroundWithBackend runs inference using the given backend and applies mask post-processing.
-func RemoveBackgroundWithBackend(ctx context.Context, backend Backend, imgBytes []byte, opts processing.RemoveBackgroundOptions) (interface{}, error) {
+func RemoveBackgroundWithBackend(ctx context.Context, backend Backend, imgBytes []byte, opts processing.RemoveBackgroundOptions) (result interface{}, err error) {
+	ctx, span := tracing.StartStage(ctx, "remove_background",
+		tracing.AttrBackend.String(fmt.Sprintf("%T", backend)),
+		tracing.AttrModel.String(opts.ModelPath),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	stageStart := time.Now()
+	_, decodeSpan := tracing.StartStage(ctx, "decode")
 	img, _, err := image.Decode(bytes.NewReader(imgBytes))
+	tracing.End(decodeSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("decode image: %w", err)
 	}
-	maskBytes, err := backend.Infer(ctx, imgBytes)
+	metrics.ObserveStage("decode", stageStart)
+	span.SetAttributes(tracing.AttrImageWidth.Int(img.Bounds().Dx()), tracing.AttrImageHeight.Int(img.Bounds().Dy()))
+
+	stageStart = time.Now()
+	inferCtx, inferSpan := tracing.StartStage(ctx, "infer")
+	maskBytes, err := backend.Infer(inferCtx, imgBytes)
+	tracing.End(inferSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("backend infer: %w", err)
 	}
+	metrics.ObserveStage("infer", stageStart)
+
+	stageStart = time.Now()
+	_, maskSpan := tracing.StartStage(ctx, "mask_decode")
 	maskImg, err := png.Decode(bytes.NewReader(maskBytes))
+	tracing.End(maskSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("decode mask: %w", err)
 	}
-	var cutout image.Image
-	if opts.OnlyMask {
-		cutout = maskImg
-	} else if opts.AlphaMatting {
-		am, err := processing.AlphaMattingCutoutGo(img, maskImg, opts.AlphaMattingForegroundThreshold, opts.AlphaMattingBackgroundThreshold, opts.AlphaMattingErodeSize)
-		if err != nil {
-			if opts.PutAlpha {
-				cutout = processing.PutAlphaCutoutGo(img, maskImg)
-			} else {
-				cutout = processing.NaiveCutoutGo(img, maskImg)
-			}
-		} else {
-			cutout = am
-		}
-	} else {
-		if opts.PutAlpha {
-			cutout = processing.PutAlphaCutoutGo(img, maskImg)
-		} else {
-			cutout = processing.NaiveCutoutGo(img, maskImg)
-		}
-	}
-	if opts.BackgroundColor != nil && !opts.OnlyMask {
-		cutout = processing.ApplyBackgroundColorGo(cutout, opts.BackgroundColor)
-	}
+	cutout := processing.Composite(ctx, img, maskImg, opts)
+	metrics.ObserveStage("postprocess", stageStart)
 	switch opts.ReturnType {
 	case "image":
 		return cutout, nil
 	case "bytes":
+		stageStart = time.Now()
+		_, encodeSpan := tracing.StartStage(ctx, "encode")
 		buf := new(bytes.Buffer)
 		err := png.Encode(buf, cutout)
+		tracing.End(encodeSpan, err)
 		if err != nil {
 			return nil, fmt.Errorf("png encode error: %w", err)
 		}
+		metrics.ObserveStage("encode", stageStart)
 		return buf.Bytes(), nil
 	default:
 		return cutout, nil
@@ -0,0 +1,246 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/unrealandychan/rembg-go/pkg/tensor"
+)
+
+// MaskDecoder converts a backend response body into PNG mask bytes, the
+// format RemoveBackgroundWithBackend and the CLI expect from Backend.Infer.
+type MaskDecoder interface {
+	DecodeMask(body []byte, contentType string) ([]byte, error)
+}
+
+// MaskDecoderFunc adapts a function to MaskDecoder.
+type MaskDecoderFunc func(body []byte, contentType string) ([]byte, error)
+
+func (f MaskDecoderFunc) DecodeMask(body []byte, contentType string) ([]byte, error) {
+	return f(body, contentType)
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// PNGMaskDecoder accepts an encoded image mask. PNG bodies are returned as is;
+// other image formats (e.g. JPEG) are decoded and re-encoded as PNG.
+type PNGMaskDecoder struct{}
+
+func (PNGMaskDecoder) DecodeMask(body []byte, contentType string) ([]byte, error) {
+	if bytes.HasPrefix(body, pngSignature) {
+		return body, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("decode mask image (content type %q): %w", contentType, err)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("encode mask png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// AlphaMaskDecoder turns a cutout into a mask by taking its alpha channel,
+// for services that return the image with the background removed (such as
+// the Python rembg server) rather than the mask itself.
+type AlphaMaskDecoder struct{}
+
+func (AlphaMaskDecoder) DecodeMask(body []byte, contentType string) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("decode cutout image (content type %q): %w", contentType, err)
+	}
+	b := img.Bounds()
+	mask := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			mask.Pix[(y-b.Min.Y)*mask.Stride+x-b.Min.X] = uint8(a >> 8)
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, mask); err != nil {
+		return nil, fmt.Errorf("encode mask png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// JSONMaskDecoder extracts a base64-encoded image mask from a JSON response.
+// Path is a dot-separated path to the field, with numeric segments indexing
+// arrays (e.g. "predictions.0.mask"); it defaults to "mask". Data URLs such
+// as "data:image/png;base64,..." are accepted.
+type JSONMaskDecoder struct {
+	Path string
+}
+
+func (d JSONMaskDecoder) DecodeMask(body []byte, contentType string) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("decode json response: %w", err)
+	}
+	path := d.Path
+	if path == "" {
+		path = "mask"
+	}
+	v, err := lookupJSONPath(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("json path %q: expected base64 string, got %T", path, v)
+	}
+	if i := strings.Index(s, ";base64,"); strings.HasPrefix(s, "data:") && i >= 0 {
+		s = s[i+len(";base64,"):]
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("json path %q: decode base64: %w", path, err)
+	}
+	return PNGMaskDecoder{}.DecodeMask(raw, "")
+}
+
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	cur := doc
+	for _, seg := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[seg]
+			if !ok {
+				return nil, fmt.Errorf("json path %q: missing field %q", path, seg)
+			}
+			cur = v
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("json path %q: invalid index %q", path, seg)
+			}
+			cur = node[i]
+		default:
+			return nil, fmt.Errorf("json path %q: cannot descend into %T at %q", path, cur, seg)
+		}
+	}
+	return cur, nil
+}
+
+// FloatTensorDecoder decodes a raw little-endian tensor whose last
+// Height*Width values are the mask (e.g. a [1,1,H,W] U2Net output). Datatype
+// is any numeric Triton datatype, "FP32" by default, so FP16, BF16 and
+// quantized UINT8/INT8 masks decode too. Values are min-max normalised to
+// 0..255. A zero Width/Height assumes a square mask.
+type FloatTensorDecoder struct {
+	Width    int
+	Height   int
+	Datatype string
+}
+
+func (d FloatTensorDecoder) DecodeMask(body []byte, contentType string) ([]byte, error) {
+	datatype := d.Datatype
+	if datatype == "" {
+		datatype = "FP32"
+	}
+	data, err := tensor.Decode[float32](datatype, body)
+	if err != nil {
+		return nil, fmt.Errorf("float tensor: %w", err)
+	}
+	w, h := d.Width, d.Height
+	if w == 0 || h == 0 {
+		side := int(math.Sqrt(float64(len(data))))
+		if side*side != len(data) {
+			return nil, fmt.Errorf("float tensor: %d values is not a square mask; set Width and Height", len(data))
+		}
+		w, h = side, side
+	}
+	if len(data) < w*h {
+		return nil, fmt.Errorf("float tensor: %d values, need %dx%d", len(data), w, h)
+	}
+	return FloatMaskToPNG(data[len(data)-w*h:], w, h)
+}
+
+// BytesTensorDecoder decodes a BYTES tensor whose first element is an encoded
+// image mask, as returned by models that encode their output on the server.
+type BytesTensorDecoder struct{}
+
+func (BytesTensorDecoder) DecodeMask(body []byte, contentType string) ([]byte, error) {
+	elems, err := tensor.DecodeBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("BYTES tensor: no elements")
+	}
+	return PNGMaskDecoder{}.DecodeMask(elems[0], contentType)
+}
+
+// FloatMaskToPNG min-max normalises an HxW float mask and encodes it as a grayscale PNG.
+func FloatMaskToPNG(data []float32, width, height int) ([]byte, error) {
+	if len(data) != width*height || len(data) == 0 {
+		return nil, fmt.Errorf("mask has %d values, want %dx%d", len(data), width, height)
+	}
+	minVal, maxVal := data[0], data[0]
+	for _, v := range data {
+		if v < minVal {
+			minVal = v
+		}
+		if v > maxVal {
+			maxVal = v
+		}
+	}
+	scale := float32(0)
+	if maxVal > minVal {
+		scale = 255 / (maxVal - minVal)
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i, v := range data {
+		img.Pix[i] = uint8((v - minVal) * scale)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("encode mask png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseMaskDecoder builds a MaskDecoder from a short spec, as used by the CLI:
+//
+//	png                 encoded image mask (default)
+//	alpha               alpha channel of an encoded cutout, see AlphaMaskDecoder
+//	json[:path]         base64 mask inside a JSON body, see JSONMaskDecoder
+//	bytes               encoded image mask in a BYTES tensor, see BytesTensorDecoder
+//	float32[:WxH]       raw little-endian float32 tensor, see FloatTensorDecoder
+//	<dtype>[:WxH]       raw tensor of another datatype, e.g. fp16, bf16, uint8
+func ParseMaskDecoder(spec string) (MaskDecoder, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	switch name {
+	case "", "png", "image":
+		return PNGMaskDecoder{}, nil
+	case "alpha":
+		return AlphaMaskDecoder{}, nil
+	case "json":
+		return JSONMaskDecoder{Path: arg}, nil
+	case "bytes":
+		return BytesTensorDecoder{}, nil
+	}
+	d := FloatTensorDecoder{}
+	if datatype := strings.ToUpper(name); datatype != "FLOAT32" && datatype != "FP32" {
+		if _, err := tensor.ElementSize(datatype); err != nil {
+			return nil, fmt.Errorf("unknown mask decoder %q; choose png, alpha, json[:path], bytes or float32[:WxH]", spec)
+		}
+		d.Datatype = datatype
+	}
+	if arg != "" {
+		if _, err := fmt.Sscanf(arg, "%dx%d", &d.Width, &d.Height); err != nil {
+			return nil, fmt.Errorf("mask decoder %q: size must be WxH", spec)
+		}
+	}
+	return d, nil
+}
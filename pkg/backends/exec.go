@@ -0,0 +1,358 @@
+package backends
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Frame status bytes of the ExecBackend protocol.
+const (
+	ExecStatusOK    byte = 0
+	ExecStatusError byte = 1
+)
+
+// ExecOptions configures ExecBackend.
+type ExecOptions struct {
+	// Command and Args start one child process; Env and Dir are passed to
+	// exec.Cmd (nil Env inherits the parent's environment).
+	Command string
+	Args    []string
+	Env     []string
+	Dir     string
+	// Workers is the number of child processes serving requests (default 1).
+	Workers int
+	// RestartBackoff is the delay before restarting a crashed child (default
+	// 100ms); it doubles on consecutive crashes up to MaxRestartBackoff (default 10s).
+	RestartBackoff    time.Duration
+	MaxRestartBackoff time.Duration
+	// MaxFrameSize bounds a response frame (default 256 MiB).
+	MaxFrameSize int
+	// Stderr receives the children's standard error (default os.Stderr).
+	Stderr io.Writer
+}
+
+// ExecBackend runs inference in long-lived child processes, e.g. Python
+// research models, exchanging length-prefixed frames over their stdin and
+// stdout. Each frame is a 4-byte big-endian length followed by that many
+// bytes:
+//
+//	request:  len | payload
+//	response: len | status | body    (status 0: body is the mask, 1: an error message)
+//
+// A child serves one request at a time. Children that exit or break the
+// protocol are restarted with backoff; a request cancelled through its
+// context kills its child so the stream stays in sync. ServeExec implements
+// the child side in Go.
+type ExecBackend struct {
+	Options ExecOptions
+
+	jobs     chan execJob
+	done     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+	restarts atomic.Int64
+}
+
+type execJob struct {
+	ctx     context.Context
+	payload []byte
+	resp    chan InferResult
+}
+
+// NewExecBackend starts opts.Workers children and returns a backend serving
+// requests with them. It fails if the first child cannot be started.
+func NewExecBackend(opts ExecOptions) (*ExecBackend, error) {
+	if opts.Command == "" {
+		return nil, fmt.Errorf("exec backend: command required")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.RestartBackoff <= 0 {
+		opts.RestartBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxRestartBackoff <= 0 {
+		opts.MaxRestartBackoff = 10 * time.Second
+	}
+	if opts.MaxFrameSize <= 0 {
+		opts.MaxFrameSize = 256 << 20
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	e := &ExecBackend{Options: opts, jobs: make(chan execJob), done: make(chan struct{})}
+
+	children := make([]*execChild, opts.Workers)
+	for i := range children {
+		children[i] = &execChild{opts: &e.Options}
+		if err := children[i].start(); err != nil {
+			for _, c := range children[:i] {
+				c.stop()
+			}
+			return nil, fmt.Errorf("exec backend: %w", err)
+		}
+	}
+	for _, c := range children {
+		e.wg.Add(1)
+		go e.supervise(c)
+	}
+	return e, nil
+}
+
+// Restarts returns how many times a child has been restarted after a crash.
+func (e *ExecBackend) Restarts() int64 {
+	return e.restarts.Load()
+}
+
+func (e *ExecBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	job := execJob{ctx: ctx, payload: payload, resp: make(chan InferResult, 1)}
+	select {
+	case e.jobs <- job:
+	case <-e.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	r := <-job.resp
+	return r.Data, r.Err
+}
+
+// Close stops accepting requests, waits for running ones and shuts the
+// children down by closing their stdin.
+func (e *ExecBackend) Close() error {
+	e.once.Do(func() { close(e.done) })
+	e.wg.Wait()
+	return nil
+}
+
+// supervise serves jobs with one child, restarting it when it dies.
+func (e *ExecBackend) supervise(c *execChild) {
+	defer e.wg.Done()
+	defer c.stop()
+	backoff := e.Options.RestartBackoff
+	for {
+		if !c.running() {
+			select {
+			case <-time.After(backoff):
+			case <-e.done:
+				return
+			}
+			if backoff *= 2; backoff > e.Options.MaxRestartBackoff {
+				backoff = e.Options.MaxRestartBackoff
+			}
+			e.restarts.Add(1)
+			if err := c.start(); err != nil {
+				fmt.Fprintln(e.Options.Stderr, "exec backend: restart failed:", err)
+				continue
+			}
+		}
+
+		var job execJob
+		select {
+		case job = <-e.jobs:
+		case <-e.done:
+			return
+		}
+		data, err := c.roundTrip(job.ctx, job.payload)
+		if c.running() {
+			backoff = e.Options.RestartBackoff
+		}
+		job.resp <- InferResult{Data: data, Err: err}
+	}
+}
+
+// execChild is one child process and its framed pipes.
+type execChild struct {
+	opts   *ExecOptions
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// out is the read end of stdout. It is an os.Pipe rather than
+	// cmd.StdoutPipe, which Wait closes, possibly before the last frame has
+	// been read, so it stays open until the child is stopped or replaced.
+	out    *os.File
+	exited chan struct{}
+}
+
+func (c *execChild) start() error {
+	cmd := exec.Command(c.opts.Command, c.opts.Args...)
+	cmd.Env = c.opts.Env
+	cmd.Dir = c.opts.Dir
+	cmd.Stderr = c.opts.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = w
+	err = cmd.Start()
+	// the child has its own copy of the write end
+	w.Close()
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("start %s: %w", c.opts.Command, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	c.closeStdout()
+	c.cmd, c.stdin, c.stdout, c.out, c.exited = cmd, stdin, bufio.NewReader(out), out, exited
+	return nil
+}
+
+// closeStdout closes the read end of the current child's stdout.
+func (c *execChild) closeStdout() {
+	if c.out != nil {
+		c.out.Close()
+		c.out = nil
+	}
+}
+
+func (c *execChild) running() bool {
+	if c.cmd == nil {
+		return false
+	}
+	select {
+	case <-c.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop closes stdin so the child can exit on EOF, killing it if it has not
+// exited after a grace period.
+func (c *execChild) stop() {
+	if c.cmd == nil {
+		return
+	}
+	c.stdin.Close()
+	select {
+	case <-c.exited:
+	case <-time.After(2 * time.Second):
+		c.cmd.Process.Kill()
+		<-c.exited
+	}
+	c.closeStdout()
+	c.cmd = nil
+}
+
+// kill terminates the child immediately; supervise restarts it.
+func (c *execChild) kill() {
+	c.cmd.Process.Kill()
+	<-c.exited
+	c.closeStdout()
+	c.cmd = nil
+}
+
+func (c *execChild) roundTrip(ctx context.Context, payload []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		status byte
+		body   []byte
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		if err := writeFrame(c.stdin, payload); err != nil {
+			ch <- result{err: err}
+			return
+		}
+		frame, err := readFrame(c.stdout, c.opts.MaxFrameSize)
+		if err == nil && len(frame) == 0 {
+			err = errors.New("empty response frame")
+		}
+		if err != nil {
+			ch <- result{err: err}
+			return
+		}
+		ch <- result{status: frame[0], body: frame[1:]}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			// the stream is out of sync or the child died: start over
+			c.kill()
+			return nil, fmt.Errorf("exec backend: child failed: %w", r.err)
+		}
+		if r.status != ExecStatusOK {
+			return nil, fmt.Errorf("exec backend: %s", r.body)
+		}
+		return r.body, nil
+	case <-ctx.Done():
+		c.kill()
+		<-ch
+		return nil, ctx.Err()
+	}
+}
+
+func writeFrame(w io.Writer, payload []byte) error {
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if int64(n) > int64(maxSize) {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the %d byte limit", n, maxSize)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// ServeExec implements the child side of the ExecBackend protocol: it reads
+// request frames from r, calls fn and writes response frames to w until r
+// reaches EOF. Errors returned by fn are sent back as error responses.
+func ServeExec(r io.Reader, w io.Writer, fn func(payload []byte) ([]byte, error)) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	for {
+		payload, err := readFrame(br, 1<<31-1)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		status := ExecStatusOK
+		body, err := fn(payload)
+		if err != nil {
+			status, body = ExecStatusError, []byte(err.Error())
+		}
+		if err := writeFrame(bw, append([]byte{status}, body...)); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain turns the test binary into an ExecBackend child when
+// REMBG_EXEC_HELPER is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("REMBG_EXEC_HELPER") == "1" {
+		err := ServeExec(os.Stdin, os.Stdout, func(payload []byte) ([]byte, error) {
+			switch string(payload) {
+			case "crash":
+				os.Exit(2)
+			case "error":
+				return nil, errors.New("bad input")
+			case "sleep":
+				time.Sleep(time.Minute)
+			case "last":
+				// answer, then exit before the parent reads the response
+				writeFrame(os.Stdout, append([]byte{ExecStatusOK}, "LAST"...))
+				os.Exit(0)
+			case "pid":
+				return []byte(fmt.Sprint(os.Getpid())), nil
+			}
+			return bytes.ToUpper(payload), nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestExecBackend(t *testing.T, workers int) *ExecBackend {
+	t.Helper()
+	e, err := NewExecBackend(ExecOptions{
+		Command:        os.Args[0],
+		Env:            append(os.Environ(), "REMBG_EXEC_HELPER=1"),
+		Workers:        workers,
+		RestartBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func TestExecBackendRoundTrip(t *testing.T) {
+	e := newTestExecBackend(t, 2)
+	pids := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		got, err := e.Infer(context.Background(), []byte("mask"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "MASK" {
+			t.Fatalf("got %q", got)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		pid, err := e.Infer(context.Background(), []byte("pid"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids[string(pid)] = true
+	}
+	if len(pids) > 2 {
+		t.Fatalf("requests served by %d processes, want at most 2", len(pids))
+	}
+
+	_, err := e.Infer(context.Background(), []byte("error"))
+	if err == nil || !strings.Contains(err.Error(), "bad input") {
+		t.Fatalf("err = %v, want the child's error", err)
+	}
+	if e.Restarts() != 0 {
+		t.Fatalf("restarts = %d after an error response", e.Restarts())
+	}
+}
+
+func TestExecBackendRestartsCrashedChild(t *testing.T) {
+	e := newTestExecBackend(t, 1)
+	if _, err := e.Infer(context.Background(), []byte("crash")); err == nil {
+		t.Fatal("expected an error from a crashing child")
+	}
+	got, err := e.Infer(context.Background(), []byte("again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "AGAIN" || e.Restarts() != 1 {
+		t.Fatalf("got %q after %d restarts", got, e.Restarts())
+	}
+}
+
+func TestExecBackendReadsAfterExit(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		e := newTestExecBackend(t, 1)
+		got, err := e.Infer(context.Background(), []byte("last"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "LAST" {
+			t.Fatalf("got %q", got)
+		}
+	}
+}
+
+func TestExecBackendCancel(t *testing.T) {
+	e := newTestExecBackend(t, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := e.Infer(ctx, []byte("sleep")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if got, err := e.Infer(context.Background(), []byte("ok")); err != nil || string(got) != "OK" {
+		t.Fatalf("after cancel: %q, %v", got, err)
+	}
+
+	e.Close()
+	if _, err := e.Infer(context.Background(), []byte("ok")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v, want ErrClosed", err)
+	}
+}
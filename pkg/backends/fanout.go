@@ -0,0 +1,111 @@
+package backends
+
+import (
+	"context"
+	"iter"
+
+	"github.com/unrealandychan/rembg-go/pkg/parallel"
+)
+
+// InferMany runs b.Infer over payloads with at most concurrency calls in
+// flight and returns the responses in input order. The first error cancels
+// the remaining calls and is returned.
+func InferMany(ctx context.Context, b Backend, payloads [][]byte, concurrency int) ([][]byte, error) {
+	results, err := parallel.Map(ctx, payloads, concurrency, parallel.FailFast, inferFunc(b))
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, len(results))
+	for i, r := range results {
+		out[i] = r.Value
+	}
+	return out, nil
+}
+
+// InferManyAll is InferMany in collect-all mode: every payload is sent and
+// each result carries its own error. The returned error joins the failures.
+func InferManyAll(ctx context.Context, b Backend, payloads [][]byte, concurrency int) ([]InferResult, error) {
+	results, err := parallel.Map(ctx, payloads, concurrency, parallel.CollectAll, inferFunc(b))
+	out := make([]InferResult, len(results))
+	for i, r := range results {
+		out[i] = InferResult{Data: r.Value, Err: r.Err}
+	}
+	return out, err
+}
+
+// InferManyStream yields (index, result) pairs in input order as soon as each
+// is ready, so callers can encode early results while later ones are still in
+// flight. With failFast the stream stops after the first error; breaking out
+// of the loop cancels the outstanding calls.
+func InferManyStream(ctx context.Context, b Backend, payloads [][]byte, concurrency int, failFast bool) iter.Seq2[int, InferResult] {
+	mode := parallel.CollectAll
+	if failFast {
+		mode = parallel.FailFast
+	}
+	return func(yield func(int, InferResult) bool) {
+		for r := range parallel.Stream(ctx, payloads, concurrency, mode, inferFunc(b)) {
+			if !yield(r.Index, InferResult{Data: r.Value, Err: r.Err}) {
+				return
+			}
+		}
+	}
+}
+
+// InferPipeline sends payloads to b as they arrive, with at most window calls
+// in flight, and delivers the results in input order. It suits unbounded
+// inputs such as video frames; with a streaming TritonGRPCBackend the calls
+// are pipelined over one stream. The output channel is closed once payloads
+// is closed and drained or ctx is done; callers must read it to the end or
+// cancel ctx.
+func InferPipeline(ctx context.Context, b Backend, payloads <-chan []byte, window int) <-chan InferResult {
+	if window <= 0 {
+		window = 1
+	}
+	// the queue holds the calls not yet delivered: window-1 queued plus the
+	// one the delivering goroutine waits for
+	queue := make(chan chan InferResult, window-1)
+	out := make(chan InferResult)
+	go func() {
+		defer close(queue)
+		for {
+			var payload []byte
+			var ok bool
+			select {
+			case payload, ok = <-payloads:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			ch := make(chan InferResult, 1)
+			select {
+			case queue <- ch:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				data, err := b.Infer(ctx, payload)
+				ch <- InferResult{Data: data, Err: err}
+			}()
+		}
+	}()
+	go func() {
+		defer close(out)
+		for ch := range queue {
+			r := <-ch // Infer returns promptly once ctx is done
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func inferFunc(b Backend) func(ctx context.Context, i int, payload []byte) ([]byte, error) {
+	return func(ctx context.Context, i int, payload []byte) ([]byte, error) {
+		return b.Infer(ctx, payload)
+	}
+}
@@ -0,0 +1,209 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/unrealandychan/rembg-go/pkg/tracing"
+)
+
+// Body modes of HTTPOptions.
+const (
+	BodyRaw       = "raw"
+	BodyMultipart = "multipart"
+)
+
+// HTTPOptions configures HTTPBackend. It can be loaded from a JSON file with
+// LoadHTTPOptions so new REST services can be targeted without Go code.
+type HTTPOptions struct {
+	// URL of the service. "{name}" placeholders are replaced by the
+	// path-escaped value of Params["name"], e.g.
+	// "https://seg.internal/v1/models/{model}:predict".
+	URL    string            `json:"url"`
+	Params map[string]string `json:"params,omitempty"`
+	// Method defaults to POST.
+	Method string `json:"method,omitempty"`
+
+	// Body is BodyRaw (default) to send the image as the request body, or
+	// BodyMultipart to upload it as a form file.
+	Body string `json:"body,omitempty"`
+	// ContentType of a raw body (default "application/octet-stream").
+	ContentType string `json:"content_type,omitempty"`
+	// FileField and FileName name the multipart file part (default "file"
+	// and "image.png"); FormFields are sent as extra multipart fields.
+	FileField  string            `json:"file_field,omitempty"`
+	FileName   string            `json:"file_name,omitempty"`
+	FormFields map[string]string `json:"form_fields,omitempty"`
+
+	// Headers are added to every request. Header values and BearerToken may
+	// reference environment variables as $VAR or ${VAR} so secrets stay out
+	// of configuration files.
+	Headers     map[string]string `json:"headers,omitempty"`
+	BearerToken string            `json:"bearer_token,omitempty"`
+	BasicUser   string            `json:"basic_user,omitempty"`
+	BasicPass   string            `json:"basic_password,omitempty"`
+
+	// Response selects how the body is turned into a mask, using the
+	// ParseMaskDecoder syntax: "png" (default), "alpha", "json:path" or
+	// "float32:WxH". Decoder, when set, takes precedence.
+	Response string      `json:"response,omitempty"`
+	Decoder  MaskDecoder `json:"-"`
+
+	// Client sends the requests (default http.DefaultClient).
+	Client *http.Client `json:"-"`
+}
+
+// HTTPBackend calls an arbitrary REST segmentation service.
+type HTTPBackend struct {
+	Options HTTPOptions
+
+	url     string
+	decoder MaskDecoder
+}
+
+// NewHTTPBackend validates opts and returns a backend for the service.
+func NewHTTPBackend(opts HTTPOptions) (*HTTPBackend, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("http backend: url required")
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	switch opts.Body {
+	case "":
+		opts.Body = BodyRaw
+	case BodyRaw, BodyMultipart:
+	default:
+		return nil, fmt.Errorf("http backend: body must be %q or %q, got %q", BodyRaw, BodyMultipart, opts.Body)
+	}
+
+	pairs := make([]string, 0, 2*len(opts.Params))
+	for k, v := range opts.Params {
+		pairs = append(pairs, "{"+k+"}", url.PathEscape(v))
+	}
+	u := strings.NewReplacer(pairs...).Replace(opts.URL)
+	if i := strings.IndexByte(u, '{'); i >= 0 && strings.IndexByte(u[i:], '}') > 0 {
+		return nil, fmt.Errorf("http backend: url %q has an unset placeholder", u)
+	}
+	if _, err := url.Parse(u); err != nil {
+		return nil, fmt.Errorf("http backend: %w", err)
+	}
+
+	decoder := opts.Decoder
+	if decoder == nil {
+		var err error
+		if decoder, err = ParseMaskDecoder(opts.Response); err != nil {
+			return nil, fmt.Errorf("http backend: %w", err)
+		}
+	}
+	return &HTTPBackend{Options: opts, url: u, decoder: decoder}, nil
+}
+
+// LoadHTTPOptions reads HTTPOptions from a JSON file.
+func LoadHTTPOptions(path string) (HTTPOptions, error) {
+	var opts HTTPOptions
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return opts, fmt.Errorf("read http backend config: %w", err)
+	}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return opts, fmt.Errorf("parse http backend config %s: %w", path, err)
+	}
+	return opts, nil
+}
+
+func (h *HTTPBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	o := h.Options
+	body, contentType, err := h.requestBody(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, o.Method, h.url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	keys := make([]string, 0, len(o.Headers))
+	for k := range o.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		req.Header.Set(k, os.ExpandEnv(o.Headers[k]))
+	}
+	if o.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+os.ExpandEnv(o.BearerToken))
+	} else if o.BasicUser != "" {
+		req.SetBasicAuth(os.ExpandEnv(o.BasicUser), os.ExpandEnv(o.BasicPass))
+	}
+	tracing.InjectHTTP(ctx, req.Header)
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("http backend: %w", &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)})
+	}
+	return h.decoder.DecodeMask(respBody, resp.Header.Get("Content-Type"))
+}
+
+func (h *HTTPBackend) requestBody(payload []byte) (io.Reader, string, error) {
+	o := h.Options
+	if o.Body == BodyRaw {
+		contentType := o.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		return bytes.NewReader(payload), contentType, nil
+	}
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	keys := make([]string, 0, len(o.FormFields))
+	for k := range o.FormFields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := mw.WriteField(k, o.FormFields[k]); err != nil {
+			return nil, "", err
+		}
+	}
+	field, name := o.FileField, o.FileName
+	if field == "" {
+		field = "file"
+	}
+	if name == "" {
+		name = "image.png"
+	}
+	part, err := mw.CreateFormFile(field, name)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(payload); err != nil {
+		return nil, "", err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf, mw.FormDataContentType(), nil
+}
@@ -0,0 +1,131 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rembgServer mimics the Python rembg server's /api/remove: a multipart
+// upload answered with an RGBA cutout whose left column is opaque.
+func rembgServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/remove" || r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		img, err := png.Decode(f)
+		if err != nil || r.FormValue("ppm") != "true" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		out := image.NewNRGBA(img.Bounds())
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			out.SetNRGBA(0, y, color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+		}
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPBackendMultipartAlpha(t *testing.T) {
+	srv := rembgServer(t)
+	t.Setenv("REMBG_TOKEN", "s3cret")
+	b, err := NewHTTPBackend(HTTPOptions{
+		URL:         srv.URL + "/api/{op}",
+		Params:      map[string]string{"op": "remove"},
+		Body:        BodyMultipart,
+		FormFields:  map[string]string{"ppm": "true"},
+		BearerToken: "${REMBG_TOKEN}",
+		Response:    "alpha",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := b.Infer(context.Background(), grayPNG(t, 3, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := mask.(*image.Gray)
+	if g.GrayAt(0, 1).Y != 255 || g.GrayAt(2, 1).Y != 0 {
+		t.Fatalf("unexpected mask: %v", g.Pix)
+	}
+}
+
+func TestHTTPBackendRawJSONFromConfig(t *testing.T) {
+	mask := grayPNG(t, 2, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPut || r.Header.Get("Content-Type") != "image/png" || r.Header.Get("X-Api-Key") != "k" || !bytes.Equal(body, []byte("img")) {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"result":{"mask":"`+base64.StdEncoding.EncodeToString(mask)+`"}}`)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "service.json")
+	config := `{"url": "` + srv.URL + `/segment", "method": "PUT", "content_type": "image/png",
+		"headers": {"X-Api-Key": "k"}, "response": "json:result.mask"}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := LoadHTTPOptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewHTTPBackend(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Infer(context.Background(), []byte("img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, mask) {
+		t.Fatal("decoded mask does not match")
+	}
+}
+
+func TestHTTPBackendErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	b, err := NewHTTPBackend(HTTPOptions{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Infer(context.Background(), []byte("img")); !IsThrottle(err) {
+		t.Fatalf("want throttle error, got %v", err)
+	}
+	if _, err := NewHTTPBackend(HTTPOptions{URL: srv.URL + "/{model}"}); err == nil {
+		t.Fatal("expected error for unset placeholder")
+	}
+	if _, err := NewHTTPBackend(HTTPOptions{URL: srv.URL, Body: "form"}); err == nil {
+		t.Fatal("expected error for unknown body mode")
+	}
+}
@@ -0,0 +1,45 @@
+package backends
+
+import (
+	"context"
+	"time"
+
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
+)
+
+// InstrumentedBackend wraps a Backend and records Prometheus request counts,
+// error counts by type, latency and in-flight requests under Name.
+type InstrumentedBackend struct {
+	Backend Backend
+	Name    string
+}
+
+// NewInstrumentedBackend wraps b so every Infer call is recorded in pkg/metrics
+// with the backend label set to name.
+func NewInstrumentedBackend(b Backend, name string) *InstrumentedBackend {
+	return &InstrumentedBackend{Backend: b, Name: name}
+}
+
+func (i *InstrumentedBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	inFlight := metrics.BackendInFlight.WithLabelValues(i.Name)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	metrics.BackendRequests.WithLabelValues(i.Name).Inc()
+	start := time.Now()
+	data, err := i.Backend.Infer(ctx, payload)
+	metrics.BackendLatency.WithLabelValues(i.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.BackendErrors.WithLabelValues(i.Name, metrics.ErrorType(err)).Inc()
+	}
+	return data, err
+}
+
+// InstrumentPool exposes the queue length and busy workers of p under name.
+// Wrap p with NewInstrumentedBackend as well to get request and latency metrics.
+func InstrumentPool(p *PooledBackend, name string) error {
+	return metrics.RegisterPool(name,
+		func() float64 { return float64(p.sched.len()) },
+		func() float64 { return float64(p.busy.Load()) },
+	)
+}
@@ -0,0 +1,69 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
+)
+
+type funcBackend func(ctx context.Context, payload []byte) ([]byte, error)
+
+func (f funcBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	return f(ctx, payload)
+}
+
+// runs numbers repeated test runs (go test -count) so each can register
+// fresh metric names in the process-wide registry.
+var runs atomic.Int64
+
+func TestInstrumentedBackendCounts(t *testing.T) {
+	requests := metrics.BackendRequests.WithLabelValues("test-counts")
+	errs := metrics.BackendErrors.WithLabelValues("test-counts", "backend")
+	// the counters are process-wide, so compare against their values before
+	requestsBefore, errsBefore := testutil.ToFloat64(requests), testutil.ToFloat64(errs)
+	fail := true
+	b := NewInstrumentedBackend(funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+		if fail {
+			return nil, errors.New("boom")
+		}
+		return payload, nil
+	}), "test-counts")
+
+	if _, err := b.Infer(context.Background(), []byte("x")); err == nil {
+		t.Fatal("expected error")
+	}
+	fail = false
+	if _, err := b.Infer(context.Background(), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(requests) - requestsBefore; got != 2 {
+		t.Fatalf("requests: want 2 got %v", got)
+	}
+	if got := testutil.ToFloat64(errs) - errsBefore; got != 1 {
+		t.Fatalf("errors: want 1 got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.BackendInFlight.WithLabelValues("test-counts")); got != 0 {
+		t.Fatalf("in flight: want 0 got %v", got)
+	}
+}
+
+func TestInstrumentPoolDuplicateName(t *testing.T) {
+	p := NewPooledBackend(funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+		return payload, nil
+	}), 1)
+	defer p.Close(context.Background())
+
+	name := fmt.Sprintf("test-pool-%d", runs.Add(1))
+	if err := InstrumentPool(p, name); err != nil {
+		t.Fatal(err)
+	}
+	if err := InstrumentPool(p, name); err == nil {
+		t.Fatal("expected duplicate registration error")
+	}
+}
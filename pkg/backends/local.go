@@ -0,0 +1,64 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/processing"
+)
+
+// LocalBackend runs a local ONNX model session in process and returns PNG
+// masks, so local inference can be used wherever a Backend is expected.
+type LocalBackend struct {
+	Session *models.Session
+	// Options controls mask post-processing; OnlyMask is always set.
+	Options processing.RemoveBackgroundOptions
+}
+
+// NewLocalBackend loads the model at modelPath.
+func NewLocalBackend(modelPath string, opts processing.RemoveBackgroundOptions) (*LocalBackend, error) {
+	return NewLocalBackendWithOptions(modelPath, opts, models.SessionOptions{})
+}
+
+// NewLocalBackendWithOptions is NewLocalBackend with session tuning options.
+func NewLocalBackendWithOptions(modelPath string, opts processing.RemoveBackgroundOptions, sessionOpts models.SessionOptions) (*LocalBackend, error) {
+	session, err := models.NewSessionWithOptions(modelPath, sessionOpts)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalBackendWithSession(session, opts), nil
+}
+
+// NewLocalBackendWithSession serves an already loaded session, e.g. one
+// created from memory or the embedded model.
+func NewLocalBackendWithSession(session *models.Session, opts processing.RemoveBackgroundOptions) *LocalBackend {
+	opts.ModelPath = session.ModelPath
+	return &LocalBackend{Session: session, Options: opts}
+}
+
+func (l *LocalBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	opts := l.Options
+	opts.OnlyMask = true
+	mask, err := processing.RemoveBackgroundWithSession(ctx, l.Session, img, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, mask); err != nil {
+		return nil, fmt.Errorf("encode mask: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Close releases the session.
+func (l *LocalBackend) Close() error {
+	return l.Session.Close()
+}
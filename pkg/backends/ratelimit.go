@@ -0,0 +1,194 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IsThrottle reports whether err signals that the backend is overloaded:
+// SageMaker/AWS throttling exceptions, HTTP 429/503 responses or gRPC
+// RESOURCE_EXHAUSTED/UNAVAILABLE statuses.
+func IsThrottle(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ThrottlingException", "Throttling", "TooManyRequestsException", "ServiceUnavailable":
+			return true
+		}
+	}
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) && isThrottleStatus(statusErr.HTTPStatusCode()) {
+		return true
+	}
+	var httpErr *HTTPStatusError
+	if errors.As(err, &httpErr) && isThrottleStatus(httpErr.StatusCode) {
+		return true
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code() == codes.ResourceExhausted || s.Code() == codes.Unavailable
+	}
+	return false
+}
+
+func isThrottleStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// RateLimitedBackend limits the rate of Infer calls with a token bucket.
+// Callers wait for a token; waiting respects ctx.
+type RateLimitedBackend struct {
+	Backend Backend
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedBackend allows rps requests per second to reach b with bursts of up to burst requests.
+func NewRateLimitedBackend(b Backend, rps float64, burst int) *RateLimitedBackend {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &RateLimitedBackend{Backend: b, limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+}
+
+func (r *RateLimitedBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	if err := r.limiter.Wait(ctx); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return r.Backend.Infer(ctx, payload)
+}
+
+// ConcurrencyLimitedBackend allows at most a fixed number of Infer calls in flight.
+type ConcurrencyLimitedBackend struct {
+	Backend Backend
+	sem     chan struct{}
+}
+
+// NewConcurrencyLimitedBackend wraps b so that at most maxInFlight calls run concurrently.
+func NewConcurrencyLimitedBackend(b Backend, maxInFlight int) *ConcurrencyLimitedBackend {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	return &ConcurrencyLimitedBackend{Backend: b, sem: make(chan struct{}, maxInFlight)}
+}
+
+func (c *ConcurrencyLimitedBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.sem }()
+	return c.Backend.Infer(ctx, payload)
+}
+
+// AdaptiveOptions configures AdaptiveBackend.
+type AdaptiveOptions struct {
+	// Initial, Min and Max bound the concurrency limit.
+	Initial int
+	Min     int
+	Max     int
+	// LatencyTarget, when non-zero, treats slower responses like throttling.
+	LatencyTarget time.Duration
+	// Backoff is the multiplicative decrease applied on throttling (default 0.5).
+	Backoff float64
+}
+
+// AdaptiveBackend limits in-flight requests with an AIMD controller: the limit
+// grows by roughly one per window of successful requests and is multiplied by
+// Backoff whenever the backend throttles or exceeds the latency target.
+type AdaptiveBackend struct {
+	Backend Backend
+	opts    AdaptiveOptions
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	// wake is closed and replaced whenever a slot may have become available.
+	wake chan struct{}
+}
+
+// NewAdaptiveBackend wraps b with an adaptive concurrency limit.
+func NewAdaptiveBackend(b Backend, opts AdaptiveOptions) *AdaptiveBackend {
+	if opts.Min <= 0 {
+		opts.Min = 1
+	}
+	if opts.Max < opts.Min {
+		opts.Max = 64
+	}
+	if opts.Initial < opts.Min || opts.Initial > opts.Max {
+		opts.Initial = opts.Min
+	}
+	if opts.Backoff <= 0 || opts.Backoff >= 1 {
+		opts.Backoff = 0.5
+	}
+	return &AdaptiveBackend{
+		Backend: b,
+		opts:    opts,
+		limit:   float64(opts.Initial),
+		wake:    make(chan struct{}),
+	}
+}
+
+// Limit returns the current concurrency limit.
+func (a *AdaptiveBackend) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.limit)
+}
+
+func (a *AdaptiveBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	if err := a.acquire(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	data, err := a.Backend.Infer(ctx, payload)
+	a.release(time.Since(start), err)
+	return data, err
+}
+
+func (a *AdaptiveBackend) acquire(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+		if a.inFlight < int(a.limit) {
+			a.inFlight++
+			a.mu.Unlock()
+			return nil
+		}
+		wake := a.wake
+		a.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (a *AdaptiveBackend) release(latency time.Duration, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inFlight--
+	switch {
+	case IsThrottle(err) || (a.opts.LatencyTarget > 0 && latency > a.opts.LatencyTarget):
+		a.limit = math.Max(float64(a.opts.Min), a.limit*a.opts.Backoff)
+	case err == nil:
+		a.limit = math.Min(float64(a.opts.Max), a.limit+1/a.limit)
+	}
+	close(a.wake)
+	a.wake = make(chan struct{})
+}
@@ -0,0 +1,102 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConcurrencyLimitedBackend(t *testing.T) {
+	var cur, peak atomic.Int64
+	b := NewConcurrencyLimitedBackend(funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+		n := cur.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		cur.Add(-1)
+		return payload, nil
+	}), 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.Infer(context.Background(), nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Fatalf("max in flight exceeded: %d", peak.Load())
+	}
+}
+
+func TestConcurrencyLimitedBackendRespectsContext(t *testing.T) {
+	release := make(chan struct{})
+	b := NewConcurrencyLimitedBackend(funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+		<-release
+		return nil, nil
+	}), 1)
+	go b.Infer(context.Background(), nil)
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := b.Infer(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+}
+
+func TestAdaptiveBackendAIMD(t *testing.T) {
+	throttle := true
+	b := NewAdaptiveBackend(funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+		if throttle {
+			return nil, status.Error(codes.ResourceExhausted, "slow down")
+		}
+		return nil, nil
+	}), AdaptiveOptions{Initial: 8, Min: 1, Max: 16})
+
+	b.Infer(context.Background(), nil)
+	if got := b.Limit(); got != 4 {
+		t.Fatalf("after throttle: want limit 4 got %d", got)
+	}
+	throttle = false
+	for i := 0; i < 20; i++ {
+		b.Infer(context.Background(), nil)
+	}
+	if got := b.Limit(); got <= 4 {
+		t.Fatalf("limit did not grow after successes: %d", got)
+	}
+}
+
+func TestIsThrottle(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{fmt.Errorf("wrap: %w", &HTTPStatusError{StatusCode: 429, Status: "429 Too Many Requests"}), true},
+		{status.Error(codes.Unavailable, "busy"), true},
+		{status.Error(codes.InvalidArgument, "bad"), false},
+	}
+	for _, c := range cases {
+		if got := IsThrottle(c.err); got != c.want {
+			t.Errorf("IsThrottle(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package backends
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/processing"
+)
+
+// Factory builds a backend from a parsed backend URI. Query parameters the
+// factory does not understand should be rejected so typos do not go unnoticed.
+type Factory func(u *url.URL) (Backend, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a backend available to Open under the URI scheme name. It
+// panics if name is registered twice or factory is nil, like sql.Register.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic("backends: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("backends: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// Schemes returns the registered URI schemes, sorted.
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open builds the backend described by a URI whose scheme selects a
+// registered factory. The built-in schemes are:
+//
+//	triton+http://host:8000/u2net?input=INPUT__0&shape=1,3,320,320&dtype=UINT8&decoder=png&timeout=10s
+//	triton+grpc://host:8001/u2net?input=INPUT__0&shape=1,3,320,320&dtype=UINT8&stream=true
+//	triton+grpc://host:8001/u2net_ensemble?input=IMAGE&dtype=BYTES&decoder=fp32:320x320
+//	sagemaker://endpoint?region=us-east-1&profile=&content_type=&accept=&custom_attributes=&variant=&component=&decoder=
+//	sagemaker+async://endpoint?bucket=b&prefix=p&region=&profile=&s3_endpoint=&content_type=&accept=&decoder=
+//	http://host/path, https://host/path           (raw POST, PNG mask response)
+//	exec:///usr/bin/python3?arg=seg.py&workers=2
+//	onnx:///path/model.onnx?post_process_mask=true&threads=4&inter_op_threads=&optimization_level=&no_fusion=&no_mem_arena=&mmap=true
+//	onnx:                                         (the model embedded with -tags embedmodel)
+//
+// Both Triton schemes also accept tls=true, ca, cert, key, server_name and
+// insecure_skip_verify for TLS and mutual TLS, and repeated header=Name:Value
+// and bearer_token (e.g. bearer_token=$TRITON_TOKEN) for authentication.
+// shm_output and shm_output_size (plus an optional shm_prefix) pass tensors
+// through system shared memory to a server on the same host.
+// preprocess=true (with optional mean=R,G,B and std=R,G,B) decodes each
+// image on the client and sends it as the tensor described by shape and
+// dtype; otherwise the payload must already be that tensor.
+// With dtype=BYTES the encoded image is sent as is, as one BYTES element
+// (shape defaults to 1), for models that decode it on the server such as the
+// ensembles written by ExportTritonModel. Decoder specs use the
+// ParseMaskDecoder syntax.
+func Open(uri string) (Backend, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("backend %q: %w", uri, err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("backend %q: missing scheme (registered: %s)", uri, strings.Join(Schemes(), ", "))
+	}
+	registryMu.RLock()
+	factory, ok := registry[u.Scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("backend %q: unknown scheme %q (registered: %s)", uri, u.Scheme, strings.Join(Schemes(), ", "))
+	}
+	b, err := factory(u)
+	if err != nil {
+		return nil, fmt.Errorf("backend %q: %w", uri, err)
+	}
+	return b, nil
+}
+
+func init() {
+	Register("triton+http", openTritonHTTP)
+	Register("triton+grpc", openTritonGRPC)
+	Register("sagemaker", openSageMaker)
+	Register("sagemaker+async", openSageMakerAsync)
+	Register("http", openHTTP)
+	Register("https", openHTTP)
+	Register("exec", openExec)
+	Register("onnx", openONNX)
+}
+
+// uriQuery reads query parameters and remembers which were used so the rest
+// can be reported as unknown.
+type uriQuery struct {
+	values url.Values
+	used   map[string]bool
+}
+
+func newURIQuery(u *url.URL) *uriQuery {
+	return &uriQuery{values: u.Query(), used: map[string]bool{}}
+}
+
+func (q *uriQuery) get(key, def string) string {
+	q.used[key] = true
+	if v := q.values.Get(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func (q *uriQuery) all(key string) []string {
+	q.used[key] = true
+	return q.values[key]
+}
+
+func (q *uriQuery) int(key string, def int) (int, error) {
+	v := q.get(key, "")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("parameter %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func (q *uriQuery) bool(key string) (bool, error) {
+	v := q.get(key, "")
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("parameter %s: %w", key, err)
+	}
+	return b, nil
+}
+
+func (q *uriQuery) duration(key string) (time.Duration, error) {
+	v := q.get(key, "")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("parameter %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// floats3 parses an R,G,B triple such as mean=0.5,0.5,0.5.
+func (q *uriQuery) floats3(key string) ([3]float32, error) {
+	var out [3]float32
+	v := q.get(key, "")
+	if v == "" {
+		return out, nil
+	}
+	parts := strings.Split(v, ",")
+	if len(parts) != 3 {
+		return out, fmt.Errorf("parameter %s: want 3 values (R,G,B), got %q", key, v)
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return out, fmt.Errorf("parameter %s: %w", key, err)
+		}
+		out[i] = float32(f)
+	}
+	return out, nil
+}
+
+func (q *uriQuery) decoder() (MaskDecoder, error) {
+	v := q.get("decoder", "")
+	if v == "" {
+		return nil, nil
+	}
+	return ParseMaskDecoder(v)
+}
+
+// unknown returns an error naming the first unused parameter.
+func (q *uriQuery) unknown() error {
+	keys := make([]string, 0, len(q.values))
+	for k := range q.values {
+		if !q.used[k] {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("unknown parameter %q", keys[0])
+}
+
+// tritonParams parses host, model, input, shape and dtype of a Triton URI.
+func tritonParams(u *url.URL, q *uriQuery) (addr, model, input string, shape []int, dtype string, err error) {
+	if u.Host == "" {
+		return "", "", "", nil, "", fmt.Errorf("host required")
+	}
+	model = strings.Trim(u.Path, "/")
+	if model == "" || strings.Contains(model, "/") {
+		return "", "", "", nil, "", fmt.Errorf("model name required as the path, e.g. /u2net")
+	}
+	dtype = q.get("dtype", "UINT8")
+	defaultShape := "1,3,320,320"
+	if dtype == "BYTES" {
+		// one encoded image, decoded by the model (e.g. an ensemble)
+		defaultShape = "1"
+	}
+	for _, s := range strings.Split(q.get("shape", defaultShape), ",") {
+		d, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return "", "", "", nil, "", fmt.Errorf("parameter shape: %w", err)
+		}
+		shape = append(shape, d)
+	}
+	return u.Host, model, q.get("input", "INPUT__0"), shape, dtype, nil
+}
+
+// tritonOptions parses the TLS and authentication parameters of a Triton URI.
+func tritonOptions(q *uriQuery) (TritonOptions, error) {
+	var opts TritonOptions
+	tlsOpts := &TLSOptions{
+		CAFile:     q.get("ca", ""),
+		CertFile:   q.get("cert", ""),
+		KeyFile:    q.get("key", ""),
+		ServerName: q.get("server_name", ""),
+	}
+	enabled, err := q.bool("tls")
+	if err != nil {
+		return opts, err
+	}
+	if tlsOpts.InsecureSkipVerify, err = q.bool("insecure_skip_verify"); err != nil {
+		return opts, err
+	}
+	if enabled || *tlsOpts != (TLSOptions{}) {
+		opts.TLS = tlsOpts
+	}
+	for _, h := range q.all("header") {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return opts, fmt.Errorf("parameter header: want Name:Value, got %q", h)
+		}
+		if opts.Headers == nil {
+			opts.Headers = map[string]string{}
+		}
+		opts.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	opts.BearerToken = q.get("bearer_token", "")
+	if output := q.get("shm_output", ""); output != "" {
+		shm := &SharedMemoryOptions{OutputName: output, Prefix: q.get("shm_prefix", "")}
+		if shm.OutputByteSize, err = q.int("shm_output_size", 0); err != nil {
+			return opts, err
+		}
+		if shm.OutputByteSize <= 0 {
+			return opts, fmt.Errorf("parameter shm_output_size required with shm_output")
+		}
+		opts.SharedMemory = shm
+	}
+	pre, err := q.bool("preprocess")
+	if err != nil {
+		return opts, err
+	}
+	mean, err := q.floats3("mean")
+	if err != nil {
+		return opts, err
+	}
+	std, err := q.floats3("std")
+	if err != nil {
+		return opts, err
+	}
+	if pre {
+		opts.Preprocess = &PreprocessOptions{Mean: mean, Std: std}
+	} else if mean != ([3]float32{}) || std != ([3]float32{}) {
+		return opts, fmt.Errorf("parameters mean and std require preprocess=true")
+	}
+	return opts, nil
+}
+
+func openTritonHTTP(u *url.URL) (Backend, error) {
+	q := newURIQuery(u)
+	addr, model, input, shape, dtype, err := tritonParams(u, q)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := tritonOptions(q)
+	if err != nil {
+		return nil, err
+	}
+	if opts.HTTP.Timeout, err = q.duration("timeout"); err != nil {
+		return nil, err
+	}
+	decoder, err := q.decoder()
+	if err != nil {
+		return nil, err
+	}
+	if err := q.unknown(); err != nil {
+		return nil, err
+	}
+	b, err := NewTritonHTTPBackendWithOptions(addr, model, input, shape, dtype, opts)
+	if err != nil {
+		return nil, err
+	}
+	b.Decoder = decoder
+	return b, nil
+}
+
+func openTritonGRPC(u *url.URL) (Backend, error) {
+	q := newURIQuery(u)
+	addr, model, input, shape, dtype, err := tritonParams(u, q)
+	if err != nil {
+		return nil, err
+	}
+	b := NewTritonGRPCBackend(addr, model, input, shape, dtype)
+	if b.Options, err = tritonOptions(q); err != nil {
+		return nil, err
+	}
+	if b.Streaming, err = q.bool("stream"); err != nil {
+		return nil, err
+	}
+	if b.Decoder, err = q.decoder(); err != nil {
+		return nil, err
+	}
+	return b, q.unknown()
+}
+
+func openSageMaker(u *url.URL) (Backend, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("endpoint name required, e.g. sagemaker://my-endpoint")
+	}
+	q := newURIQuery(u)
+	opts := SageMakerOptions{
+		Region:                 q.get("region", ""),
+		Profile:                q.get("profile", ""),
+		ContentType:            q.get("content_type", ""),
+		Accept:                 q.get("accept", ""),
+		CustomAttributes:       q.get("custom_attributes", ""),
+		TargetVariant:          q.get("variant", ""),
+		InferenceComponentName: q.get("component", ""),
+	}
+	var err error
+	if opts.Decoder, err = q.decoder(); err != nil {
+		return nil, err
+	}
+	// the AWS configuration is loaded on the first Infer call
+	return &SageMakerBackend{Endpoint: u.Host, Options: opts}, q.unknown()
+}
+
+func openSageMakerAsync(u *url.URL) (Backend, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("endpoint name required, e.g. sagemaker+async://my-endpoint?bucket=b")
+	}
+	q := newURIQuery(u)
+	opts := SageMakerAsyncOptions{
+		Region:           q.get("region", ""),
+		Profile:          q.get("profile", ""),
+		S3Endpoint:       q.get("s3_endpoint", ""),
+		InputBucket:      q.get("bucket", ""),
+		InputPrefix:      q.get("prefix", ""),
+		ContentType:      q.get("content_type", ""),
+		Accept:           q.get("accept", ""),
+		CustomAttributes: q.get("custom_attributes", ""),
+	}
+	var err error
+	if opts.Timeout, err = q.duration("timeout"); err != nil {
+		return nil, err
+	}
+	if opts.Decoder, err = q.decoder(); err != nil {
+		return nil, err
+	}
+	if opts.InputBucket == "" {
+		return nil, fmt.Errorf("parameter bucket required")
+	}
+	return &SageMakerAsyncBackend{Endpoint: u.Host, Options: opts}, q.unknown()
+}
+
+// openHTTP posts the raw image to the URI as is; use HTTPOptions or
+// LoadHTTPOptions for anything more involved.
+func openHTTP(u *url.URL) (Backend, error) {
+	return NewHTTPBackend(HTTPOptions{URL: u.String()})
+}
+
+func openExec(u *url.URL) (Backend, error) {
+	command := u.Path
+	if u.Opaque != "" {
+		command = u.Opaque // exec:python3?arg=seg.py, resolved through PATH
+	}
+	if command == "" {
+		return nil, fmt.Errorf("command required, e.g. exec:///usr/bin/python3?arg=seg.py")
+	}
+	q := newURIQuery(u)
+	opts := ExecOptions{Command: command, Args: q.all("arg"), Dir: q.get("dir", "")}
+	var err error
+	if opts.Workers, err = q.int("workers", 1); err != nil {
+		return nil, err
+	}
+	if err := q.unknown(); err != nil {
+		return nil, err
+	}
+	return NewExecBackend(opts)
+}
+
+func openONNX(u *url.URL) (Backend, error) {
+	path := u.Path
+	if u.Opaque != "" {
+		path = u.Opaque // onnx:models/u2net.onnx, relative to the working directory
+	}
+	if path == "" && !models.HasEmbeddedModel() {
+		return nil, fmt.Errorf("model path required, e.g. onnx:///models/u2net.onnx")
+	}
+	q := newURIQuery(u)
+	var opts processing.RemoveBackgroundOptions
+	var err error
+	if opts.PostProcessMask, err = q.bool("post_process_mask"); err != nil {
+		return nil, err
+	}
+	var sessionOpts models.SessionOptions
+	if sessionOpts.Threads, err = q.int("threads", 0); err != nil {
+		return nil, err
+	}
+	if sessionOpts.InterOpThreads, err = q.int("inter_op_threads", 0); err != nil {
+		return nil, err
+	}
+	sessionOpts.OptimizationLevel = q.get("optimization_level", "")
+	if sessionOpts.NoFusion, err = q.bool("no_fusion"); err != nil {
+		return nil, err
+	}
+	if sessionOpts.NoMemArena, err = q.bool("no_mem_arena"); err != nil {
+		return nil, err
+	}
+	if sessionOpts.MemoryMap, err = q.bool("mmap"); err != nil {
+		return nil, err
+	}
+	if err := q.unknown(); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		session, err := models.NewEmbeddedSession(sessionOpts)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalBackendWithSession(session, opts), nil
+	}
+	return NewLocalBackendWithOptions(path, opts, sessionOpts)
+}
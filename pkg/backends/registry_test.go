@@ -0,0 +1,89 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenTriton(t *testing.T) {
+	b, err := Open("triton+grpc://localhost:8001/u2net?input=input.1&shape=1,3,512,512&dtype=FP32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, ok := b.(*TritonGRPCBackend)
+	if !ok {
+		t.Fatalf("got %T", b)
+	}
+	want := &TritonGRPCBackend{Addr: "localhost:8001", Model: "u2net", InputName: "input.1", Shape: []int{1, 3, 512, 512}, DType: "FP32"}
+	if !reflect.DeepEqual(g, want) {
+		t.Fatalf("got %+v, want %+v", g, want)
+	}
+
+	b, err = Open("triton+http://triton:8000/u2net?decoder=float32:320x320")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := b.(*TritonHTTPBackend)
+	if h.InputName != "INPUT__0" || h.DType != "UINT8" || h.Decoder != (FloatTensorDecoder{Width: 320, Height: 320}) {
+		t.Fatalf("defaults not applied: %+v", h)
+	}
+}
+
+func TestOpenSageMaker(t *testing.T) {
+	b, err := Open("sagemaker://rembg-prod?region=eu-west-1&variant=blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := b.(*SageMakerBackend)
+	if s.Endpoint != "rembg-prod" || s.Options.Region != "eu-west-1" || s.Options.TargetVariant != "blue" {
+		t.Fatalf("got %+v", s)
+	}
+	if _, err := Open("sagemaker+async://rembg-prod"); err == nil || !strings.Contains(err.Error(), "bucket") {
+		t.Fatalf("err = %v, want missing bucket", err)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	for _, uri := range []string{
+		"u2net",
+		"nope://x",
+		"triton+http://host:8000",
+		"triton+http://host:8000/u2net?shpe=1,3",
+		"triton+grpc://host:8001/u2net?shape=1,x",
+		"onnx://",
+		"triton+http://host:8000/u2net?mean=0.5,0.5,0.5",
+		"triton+http://host:8000/u2net?preprocess=true&std=1,1",
+	} {
+		if _, err := Open(uri); err == nil {
+			t.Errorf("Open(%q) succeeded", uri)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	// schemes stay registered for the life of the process
+	scheme := fmt.Sprintf("test+echo%d", runs.Add(1))
+	Register(scheme, func(u *url.URL) (Backend, error) {
+		return funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+			return []byte(u.Host), nil
+		}), nil
+	})
+	b, err := Open(strings.ToUpper(scheme) + "://hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Infer(context.Background(), nil); string(got) != "hello" {
+		t.Fatalf("got %q", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate Register did not panic")
+		}
+	}()
+	Register(scheme, openHTTP)
+}
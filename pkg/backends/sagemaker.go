@@ -2,19 +2,164 @@ package backends
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sagemakerruntime"
 )
 
-// InvokeSageMaker calls a SageMaker real-time endpoint with raw image bytes and returns the raw response bytes.
-func InvokeSageMaker(ctx context.Context, endpoint string, payload []byte) ([]byte, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// SageMakerRuntimeAPI is the subset of the SageMaker runtime client used by
+// the SageMaker backends. Tests can substitute a fake.
+type SageMakerRuntimeAPI interface {
+	InvokeEndpoint(ctx context.Context, params *sagemakerruntime.InvokeEndpointInput, optFns ...func(*sagemakerruntime.Options)) (*sagemakerruntime.InvokeEndpointOutput, error)
+}
+
+// SageMakerOptions configures SageMakerBackend. Empty fields are omitted from
+// the request.
+type SageMakerOptions struct {
+	// Region and Profile select the AWS region and shared-config profile used
+	// when Client is nil. Empty values use the default credential chain.
+	Region  string
+	Profile string
+	// Client overrides the runtime client, e.g. with a fake in tests.
+	Client SageMakerRuntimeAPI
+
+	// ContentType of the payload (default "application/octet-stream").
+	ContentType            string
+	Accept                 string
+	CustomAttributes       string
+	TargetVariant          string
+	InferenceComponentName string
+
+	// Decoder turns the response body into PNG mask bytes (default PNGMaskDecoder).
+	Decoder MaskDecoder
+}
+
+// SageMakerBackend wraps a SageMaker real-time endpoint. The runtime client is
+// created once and shared by all requests.
+type SageMakerBackend struct {
+	Endpoint string
+	Options  SageMakerOptions
+
+	mu sync.Mutex
+}
+
+// NewSageMakerBackend returns a backend for endpoint using the default AWS
+// configuration. The client is loaded on the first Infer call.
+func NewSageMakerBackend(endpoint string) *SageMakerBackend {
+	return &SageMakerBackend{Endpoint: endpoint}
+}
+
+// NewSageMakerBackendWithOptions returns a backend for endpoint configured by
+// opts, loading the AWS configuration immediately when opts.Client is nil.
+func NewSageMakerBackendWithOptions(ctx context.Context, endpoint string, opts SageMakerOptions) (*SageMakerBackend, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("sagemaker endpoint required")
+	}
+	s := &SageMakerBackend{Endpoint: endpoint, Options: opts}
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// init loads the runtime client unless it is set. A failed load is not
+// remembered: the next call retries it under its own context.
+func (s *SageMakerBackend) init(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Options.Client != nil {
+		return nil
+	}
+	client, err := newSageMakerClient(ctx, s.Options.Region, s.Options.Profile)
+	if err != nil {
+		return err
+	}
+	s.Options.Client = client
+	return nil
+}
+
+func (s *SageMakerBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+	o := s.Options
+	contentType := o.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	input := &sagemakerruntime.InvokeEndpointInput{
+		Body:                   payload,
+		EndpointName:           aws.String(s.Endpoint),
+		ContentType:            aws.String(contentType),
+		Accept:                 optionalString(o.Accept),
+		CustomAttributes:       optionalString(o.CustomAttributes),
+		TargetVariant:          optionalString(o.TargetVariant),
+		InferenceComponentName: optionalString(o.InferenceComponentName),
+	}
+	resp, err := o.Client.InvokeEndpoint(ctx, input)
 	if err != nil {
 		return nil, err
 	}
-	client := sagemakerruntime.NewFromConfig(cfg)
+	decoder := o.Decoder
+	if decoder == nil {
+		decoder = PNGMaskDecoder{}
+	}
+	return decoder.DecodeMask(resp.Body, aws.ToString(resp.ContentType))
+}
+
+func newSageMakerClient(ctx context.Context, region, profile string) (*sagemakerruntime.Client, error) {
+	cfg, err := loadAWSConfig(ctx, region, profile)
+	if err != nil {
+		return nil, err
+	}
+	return sagemakerruntime.NewFromConfig(cfg), nil
+}
+
+func loadAWSConfig(ctx context.Context, region, profile string) (aws.Config, error) {
+	var loadOpts []func(*config.LoadOptions) error
+	if region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(region))
+	}
+	if profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("load aws config: %w", err)
+	}
+	return cfg, nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+var (
+	defaultSageMakerMu     sync.Mutex
+	defaultSageMakerClient *sagemakerruntime.Client
+)
+
+// InvokeSageMaker calls a SageMaker real-time endpoint with raw image bytes and returns the raw response bytes.
+// It shares one client built from the default AWS configuration across calls;
+// use SageMakerBackend for per-endpoint options and response decoding.
+func InvokeSageMaker(ctx context.Context, endpoint string, payload []byte) ([]byte, error) {
+	defaultSageMakerMu.Lock()
+	if defaultSageMakerClient == nil {
+		client, err := newSageMakerClient(ctx, "", "")
+		if err != nil {
+			defaultSageMakerMu.Unlock()
+			return nil, err
+		}
+		defaultSageMakerClient = client
+	}
+	client := defaultSageMakerClient
+	defaultSageMakerMu.Unlock()
 
 	input := &sagemakerruntime.InvokeEndpointInput{
 		Body:         payload,
@@ -0,0 +1,320 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sagemakerruntime"
+)
+
+// SageMakerAsyncRuntimeAPI is the subset of the SageMaker runtime client used
+// by SageMakerAsyncBackend.
+type SageMakerAsyncRuntimeAPI interface {
+	InvokeEndpointAsync(ctx context.Context, params *sagemakerruntime.InvokeEndpointAsyncInput, optFns ...func(*sagemakerruntime.Options)) (*sagemakerruntime.InvokeEndpointAsyncOutput, error)
+}
+
+// S3API is the subset of the S3 client used by SageMakerAsyncBackend.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// AsyncNotifier waits for SageMaker's completion notification (e.g. an SNS
+// topic delivered to SQS) for an inference ID. It returns nil once the output
+// object is ready and an error if the inference failed.
+type AsyncNotifier interface {
+	Wait(ctx context.Context, inferenceID string) error
+}
+
+// SageMakerAsyncOptions configures SageMakerAsyncBackend.
+type SageMakerAsyncOptions struct {
+	// Region and Profile select the AWS configuration when Runtime or S3 is nil.
+	Region  string
+	Profile string
+	// S3Endpoint points the S3 client at an S3-compatible store (path-style).
+	S3Endpoint string
+	// Runtime and S3 override the clients, e.g. with fakes in tests.
+	Runtime SageMakerAsyncRuntimeAPI
+	S3      S3API
+
+	// InputBucket and InputPrefix locate the uploaded payloads.
+	InputBucket string
+	InputPrefix string
+
+	ContentType      string
+	Accept           string
+	CustomAttributes string
+	// InvocationTimeout and RequestTTL are passed to InvokeEndpointAsync when non-zero.
+	InvocationTimeout time.Duration
+	RequestTTL        time.Duration
+
+	// PollInterval is the initial delay between output checks (default 1s);
+	// it doubles up to MaxPollInterval (default 15s).
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// Timeout bounds the whole request when ctx has no earlier deadline (default 15m).
+	Timeout time.Duration
+	// Notifier, when set, replaces polling for completion.
+	Notifier AsyncNotifier
+	// KeepObjects leaves the input and output objects in S3 after the request.
+	KeepObjects bool
+
+	// Decoder turns the output object into PNG mask bytes (default PNGMaskDecoder).
+	Decoder MaskDecoder
+}
+
+// SageMakerAsyncBackend calls a SageMaker asynchronous endpoint: the payload
+// is uploaded to S3, InvokeEndpointAsync is called with its location and the
+// output object is awaited. Use it for payloads above the 6 MB real-time limit.
+type SageMakerAsyncBackend struct {
+	Endpoint string
+	Options  SageMakerAsyncOptions
+
+	mu sync.Mutex
+}
+
+// NewSageMakerAsyncBackend returns an async backend for endpoint, building
+// the missing clients from the AWS configuration.
+func NewSageMakerAsyncBackend(ctx context.Context, endpoint string, opts SageMakerAsyncOptions) (*SageMakerAsyncBackend, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("sagemaker endpoint required")
+	}
+	if opts.InputBucket == "" {
+		return nil, fmt.Errorf("sagemaker async: input bucket required")
+	}
+	s := &SageMakerAsyncBackend{Endpoint: endpoint, Options: opts}
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// init builds the missing clients. A failed load is not remembered: the next
+// call retries it under its own context.
+func (s *SageMakerAsyncBackend) init(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := &s.Options
+	if o.Runtime != nil && o.S3 != nil {
+		return nil
+	}
+	cfg, err := loadAWSConfig(ctx, o.Region, o.Profile)
+	if err != nil {
+		return err
+	}
+	if o.Runtime == nil {
+		o.Runtime = sagemakerruntime.NewFromConfig(cfg)
+	}
+	if o.S3 == nil {
+		o.S3 = s3.NewFromConfig(cfg, func(so *s3.Options) {
+			if o.S3Endpoint != "" {
+				so.BaseEndpoint = aws.String(o.S3Endpoint)
+				so.UsePathStyle = true
+			}
+		})
+	}
+	return nil
+}
+
+func (s *SageMakerAsyncBackend) Infer(ctx context.Context, payload []byte) ([]byte, error) {
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+	o := s.Options
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = 15 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 1. upload the payload
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	inputKey := strings.TrimSuffix(o.InputPrefix, "/")
+	if inputKey != "" {
+		inputKey += "/"
+	}
+	inputKey += id
+	contentType := o.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	_, err = o.S3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(o.InputBucket),
+		Key:         aws.String(inputKey),
+		Body:        bytes.NewReader(payload),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload input: %w", err)
+	}
+	if !o.KeepObjects {
+		defer s.deleteObject(o.InputBucket, inputKey)
+	}
+
+	// 2. start the asynchronous inference
+	input := &sagemakerruntime.InvokeEndpointAsyncInput{
+		EndpointName:     aws.String(s.Endpoint),
+		InputLocation:    aws.String(fmt.Sprintf("s3://%s/%s", o.InputBucket, inputKey)),
+		ContentType:      aws.String(contentType),
+		Accept:           optionalString(o.Accept),
+		CustomAttributes: optionalString(o.CustomAttributes),
+		InferenceId:      aws.String(id),
+	}
+	if o.InvocationTimeout > 0 {
+		input.InvocationTimeoutSeconds = aws.Int32(int32(o.InvocationTimeout / time.Second))
+	}
+	if o.RequestTTL > 0 {
+		input.RequestTTLSeconds = aws.Int32(int32(o.RequestTTL / time.Second))
+	}
+	resp, err := o.Runtime.InvokeEndpointAsync(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("invoke endpoint async: %w", err)
+	}
+	outBucket, outKey, err := parseS3URI(aws.ToString(resp.OutputLocation))
+	if err != nil {
+		return nil, fmt.Errorf("output location: %w", err)
+	}
+	if !o.KeepObjects {
+		defer s.deleteObject(outBucket, outKey)
+	}
+
+	// 3. wait for the output object
+	var body []byte
+	if o.Notifier != nil {
+		inferenceID := aws.ToString(resp.InferenceId)
+		if inferenceID == "" {
+			inferenceID = id
+		}
+		if err := o.Notifier.Wait(ctx, inferenceID); err != nil {
+			return nil, fmt.Errorf("sagemaker async inference %s: %w", inferenceID, err)
+		}
+		body, err = s.getObject(ctx, outBucket, outKey)
+	} else {
+		body, err = s.poll(ctx, outBucket, outKey, aws.ToString(resp.FailureLocation))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := o.Decoder
+	if decoder == nil {
+		decoder = PNGMaskDecoder{}
+	}
+	return decoder.DecodeMask(body, o.Accept)
+}
+
+// poll fetches the output object until it exists, the failure object appears
+// or ctx is done.
+func (s *SageMakerAsyncBackend) poll(ctx context.Context, bucket, key, failureLocation string) ([]byte, error) {
+	interval := s.Options.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxInterval := s.Options.MaxPollInterval
+	if maxInterval <= 0 {
+		maxInterval = 15 * time.Second
+	}
+	var failBucket, failKey string
+	if failureLocation != "" {
+		failBucket, failKey, _ = parseS3URI(failureLocation)
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for s3://%s/%s: %w", bucket, key, ctx.Err())
+		case <-timer.C:
+		}
+
+		body, err := s.getObject(ctx, bucket, key)
+		if err == nil {
+			return body, nil
+		}
+		if !isNotFound(err) {
+			return nil, fmt.Errorf("get output: %w", err)
+		}
+		if failKey != "" {
+			if msg, err := s.getObject(ctx, failBucket, failKey); err == nil {
+				if !s.Options.KeepObjects {
+					s.deleteObject(failBucket, failKey)
+				}
+				return nil, fmt.Errorf("sagemaker async inference failed: %s", strings.TrimSpace(string(msg)))
+			}
+		}
+
+		timer.Reset(interval)
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+func (s *SageMakerAsyncBackend) getObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	out, err := s.Options.S3.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// deleteObject removes a temporary object on a best-effort basis, outliving
+// the request context so cancelled requests still clean up.
+func (s *SageMakerAsyncBackend) deleteObject(bucket, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.Options.S3.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+}
+
+func isNotFound(err error) bool {
+	var noKey *s3types.NoSuchKey
+	if errors.As(err, &noKey) {
+		return true
+	}
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var statusErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusNotFound
+}
+
+// parseS3URI splits s3://bucket/key.
+func parseS3URI(uri string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(uri, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("not an s3 uri: %q", uri)
+	}
+	bucket, key, ok = strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("s3 uri needs bucket and key: %q", uri)
+	}
+	return bucket, key, nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate request id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,165 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sagemakerruntime"
+)
+
+// fakeS3 is a minimal path-style S3-compatible object store.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) put(key string, body []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = body
+}
+
+func (f *fakeS3) get(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.objects[key]
+	return b, ok
+}
+
+// fakeAsyncRuntime "runs" the model by writing the output object after a delay.
+type fakeAsyncRuntime struct {
+	store  *fakeS3
+	output []byte
+	fail   bool
+	input  []byte
+}
+
+func (f *fakeAsyncRuntime) InvokeEndpointAsync(ctx context.Context, params *sagemakerruntime.InvokeEndpointAsyncInput, optFns ...func(*sagemakerruntime.Options)) (*sagemakerruntime.InvokeEndpointAsyncOutput, error) {
+	inKey := strings.TrimPrefix(aws.ToString(params.InputLocation), "s3://")
+	in, ok := f.store.get(inKey)
+	if !ok {
+		return nil, io.ErrUnexpectedEOF
+	}
+	f.input = in
+	id := aws.ToString(params.InferenceId)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		if f.fail {
+			f.store.put("results/"+id+".err", []byte("model crashed"))
+			return
+		}
+		f.store.put("results/"+id+".out", f.output)
+	}()
+	return &sagemakerruntime.InvokeEndpointAsyncOutput{
+		InferenceId:     aws.String(id),
+		OutputLocation:  aws.String("s3://results/" + id + ".out"),
+		FailureLocation: aws.String("s3://results/" + id + ".err"),
+	}, nil
+}
+
+func newAsyncTestBackend(t *testing.T, fail bool) (*SageMakerAsyncBackend, *fakeS3, []byte) {
+	t.Helper()
+	store := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(store)
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	mask := grayPNG(t, 2, 2)
+	b, err := NewSageMakerAsyncBackend(context.Background(), "u2net-async", SageMakerAsyncOptions{
+		Region:       "us-east-1",
+		S3Endpoint:   srv.URL,
+		Runtime:      &fakeAsyncRuntime{store: store, output: mask, fail: fail},
+		InputBucket:  "inputs",
+		InputPrefix:  "rembg/",
+		PollInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, store, mask
+}
+
+func TestSageMakerAsyncBackendPollsOutput(t *testing.T) {
+	b, store, mask := newAsyncTestBackend(t, false)
+	got, err := b.Infer(context.Background(), []byte("large image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, mask) {
+		t.Fatal("unexpected mask")
+	}
+	if in := b.Options.Runtime.(*fakeAsyncRuntime).input; string(in) != "large image" {
+		t.Fatalf("uploaded payload mismatch: %q", in)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if n := len(store.objects); n != 0 {
+		t.Fatalf("temporary objects not cleaned up: %d left", n)
+	}
+}
+
+func TestSageMakerAsyncBackendFailure(t *testing.T) {
+	b, _, _ := newAsyncTestBackend(t, true)
+	_, err := b.Infer(context.Background(), []byte("large image"))
+	if err == nil || !strings.Contains(err.Error(), "model crashed") {
+		t.Fatalf("want failure message, got %v", err)
+	}
+}
+
+func TestSageMakerAsyncBackendHonorsContext(t *testing.T) {
+	b, _, _ := newAsyncTestBackend(t, false)
+	b.Options.Runtime = neverFinishingRuntime{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.Infer(ctx, []byte("x")); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Fatalf("want deadline error, got %v", err)
+	}
+}
+
+// neverFinishingRuntime accepts the request but never writes an output.
+type neverFinishingRuntime struct{}
+
+func (neverFinishingRuntime) InvokeEndpointAsync(ctx context.Context, params *sagemakerruntime.InvokeEndpointAsyncInput, optFns ...func(*sagemakerruntime.Options)) (*sagemakerruntime.InvokeEndpointAsyncOutput, error) {
+	id := aws.ToString(params.InferenceId)
+	return &sagemakerruntime.InvokeEndpointAsyncOutput{
+		InferenceId:    aws.String(id),
+		OutputLocation: aws.String("s3://results/" + id + ".out"),
+	}, nil
+}
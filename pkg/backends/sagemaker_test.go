@@ -0,0 +1,105 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sagemakerruntime"
+)
+
+type fakeSageMakerRuntime struct {
+	input *sagemakerruntime.InvokeEndpointInput
+	body  []byte
+}
+
+func (f *fakeSageMakerRuntime) InvokeEndpoint(ctx context.Context, params *sagemakerruntime.InvokeEndpointInput, optFns ...func(*sagemakerruntime.Options)) (*sagemakerruntime.InvokeEndpointOutput, error) {
+	f.input = params
+	return &sagemakerruntime.InvokeEndpointOutput{Body: f.body, ContentType: aws.String("application/json")}, nil
+}
+
+func grayPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSageMakerBackendRequestAndDecoder(t *testing.T) {
+	mask := grayPNG(t, 4, 4)
+	fake := &fakeSageMakerRuntime{body: []byte(`{"predictions":[{"mask":"` + base64.StdEncoding.EncodeToString(mask) + `"}]}`)}
+	b, err := NewSageMakerBackendWithOptions(context.Background(), "u2net-endpoint", SageMakerOptions{
+		Client:                 fake,
+		ContentType:            "image/png",
+		Accept:                 "application/json",
+		CustomAttributes:       "return=mask",
+		TargetVariant:          "blue",
+		InferenceComponentName: "u2net-ic",
+		Decoder:                JSONMaskDecoder{Path: "predictions.0.mask"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := b.Infer(context.Background(), []byte("img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, mask) {
+		t.Fatal("decoded mask does not match")
+	}
+	in := fake.input
+	if aws.ToString(in.EndpointName) != "u2net-endpoint" || aws.ToString(in.ContentType) != "image/png" ||
+		aws.ToString(in.Accept) != "application/json" || aws.ToString(in.CustomAttributes) != "return=mask" ||
+		aws.ToString(in.TargetVariant) != "blue" || aws.ToString(in.InferenceComponentName) != "u2net-ic" {
+		t.Fatalf("unexpected request: %+v", in)
+	}
+}
+
+func TestFloatTensorDecoder(t *testing.T) {
+	body := Float32sToBytes([]float32{0, 0.5, 1, 1})
+	out, err := FloatTensorDecoder{}.DecodeMask(body, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := img.(*image.Gray)
+	if g.Bounds().Dx() != 2 || g.GrayAt(0, 0).Y != 0 || g.GrayAt(1, 1).Y != 255 {
+		t.Fatalf("unexpected mask: %v", g.Pix)
+	}
+}
+
+func TestFloatTensorDecoderDatatypes(t *testing.T) {
+	for spec, body := range map[string][]byte{
+		"fp16:2x2":  {0, 0, 0, 0x38, 0, 0x3c, 0, 0x3c},
+		"uint8:2x2": {0, 128, 255, 255},
+	} {
+		d, err := ParseMaskDecoder(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := d.DecodeMask(body, "")
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		img, err := png.Decode(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := img.(*image.Gray); g.GrayAt(0, 0).Y != 0 || g.GrayAt(1, 1).Y != 255 || g.GrayAt(1, 0).Y < 126 || g.GrayAt(1, 0).Y > 128 {
+			t.Fatalf("%s: unexpected mask %v", spec, g.Pix)
+		}
+	}
+	if _, err := ParseMaskDecoder("fp12"); err == nil {
+		t.Fatal("expected an unknown decoder error")
+	}
+}
@@ -0,0 +1,300 @@
+package backends
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority is the scheduling class of a job submitted to a PooledBackend.
+// Higher classes are served first.
+type Priority int
+
+const (
+	// PriorityBulk is for throughput work such as video frames and batch folders.
+	PriorityBulk Priority = iota
+	// PriorityNormal is the default when no priority is attached to the context.
+	PriorityNormal
+	// PriorityInteractive is for latency-sensitive single requests.
+	PriorityInteractive
+
+	numPriorities = int(PriorityInteractive) + 1
+)
+
+type priorityKey struct{}
+
+type tenantKey struct{}
+
+// WithPriority returns a context whose PooledBackend jobs are scheduled in class p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority attached with WithPriority, or PriorityNormal.
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= PriorityBulk && p <= PriorityInteractive {
+		return p
+	}
+	return PriorityNormal
+}
+
+// WithTenant returns a context whose PooledBackend jobs are accounted to tenant
+// (a customer, job ID, ...) for weighted fair queuing within a priority class.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant attached with WithTenant, or "".
+func TenantFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(tenantKey{}).(string)
+	return t
+}
+
+// queueItem is a job waiting in the scheduler.
+type queueItem struct {
+	job      pooledJob
+	priority Priority
+	tenant   string
+	start    float64 // virtual start tag
+	finish   float64 // virtual finish tag, the heap key
+	seq      uint64
+	enqueued time.Time
+	index    int // position in the class heap, -1 once dequeued
+}
+
+type itemHeap []*queueItem
+
+func (h itemHeap) Len() int { return len(h) }
+
+func (h itemHeap) Less(i, j int) bool {
+	if h[i].finish != h[j].finish {
+		return h[i].finish < h[j].finish
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h itemHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *itemHeap) Push(x interface{}) {
+	it := x.(*queueItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*h = old[:n-1]
+	return it
+}
+
+// priorityClass queues the jobs of one priority with start-time fair queuing
+// across tenants.
+type priorityClass struct {
+	items itemHeap
+	// fifo holds items in arrival order for starvation checks; dequeued items
+	// (index -1) are dropped lazily from the front.
+	fifo       []*queueItem
+	vtime      float64
+	lastFinish map[string]float64
+}
+
+func (c *priorityClass) oldest() *queueItem {
+	for len(c.fifo) > 0 && c.fifo[0].index < 0 {
+		c.fifo[0] = nil
+		c.fifo = c.fifo[1:]
+	}
+	if len(c.fifo) == 0 {
+		return nil
+	}
+	return c.fifo[0]
+}
+
+// scheduler is the PooledBackend job queue: strict priority between classes,
+// weighted fair queuing between tenants inside a class, and aging so that a
+// job waiting longer than starvationAge is served next regardless of class.
+type scheduler struct {
+	mu            sync.Mutex
+	classes       [numPriorities]priorityClass
+	weights       map[string]float64
+	defaultWeight float64
+	starvationAge time.Duration
+	seq           uint64
+	length        int
+	closed        bool
+	// ready is closed and replaced whenever an item is pushed or the scheduler closes.
+	ready chan struct{}
+}
+
+func newScheduler(weights map[string]float64, defaultWeight float64, starvationAge time.Duration) *scheduler {
+	if defaultWeight <= 0 {
+		defaultWeight = 1
+	}
+	s := &scheduler{
+		weights:       weights,
+		defaultWeight: defaultWeight,
+		starvationAge: starvationAge,
+		ready:         make(chan struct{}),
+	}
+	for i := range s.classes {
+		s.classes[i].lastFinish = make(map[string]float64)
+	}
+	return s
+}
+
+func (s *scheduler) weight(tenant string) float64 {
+	if w, ok := s.weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return s.defaultWeight
+}
+
+// push queues it and reports false if the scheduler is closed.
+func (s *scheduler) push(it *queueItem) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	c := &s.classes[it.priority]
+	it.start = c.vtime
+	if last := c.lastFinish[it.tenant]; last > it.start {
+		it.start = last
+	}
+	it.finish = it.start + 1/s.weight(it.tenant)
+	c.lastFinish[it.tenant] = it.finish
+	s.seq++
+	it.seq = s.seq
+	it.enqueued = time.Now()
+	heap.Push(&c.items, it)
+	c.fifo = append(c.fifo, it)
+	s.length++
+
+	close(s.ready)
+	s.ready = make(chan struct{})
+	return true
+}
+
+// remove drops a still-queued item, reporting whether it was removed.
+func (s *scheduler) remove(it *queueItem) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if it.index < 0 {
+		return false
+	}
+	s.dequeue(it)
+	return true
+}
+
+func (s *scheduler) dequeue(it *queueItem) {
+	c := &s.classes[it.priority]
+	heap.Remove(&c.items, it.index)
+	s.length--
+	if len(c.items) == 0 {
+		// nothing left to be fair against; forget the tenants' history
+		c.fifo = nil
+		c.vtime = 0
+		c.lastFinish = make(map[string]float64)
+	}
+}
+
+// pop blocks until an item is available or the scheduler is closed.
+func (s *scheduler) pop() (*queueItem, bool) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, false
+		}
+		if it := s.next(); it != nil {
+			s.mu.Unlock()
+			return it, true
+		}
+		ready := s.ready
+		s.mu.Unlock()
+		<-ready
+	}
+}
+
+// next picks and dequeues the next item; s.mu must be held.
+func (s *scheduler) next() *queueItem {
+	if s.length == 0 {
+		return nil
+	}
+	if s.starvationAge > 0 {
+		var starved *queueItem
+		for i := range s.classes {
+			if it := s.classes[i].oldest(); it != nil && (starved == nil || it.enqueued.Before(starved.enqueued)) {
+				starved = it
+			}
+		}
+		if starved != nil && time.Since(starved.enqueued) >= s.starvationAge {
+			s.take(starved)
+			return starved
+		}
+	}
+	for p := numPriorities - 1; p >= 0; p-- {
+		c := &s.classes[p]
+		if len(c.items) > 0 {
+			it := c.items[0]
+			s.take(it)
+			return it
+		}
+	}
+	return nil
+}
+
+func (s *scheduler) take(it *queueItem) {
+	s.classes[it.priority].vtime = it.start
+	s.dequeue(it)
+}
+
+// close rejects further pushes, wakes blocked pops and returns the items that
+// were still queued.
+func (s *scheduler) close() []*queueItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var pending []*queueItem
+	for i := range s.classes {
+		c := &s.classes[i]
+		pending = append(pending, c.items...)
+		for _, it := range c.items {
+			it.index = -1
+		}
+		c.items = nil
+		c.fifo = nil
+	}
+	s.length = 0
+	close(s.ready)
+	return pending
+}
+
+// len returns the number of queued items.
+func (s *scheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.length
+}
+
+// lenByPriority returns the number of queued items per class.
+func (s *scheduler) lenByPriority() [numPriorities]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out [numPriorities]int
+	for i := range s.classes {
+		out[i] = len(s.classes[i].items)
+	}
+	return out
+}
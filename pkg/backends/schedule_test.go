@@ -0,0 +1,94 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func pushItem(t *testing.T, s *scheduler, prio Priority, tenant string) *queueItem {
+	t.Helper()
+	it := &queueItem{priority: prio, tenant: tenant}
+	if !s.push(it) {
+		t.Fatal("push on open scheduler failed")
+	}
+	return it
+}
+
+func TestSchedulerPriorityOrder(t *testing.T) {
+	s := newScheduler(nil, 1, 0)
+	bulk := pushItem(t, s, PriorityBulk, "")
+	normal := pushItem(t, s, PriorityNormal, "")
+	interactive := pushItem(t, s, PriorityInteractive, "")
+
+	for _, want := range []*queueItem{interactive, normal, bulk} {
+		if got, _ := s.pop(); got != want {
+			t.Fatalf("want priority %d, got %d", want.priority, got.priority)
+		}
+	}
+}
+
+func TestSchedulerWeightedFairness(t *testing.T) {
+	s := newScheduler(map[string]float64{"a": 2, "b": 1}, 1, 0)
+	for i := 0; i < 30; i++ {
+		pushItem(t, s, PriorityBulk, "a")
+		pushItem(t, s, PriorityBulk, "b")
+	}
+	counts := map[string]int{}
+	for i := 0; i < 30; i++ {
+		it, _ := s.pop()
+		counts[it.tenant]++
+	}
+	if counts["a"] != 20 || counts["b"] != 10 {
+		t.Fatalf("want a:b = 20:10, got %v", counts)
+	}
+}
+
+func TestSchedulerStarvationProtection(t *testing.T) {
+	s := newScheduler(nil, 1, 10*time.Millisecond)
+	bulk := pushItem(t, s, PriorityBulk, "")
+	time.Sleep(15 * time.Millisecond)
+	pushItem(t, s, PriorityInteractive, "")
+
+	if got, _ := s.pop(); got != bulk {
+		t.Fatalf("aged bulk job not served first, got priority %d", got.priority)
+	}
+}
+
+func TestPooledBackendPriorityPreemptsQueue(t *testing.T) {
+	release := make(chan struct{})
+	order := make(chan string, 3)
+	p := NewPooledBackend(funcBackend(func(ctx context.Context, payload []byte) ([]byte, error) {
+		<-release
+		order <- string(payload)
+		return payload, nil
+	}), 1)
+	defer p.Close(context.Background())
+
+	// occupy the only worker, then queue bulk before interactive work
+	busy := InferAsync(context.Background(), p, []byte("busy"))
+	waitFor(t, func() bool { return p.Stats().Busy == 1 })
+	bulk := InferAsync(WithPriority(context.Background(), PriorityBulk), p, []byte("bulk"))
+	waitFor(t, func() bool { return p.Stats().Queued == 1 })
+	interactive := InferAsync(WithPriority(context.Background(), PriorityInteractive), p, []byte("interactive"))
+	waitFor(t, func() bool { return p.Stats().QueuedByPriority[PriorityInteractive] == 1 })
+
+	close(release)
+	<-busy
+	<-bulk
+	<-interactive
+	if got := []string{<-order, <-order, <-order}; got[1] != "interactive" || got[2] != "bulk" {
+		t.Fatalf("unexpected execution order: %v", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package backends
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// shmDir is where POSIX shared-memory objects live on Linux.
+const shmDir = "/dev/shm"
+
+// SharedMemoryRegion is a POSIX shared-memory segment mapped into this
+// process. Name is the region name registered with Triton and Key the
+// shm_open key the server maps (e.g. "/rembg_42_0_input").
+type SharedMemoryRegion struct {
+	Name string
+	Key  string
+	Size int
+
+	data []byte
+}
+
+// CreateSharedMemoryRegion creates the segment key of size bytes and maps it.
+// It fails if the segment already exists.
+func CreateSharedMemoryRegion(name, key string, size int) (*SharedMemoryRegion, error) {
+	return mapSharedMemory(name, key, size, os.O_RDWR|os.O_CREATE|os.O_EXCL)
+}
+
+// OpenSharedMemoryRegion maps the first size bytes of the existing segment
+// key, as the server side of the extension does.
+func OpenSharedMemoryRegion(key string, size int) (*SharedMemoryRegion, error) {
+	return mapSharedMemory("", key, size, os.O_RDWR)
+}
+
+func mapSharedMemory(name, key string, size int, flag int) (*SharedMemoryRegion, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("shared memory %q: invalid size %d", key, size)
+	}
+	path, err := shmPath(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, flag, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("shared memory %q: %w", key, err)
+	}
+	defer f.Close()
+	if flag&os.O_CREATE != 0 {
+		if err := f.Truncate(int64(size)); err != nil {
+			os.Remove(path)
+			return nil, fmt.Errorf("shared memory %q: %w", key, err)
+		}
+	} else if fi, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("shared memory %q: %w", key, err)
+	} else if fi.Size() < int64(size) {
+		return nil, fmt.Errorf("shared memory %q: %d bytes, want %d", key, fi.Size(), size)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		if flag&os.O_CREATE != 0 {
+			os.Remove(path)
+		}
+		return nil, fmt.Errorf("shared memory %q: mmap: %w", key, err)
+	}
+	return &SharedMemoryRegion{Name: name, Key: key, Size: size, data: data}, nil
+}
+
+// shmPath maps a shm_open key to its file, rejecting keys with a path.
+func shmPath(key string) (string, error) {
+	name := strings.TrimPrefix(key, "/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("shared memory: invalid key %q", key)
+	}
+	return filepath.Join(shmDir, name), nil
+}
+
+// Bytes returns the mapped memory. It must not be used after Close.
+func (r *SharedMemoryRegion) Bytes() []byte { return r.data }
+
+// Close unmaps the region; the segment itself stays until Unlink.
+func (r *SharedMemoryRegion) Close() error {
+	if r.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(r.data)
+	r.data = nil
+	return err
+}
+
+// Unlink removes the segment. Processes that still map it keep their mapping.
+func (r *SharedMemoryRegion) Unlink() error {
+	path, err := shmPath(r.Key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
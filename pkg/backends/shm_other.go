@@ -0,0 +1,31 @@
+//go:build !linux
+
+package backends
+
+import "errors"
+
+var errSharedMemoryUnsupported = errors.New("shared memory: only supported on linux")
+
+// SharedMemoryRegion is a POSIX shared-memory segment mapped into this
+// process. It is only available on Linux.
+type SharedMemoryRegion struct {
+	Name string
+	Key  string
+	Size int
+}
+
+// CreateSharedMemoryRegion is only supported on Linux.
+func CreateSharedMemoryRegion(name, key string, size int) (*SharedMemoryRegion, error) {
+	return nil, errSharedMemoryUnsupported
+}
+
+// OpenSharedMemoryRegion is only supported on Linux.
+func OpenSharedMemoryRegion(key string, size int) (*SharedMemoryRegion, error) {
+	return nil, errSharedMemoryUnsupported
+}
+
+func (r *SharedMemoryRegion) Bytes() []byte { return nil }
+
+func (r *SharedMemoryRegion) Close() error { return nil }
+
+func (r *SharedMemoryRegion) Unlink() error { return errSharedMemoryUnsupported }
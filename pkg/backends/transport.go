@@ -0,0 +1,140 @@
+package backends
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSOptions configures TLS to a backend. A zero value verifies the server
+// against the system roots.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of roots trusted instead of the system pool.
+	CAFile string
+	// CertFile and KeyFile hold a PEM client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name verified in the server certificate.
+	ServerName string
+	// InsecureSkipVerify disables server verification (testing only).
+	InsecureSkipVerify bool
+}
+
+// Config builds the tls.Config described by o.
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA bundle %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// HTTPClientOptions tunes the client built by NewHTTPClient. Zero fields use
+// the net/http defaults.
+type HTTPClientOptions struct {
+	// Timeout bounds each request including reading the body.
+	Timeout time.Duration
+	// DialTimeout and KeepAlive configure the TCP dialer.
+	DialTimeout time.Duration
+	KeepAlive   time.Duration
+	// MaxIdleConnsPerHost and IdleConnTimeout control connection reuse.
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// TLS, when set, configures server verification and client certificates.
+	TLS *TLSOptions
+}
+
+// NewHTTPClient returns an http.Client with its own transport configured by opts.
+func NewHTTPClient(opts HTTPClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.DialTimeout > 0 || opts.KeepAlive != 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if opts.DialTimeout > 0 {
+			dialer.Timeout = opts.DialTimeout
+		}
+		if opts.KeepAlive != 0 {
+			dialer.KeepAlive = opts.KeepAlive
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < opts.MaxIdleConnsPerHost {
+			transport.MaxIdleConns = opts.MaxIdleConnsPerHost
+		}
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.TLS != nil {
+		cfg, err := opts.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = cfg
+	}
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}, nil
+}
+
+// authHeaders expands the environment references in headers and adds the
+// bearer token as Authorization.
+func authHeaders(headers map[string]string, bearerToken string) map[string]string {
+	out := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		out[k] = os.ExpandEnv(v)
+	}
+	if bearerToken != "" {
+		out["Authorization"] = "Bearer " + os.ExpandEnv(bearerToken)
+	}
+	return out
+}
+
+// metadataCredentials sends headers as gRPC metadata on every call.
+type metadataCredentials struct {
+	headers     map[string]string
+	bearerToken string
+	secure      bool
+}
+
+func (m metadataCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := map[string]string{}
+	for k, v := range authHeaders(m.headers, m.bearerToken) {
+		// gRPC metadata keys are lower case
+		md[strings.ToLower(k)] = v
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity reports whether the connection uses TLS; tokens
+// may still be sent in plaintext to e.g. a local sidecar.
+func (m metadataCredentials) RequireTransportSecurity() bool {
+	return m.secure
+}
@@ -0,0 +1,218 @@
+package backends
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// testPKI is a CA with a server certificate for 127.0.0.1 and a client
+// certificate, written as PEM files to dir.
+type testPKI struct {
+	pool                      *x509.CertPool
+	server                    tls.Certificate
+	caFile, certFile, keyFile string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+	writePEM := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	p := &testPKI{pool: x509.NewCertPool()}
+	p.pool.AddCert(ca)
+	p.caFile = writePEM("ca.pem", "CERTIFICATE", caDER)
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	p.server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	keyDER, _ := x509.MarshalECPrivateKey(clientKey)
+	p.certFile = writePEM("client.pem", "CERTIFICATE", clientDER)
+	p.keyFile = writePEM("client-key.pem", "EC PRIVATE KEY", keyDER)
+	return p
+}
+
+// serverConfig requires a client certificate signed by the CA.
+func (p *testPKI) serverConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    p.pool,
+	}
+}
+
+func TestTritonHTTPBackendMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	t.Setenv("TRITON_TOKEN", "s3cret")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer s3cret" {
+			http.Error(w, "bad token "+got, http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Tenant") != "rembg" {
+			http.Error(w, "missing tenant", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(TritonInferResponse{
+			ModelName: "u2net",
+			Outputs:   []TritonTensor{{Name: "out", Shape: []int64{2}, Datatype: "UINT8", Data: []interface{}{1.0, 2.0}}},
+		})
+	}))
+	srv.TLS = pki.serverConfig()
+	srv.StartTLS()
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	b, err := NewTritonHTTPBackendWithOptions(addr, "u2net", "INPUT__0", []int{2}, "UINT8", TritonOptions{
+		TLS:         &TLSOptions{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile},
+		Headers:     map[string]string{"X-Tenant": "rembg"},
+		BearerToken: "$TRITON_TOKEN",
+		HTTP:        HTTPClientOptions{Timeout: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Infer(context.Background(), []byte{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "\x01\x02" {
+		t.Fatalf("got %v", got)
+	}
+
+	// without a client certificate the handshake fails
+	noCert, _ := NewTritonHTTPBackendWithOptions(addr, "u2net", "INPUT__0", []int{2}, "UINT8", TritonOptions{
+		TLS: &TLSOptions{CAFile: pki.caFile},
+	})
+	if _, err := noCert.Infer(context.Background(), []byte{0, 0}); err == nil {
+		t.Fatal("expected a TLS error without a client certificate")
+	}
+}
+
+func TestTritonOptionsHTTPClientShared(t *testing.T) {
+	client := func(opts TritonOptions) *http.Client {
+		t.Helper()
+		c, err := opts.httpClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a := client(TritonOptions{TLS: &TLSOptions{ServerName: "triton"}})
+	if b := client(TritonOptions{TLS: &TLSOptions{ServerName: "triton"}}); b != a {
+		t.Fatal("equal options built a second client")
+	}
+	if b := client(TritonOptions{HTTP: HTTPClientOptions{TLS: &TLSOptions{ServerName: "triton"}}}); b != a {
+		t.Fatal("the same TLS options given through HTTP built a second client")
+	}
+	if b := client(TritonOptions{TLS: &TLSOptions{ServerName: "other"}}); b == a {
+		t.Fatal("different options shared a client")
+	}
+}
+
+func TestTritonGRPCConnMutualTLSAndMetadata(t *testing.T) {
+	pki := newTestPKI(t)
+	var gotMD metadata.MD
+	srv := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(pki.serverConfig())),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			gotMD, _ = metadata.FromIncomingContext(ctx)
+			return handler(ctx, req)
+		}),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	conn, err := NewTritonGRPCConnWithOptions(ln.Addr().String(), TritonOptions{
+		TLS:         &TLSOptions{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile},
+		Headers:     map[string]string{"X-Tenant": "rembg"},
+		BearerToken: "token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if v := gotMD.Get("authorization"); len(v) != 1 || v[0] != "Bearer token" {
+		t.Fatalf("authorization metadata = %v", v)
+	}
+	if v := gotMD.Get("x-tenant"); len(v) != 1 || v[0] != "rembg" {
+		t.Fatalf("x-tenant metadata = %v", v)
+	}
+}
+
+func TestTLSOptionsErrors(t *testing.T) {
+	if _, err := (&TLSOptions{CertFile: "client.pem"}).Config(); err == nil {
+		t.Fatal("expected an error for a certificate without a key")
+	}
+	if _, err := (&TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).Config(); err == nil {
+		t.Fatal("expected an error for a missing CA bundle")
+	}
+}
@@ -5,36 +5,138 @@ import (
     "fmt"
 
     "google.golang.org/grpc"
+    "google.golang.org/grpc/credentials"
     "google.golang.org/grpc/credentials/insecure"
+
+    "github.com/unrealandychan/rembg-go/pkg/tracing"
 )
 
 // NewTritonGRPCConn creates a gRPC connection to a Triton server.
 // Use this connection with the generated Triton gRPC client (after you generate Go code from Triton's protos).
 func NewTritonGRPCConn(addr string) (*grpc.ClientConn, error) {
+    return NewTritonGRPCConnWithOptions(addr, TritonOptions{})
+}
+
+// NewTritonGRPCConnWithOptions creates a gRPC connection using TLS (or mutual
+// TLS) when opts.TLS is set and sending opts.Headers and the bearer token as
+// metadata on every call.
+func NewTritonGRPCConnWithOptions(addr string, opts TritonOptions) (*grpc.ClientConn, error) {
     if addr == "" {
         return nil, fmt.Errorf("address required")
     }
-    conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+    creds := insecure.NewCredentials()
+    if opts.TLS != nil {
+        cfg, err := opts.TLS.Config()
+        if err != nil {
+            return nil, err
+        }
+        creds = credentials.NewTLS(cfg)
+    }
+    dialOpts := []grpc.DialOption{
+        grpc.WithTransportCredentials(creds),
+        grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor()),
+        grpc.WithStreamInterceptor(tracing.StreamClientInterceptor()),
+    }
+    if len(opts.Headers) > 0 || opts.BearerToken != "" {
+        dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(metadataCredentials{
+            headers:     opts.Headers,
+            bearerToken: opts.BearerToken,
+            secure:      opts.TLS != nil,
+        }))
+    }
+    conn, err := grpc.Dial(addr, dialOpts...)
     if err != nil {
         return nil, err
     }
     return conn, nil
 }
 
-// InferTritonGRPCStub is a documented stub showing how to perform inference using the generated Triton gRPC client.
-// It intentionally does not reference generated proto types so this file compiles without the generated code.
-// Steps to complete:
-// 1. Generate Go code from Triton protos (see copilot-instructions.md):
-//    protoc --proto_path=server --go_out=. --go-grpc_out=. server/src/core/grpc_service.proto server/src/core/infer.proto
-// 2. Import the generated package (for example: tritonpb "path/to/generated/package").
-// 3. Replace the pseudo-code below with real calls using the generated client and request/response types.
+// InferTritonGRPC performs a unary ModelInfer call on conn with a single
+// input sent as raw contents and returns the contents of the first output.
+// The messages are encoded without generated Triton protos.
+func InferTritonGRPC(ctx context.Context, conn *grpc.ClientConn, modelName, inputName string, inputData []byte, shape []int, dtype string) ([]byte, error) {
+    resp, err := inferTritonGRPC(ctx, conn, newModelInferRequest(modelName, inputName, inputData, shape, dtype))
+    if err != nil {
+        return nil, err
+    }
+    return resp.firstOutput()
+}
+
+// InferTritonGRPCStub is the former name of InferTritonGRPC.
+//
+// Deprecated: use InferTritonGRPC.
 func InferTritonGRPCStub(ctx context.Context, conn *grpc.ClientConn, modelName, inputName string, inputData []byte, shape []int, dtype string) ([]byte, error) {
-    // PSEUDO-CODE (replace with generated types):
-    // client := tritonpb.NewGRPCInferenceServiceClient(conn)
-    // req := &tritonpb.InferRequest{ ModelName: modelName, /* build inputs using ModelInferRequest_InferInputTensor etc. */ }
-    // resp, err := client.Infer(ctx, req)
-    // if err != nil { return nil, err }
-    // // extract raw bytes from resp outputs and return
-
-    return nil, fmt.Errorf("InferTritonGRPCStub: implement using generated Triton proto types as documented in copilot-instructions.md")
+    return InferTritonGRPC(ctx, conn, modelName, inputName, inputData, shape, dtype)
+}
+
+// registerTritonGRPCSharedMemory registers r with the system shared-memory
+// extension.
+func registerTritonGRPCSharedMemory(ctx context.Context, conn *grpc.ClientConn, r *SharedMemoryRegion) error {
+    req := &systemSharedMemoryRegisterRequest{Name: r.Name, Key: r.Key, ByteSize: uint64(r.Size)}
+    return conn.Invoke(ctx, tritonSharedMemoryRegisterMethod, req, &emptyResponse{}, grpc.ForceCodec(tritonCodec{}))
+}
+
+// unregisterTritonGRPCSharedMemory unregisters the region name.
+func unregisterTritonGRPCSharedMemory(ctx context.Context, conn *grpc.ClientConn, name string) error {
+    req := &systemSharedMemoryUnregisterRequest{Name: name}
+    return conn.Invoke(ctx, tritonSharedMemoryUnregisterMethod, req, &emptyResponse{}, grpc.ForceCodec(tritonCodec{}))
+}
+
+// inferSharedMemory runs one request with the input and output in shared
+// memory, unary or streamed.
+func (t *TritonGRPCBackend) inferSharedMemory(ctx context.Context, conn *grpc.ClientConn, payload []byte, shape []int) ([]byte, error) {
+    pool, err := t.sharedMemory(conn)
+    if err != nil {
+        return nil, err
+    }
+    pair, err := pool.get(ctx, len(payload))
+    if err != nil {
+        return nil, fmt.Errorf("triton grpc: %w", err)
+    }
+    out, err := t.inferPair(ctx, conn, pair, payload, shape)
+    pool.put(pair, err == nil)
+    return out, err
+}
+
+func (t *TritonGRPCBackend) inferPair(ctx context.Context, conn *grpc.ClientConn, pair *shmPair, payload []byte, shape []int) ([]byte, error) {
+    outputName := t.Options.SharedMemory.OutputName
+    req := &modelInferRequest{
+        ModelName: t.Model,
+        Inputs: []inferInputTensor{{
+            Name:       t.InputName,
+            Datatype:   t.DType,
+            Shape:      IntsToInt64s(shape),
+            Parameters: pair.write(payload),
+        }},
+        Outputs: []inferRequestedOutput{{Name: outputName, Parameters: pair.outputParameters()}},
+    }
+    resp, err := t.infer(ctx, conn, req)
+    if err != nil {
+        return nil, err
+    }
+    for _, out := range resp.Outputs {
+        if out.Name == outputName {
+            return pair.read(out.Parameters)
+        }
+    }
+    return nil, fmt.Errorf("triton grpc: output %q missing from response", outputName)
+}
+
+func (t *TritonGRPCBackend) sharedMemory(conn *grpc.ClientConn) (*shmPool, error) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.shm == nil {
+        pool, err := newSHMPool(*t.Options.SharedMemory,
+            func(ctx context.Context, r *SharedMemoryRegion) error {
+                return registerTritonGRPCSharedMemory(ctx, conn, r)
+            },
+            func(ctx context.Context, name string) error {
+                return unregisterTritonGRPCSharedMemory(ctx, conn, name)
+            })
+        if err != nil {
+            return nil, err
+        }
+        t.shm = pool
+    }
+    return t.shm, nil
 }
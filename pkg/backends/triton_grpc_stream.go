@@ -0,0 +1,192 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errStreamUnavailable reports that the server does not implement
+// ModelStreamInfer; the request was not processed and can be sent unary.
+var errStreamUnavailable = errors.New("triton grpc: streaming inference unavailable")
+
+// inferTritonGRPC performs a unary ModelInfer call.
+func inferTritonGRPC(ctx context.Context, conn *grpc.ClientConn, req *modelInferRequest) (*modelInferResponse, error) {
+	var resp modelInferResponse
+	if err := conn.Invoke(ctx, tritonModelInferMethod, req, &resp, grpc.ForceCodec(tritonCodec{})); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// inferStream sends req over the shared stream, opening a new one if there is
+// none or the previous one broke.
+func (t *TritonGRPCBackend) inferStream(ctx context.Context, conn *grpc.ClientConn, req *modelInferRequest) (*modelInferResponse, error) {
+	t.mu.Lock()
+	if t.noStream {
+		t.mu.Unlock()
+		return nil, errStreamUnavailable
+	}
+	if t.stream == nil || t.stream.broken() {
+		s, err := openTritonStream(conn)
+		if err != nil {
+			t.noStream = errors.Is(err, errStreamUnavailable)
+			t.mu.Unlock()
+			return nil, err
+		}
+		t.stream = s
+	}
+	s := t.stream
+	t.mu.Unlock()
+
+	req.ID = strconv.FormatUint(t.requestIDs.Add(1), 10)
+	resp, err := s.infer(ctx, req)
+	if errors.Is(err, errStreamUnavailable) {
+		t.mu.Lock()
+		t.noStream = true
+		t.mu.Unlock()
+	}
+	return resp, err
+}
+
+// tritonStream multiplexes requests over one ModelStreamInfer stream.
+// Responses may arrive in any order and are routed by request ID.
+type tritonStream struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan streamResult
+	err     error
+}
+
+// streamResult is the response to one streamed request.
+type streamResult struct {
+	resp *modelInferResponse
+	err  error
+}
+
+func openTritonStream(conn *grpc.ClientConn) (*tritonStream, error) {
+	// the stream outlives the request that opened it
+	ctx, cancel := context.WithCancel(context.Background())
+	desc := &grpc.StreamDesc{StreamName: "ModelStreamInfer", ServerStreams: true, ClientStreams: true}
+	cs, err := conn.NewStream(ctx, desc, tritonModelStreamInferMethod, grpc.ForceCodec(tritonCodec{}))
+	if err != nil {
+		cancel()
+		if status.Code(err) == codes.Unimplemented {
+			return nil, errStreamUnavailable
+		}
+		return nil, err
+	}
+	s := &tritonStream{stream: cs, cancel: cancel, pending: map[string]chan streamResult{}}
+	go s.receive()
+	return s, nil
+}
+
+func (s *tritonStream) infer(ctx context.Context, req *modelInferRequest) (*modelInferResponse, error) {
+	ch := make(chan streamResult, 1)
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	s.pending[req.ID] = ch
+	s.mu.Unlock()
+
+	s.sendMu.Lock()
+	err := s.stream.SendMsg(req)
+	s.sendMu.Unlock()
+	// io.EOF means the stream ended; receive reports why to every request
+	if err != nil && err != io.EOF {
+		s.forget(req.ID)
+		return nil, err
+	}
+
+	select {
+	case r := <-ch:
+		return r.resp, r.err
+	case <-ctx.Done():
+		s.forget(req.ID)
+		return nil, ctx.Err()
+	}
+}
+
+// receive routes responses to their requests until the stream fails.
+func (s *tritonStream) receive() {
+	for {
+		var resp modelStreamInferResponse
+		if err := s.stream.RecvMsg(&resp); err != nil {
+			if status.Code(err) == codes.Unimplemented {
+				err = errStreamUnavailable
+			} else if err == io.EOF {
+				err = fmt.Errorf("triton grpc: stream closed by server")
+			}
+			s.fail(err)
+			return
+		}
+		var id string
+		if resp.InferResponse != nil {
+			id = resp.InferResponse.ID
+		}
+		s.mu.Lock()
+		ch, ok := s.pending[id]
+		delete(s.pending, id)
+		s.mu.Unlock()
+		if !ok {
+			// cancelled request, or an error the server could not attribute
+			if id == "" && resp.ErrorMessage != "" {
+				s.fail(fmt.Errorf("triton grpc: %s", resp.ErrorMessage))
+				return
+			}
+			continue
+		}
+		if resp.ErrorMessage != "" {
+			ch <- streamResult{err: fmt.Errorf("triton grpc: %s", resp.ErrorMessage)}
+			continue
+		}
+		ch <- streamResult{resp: resp.InferResponse}
+	}
+}
+
+// fail ends the stream and reports err to every pending request.
+func (s *tritonStream) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	pending := s.pending
+	s.pending = map[string]chan streamResult{}
+	s.mu.Unlock()
+	for _, ch := range pending {
+		ch <- streamResult{err: err}
+	}
+	s.cancel()
+}
+
+func (s *tritonStream) forget(id string) {
+	s.mu.Lock()
+	delete(s.pending, id)
+	s.mu.Unlock()
+}
+
+func (s *tritonStream) broken() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err != nil
+}
+
+func (s *tritonStream) close() {
+	s.sendMu.Lock()
+	s.stream.CloseSend()
+	s.sendMu.Unlock()
+	s.fail(ErrClosed)
+}
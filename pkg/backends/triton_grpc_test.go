@@ -0,0 +1,333 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeTriton implements ModelInfer and, optionally, ModelStreamInfer. Each
+// output byte is the input byte plus one; a first input byte of 0xff fails
+// the request and other values delay the response by that many milliseconds,
+// so streamed responses can be made to arrive out of order. With echo set
+// the input is returned unchanged. Inputs and outputs may also be passed in
+// shared memory registered with shm.
+type fakeTriton struct {
+	noStream bool
+	echo     bool
+	unary    atomic.Int32
+	streams  atomic.Int32
+	streamed atomic.Int32
+	raw      atomic.Int32
+	shm      fakeSHM
+}
+
+func (f *fakeTriton) infer(req *modelInferRequest) (*modelInferResponse, error) {
+	shm := req.Inputs[0].Parameters["shared_memory_region"] != nil
+	var in []byte
+	if shm {
+		var err error
+		if in, err = f.shm.read(req.Inputs[0].Parameters); err != nil {
+			return nil, err
+		}
+	} else {
+		f.raw.Add(1)
+		in = req.RawInputContents[0]
+	}
+	out := make([]byte, len(in))
+	switch {
+	case f.echo:
+		copy(out, in)
+	case len(in) > 0 && in[0] == 0xff:
+		return nil, errors.New("bad frame")
+	default:
+		if len(in) > 0 {
+			time.Sleep(time.Duration(in[0]) * time.Millisecond)
+		}
+		for i, b := range in {
+			out[i] = b + 1
+		}
+	}
+	resp := &modelInferResponse{
+		ModelName: req.ModelName,
+		ID:        req.ID,
+		Outputs:   []inferOutputTensor{{Name: "mask", Datatype: req.Inputs[0].Datatype, Shape: req.Inputs[0].Shape}},
+	}
+	if !shm {
+		resp.RawOutputContents = [][]byte{out}
+		return resp, nil
+	}
+	params, err := f.shm.write(req.Outputs[0].Parameters, out)
+	if err != nil {
+		return nil, err
+	}
+	resp.Outputs[0].Parameters = params
+	return resp, nil
+}
+
+func (f *fakeTriton) register(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	var req systemSharedMemoryRegisterRequest
+	if err := dec(&req); err != nil {
+		return nil, err
+	}
+	return &emptyResponse{}, f.shm.register(req.Name, req.Key, int(req.ByteSize))
+}
+
+func (f *fakeTriton) unregister(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	var req systemSharedMemoryUnregisterRequest
+	if err := dec(&req); err != nil {
+		return nil, err
+	}
+	f.shm.unregister(req.Name)
+	return &emptyResponse{}, nil
+}
+
+func (f *fakeTriton) modelInfer(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	var req modelInferRequest
+	if err := dec(&req); err != nil {
+		return nil, err
+	}
+	f.unary.Add(1)
+	return f.infer(&req)
+}
+
+func (f *fakeTriton) modelStreamInfer(srv interface{}, stream grpc.ServerStream) error {
+	f.streams.Add(1)
+	var sendMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var req modelInferRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		f.streamed.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := &modelStreamInferResponse{}
+			r, err := f.infer(&req)
+			if err != nil {
+				resp.ErrorMessage = err.Error()
+				r = &modelInferResponse{ID: req.ID}
+			}
+			resp.InferResponse = r
+			sendMu.Lock()
+			defer sendMu.Unlock()
+			stream.SendMsg(resp)
+		}()
+	}
+}
+
+// startFakeTriton serves f on a local port and returns its address.
+func startFakeTriton(t *testing.T, f *fakeTriton) string {
+	t.Helper()
+	desc := grpc.ServiceDesc{
+		ServiceName: "inference.GRPCInferenceService",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "ModelInfer", Handler: f.modelInfer},
+			{MethodName: "SystemSharedMemoryRegister", Handler: f.register},
+			{MethodName: "SystemSharedMemoryUnregister", Handler: f.unregister},
+		},
+	}
+	if !f.noStream {
+		desc.Streams = []grpc.StreamDesc{{StreamName: "ModelStreamInfer", Handler: f.modelStreamInfer, ServerStreams: true, ClientStreams: true}}
+	}
+	srv := grpc.NewServer(grpc.ForceServerCodec(tritonCodec{}))
+	srv.RegisterService(&desc, f)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	return ln.Addr().String()
+}
+
+func TestTritonGRPCBackendUnary(t *testing.T) {
+	f := &fakeTriton{}
+	b := NewTritonGRPCBackend(startFakeTriton(t, f), "u2net", "INPUT__0", []int{3}, "UINT8")
+	defer b.Close()
+	for i := 0; i < 2; i++ {
+		got, err := b.Infer(context.Background(), []byte{0, 1, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "\x01\x02\x03" {
+			t.Fatalf("got %v", got)
+		}
+	}
+	if f.unary.Load() != 2 || f.streams.Load() != 0 {
+		t.Fatalf("unary=%d streams=%d", f.unary.Load(), f.streams.Load())
+	}
+}
+
+func TestTritonGRPCBackendStreaming(t *testing.T) {
+	f := &fakeTriton{}
+	b := NewTritonGRPCBackend(startFakeTriton(t, f), "u2net", "INPUT__0", []int{1}, "UINT8")
+	b.Streaming = true
+	defer b.Close()
+
+	// earlier frames answer later, so responses arrive out of order
+	const n = 10
+	frames := make(chan []byte, n)
+	for i := 0; i < n; i++ {
+		frames <- []byte{byte(2 * (n - i))}
+	}
+	close(frames)
+	i := 0
+	for r := range InferPipeline(context.Background(), b, frames, n) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if want := byte(2*(n-i)) + 1; len(r.Data) != 1 || r.Data[0] != want {
+			t.Fatalf("result %d = %v, want [%d]", i, r.Data, want)
+		}
+		i++
+	}
+	if i != n {
+		t.Fatalf("got %d results, want %d", i, n)
+	}
+
+	if _, err := b.Infer(context.Background(), []byte{0xff}); err == nil {
+		t.Fatal("expected the streamed error response")
+	}
+	if _, err := b.Infer(context.Background(), []byte{0}); err != nil {
+		t.Fatalf("stream unusable after an error response: %v", err)
+	}
+	if f.streams.Load() != 1 || f.streamed.Load() != n+2 || f.unary.Load() != 0 {
+		t.Fatalf("streams=%d streamed=%d unary=%d", f.streams.Load(), f.streamed.Load(), f.unary.Load())
+	}
+}
+
+func TestTritonGRPCBackendStreamingFallback(t *testing.T) {
+	f := &fakeTriton{noStream: true}
+	b := NewTritonGRPCBackend(startFakeTriton(t, f), "u2net", "INPUT__0", []int{1}, "UINT8")
+	b.Streaming = true
+	defer b.Close()
+	for i := 0; i < 3; i++ {
+		got, err := b.Infer(context.Background(), []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0] != byte(i)+1 {
+			t.Fatalf("got %v", got)
+		}
+	}
+	if f.unary.Load() != 3 {
+		t.Fatalf("unary=%d, want 3", f.unary.Load())
+	}
+}
+
+func TestTritonGRPCBackendChecksInputSize(t *testing.T) {
+	f := &fakeTriton{}
+	b := NewTritonGRPCBackend(startFakeTriton(t, f), "u2net", "INPUT__0", []int{1, 2}, "FP16")
+	defer b.Close()
+	if _, err := b.Infer(context.Background(), []byte{0, 1}); err == nil {
+		t.Fatal("expected an input size error")
+	}
+	if _, err := b.Infer(context.Background(), []byte{0, 0x3c, 0, 0x3c}); err != nil {
+		t.Fatal(err)
+	}
+	if f.unary.Load() != 1 {
+		t.Fatalf("unary=%d, want the short input rejected before sending", f.unary.Load())
+	}
+}
+
+func TestTritonGRPCBackendBytes(t *testing.T) {
+	f := &fakeTriton{echo: true}
+	b, err := Open("triton+grpc://" + startFakeTriton(t, f) + "/u2net_ensemble?input=IMAGE&dtype=BYTES&decoder=bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := b.(*TritonGRPCBackend)
+	defer g.Close()
+	if len(g.Shape) != 1 || g.Shape[0] != 1 {
+		t.Fatalf("shape = %v, want [1]", g.Shape)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	got, err := g.Infer(context.Background(), buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, buf.Bytes()) {
+		t.Fatalf("got %d bytes, want the %d byte PNG back", len(got), buf.Len())
+	}
+	if f.raw.Load() != 1 {
+		t.Fatalf("raw=%d, want 1", f.raw.Load())
+	}
+}
+
+func TestTritonGRPCBackendPreprocess(t *testing.T) {
+	f := &fakeTriton{echo: true}
+	b, err := Open("triton+grpc://" + startFakeTriton(t, f) + "/u2net?shape=1,3,2,2&dtype=UINT8&preprocess=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := b.(*TritonGRPCBackend)
+	defer g.Close()
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.NRGBA{R: 255, B: 128, A: 255}}, image.Point{}, draw.Src)
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	got, err := g.Infer(context.Background(), buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{255, 255, 255, 255, 0, 0, 0, 0, 128, 128, 128, 128}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %v, want the resized RGB planes %v", got, want)
+	}
+	if _, err := g.Infer(context.Background(), []byte("not an image")); err == nil {
+		t.Fatal("expected a decode error")
+	}
+}
+
+func TestModelInferResponseTypedContents(t *testing.T) {
+	var contents []byte
+	for _, v := range []float32{0.25, 1} {
+		contents = protowire.AppendTag(contents, 6, protowire.Fixed32Type)
+		contents = protowire.AppendFixed32(contents, math.Float32bits(v))
+	}
+	var out []byte
+	out = appendString(out, 1, "mask")
+	out = appendString(out, 2, "FP32")
+	out = appendPackedInt64s(out, 3, []int64{2})
+	out = appendMessage(out, 5, contents)
+	msg := appendMessage(appendString(nil, 3, "7"), 5, out)
+
+	var resp modelInferResponse
+	if err := resp.unmarshal(msg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := resp.firstOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals := BytesToFloat32s(got); resp.ID != "7" || len(vals) != 2 || vals[0] != 0.25 || vals[1] != 1 {
+		t.Fatalf("id %q, values %v", resp.ID, vals)
+	}
+}
@@ -0,0 +1,577 @@
+package backends
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// The messages below mirror the subset of Triton's grpc_service.proto
+// (package inference) used by the gRPC backend. They are encoded by hand
+// with protowire so the default build speaks the protocol without generated
+// code; field numbers follow the .proto file.
+
+const (
+	tritonModelInferMethod       = "/inference.GRPCInferenceService/ModelInfer"
+	tritonModelStreamInferMethod = "/inference.GRPCInferenceService/ModelStreamInfer"
+
+	tritonSharedMemoryRegisterMethod   = "/inference.GRPCInferenceService/SystemSharedMemoryRegister"
+	tritonSharedMemoryUnregisterMethod = "/inference.GRPCInferenceService/SystemSharedMemoryUnregister"
+)
+
+// tritonCodec marshals the hand-written messages. It is registered under the
+// "proto" name so requests carry the usual application/grpc+proto type.
+type tritonCodec struct{}
+
+type wireMessage interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+func (tritonCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("triton codec: cannot marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (tritonCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("triton codec: cannot unmarshal into %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (tritonCodec) Name() string { return "proto" }
+
+// modelInferRequest is inference.ModelInferRequest.
+type modelInferRequest struct {
+	ModelName        string                 // 1
+	ModelVersion     string                 // 2
+	ID               string                 // 3
+	Parameters       map[string]interface{} // 4
+	Inputs           []inferInputTensor     // 5
+	Outputs          []inferRequestedOutput // 6
+	RawInputContents [][]byte               // 7
+}
+
+// inferInputTensor is ModelInferRequest.InferInputTensor; contents are
+// always sent as raw_input_contents.
+type inferInputTensor struct {
+	Name       string                 // 1
+	Datatype   string                 // 2
+	Shape      []int64                // 3
+	Parameters map[string]interface{} // 4
+}
+
+// inferRequestedOutput is ModelInferRequest.InferRequestedOutputTensor.
+type inferRequestedOutput struct {
+	Name       string                 // 1
+	Parameters map[string]interface{} // 2
+}
+
+// modelInferResponse is inference.ModelInferResponse.
+type modelInferResponse struct {
+	ModelName         string                 // 1
+	ModelVersion      string                 // 2
+	ID                string                 // 3
+	Parameters        map[string]interface{} // 4
+	Outputs           []inferOutputTensor    // 5
+	RawOutputContents [][]byte               // 6
+}
+
+// inferOutputTensor is ModelInferResponse.InferOutputTensor. Contents holds
+// typed InferTensorContents converted to little-endian bytes.
+type inferOutputTensor struct {
+	Name       string                 // 1
+	Datatype   string                 // 2
+	Shape      []int64                // 3
+	Parameters map[string]interface{} // 4
+	Contents   []byte                 // 5
+}
+
+// modelStreamInferResponse is inference.ModelStreamInferResponse.
+type modelStreamInferResponse struct {
+	ErrorMessage  string              // 1
+	InferResponse *modelInferResponse // 2
+}
+
+// systemSharedMemoryRegisterRequest is
+// inference.SystemSharedMemoryRegisterRequest.
+type systemSharedMemoryRegisterRequest struct {
+	Name     string // 1
+	Key      string // 2
+	Offset   uint64 // 3
+	ByteSize uint64 // 4
+}
+
+// systemSharedMemoryUnregisterRequest is
+// inference.SystemSharedMemoryUnregisterRequest.
+type systemSharedMemoryUnregisterRequest struct {
+	Name string // 1
+}
+
+// emptyResponse stands for the field-less register and unregister responses.
+type emptyResponse struct{}
+
+// newModelInferRequest builds a request for a single input sent as raw contents.
+func newModelInferRequest(model, inputName string, data []byte, shape []int, dtype string) *modelInferRequest {
+	return &modelInferRequest{
+		ModelName:        model,
+		Inputs:           []inferInputTensor{{Name: inputName, Datatype: dtype, Shape: IntsToInt64s(shape)}},
+		RawInputContents: [][]byte{data},
+	}
+}
+
+// firstOutput returns the contents of the first output, raw or typed.
+func (r *modelInferResponse) firstOutput() ([]byte, error) {
+	if len(r.Outputs) == 0 {
+		return nil, fmt.Errorf("no outputs from Triton")
+	}
+	if len(r.RawOutputContents) > 0 {
+		return r.RawOutputContents[0], nil
+	}
+	return r.Outputs[0].Contents, nil
+}
+
+func (r *modelInferRequest) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.ModelName)
+	b = appendString(b, 2, r.ModelVersion)
+	b = appendString(b, 3, r.ID)
+	b = appendParameters(b, 4, r.Parameters)
+	for _, in := range r.Inputs {
+		var m []byte
+		m = appendString(m, 1, in.Name)
+		m = appendString(m, 2, in.Datatype)
+		m = appendPackedInt64s(m, 3, in.Shape)
+		m = appendParameters(m, 4, in.Parameters)
+		b = appendMessage(b, 5, m)
+	}
+	for _, out := range r.Outputs {
+		var m []byte
+		m = appendString(m, 1, out.Name)
+		m = appendParameters(m, 2, out.Parameters)
+		b = appendMessage(b, 6, m)
+	}
+	for _, raw := range r.RawInputContents {
+		b = appendMessage(b, 7, raw)
+	}
+	return b
+}
+
+func (r *modelInferRequest) unmarshal(b []byte) error {
+	*r = modelInferRequest{}
+	return eachWireField(b, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+		switch num {
+		case 1:
+			r.ModelName = string(buf)
+		case 2:
+			r.ModelVersion = string(buf)
+		case 3:
+			r.ID = string(buf)
+		case 4:
+			return decodeParameter(buf, &r.Parameters)
+		case 5:
+			var in inferInputTensor
+			err := eachWireField(buf, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+				switch num {
+				case 1:
+					in.Name = string(buf)
+				case 2:
+					in.Datatype = string(buf)
+				case 3:
+					return appendInt64Field(&in.Shape, typ, v, buf)
+				case 4:
+					return decodeParameter(buf, &in.Parameters)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Inputs = append(r.Inputs, in)
+		case 6:
+			var out inferRequestedOutput
+			err := eachWireField(buf, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+				switch num {
+				case 1:
+					out.Name = string(buf)
+				case 2:
+					return decodeParameter(buf, &out.Parameters)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Outputs = append(r.Outputs, out)
+		case 7:
+			r.RawInputContents = append(r.RawInputContents, append([]byte(nil), buf...))
+		}
+		return nil
+	})
+}
+
+func (r *modelInferResponse) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.ModelName)
+	b = appendString(b, 2, r.ModelVersion)
+	b = appendString(b, 3, r.ID)
+	b = appendParameters(b, 4, r.Parameters)
+	for _, out := range r.Outputs {
+		var m []byte
+		m = appendString(m, 1, out.Name)
+		m = appendString(m, 2, out.Datatype)
+		m = appendPackedInt64s(m, 3, out.Shape)
+		m = appendParameters(m, 4, out.Parameters)
+		b = appendMessage(b, 5, m)
+	}
+	for _, raw := range r.RawOutputContents {
+		b = appendMessage(b, 6, raw)
+	}
+	return b
+}
+
+func (r *modelInferResponse) unmarshal(b []byte) error {
+	*r = modelInferResponse{}
+	return eachWireField(b, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+		switch num {
+		case 1:
+			r.ModelName = string(buf)
+		case 2:
+			r.ModelVersion = string(buf)
+		case 3:
+			r.ID = string(buf)
+		case 4:
+			return decodeParameter(buf, &r.Parameters)
+		case 5:
+			var out inferOutputTensor
+			var contents []byte
+			err := eachWireField(buf, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+				switch num {
+				case 1:
+					out.Name = string(buf)
+				case 2:
+					out.Datatype = string(buf)
+				case 3:
+					return appendInt64Field(&out.Shape, typ, v, buf)
+				case 4:
+					return decodeParameter(buf, &out.Parameters)
+				case 5:
+					contents = buf
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if contents != nil {
+				if out.Contents, err = decodeTensorContents(contents, out.Datatype); err != nil {
+					return fmt.Errorf("output %q: %w", out.Name, err)
+				}
+			}
+			r.Outputs = append(r.Outputs, out)
+		case 6:
+			r.RawOutputContents = append(r.RawOutputContents, append([]byte(nil), buf...))
+		}
+		return nil
+	})
+}
+
+func (r *modelStreamInferResponse) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.ErrorMessage)
+	if r.InferResponse != nil {
+		b = appendMessage(b, 2, r.InferResponse.marshal())
+	}
+	return b
+}
+
+func (r *modelStreamInferResponse) unmarshal(b []byte) error {
+	*r = modelStreamInferResponse{}
+	return eachWireField(b, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+		switch num {
+		case 1:
+			r.ErrorMessage = string(buf)
+		case 2:
+			r.InferResponse = &modelInferResponse{}
+			return r.InferResponse.unmarshal(buf)
+		}
+		return nil
+	})
+}
+
+func (r *systemSharedMemoryRegisterRequest) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.Name)
+	b = appendString(b, 2, r.Key)
+	if r.Offset != 0 {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, r.Offset)
+	}
+	if r.ByteSize != 0 {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, r.ByteSize)
+	}
+	return b
+}
+
+func (r *systemSharedMemoryRegisterRequest) unmarshal(b []byte) error {
+	*r = systemSharedMemoryRegisterRequest{}
+	return eachWireField(b, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+		switch num {
+		case 1:
+			r.Name = string(buf)
+		case 2:
+			r.Key = string(buf)
+		case 3:
+			r.Offset = v
+		case 4:
+			r.ByteSize = v
+		}
+		return nil
+	})
+}
+
+func (r *systemSharedMemoryUnregisterRequest) marshal() []byte {
+	return appendString(nil, 1, r.Name)
+}
+
+func (r *systemSharedMemoryUnregisterRequest) unmarshal(b []byte) error {
+	*r = systemSharedMemoryUnregisterRequest{}
+	return eachWireField(b, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+		if num == 1 {
+			r.Name = string(buf)
+		}
+		return nil
+	})
+}
+
+func (*emptyResponse) marshal() []byte { return nil }
+
+func (*emptyResponse) unmarshal([]byte) error { return nil }
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+func appendPackedInt64s(b []byte, num protowire.Number, values []int64) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, v := range values {
+		packed = protowire.AppendVarint(packed, uint64(v))
+	}
+	return appendMessage(b, num, packed)
+}
+
+// appendParameters encodes a map<string, InferParameter> field. Values may be
+// bool, int, int64, uint64, float64 or string.
+func appendParameters(b []byte, num protowire.Number, params map[string]interface{}) []byte {
+	for _, k := range sortedKeys(params) {
+		var p []byte
+		switch v := params[k].(type) {
+		case bool:
+			p = protowire.AppendTag(p, 1, protowire.VarintType)
+			p = protowire.AppendVarint(p, protowire.EncodeBool(v))
+		case int:
+			p = protowire.AppendTag(p, 2, protowire.VarintType)
+			p = protowire.AppendVarint(p, uint64(v))
+		case int64:
+			p = protowire.AppendTag(p, 2, protowire.VarintType)
+			p = protowire.AppendVarint(p, uint64(v))
+		case string:
+			p = appendMessage(p, 3, []byte(v))
+		case float64:
+			p = protowire.AppendTag(p, 4, protowire.Fixed64Type)
+			p = protowire.AppendFixed64(p, math.Float64bits(v))
+		case uint64:
+			p = protowire.AppendTag(p, 5, protowire.VarintType)
+			p = protowire.AppendVarint(p, v)
+		default:
+			continue
+		}
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendMessage(entry, 2, p)
+		b = appendMessage(b, num, entry)
+	}
+	return b
+}
+
+// decodeParameter adds one map<string, InferParameter> entry to params.
+func decodeParameter(entry []byte, params *map[string]interface{}) error {
+	var key string
+	var value interface{}
+	err := eachWireField(entry, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+		switch num {
+		case 1:
+			key = string(buf)
+		case 2:
+			return eachWireField(buf, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+				switch num {
+				case 1:
+					value = protowire.DecodeBool(v)
+				case 2:
+					value = int64(v)
+				case 3:
+					value = string(buf)
+				case 4:
+					value = math.Float64frombits(v)
+				case 5:
+					value = v
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *params == nil {
+		*params = map[string]interface{}{}
+	}
+	(*params)[key] = value
+	return nil
+}
+
+// decodeTensorContents converts InferTensorContents to the little-endian
+// layout of raw contents for datatype.
+func decodeTensorContents(b []byte, datatype string) ([]byte, error) {
+	size := 0
+	if dt, err := onnx.DataTypeFromTriton(datatype); err == nil {
+		size = dt.Size()
+	}
+	var out []byte
+	put := func(v uint64, n int) {
+		if size > 0 && size < n {
+			n = size
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], v)
+		out = append(out, buf[:n]...)
+	}
+	err := eachWireField(b, func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error {
+		var values []int64
+		switch num {
+		case 1, 2, 3, 4, 5: // bool, int, int64, uint, uint64
+			if err := appendInt64Field(&values, typ, v, buf); err != nil {
+				return err
+			}
+			n := map[protowire.Number]int{1: 1, 2: 4, 3: 8, 4: 4, 5: 8}[num]
+			for _, x := range values {
+				put(uint64(x), n)
+			}
+		case 6: // fp32
+			for _, x := range fixedValues(typ, v, buf, 4) {
+				put(x, 4)
+			}
+		case 7: // fp64
+			for _, x := range fixedValues(typ, v, buf, 8) {
+				put(x, 8)
+			}
+		case 8: // bytes, in the raw BYTES layout
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(buf)))
+			out = append(out, buf...)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// appendInt64Field appends a packed or unpacked varint field to values.
+func appendInt64Field(values *[]int64, typ protowire.Type, v uint64, buf []byte) error {
+	if typ == protowire.VarintType {
+		*values = append(*values, int64(v))
+		return nil
+	}
+	for len(buf) > 0 {
+		x, n := protowire.ConsumeVarint(buf)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		*values = append(*values, int64(x))
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// fixedValues returns the packed or unpacked fixed-width values of a field.
+func fixedValues(typ protowire.Type, v uint64, buf []byte, width int) []uint64 {
+	if typ != protowire.BytesType {
+		return []uint64{v}
+	}
+	out := make([]uint64, 0, len(buf)/width)
+	for ; len(buf) >= width; buf = buf[width:] {
+		if width == 4 {
+			out = append(out, uint64(binary.LittleEndian.Uint32(buf)))
+		} else {
+			out = append(out, binary.LittleEndian.Uint64(buf))
+		}
+	}
+	return out
+}
+
+// eachWireField calls fn for every field of the message in b with its
+// scalar value or its length-delimited bytes.
+func eachWireField(b []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, buf []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v uint64
+		var buf []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var x uint32
+			x, n = protowire.ConsumeFixed32(b)
+			v = uint64(x)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			buf, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
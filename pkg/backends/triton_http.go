@@ -7,45 +7,199 @@ import (
     "fmt"
     "io"
     "net/http"
+    "strings"
+
+    "github.com/unrealandychan/rembg-go/pkg/tracing"
 )
 
-// TritonInferRequest is a minimal struct for /v2/models/{model}/infer HTTP body.
-type TritonInferRequest struct {
-    Inputs []map[string]interface{} `json:"inputs"`
+// HTTPStatusError is returned by HTTP backends when the server answers with a non-200 status.
+type HTTPStatusError struct {
+    StatusCode int
+    Status     string
+    Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Status, e.Body)
 }
 
 // InferTritonHTTP sends an HTTP inference request to Triton V2 HTTP API. It currently wraps a single raw input.
+// inputData holds the little-endian tensor contents and is sent with the
+// binary tensor data extension; the contents of the first output are returned.
 func InferTritonHTTP(ctx context.Context, addr, modelName, inputName string, inputData []byte, shape []int, dtype string) ([]byte, error) {
-    url := fmt.Sprintf("http://%s/v2/models/%s/infer", addr, modelName)
+    return InferTritonHTTPWithOptions(ctx, addr, modelName, inputName, inputData, shape, dtype, TritonOptions{})
+}
 
-    inp := map[string]interface{}{
-        "name": inputName,
-        "shape": shape,
-        "datatype": dtype,
-        // Triton accepts "data" for JSON-encoded array, or "raw_input" alternative; here we use "data" with base64 not implemented.
-        "data": []interface{}{},
+// InferTritonHTTPWithOptions is InferTritonHTTP using https when opts.TLS is
+// set, sending opts.Headers and the bearer token, and using opts.Client. addr
+// may also be a base URL such as "https://gateway/triton".
+func InferTritonHTTPWithOptions(ctx context.Context, addr, modelName, inputName string, inputData []byte, shape []int, dtype string, opts TritonOptions) ([]byte, error) {
+    reqObj := TritonInferRequest{
+        Inputs: []TritonTensor{{
+            Name:       inputName,
+            Shape:      IntsToInt64s(shape),
+            Datatype:   dtype,
+            Parameters: map[string]interface{}{"binary_data_size": len(inputData)},
+        }},
+        Parameters: map[string]interface{}{"binary_data_output": true},
     }
-
-    reqObj := TritonInferRequest{Inputs: []map[string]interface{}{inp}}
-    body, err := json.Marshal(reqObj)
+    inferResp, contents, err := tritonHTTPInfer(ctx, addr, modelName, reqObj, opts, inputData)
     if err != nil {
         return nil, err
     }
+    if len(inferResp.Outputs) == 0 {
+        return nil, fmt.Errorf("no outputs from Triton")
+    }
+    return contents[0], nil
+}
 
-    req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+// tritonHTTPInfer posts reqObj followed by the binary chunks, if any, to the
+// infer endpoint and returns the response with the contents of each output.
+func tritonHTTPInfer(ctx context.Context, addr, modelName string, reqObj TritonInferRequest, opts TritonOptions, chunks ...[]byte) (TritonInferResponse, [][]byte, error) {
+    var inferResp TritonInferResponse
+    body, headerLen, err := EncodeInferBody(reqObj, chunks...)
     if err != nil {
-        return nil, err
+        return inferResp, nil, err
+    }
+    if len(chunks) == 0 {
+        headerLen = ""
+    }
+    respBody, respHeader, err := tritonHTTPPost(ctx, addr, "/v2/models/"+modelName+"/infer", body, headerLen, opts)
+    if err != nil {
+        return inferResp, nil, fmt.Errorf("triton infer failed: %w", err)
+    }
+    header, data, err := SplitInferBody(respBody, respHeader.Get(InferHeaderContentLength))
+    if err != nil {
+        return inferResp, nil, err
     }
-    req.Header.Set("Content-Type", "application/json")
+    if err := json.Unmarshal(header, &inferResp); err != nil {
+        return inferResp, nil, fmt.Errorf("decode triton response: %w", err)
+    }
+    contents, err := TensorContents(inferResp.Outputs, data)
+    if err != nil {
+        return inferResp, nil, fmt.Errorf("decode triton response: %w", err)
+    }
+    return inferResp, contents, nil
+}
 
-    resp, err := http.DefaultClient.Do(req)
+// tritonHTTPPost posts body to path on the server at addr. headerLen, when
+// set, is sent as InferHeaderContentLength. Non-200 responses are returned as
+// *HTTPStatusError.
+func tritonHTTPPost(ctx context.Context, addr, path string, body []byte, headerLen string, opts TritonOptions) ([]byte, http.Header, error) {
+    base := addr
+    if !strings.Contains(addr, "://") {
+        scheme := "http"
+        if opts.TLS != nil {
+            scheme = "https"
+        }
+        base = scheme + "://" + addr
+    }
+    client, err := opts.httpClient()
     if err != nil {
-        return nil, err
+        return nil, nil, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(base, "/")+path, bytes.NewReader(body))
+    if err != nil {
+        return nil, nil, err
+    }
+    if headerLen != "" {
+        req.Header.Set("Content-Type", "application/octet-stream")
+        req.Header.Set(InferHeaderContentLength, headerLen)
+    } else {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    for k, v := range authHeaders(opts.Headers, opts.BearerToken) {
+        req.Header.Set(k, v)
+    }
+    tracing.InjectHTTP(ctx, req.Header)
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, nil, err
     }
     defer resp.Body.Close()
+    respBody, err := io.ReadAll(resp.Body)
     if resp.StatusCode != http.StatusOK {
-        b, _ := io.ReadAll(resp.Body)
-        return nil, fmt.Errorf("triton infer failed: %s: %s", resp.Status, string(b))
+        return nil, nil, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+    }
+    if err != nil {
+        return nil, nil, err
+    }
+    return respBody, resp.Header, nil
+}
+
+// registerTritonHTTPSharedMemory registers r with the system shared-memory
+// extension of the server at addr.
+func registerTritonHTTPSharedMemory(ctx context.Context, addr string, r *SharedMemoryRegion, opts TritonOptions) error {
+    body, err := json.Marshal(map[string]interface{}{"key": r.Key, "offset": 0, "byte_size": r.Size})
+    if err != nil {
+        return err
+    }
+    _, _, err = tritonHTTPPost(ctx, addr, "/v2/systemsharedmemory/region/"+r.Name+"/register", body, "", opts)
+    return err
+}
+
+// unregisterTritonHTTPSharedMemory unregisters the region name.
+func unregisterTritonHTTPSharedMemory(ctx context.Context, addr, name string, opts TritonOptions) error {
+    _, _, err := tritonHTTPPost(ctx, addr, "/v2/systemsharedmemory/region/"+name+"/unregister", nil, "", opts)
+    return err
+}
+
+// inferSharedMemory runs one request with the input and output in shared
+// memory.
+func (t *TritonHTTPBackend) inferSharedMemory(ctx context.Context, payload []byte, shape []int) ([]byte, error) {
+    pool, err := t.sharedMemory()
+    if err != nil {
+        return nil, err
+    }
+    pair, err := pool.get(ctx, len(payload))
+    if err != nil {
+        return nil, fmt.Errorf("triton http: %w", err)
+    }
+    out, err := t.inferPair(ctx, pair, payload, shape)
+    pool.put(pair, err == nil)
+    return out, err
+}
+
+func (t *TritonHTTPBackend) inferPair(ctx context.Context, pair *shmPair, payload []byte, shape []int) ([]byte, error) {
+    reqObj := TritonInferRequest{
+        Inputs: []TritonTensor{{
+            Name:       t.InputName,
+            Shape:      IntsToInt64s(shape),
+            Datatype:   t.DType,
+            Parameters: pair.write(payload),
+        }},
+        Outputs: []TritonTensor{{Name: t.Options.SharedMemory.OutputName, Parameters: pair.outputParameters()}},
+    }
+    inferResp, _, err := tritonHTTPInfer(ctx, t.Addr, t.Model, reqObj, t.Options)
+    if err != nil {
+        return nil, err
+    }
+    for _, out := range inferResp.Outputs {
+        if out.Name == t.Options.SharedMemory.OutputName {
+            return pair.read(out.Parameters)
+        }
+    }
+    return nil, fmt.Errorf("triton http: output %q missing from response", t.Options.SharedMemory.OutputName)
+}
+
+func (t *TritonHTTPBackend) sharedMemory() (*shmPool, error) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.shm == nil {
+        opts := t.Options
+        pool, err := newSHMPool(*opts.SharedMemory,
+            func(ctx context.Context, r *SharedMemoryRegion) error {
+                return registerTritonHTTPSharedMemory(ctx, t.Addr, r, opts)
+            },
+            func(ctx context.Context, name string) error {
+                return unregisterTritonHTTPSharedMemory(ctx, t.Addr, name, opts)
+            })
+        if err != nil {
+            return nil, err
+        }
+        t.shm = pool
     }
-    return io.ReadAll(resp.Body)
+    return t.shm, nil
 }
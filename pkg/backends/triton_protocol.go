@@ -0,0 +1,219 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+	"github.com/unrealandychan/rembg-go/pkg/tensor"
+)
+
+// InferHeaderContentLength is the header of the binary tensor data extension
+// giving the size of the JSON part of a request or response body; the binary
+// tensor data follows it.
+const InferHeaderContentLength = "Inference-Header-Content-Length"
+
+// TritonInferRequest is the body of a /v2/models/{model}/infer request.
+type TritonInferRequest struct {
+	ID         string                 `json:"id,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Inputs     []TritonTensor         `json:"inputs"`
+	Outputs    []TritonTensor         `json:"outputs,omitempty"`
+}
+
+// TritonInferResponse is the body of a successful infer response.
+type TritonInferResponse struct {
+	ModelName    string                 `json:"model_name"`
+	ModelVersion string                 `json:"model_version,omitempty"`
+	ID           string                 `json:"id,omitempty"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+	Outputs      []TritonTensor         `json:"outputs"`
+}
+
+// TritonTensor is an input or output tensor of the v2 inference protocol.
+// Data holds the row-major values when they are sent as JSON rather than as
+// binary data; requested outputs only carry Name and Parameters.
+type TritonTensor struct {
+	Name       string                 `json:"name"`
+	Shape      []int64                `json:"shape,omitempty"`
+	Datatype   string                 `json:"datatype,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Data       []interface{}          `json:"data,omitempty"`
+}
+
+// TritonTensorMetadata describes a model input or output.
+type TritonTensorMetadata struct {
+	Name     string  `json:"name"`
+	Datatype string  `json:"datatype"`
+	Shape    []int64 `json:"shape"`
+}
+
+// TritonModelMetadata is the body of a /v2/models/{model} response.
+type TritonModelMetadata struct {
+	Name     string                 `json:"name"`
+	Versions []string               `json:"versions,omitempty"`
+	Platform string                 `json:"platform"`
+	Inputs   []TritonTensorMetadata `json:"inputs"`
+	Outputs  []TritonTensorMetadata `json:"outputs"`
+}
+
+// TritonModelMetadataFromONNX describes an ONNX model in v2 protocol terms:
+// its runtime inputs and outputs with Triton datatypes and -1 for dynamic
+// dimensions. The KServe server reports it and the Triton exporter writes
+// config.pbtxt from it, so clients built with BackendURI match both.
+func TritonModelMetadataFromONNX(name string, m *onnx.Model) TritonModelMetadata {
+	meta := TritonModelMetadata{
+		Name:     name,
+		Versions: []string{"1"},
+		Platform: "onnxruntime_onnx",
+		Inputs:   []TritonTensorMetadata{},
+		Outputs:  []TritonTensorMetadata{},
+	}
+	for _, v := range m.Graph.RuntimeInputs() {
+		meta.Inputs = append(meta.Inputs, TritonTensorMetadata{Name: v.Name, Datatype: v.ElemType.TritonName(), Shape: v.Dims()})
+	}
+	for _, v := range m.Graph.Outputs {
+		meta.Outputs = append(meta.Outputs, TritonTensorMetadata{Name: v.Name, Datatype: v.ElemType.TritonName(), Shape: v.Dims()})
+	}
+	return meta
+}
+
+// BackendURI returns the backends.Open URI of a Triton backend for the
+// first input of the model served at addr, e.g.
+// "triton+grpc://localhost:8001/u2net?input=input.1&shape=1,3,320,320&dtype=FP32".
+// scheme is "triton+http" or "triton+grpc"; dynamic dimensions are sent as 1.
+func (m TritonModelMetadata) BackendURI(scheme, addr string) (string, error) {
+	if len(m.Inputs) == 0 {
+		return "", fmt.Errorf("model %q has no inputs", m.Name)
+	}
+	in := m.Inputs[0]
+	dims := make([]string, len(in.Shape))
+	for i, d := range in.Shape {
+		if d < 1 {
+			d = 1
+		}
+		dims[i] = strconv.FormatInt(d, 10)
+	}
+	q := url.Values{}
+	q.Set("input", in.Name)
+	q.Set("shape", strings.Join(dims, ","))
+	q.Set("dtype", in.Datatype)
+	u := url.URL{Scheme: scheme, Host: addr, Path: "/" + m.Name, RawQuery: q.Encode()}
+	return u.String(), nil
+}
+
+// BinaryDataSize returns the binary_data_size parameter of t, or -1 if the
+// tensor data is not sent as binary.
+func (t TritonTensor) BinaryDataSize() int {
+	if n, ok := intParameter(t.Parameters, "binary_data_size"); ok {
+		return n
+	}
+	return -1
+}
+
+// intParameter returns the integer parameter key as decoded from JSON or
+// protobuf.
+func intParameter(params map[string]interface{}, key string) (int, bool) {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case json.Number:
+		n, err := v.Int64()
+		if err == nil {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// EncodeInferBody serializes header followed by the binary chunks and returns
+// the body and the value of InferHeaderContentLength.
+func EncodeInferBody(header interface{}, chunks ...[]byte) ([]byte, string, error) {
+	body, err := json.Marshal(header)
+	if err != nil {
+		return nil, "", err
+	}
+	jsonLen := len(body)
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return body, strconv.Itoa(jsonLen), nil
+}
+
+// SplitInferBody separates the JSON header from the binary data of a body
+// using the InferHeaderContentLength value (empty for JSON-only bodies).
+func SplitInferBody(body []byte, headerLength string) (header, data []byte, err error) {
+	if headerLength == "" {
+		return body, nil, nil
+	}
+	n, err := strconv.Atoi(headerLength)
+	if err != nil || n < 0 || n > len(body) {
+		return nil, nil, fmt.Errorf("invalid %s %q for a %d byte body", InferHeaderContentLength, headerLength, len(body))
+	}
+	return body[:n], body[n:], nil
+}
+
+// TensorContents returns the little-endian contents of each tensor, taking
+// binary tensors in order from data and encoding JSON ones by datatype.
+func TensorContents(tensors []TritonTensor, data []byte) ([][]byte, error) {
+	out := make([][]byte, len(tensors))
+	for i, t := range tensors {
+		if size := t.BinaryDataSize(); size >= 0 {
+			if size > len(data) {
+				return nil, fmt.Errorf("tensor %q: binary_data_size %d exceeds the remaining %d bytes", t.Name, size, len(data))
+			}
+			out[i], data = data[:size], data[size:]
+			continue
+		}
+		b, err := encodeJSONData(t.Datatype, t.Data)
+		if err != nil {
+			return nil, fmt.Errorf("tensor %q: %w", t.Name, err)
+		}
+		out[i] = b
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%d unused bytes of binary tensor data", len(data))
+	}
+	return out, nil
+}
+
+// encodeJSONData converts JSON tensor values, flattening nested arrays, to
+// little-endian bytes of datatype.
+func encodeJSONData(datatype string, values []interface{}) ([]byte, error) {
+	var flat []float64
+	var walk func(v interface{}) error
+	walk = func(v interface{}) error {
+		switch x := v.(type) {
+		case []interface{}:
+			for _, e := range x {
+				if err := walk(e); err != nil {
+					return err
+				}
+			}
+		case float64:
+			flat = append(flat, x)
+		case bool:
+			if x {
+				flat = append(flat, 1)
+			} else {
+				flat = append(flat, 0)
+			}
+		default:
+			return fmt.Errorf("unsupported JSON value %T", v)
+		}
+		return nil
+	}
+	if err := walk(values); err != nil {
+		return nil, err
+	}
+	return tensor.Encode(datatype, flat)
+}
@@ -0,0 +1,399 @@
+package backends
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// TritonExportOptions configures ExportTritonModel.
+type TritonExportOptions struct {
+	// Name is the model name in the repository; the default is the file
+	// name of the ONNX model without its extension.
+	Name string
+	// Version is the version directory (default 1).
+	Version int
+	// MaxBatchSize enables batching along the first input dimension, which
+	// must then be dynamic (or 1 with MaxBatchSize 1). 0 disables batching
+	// and -1 picks 8 when the first dimension is dynamic and 0 otherwise.
+	MaxBatchSize int
+	// MaxQueueDelay and PreferredBatchSizes tune dynamic batching, which is
+	// enabled whenever MaxBatchSize > 0.
+	MaxQueueDelay       time.Duration
+	PreferredBatchSizes []int
+	// Instances is the number of model instances per device (default 1) and
+	// InstanceKind "gpu", "cpu" or "" to let Triton choose.
+	Instances    int
+	InstanceKind string
+	// Ensemble also writes a Python preprocessing model taking encoded
+	// images (BYTES input "IMAGE") and an ensemble "<name>_ensemble" that
+	// chains it with the model. Mean and Std normalise RGB values in [0,1]
+	// (default: the ImageNet values u2net was trained with).
+	Ensemble  bool
+	Mean, Std [3]float32
+}
+
+// TritonModelConfig is the subset of Triton's model configuration written to
+// config.pbtxt. Tensor dims exclude the batch dimension when MaxBatchSize > 0.
+type TritonModelConfig struct {
+	Name         string
+	Platform     string
+	Backend      string
+	MaxBatchSize int
+	Inputs       []TritonTensorMetadata
+	Outputs      []TritonTensorMetadata
+	// DynamicBatching is nil when dynamic batching is off.
+	DynamicBatching *TritonDynamicBatching
+	Instances       []TritonInstanceGroup
+	// Steps are the ensemble scheduling steps of an "ensemble" model.
+	Steps []TritonEnsembleStep
+}
+
+// TritonDynamicBatching is the dynamic_batching block of a model config.
+type TritonDynamicBatching struct {
+	PreferredBatchSizes []int
+	MaxQueueDelay       time.Duration
+}
+
+// TritonInstanceGroup is one instance_group entry; Kind is "KIND_GPU",
+// "KIND_CPU" or "" for the default.
+type TritonInstanceGroup struct {
+	Count int
+	Kind  string
+}
+
+// TritonEnsembleStep runs Model with its tensors mapped from and to ensemble
+// tensor names (model tensor name -> ensemble tensor name).
+type TritonEnsembleStep struct {
+	Model     string
+	InputMap  map[string]string
+	OutputMap map[string]string
+}
+
+// TritonModelConfigFromMetadata builds the model configuration for meta, as
+// reported by TritonModelMetadataFromONNX, with the batching and instance
+// options of opts.
+func TritonModelConfigFromMetadata(meta TritonModelMetadata, opts TritonExportOptions) (*TritonModelConfig, error) {
+	batch, err := exportBatchSize(meta, opts.MaxBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &TritonModelConfig{Name: meta.Name, Platform: meta.Platform, MaxBatchSize: batch}
+	for _, t := range []struct {
+		src []TritonTensorMetadata
+		dst *[]TritonTensorMetadata
+	}{{meta.Inputs, &cfg.Inputs}, {meta.Outputs, &cfg.Outputs}} {
+		for _, v := range t.src {
+			if v.Datatype == "" {
+				return nil, fmt.Errorf("tensor %q: datatype not supported by Triton", v.Name)
+			}
+			if batch > 0 {
+				if len(v.Shape) == 0 {
+					return nil, fmt.Errorf("tensor %q: batching needs a batch dimension", v.Name)
+				}
+				v.Shape = v.Shape[1:]
+			}
+			*t.dst = append(*t.dst, v)
+		}
+	}
+	if batch > 0 {
+		cfg.DynamicBatching = &TritonDynamicBatching{PreferredBatchSizes: opts.PreferredBatchSizes, MaxQueueDelay: opts.MaxQueueDelay}
+	}
+	group := TritonInstanceGroup{Count: opts.Instances}
+	if group.Count <= 0 {
+		group.Count = 1
+	}
+	switch strings.ToLower(opts.InstanceKind) {
+	case "":
+	case "gpu", "cpu":
+		group.Kind = "KIND_" + strings.ToUpper(opts.InstanceKind)
+	default:
+		return nil, fmt.Errorf("instance kind %q: want gpu or cpu", opts.InstanceKind)
+	}
+	cfg.Instances = []TritonInstanceGroup{group}
+	return cfg, nil
+}
+
+// exportBatchSize resolves the MaxBatchSize option against the model's first
+// input dimensions.
+func exportBatchSize(meta TritonModelMetadata, requested int) (int, error) {
+	dynamic, fixedOne := true, true
+	for _, v := range append(append([]TritonTensorMetadata(nil), meta.Inputs...), meta.Outputs...) {
+		if len(v.Shape) == 0 {
+			dynamic, fixedOne = false, false
+			break
+		}
+		dynamic = dynamic && v.Shape[0] == -1
+		fixedOne = fixedOne && v.Shape[0] == 1
+	}
+	switch {
+	case requested < 0:
+		if dynamic {
+			return 8, nil
+		}
+		return 0, nil
+	case requested == 0 || dynamic || (requested == 1 && fixedOne):
+		return requested, nil
+	default:
+		return 0, fmt.Errorf("model %q: max batch size %d needs a dynamic first dimension on every input and output", meta.Name, requested)
+	}
+}
+
+// tritonConfigType maps a v2 datatype to the data_type of a model config.
+func tritonConfigType(datatype string) string {
+	if datatype == "BYTES" {
+		return "TYPE_STRING"
+	}
+	return "TYPE_" + datatype
+}
+
+// WriteTo writes c in the protobuf text format of config.pbtxt.
+func (c *TritonModelConfig) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "name: %q\n", c.Name)
+	if c.Platform != "" {
+		fmt.Fprintf(&b, "platform: %q\n", c.Platform)
+	}
+	if c.Backend != "" {
+		fmt.Fprintf(&b, "backend: %q\n", c.Backend)
+	}
+	fmt.Fprintf(&b, "max_batch_size: %d\n", c.MaxBatchSize)
+	writeTensors := func(kind string, tensors []TritonTensorMetadata) {
+		if len(tensors) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s [\n", kind)
+		for i, t := range tensors {
+			dims := make([]string, len(t.Shape))
+			for j, d := range t.Shape {
+				dims[j] = fmt.Sprint(d)
+			}
+			fmt.Fprintf(&b, "  {\n    name: %q\n    data_type: %s\n    dims: [ %s ]\n  }", t.Name, tritonConfigType(t.Datatype), strings.Join(dims, ", "))
+			if i < len(tensors)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("]\n")
+	}
+	writeTensors("input", c.Inputs)
+	writeTensors("output", c.Outputs)
+	if d := c.DynamicBatching; d != nil {
+		b.WriteString("dynamic_batching {\n")
+		if len(d.PreferredBatchSizes) > 0 {
+			sizes := make([]string, len(d.PreferredBatchSizes))
+			for i, n := range d.PreferredBatchSizes {
+				sizes[i] = fmt.Sprint(n)
+			}
+			fmt.Fprintf(&b, "  preferred_batch_size: [ %s ]\n", strings.Join(sizes, ", "))
+		}
+		if d.MaxQueueDelay > 0 {
+			fmt.Fprintf(&b, "  max_queue_delay_microseconds: %d\n", d.MaxQueueDelay.Microseconds())
+		}
+		b.WriteString("}\n")
+	}
+	if len(c.Instances) > 0 {
+		b.WriteString("instance_group [\n")
+		for i, g := range c.Instances {
+			fmt.Fprintf(&b, "  {\n    count: %d\n", g.Count)
+			if g.Kind != "" {
+				fmt.Fprintf(&b, "    kind: %s\n", g.Kind)
+			}
+			b.WriteString("  }")
+			if i < len(c.Instances)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("]\n")
+	}
+	if len(c.Steps) > 0 {
+		b.WriteString("ensemble_scheduling {\n  step [\n")
+		for i, s := range c.Steps {
+			fmt.Fprintf(&b, "    {\n      model_name: %q\n      model_version: -1\n", s.Model)
+			for _, k := range sortedKeys(s.InputMap) {
+				fmt.Fprintf(&b, "      input_map { key: %q value: %q }\n", k, s.InputMap[k])
+			}
+			for _, k := range sortedKeys(s.OutputMap) {
+				fmt.Fprintf(&b, "      output_map { key: %q value: %q }\n", k, s.OutputMap[k])
+			}
+			b.WriteString("    }")
+			if i < len(c.Steps)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("  ]\n}\n")
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ExportTritonModel writes the ONNX model at modelPath into the Triton model
+// repository repoDir as <name>/<version>/model.onnx with a config.pbtxt
+// derived from the model's inputs and outputs, plus the preprocessing
+// ensemble when opts.Ensemble is set. It returns the model metadata, whose
+// BackendURI configures a matching client.
+func ExportTritonModel(modelPath, repoDir string, opts TritonExportOptions) (TritonModelMetadata, error) {
+	m, err := onnx.ReadFile(modelPath)
+	if err != nil {
+		return TritonModelMetadata{}, err
+	}
+	if opts.Name == "" {
+		opts.Name = strings.TrimSuffix(filepath.Base(modelPath), filepath.Ext(modelPath))
+	}
+	if opts.Version <= 0 {
+		opts.Version = 1
+	}
+	meta := TritonModelMetadataFromONNX(opts.Name, m)
+	meta.Versions = []string{fmt.Sprint(opts.Version)}
+	cfg, err := TritonModelConfigFromMetadata(meta, opts)
+	if err != nil {
+		return meta, err
+	}
+
+	versionDir := filepath.Join(repoDir, opts.Name, fmt.Sprint(opts.Version))
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		return meta, err
+	}
+	if err := copyFile(modelPath, filepath.Join(versionDir, "model.onnx")); err != nil {
+		return meta, err
+	}
+	if err := writeTritonConfig(filepath.Join(repoDir, opts.Name), cfg); err != nil {
+		return meta, err
+	}
+	if opts.Ensemble {
+		if err := exportTritonEnsemble(repoDir, cfg, opts); err != nil {
+			return meta, err
+		}
+	}
+	return meta, nil
+}
+
+// exportTritonEnsemble writes "<name>_preprocess", a Python model turning
+// encoded images into the model's first input, and "<name>_ensemble".
+func exportTritonEnsemble(repoDir string, model *TritonModelConfig, opts TritonExportOptions) error {
+	if len(model.Inputs) != 1 {
+		return fmt.Errorf("ensemble: model %q has %d inputs, want 1", model.Name, len(model.Inputs))
+	}
+	in := model.Inputs[0]
+	if in.Datatype != "FP32" || len(in.Shape) < 2 || in.Shape[len(in.Shape)-1] <= 0 || in.Shape[len(in.Shape)-2] <= 0 {
+		return fmt.Errorf("ensemble: input %q must be FP32 NCHW with a fixed size", in.Name)
+	}
+	mean, std := opts.Mean, opts.Std
+	if mean == ([3]float32{}) {
+		mean = [3]float32{0.485, 0.456, 0.406}
+	}
+	if std == ([3]float32{}) {
+		std = [3]float32{0.229, 0.224, 0.225}
+	}
+	// one encoded image per request, or per batch entry
+	image := TritonTensorMetadata{Name: "IMAGE", Datatype: "BYTES", Shape: []int64{1}}
+
+	pre := &TritonModelConfig{
+		Name:         model.Name + "_preprocess",
+		Backend:      "python",
+		MaxBatchSize: model.MaxBatchSize,
+		Inputs:       []TritonTensorMetadata{image},
+		Outputs:      []TritonTensorMetadata{{Name: "PREPROCESSED", Datatype: in.Datatype, Shape: in.Shape}},
+		Instances:    []TritonInstanceGroup{{Count: 1, Kind: "KIND_CPU"}},
+	}
+	h, w := in.Shape[len(in.Shape)-2], in.Shape[len(in.Shape)-1]
+	script := fmt.Sprintf(tritonPreprocessScript, w, h, mean[0], mean[1], mean[2], std[0], std[1], std[2])
+	dir := filepath.Join(repoDir, pre.Name, "1")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "model.py"), []byte(script), 0o644); err != nil {
+		return err
+	}
+	if err := writeTritonConfig(filepath.Join(repoDir, pre.Name), pre); err != nil {
+		return err
+	}
+
+	ens := &TritonModelConfig{
+		Name:         model.Name + "_ensemble",
+		Platform:     "ensemble",
+		MaxBatchSize: model.MaxBatchSize,
+		Inputs:       []TritonTensorMetadata{image},
+		Outputs:      model.Outputs,
+		Steps: []TritonEnsembleStep{
+			{Model: pre.Name, InputMap: map[string]string{"IMAGE": "IMAGE"}, OutputMap: map[string]string{"PREPROCESSED": "preprocessed"}},
+			{Model: model.Name, InputMap: map[string]string{in.Name: "preprocessed"}, OutputMap: map[string]string{}},
+		},
+	}
+	for _, out := range model.Outputs {
+		ens.Steps[1].OutputMap[out.Name] = out.Name
+	}
+	// Triton requires a version directory, even an empty one, for ensembles
+	if err := os.MkdirAll(filepath.Join(repoDir, ens.Name, "1"), 0o755); err != nil {
+		return err
+	}
+	return writeTritonConfig(filepath.Join(repoDir, ens.Name), ens)
+}
+
+func writeTritonConfig(dir string, cfg *TritonModelConfig) error {
+	f, err := os.Create(filepath.Join(dir, "config.pbtxt"))
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// tritonPreprocessScript is the Python backend model of the preprocessing
+// ensemble step: it decodes each image, resizes it to the model input size
+// and normalises it to NCHW float32. Format arguments: width, height, mean
+// and std.
+const tritonPreprocessScript = `import io
+
+import numpy as np
+import triton_python_backend_utils as pb_utils
+from PIL import Image
+
+SIZE = (%d, %d)
+MEAN = np.array([%g, %g, %g], dtype=np.float32)
+STD = np.array([%g, %g, %g], dtype=np.float32)
+
+
+def preprocess(data):
+    image = Image.open(io.BytesIO(data)).convert("RGB").resize(SIZE, Image.LANCZOS)
+    x = (np.asarray(image, dtype=np.float32) / 255.0 - MEAN) / STD
+    return x.transpose(2, 0, 1)
+
+
+class TritonPythonModel:
+    def execute(self, requests):
+        responses = []
+        for request in requests:
+            images = pb_utils.get_input_tensor_by_name(request, "IMAGE").as_numpy().reshape(-1)
+            batch = np.stack([preprocess(bytes(b)) for b in images]).astype(np.float32)
+            out = pb_utils.Tensor("PREPROCESSED", batch)
+            responses.append(pb_utils.InferenceResponse(output_tensors=[out]))
+        return responses
+`
@@ -0,0 +1,127 @@
+package backends
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// writeSegModel writes a one-node model mapping an FP32 image of shape
+// [batch,3,8,8] to a mask of shape [batch,1,8,8] and returns its path.
+func writeSegModel(t *testing.T, batch onnx.Dim) string {
+	t.Helper()
+	m := &onnx.Model{
+		IRVersion:    7,
+		OpsetImports: []onnx.OpsetID{{Version: 11}},
+		Graph: onnx.Graph{
+			Nodes:   []onnx.Node{{OpType: "ReduceMean", Inputs: []string{"input.1"}, Outputs: []string{"mask"}}},
+			Inputs:  []onnx.ValueInfo{{Name: "input.1", ElemType: onnx.Float, Shape: []onnx.Dim{batch, {Value: 3}, {Value: 8}, {Value: 8}}}},
+			Outputs: []onnx.ValueInfo{{Name: "mask", ElemType: onnx.Float, Shape: []onnx.Dim{batch, {Value: 1}, {Value: 8}, {Value: 8}}}},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "seg.onnx")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExportTritonModel(t *testing.T) {
+	model := writeSegModel(t, onnx.Dim{Param: "batch"})
+	repo := t.TempDir()
+	meta, err := ExportTritonModel(model, repo, TritonExportOptions{
+		MaxBatchSize:        -1,
+		MaxQueueDelay:       100 * time.Microsecond,
+		PreferredBatchSizes: []int{4, 8},
+		Instances:           2,
+		InstanceKind:        "gpu",
+		Ensemble:            true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `name: "seg"
+platform: "onnxruntime_onnx"
+max_batch_size: 8
+input [
+  {
+    name: "input.1"
+    data_type: TYPE_FP32
+    dims: [ 3, 8, 8 ]
+  }
+]
+output [
+  {
+    name: "mask"
+    data_type: TYPE_FP32
+    dims: [ 1, 8, 8 ]
+  }
+]
+dynamic_batching {
+  preferred_batch_size: [ 4, 8 ]
+  max_queue_delay_microseconds: 100
+}
+instance_group [
+  {
+    count: 2
+    kind: KIND_GPU
+  }
+]
+`
+	got, err := os.ReadFile(filepath.Join(repo, "seg", "config.pbtxt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("config.pbtxt:\n%s\nwant:\n%s", got, want)
+	}
+	for _, f := range []string{"seg/1/model.onnx", "seg_preprocess/1/model.py", "seg_preprocess/config.pbtxt", "seg_ensemble/1", "seg_ensemble/config.pbtxt"} {
+		if _, err := os.Stat(filepath.Join(repo, f)); err != nil {
+			t.Error(err)
+		}
+	}
+	ens, _ := os.ReadFile(filepath.Join(repo, "seg_ensemble", "config.pbtxt"))
+	for _, s := range []string{`platform: "ensemble"`, `data_type: TYPE_STRING`, `input_map { key: "input.1" value: "preprocessed" }`, `output_map { key: "mask" value: "mask" }`} {
+		if !strings.Contains(string(ens), s) {
+			t.Errorf("ensemble config lacks %s:\n%s", s, ens)
+		}
+	}
+	script, _ := os.ReadFile(filepath.Join(repo, "seg_preprocess", "1", "model.py"))
+	if !strings.Contains(string(script), "SIZE = (8, 8)") {
+		t.Errorf("preprocess script:\n%s", script)
+	}
+
+	// the client configuration follows from the same metadata
+	uri, err := meta.BackendURI("triton+grpc", "localhost:8001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := b.(*TritonGRPCBackend)
+	if g.Model != "seg" || g.InputName != "input.1" || g.DType != "FP32" || len(g.Shape) != 4 || g.Shape[0] != 1 || g.Shape[1] != 3 {
+		t.Fatalf("backend from %s: %+v", uri, g)
+	}
+}
+
+func TestExportTritonModelFixedBatch(t *testing.T) {
+	model := writeSegModel(t, onnx.Dim{Value: 1})
+	if _, err := ExportTritonModel(model, t.TempDir(), TritonExportOptions{MaxBatchSize: 4}); err == nil {
+		t.Fatal("expected an error batching a model with a fixed batch dimension")
+	}
+	repo := t.TempDir()
+	if _, err := ExportTritonModel(model, repo, TritonExportOptions{Name: "u2net", MaxBatchSize: -1}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(filepath.Join(repo, "u2net", "config.pbtxt"))
+	if !strings.Contains(string(got), "max_batch_size: 0\n") || !strings.Contains(string(got), "dims: [ 1, 3, 8, 8 ]") || strings.Contains(string(got), "dynamic_batching") {
+		t.Fatalf("config.pbtxt:\n%s", got)
+	}
+}
@@ -0,0 +1,187 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SharedMemoryOptions makes the Triton backends pass tensors through POSIX
+// shared memory (Triton's system shared-memory extension) instead of the
+// request body, for servers on the same host. Each in-flight request uses an
+// input and an output region, registered on first use and reused until the
+// backend is closed.
+type SharedMemoryOptions struct {
+	// OutputName is the model output written to shared memory, and
+	// OutputByteSize the size of its region.
+	OutputName     string
+	OutputByteSize int
+	// Prefix names the regions and their /dev/shm keys; the default is
+	// "rembg_<pid>_<n>".
+	Prefix string
+}
+
+// shmUnregisterTimeout bounds unregistering regions that are released.
+const shmUnregisterTimeout = 5 * time.Second
+
+var shmPrefixes struct {
+	sync.Mutex
+	n int
+}
+
+// shmPool hands out registered input/output region pairs. register and
+// unregister are supplied by the HTTP or gRPC backend.
+type shmPool struct {
+	opts       SharedMemoryOptions
+	register   func(ctx context.Context, r *SharedMemoryRegion) error
+	unregister func(ctx context.Context, name string) error
+
+	mu     sync.Mutex
+	free   []*shmPair
+	next   int
+	closed bool
+}
+
+// shmPair is the input and output region of one request.
+type shmPair struct {
+	input, output *SharedMemoryRegion
+}
+
+func newSHMPool(opts SharedMemoryOptions, register func(context.Context, *SharedMemoryRegion) error, unregister func(context.Context, string) error) (*shmPool, error) {
+	if opts.OutputName == "" || opts.OutputByteSize <= 0 {
+		return nil, errors.New("shared memory: output name and byte size required")
+	}
+	if opts.Prefix == "" {
+		shmPrefixes.Lock()
+		opts.Prefix = fmt.Sprintf("rembg_%d_%d", os.Getpid(), shmPrefixes.n)
+		shmPrefixes.n++
+		shmPrefixes.Unlock()
+	}
+	return &shmPool{opts: opts, register: register, unregister: unregister}, nil
+}
+
+// get returns a registered pair whose input region holds at least inputSize
+// bytes, creating one if none is free.
+func (p *shmPool) get(ctx context.Context, inputSize int) (*shmPair, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+	var found *shmPair
+	var small []*shmPair
+	for found == nil && len(p.free) > 0 {
+		pair := p.free[len(p.free)-1]
+		p.free = p.free[:len(p.free)-1]
+		if pair.input.Size >= inputSize {
+			found = pair
+		} else {
+			small = append(small, pair)
+		}
+	}
+	n := p.next
+	if found == nil {
+		p.next++
+	}
+	p.mu.Unlock()
+	for _, pair := range small {
+		p.release(pair)
+	}
+	if found != nil {
+		return found, nil
+	}
+
+	name := fmt.Sprintf("%s_%d", p.opts.Prefix, n)
+	pair := &shmPair{}
+	var err error
+	if pair.input, err = CreateSharedMemoryRegion(name+"_input", "/"+name+"_input", inputSize); err != nil {
+		return nil, err
+	}
+	if pair.output, err = CreateSharedMemoryRegion(name+"_output", "/"+name+"_output", p.opts.OutputByteSize); err != nil {
+		destroySHM(pair.input)
+		return nil, err
+	}
+	for _, r := range []*SharedMemoryRegion{pair.input, pair.output} {
+		if err := p.register(ctx, r); err != nil {
+			p.release(pair)
+			return nil, fmt.Errorf("register shared memory %q: %w", r.Name, err)
+		}
+	}
+	return pair, nil
+}
+
+// put returns pair to the pool after a successful request. After a failure
+// the server may still use the regions, so they are released instead.
+func (p *shmPool) put(pair *shmPair, ok bool) {
+	p.mu.Lock()
+	if ok && !p.closed {
+		p.free = append(p.free, pair)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	p.release(pair)
+}
+
+// release unregisters the pair's regions, then unmaps and unlinks them.
+func (p *shmPool) release(pair *shmPair) {
+	ctx, cancel := context.WithTimeout(context.Background(), shmUnregisterTimeout)
+	defer cancel()
+	for _, r := range []*SharedMemoryRegion{pair.input, pair.output} {
+		p.unregister(ctx, r.Name)
+		destroySHM(r)
+	}
+}
+
+// Close releases the free pairs; pairs in use are released when returned.
+func (p *shmPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	free := p.free
+	p.free = nil
+	p.mu.Unlock()
+	for _, pair := range free {
+		p.release(pair)
+	}
+	return nil
+}
+
+func destroySHM(r *SharedMemoryRegion) {
+	r.Close()
+	r.Unlink()
+}
+
+// write copies data to the input region and returns the input parameters
+// referencing it.
+func (pair *shmPair) write(data []byte) map[string]interface{} {
+	copy(pair.input.Bytes(), data)
+	return map[string]interface{}{
+		"shared_memory_region":    pair.input.Name,
+		"shared_memory_byte_size": len(data),
+	}
+}
+
+// outputParameters returns the requested output parameters placing the
+// output in the output region.
+func (pair *shmPair) outputParameters() map[string]interface{} {
+	return map[string]interface{}{
+		"shared_memory_region":    pair.output.Name,
+		"shared_memory_byte_size": pair.output.Size,
+	}
+}
+
+// read copies the output the server wrote, whose response parameters are
+// params, out of the output region.
+func (pair *shmPair) read(params map[string]interface{}) ([]byte, error) {
+	size, ok := intParameter(params, "shared_memory_byte_size")
+	if !ok {
+		size = pair.output.Size
+	}
+	if size < 0 || size > pair.output.Size {
+		return nil, fmt.Errorf("shared memory output of %d bytes exceeds the %d byte region", size, pair.output.Size)
+	}
+	return append([]byte(nil), pair.output.Bytes()[:size]...), nil
+}
@@ -0,0 +1,255 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSHM is the server side of the system shared-memory extension: it maps
+// registered regions and reads and writes tensors in them.
+type fakeSHM struct {
+	mu           sync.Mutex
+	regions      map[string]*SharedMemoryRegion
+	registered   int
+	unregistered int
+}
+
+func (f *fakeSHM) register(name, key string, size int) error {
+	r, err := OpenSharedMemoryRegion(key, size)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.regions == nil {
+		f.regions = map[string]*SharedMemoryRegion{}
+	}
+	if _, ok := f.regions[name]; ok {
+		r.Close()
+		return fmt.Errorf("region %q already registered", name)
+	}
+	f.regions[name] = r
+	f.registered++
+	return nil
+}
+
+func (f *fakeSHM) unregister(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r, ok := f.regions[name]; ok {
+		r.Close()
+		delete(f.regions, name)
+		f.unregistered++
+	}
+}
+
+// region returns the registered region and byte size named by params.
+func (f *fakeSHM) region(params map[string]interface{}) ([]byte, error) {
+	name, _ := params["shared_memory_region"].(string)
+	size, ok := intParameter(params, "shared_memory_byte_size")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.regions[name]
+	if r == nil || !ok || size > r.Size {
+		return nil, fmt.Errorf("bad shared memory reference %v", params)
+	}
+	return r.Bytes()[:size], nil
+}
+
+func (f *fakeSHM) read(params map[string]interface{}) ([]byte, error) {
+	b, err := f.region(params)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// write stores data in the requested output region and returns the response
+// parameters describing it.
+func (f *fakeSHM) write(params map[string]interface{}, data []byte) (map[string]interface{}, error) {
+	b, err := f.region(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > len(b) {
+		return nil, fmt.Errorf("output of %d bytes does not fit", len(data))
+	}
+	copy(b, data)
+	return map[string]interface{}{
+		"shared_memory_region":    params["shared_memory_region"],
+		"shared_memory_byte_size": len(data),
+	}, nil
+}
+
+func (f *fakeSHM) counts() (registered, unregistered, open int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.registered, f.unregistered, len(f.regions)
+}
+
+// fakeTritonHTTP serves the shared-memory and infer endpoints with the
+// semantics of fakeTriton.
+func fakeTritonHTTP(t *testing.T, f *fakeTriton) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v2/systemsharedmemory/region/{name}/register", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Key      string `json:"key"`
+			ByteSize int    `json:"byte_size"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := f.shm.register(r.PathValue("name"), req.Key, req.ByteSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("POST /v2/systemsharedmemory/region/{name}/unregister", func(w http.ResponseWriter, r *http.Request) {
+		f.shm.unregister(r.PathValue("name"))
+	})
+	mux.HandleFunc("POST /v2/models/{model}/infer", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(InferHeaderContentLength) != "" {
+			http.Error(w, "unexpected binary tensor data", http.StatusBadRequest)
+			return
+		}
+		var req TritonInferRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in := req.Inputs[0]
+		resp, err := f.infer(&modelInferRequest{
+			ModelName: r.PathValue("model"),
+			Inputs:    []inferInputTensor{{Name: in.Name, Datatype: in.Datatype, Shape: in.Shape, Parameters: in.Parameters}},
+			Outputs:   []inferRequestedOutput{{Name: req.Outputs[0].Name, Parameters: req.Outputs[0].Parameters}},
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out := resp.Outputs[0]
+		json.NewEncoder(w).Encode(TritonInferResponse{
+			ModelName: resp.ModelName,
+			Outputs:   []TritonTensor{{Name: out.Name, Shape: out.Shape, Datatype: out.Datatype, Parameters: out.Parameters}},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func skipWithoutSHM(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("shared memory requires linux")
+	}
+	if _, err := os.Stat("/dev/shm"); err != nil {
+		t.Skip(err)
+	}
+}
+
+// shmSegments lists the /dev/shm segments with prefix.
+func shmSegments(t *testing.T, prefix string) []string {
+	t.Helper()
+	m, err := filepath.Glob(filepath.Join("/dev/shm", prefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestTritonHTTPBackendSharedMemory(t *testing.T) {
+	skipWithoutSHM(t)
+	f := &fakeTriton{}
+	srv := fakeTritonHTTP(t, f)
+	prefix := fmt.Sprintf("rembgtest_%d_http", os.Getpid())
+	b, err := NewTritonHTTPBackendWithOptions(strings.TrimPrefix(srv.URL, "http://"), "u2net", "INPUT__0", []int{3}, "UINT8", TritonOptions{
+		SharedMemory: &SharedMemoryOptions{OutputName: "mask", OutputByteSize: 16, Prefix: prefix},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		got, err := b.Infer(context.Background(), []byte{0, 1, byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string([]byte{1, 2, byte(i) + 1}) {
+			t.Fatalf("got %v", got)
+		}
+	}
+	// the failed request's regions are discarded and a new pair registered
+	if _, err := b.Infer(context.Background(), []byte{0xff, 0, 0}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if reg, unreg, _ := f.shm.counts(); reg != 2 || unreg != 2 {
+		t.Fatalf("registered %d, unregistered %d; want the pair reused until the failure", reg, unreg)
+	}
+	if _, err := b.Infer(context.Background(), []byte{4, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if reg, unreg, open := f.shm.counts(); reg != 4 || unreg != 4 || open != 0 {
+		t.Fatalf("registered %d, unregistered %d, open %d", reg, unreg, open)
+	}
+	if segs := shmSegments(t, prefix); len(segs) != 0 {
+		t.Fatalf("segments left behind: %v", segs)
+	}
+}
+
+func TestTritonGRPCBackendSharedMemory(t *testing.T) {
+	skipWithoutSHM(t)
+	f := &fakeTriton{}
+	prefix := fmt.Sprintf("rembgtest_%d_grpc", os.Getpid())
+	b := NewTritonGRPCBackend(startFakeTriton(t, f), "u2net", "INPUT__0", []int{1}, "UINT8")
+	b.Streaming = true
+	b.Options.SharedMemory = &SharedMemoryOptions{OutputName: "mask", OutputByteSize: 1, Prefix: prefix}
+
+	const n = 8
+	frames := make(chan []byte, n)
+	for i := 0; i < n; i++ {
+		frames <- []byte{byte(2 * (n - i))}
+	}
+	close(frames)
+	i := 0
+	for r := range InferPipeline(context.Background(), b, frames, 4) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if want := byte(2*(n-i)) + 1; len(r.Data) != 1 || r.Data[0] != want {
+			t.Fatalf("result %d = %v, want [%d]", i, r.Data, want)
+		}
+		i++
+	}
+	if f.raw.Load() != 0 || f.streamed.Load() != n {
+		t.Fatalf("raw=%d streamed=%d", f.raw.Load(), f.streamed.Load())
+	}
+	if reg, _, _ := f.shm.counts(); reg > 2*4 {
+		t.Fatalf("registered %d regions for 4 requests in flight", reg)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, open := f.shm.counts(); open != 0 {
+		t.Fatalf("%d regions still registered", open)
+	}
+	if segs := shmSegments(t, prefix); len(segs) != 0 {
+		t.Fatalf("segments left behind: %v", segs)
+	}
+}
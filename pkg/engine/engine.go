@@ -0,0 +1,299 @@
+// Package engine is a pure-Go executor for ONNX graphs. It runs the models
+// decoded by package onnx on the CPU with float32 arithmetic, covering the
+// operators U2Net, U2NetP, ISNet and similar segmentation models use:
+// convolutions (grouped, dilated and transposed), batch normalization,
+// pooling, Resize/Upsample in every coordinate mode, broadcasting arithmetic
+// and the shape plumbing (Shape, Gather, Slice, Concat, ...) exporters emit
+// around them.
+//
+// Integer and boolean tensors, which only carry shapes and indices in these
+// models, are held as int64, except 8-bit tensors, which stay packed one
+// byte per value. QDQ and QLinear quantized models run through
+// QuantizeLinear, DequantizeLinear, QLinearConv and MatMulInteger.
+//
+// Convolutions lower to im2col and a cache-blocked GEMM split across
+// goroutines, Conv+BatchNormalization+Relu chains are fused at load time,
+// and intermediate buffers are recycled between layers and runs.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// Options tunes how an Engine executes a model.
+type Options struct {
+	// Threads bounds the goroutines one operator may use; zero means
+	// runtime.GOMAXPROCS(0).
+	Threads int
+	// NoFusion keeps Conv, BatchNormalization and Relu as separate
+	// operators, e.g. to compare results against the fused graph.
+	NoFusion bool
+	// Observe, if set, is called with every input and every value a node
+	// computes, e.g. to calibrate quantization ranges. It must not modify
+	// or retain t.
+	Observe func(name string, t *Tensor)
+}
+
+// Engine executes one model. It is immutable after New and safe for
+// concurrent use; each Run keeps its own intermediate tensors.
+type Engine struct {
+	graph   *onnx.Graph
+	opset   int64
+	threads int
+	observe func(name string, t *Tensor)
+	consts  map[string]*Tensor
+	inputs  []onnx.ValueInfo
+	// nodes is the graph after fusion, with kernels[i] running nodes[i].
+	nodes   []onnx.Node
+	kernels []kernel
+	// release[i] lists the values no longer needed after node i runs.
+	release [][]string
+}
+
+// New prepares m for execution with default options. It fails, naming
+// every operator it cannot run, if the graph uses operators this package
+// does not implement.
+func New(m *onnx.Model) (*Engine, error) {
+	return NewWithOptions(m, Options{})
+}
+
+// NewWithOptions is New with explicit options.
+func NewWithOptions(m *onnx.Model, opts Options) (*Engine, error) {
+	if ops := Unsupported(m); len(ops) > 0 {
+		return nil, fmt.Errorf("unsupported operators: %s", strings.Join(ops, ", "))
+	}
+	threads := opts.Threads
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	e := &Engine{
+		graph:   &m.Graph,
+		opset:   m.Opset(""),
+		threads: threads,
+		observe: opts.Observe,
+		consts:  make(map[string]*Tensor, len(m.Graph.Initializers)),
+		inputs:  m.Graph.RuntimeInputs(),
+	}
+	for i := range m.Graph.Initializers {
+		init := &m.Graph.Initializers[i]
+		t, err := FromONNX(init)
+		if err != nil {
+			return nil, fmt.Errorf("initializer %q: %w", init.Name, err)
+		}
+		e.consts[init.Name] = t
+	}
+	e.nodes = m.Graph.Nodes
+	e.kernels = make([]kernel, len(e.nodes))
+	for i := range e.nodes {
+		e.kernels[i] = kernels[e.nodes[i].OpType]
+	}
+	if !opts.NoFusion {
+		e.fuse()
+	}
+	e.planRelease()
+	return e, nil
+}
+
+// Unsupported returns the sorted op types m uses that the engine cannot run,
+// qualified by domain for custom operator sets (e.g. "com.microsoft.Gelu").
+// Operators only used inside subgraphs are reported too.
+func Unsupported(m *onnx.Model) []string {
+	seen := map[string]bool{}
+	var walk func(g *onnx.Graph)
+	walk = func(g *onnx.Graph) {
+		for _, n := range g.Nodes {
+			if n.Domain != "" && n.Domain != "ai.onnx" {
+				seen[n.Domain+"."+n.OpType] = true
+			} else if kernels[n.OpType] == nil {
+				seen[n.OpType] = true
+			}
+			for _, a := range n.Attributes {
+				if a.G != nil {
+					walk(a.G)
+				}
+				for i := range a.Graphs {
+					walk(&a.Graphs[i])
+				}
+			}
+		}
+	}
+	walk(&m.Graph)
+	ops := make([]string, 0, len(seen))
+	for op := range seen {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// Operators returns the sorted op types the engine implements.
+func Operators() []string {
+	ops := make([]string, 0, len(kernels))
+	for op := range kernels {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// Inputs describes the tensors Run expects.
+func (e *Engine) Inputs() []onnx.ValueInfo {
+	return e.inputs
+}
+
+// Outputs describes the tensors Run returns, in order.
+func (e *Engine) Outputs() []onnx.ValueInfo {
+	return e.graph.Outputs
+}
+
+// planRelease records after which node each intermediate value is last
+// read, so Run can drop it and keep peak memory near the widest layer.
+func (e *Engine) planRelease() {
+	keep := map[string]bool{}
+	for _, o := range e.graph.Outputs {
+		keep[o.Name] = true
+	}
+	last := map[string]int{}
+	for i, n := range e.nodes {
+		for _, name := range n.Inputs {
+			last[name] = i
+		}
+	}
+	e.release = make([][]string, len(e.nodes))
+	for name, i := range last {
+		if !keep[name] && e.consts[name] == nil {
+			e.release[i] = append(e.release[i], name)
+		}
+	}
+}
+
+// Run feeds inputs, keyed by name, through the graph and returns the graph
+// outputs in order. Every runtime input must be given. Run neither modifies
+// nor retains the inputs.
+func (e *Engine) Run(ctx context.Context, inputs map[string]*Tensor) ([]*Tensor, error) {
+	values := make(map[string]*Tensor, len(e.inputs)+len(e.nodes))
+	for _, in := range e.inputs {
+		t, ok := inputs[in.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %q", in.Name)
+		}
+		if err := checkInput(in, t); err != nil {
+			return nil, err
+		}
+		values[in.Name] = t
+	}
+	for name := range inputs {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("model has no input %q", name)
+		}
+	}
+	lookup := func(name string) *Tensor {
+		if t, ok := values[name]; ok {
+			return t
+		}
+		return e.consts[name]
+	}
+	// Arrays owned by this run are counted by the live values sharing them
+	// (Reshape and friends alias their input) and recycled when the last
+	// one is released. Inputs, initializers and attribute values are not
+	// ours to reuse.
+	live := map[*float32]int{}
+	foreign := map[*float32]bool{}
+	for name, t := range values {
+		foreign[arrayOf(t)] = true
+		if e.observe != nil {
+			e.observe(name, t)
+		}
+	}
+	for _, t := range e.consts {
+		foreign[arrayOf(t)] = true
+	}
+
+	for i := range e.nodes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := &e.nodes[i]
+		args := make([]*Tensor, len(n.Inputs))
+		for j, name := range n.Inputs {
+			if name == "" {
+				continue // omitted optional input
+			}
+			if args[j] = lookup(name); args[j] == nil {
+				return nil, fmt.Errorf("node %s: input %q is not computed before use", nodeName(n), name)
+			}
+			if !packedKernels[n.OpType] {
+				args[j] = args[j].unpacked()
+			}
+		}
+		outs, err := e.kernels[i](&nodeContext{Node: n, opset: e.opset, threads: e.threads}, args)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", nodeName(n), err)
+		}
+		for j, name := range n.Outputs {
+			if name != "" && j < len(outs) {
+				values[name] = outs[j]
+				if e.observe != nil {
+					e.observe(name, outs[j])
+				}
+				if p := arrayOf(outs[j]); p != nil {
+					live[p]++
+					if n.OpType == "Constant" {
+						foreign[p] = true
+					}
+				}
+			}
+		}
+		for _, name := range e.release[i] {
+			t := values[name]
+			delete(values, name)
+			if p := arrayOf(t); p != nil && !foreign[p] {
+				if live[p]--; live[p] == 0 {
+					delete(live, p)
+					recycle(t.Data)
+				}
+			}
+		}
+	}
+
+	result := make([]*Tensor, len(e.graph.Outputs))
+	for i, o := range e.graph.Outputs {
+		if result[i] = lookup(o.Name); result[i] == nil {
+			return nil, fmt.Errorf("output %q was not computed", o.Name)
+		}
+	}
+	return result, nil
+}
+
+// checkInput validates t against the declared rank and fixed dimensions.
+func checkInput(in onnx.ValueInfo, t *Tensor) error {
+	if len(t.Shape) != 0 && t.NumElements() != t.Len() {
+		return fmt.Errorf("input %q: shape %v needs %d values, got %d", in.Name, t.Shape, t.NumElements(), t.Len())
+	}
+	dims := in.Dims()
+	if dims == nil {
+		return nil
+	}
+	if len(dims) != len(t.Shape) {
+		return fmt.Errorf("input %q: rank %d, model expects %v", in.Name, len(t.Shape), dims)
+	}
+	for i, d := range dims {
+		if d >= 0 && int(d) != t.Shape[i] {
+			return fmt.Errorf("input %q: shape %v, model expects %v", in.Name, t.Shape, dims)
+		}
+	}
+	return nil
+}
+
+func nodeName(n *onnx.Node) string {
+	if n.Name != "" {
+		return fmt.Sprintf("%q (%s)", n.Name, n.OpType)
+	}
+	return n.OpType
+}
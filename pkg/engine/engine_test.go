@@ -0,0 +1,416 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// run executes a graph of nodes at opset with the given initializers and
+// float inputs, returning the outputs named by outputs.
+func run(t *testing.T, opset int64, nodes []onnx.Node, inits []onnx.Tensor, inputs map[string]*Tensor, outputs ...string) []*Tensor {
+	t.Helper()
+	m := &onnx.Model{IRVersion: 7, OpsetImports: []onnx.OpsetID{{Version: opset}}}
+	m.Graph.Nodes = nodes
+	m.Graph.Initializers = inits
+	for name := range inputs {
+		m.Graph.Inputs = append(m.Graph.Inputs, onnx.ValueInfo{Name: name, ElemType: onnx.Float})
+	}
+	for _, name := range outputs {
+		m.Graph.Outputs = append(m.Graph.Outputs, onnx.ValueInfo{Name: name, ElemType: onnx.Float})
+	}
+	e, err := New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := e.Run(context.Background(), inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func ints(name string, v ...int64) onnx.Attribute {
+	return onnx.Attribute{Name: name, Type: onnx.AttrInts, Ints: v}
+}
+
+func str(name, v string) onnx.Attribute {
+	return onnx.Attribute{Name: name, Type: onnx.AttrString, S: []byte(v)}
+}
+
+func int64Tensor(name string, v ...int64) onnx.Tensor {
+	return onnx.Tensor{Name: name, Dims: []int64{int64(len(v))}, DataType: onnx.Int64, Int64Data: v}
+}
+
+func seq(n int) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = float32(i + 1)
+	}
+	return v
+}
+
+func assertClose(t *testing.T, got *Tensor, shape []int, want []float32) {
+	t.Helper()
+	if !reflect.DeepEqual(got.Shape, shape) {
+		t.Fatalf("shape = %v, want %v", got.Shape, shape)
+	}
+	for i, w := range want {
+		if math.Abs(float64(got.Data[i]-w)) > 1e-5 {
+			t.Fatalf("values = %v, want %v", got.Data, want)
+		}
+	}
+}
+
+func TestUnsupportedOperators(t *testing.T) {
+	m := &onnx.Model{Graph: onnx.Graph{Nodes: []onnx.Node{
+		{OpType: "Conv"},
+		{OpType: "NonMaxSuppression"},
+		{OpType: "Gelu", Domain: "com.microsoft"},
+		{OpType: "NonMaxSuppression"},
+	}}}
+	if got := Unsupported(m); !reflect.DeepEqual(got, []string{"NonMaxSuppression", "com.microsoft.Gelu"}) {
+		t.Fatalf("unsupported = %v", got)
+	}
+	_, err := New(m)
+	if err == nil || !strings.Contains(err.Error(), "NonMaxSuppression, com.microsoft.Gelu") {
+		t.Fatalf("New error = %v", err)
+	}
+}
+
+func TestConv(t *testing.T) {
+	ones := onnx.NewFloatTensor("w", []int64{1, 1, 3, 3}, []float32{1, 1, 1, 1, 1, 1, 1, 1, 1})
+	bias := onnx.NewFloatTensor("b", []int64{1}, []float32{0.5})
+	x := NewTensor([]int{1, 1, 3, 3}, seq(9))
+	out := run(t, 11, []onnx.Node{{OpType: "Conv", Inputs: []string{"x", "w", "b"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{ints("pads", 1, 1, 1, 1)}}},
+		[]onnx.Tensor{ones, bias}, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 1, 3, 3}, []float32{12.5, 21.5, 16.5, 27.5, 45.5, 33.5, 24.5, 39.5, 28.5})
+
+	// dilation 2 over 5x5 samples the corners, edge midpoints and centre
+	x = NewTensor([]int{1, 1, 5, 5}, seq(25))
+	out = run(t, 11, []onnx.Node{{OpType: "Conv", Inputs: []string{"x", "w"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{ints("dilations", 2, 2)}}},
+		[]onnx.Tensor{ones}, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 1, 1, 1}, []float32{1 + 3 + 5 + 11 + 13 + 15 + 21 + 23 + 25})
+
+	// depthwise: two groups of one channel, strided
+	dw := onnx.NewFloatTensor("w", []int64{2, 1, 1, 1}, []float32{1, -1})
+	x = NewTensor([]int{1, 2, 2, 2}, seq(8))
+	out = run(t, 11, []onnx.Node{{OpType: "Conv", Inputs: []string{"x", "w"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{{Name: "group", Type: onnx.AttrInt, I: 2}, ints("strides", 2, 2)}}},
+		[]onnx.Tensor{dw}, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 2, 1, 1}, []float32{1, -5})
+}
+
+func TestConvTranspose(t *testing.T) {
+	w := onnx.NewFloatTensor("w", []int64{1, 1, 2, 2}, []float32{1, 1, 1, 1})
+	x := NewTensor([]int{1, 1, 2, 2}, seq(4))
+	out := run(t, 11, []onnx.Node{{OpType: "ConvTranspose", Inputs: []string{"x", "w"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{ints("strides", 2, 2)}}},
+		[]onnx.Tensor{w}, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 1, 4, 4}, []float32{1, 1, 2, 2, 1, 1, 2, 2, 3, 3, 4, 4, 3, 3, 4, 4})
+
+	// overlapping windows with padding and output_padding
+	x = NewTensor([]int{1, 1, 2, 2}, seq(4))
+	out = run(t, 11, []onnx.Node{{OpType: "ConvTranspose", Inputs: []string{"x", "w"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{ints("pads", 1, 1, 0, 0), ints("output_padding", 1, 0)}}},
+		[]onnx.Tensor{w}, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 1, 3, 2}, []float32{10, 6, 7, 4, 0, 0})
+}
+
+func TestPoolingAndBatchNorm(t *testing.T) {
+	x := NewTensor([]int{1, 1, 3, 3}, seq(9))
+	out := run(t, 11, []onnx.Node{{OpType: "MaxPool", Inputs: []string{"x"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{ints("kernel_shape", 2, 2), ints("strides", 2, 2), {Name: "ceil_mode", Type: onnx.AttrInt, I: 1}}}},
+		nil, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 1, 2, 2}, []float32{5, 6, 8, 9})
+
+	out = run(t, 11, []onnx.Node{{OpType: "AveragePool", Inputs: []string{"x"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{ints("kernel_shape", 2, 2), ints("pads", 0, 0, 1, 1)}}},
+		nil, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 1, 3, 3}, []float32{3, 4, 4.5, 6, 7, 7.5, 7.5, 8.5, 9})
+
+	params := []onnx.Tensor{
+		onnx.NewFloatTensor("scale", []int64{2}, []float32{1, 2}),
+		onnx.NewFloatTensor("bias", []int64{2}, []float32{0, 1}),
+		onnx.NewFloatTensor("mean", []int64{2}, []float32{1, 0}),
+		onnx.NewFloatTensor("var", []int64{2}, []float32{4, 1}),
+	}
+	x = NewTensor([]int{1, 2, 1, 2}, []float32{1, 5, 1, 2})
+	out = run(t, 11, []onnx.Node{{OpType: "BatchNormalization", Inputs: []string{"x", "scale", "bias", "mean", "var"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{{Name: "epsilon", Type: onnx.AttrFloat, F: 0}}}},
+		params, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 2, 1, 2}, []float32{0, 2, 3, 5})
+}
+
+func TestResize(t *testing.T) {
+	x := NewTensor([]int{1, 1, 1, 2}, []float32{0, 1})
+	scales := onnx.NewFloatTensor("scales", []int64{4}, []float32{1, 1, 1, 2})
+	for _, tc := range []struct {
+		attrs []onnx.Attribute
+		want  []float32
+	}{
+		{[]onnx.Attribute{str("mode", "linear")}, []float32{0, 0.25, 0.75, 1}},
+		{[]onnx.Attribute{str("mode", "linear"), str("coordinate_transformation_mode", "align_corners")}, []float32{0, 1. / 3, 2. / 3, 1}},
+		{[]onnx.Attribute{str("coordinate_transformation_mode", "asymmetric"), str("nearest_mode", "floor")}, []float32{0, 0, 1, 1}},
+		{[]onnx.Attribute{str("mode", "cubic"), str("coordinate_transformation_mode", "align_corners")}, []float32{0, 0.31481481, 0.68518519, 1}},
+	} {
+		out := run(t, 13, []onnx.Node{{OpType: "Resize", Inputs: []string{"x", "", "scales"}, Outputs: []string{"y"}, Attributes: tc.attrs}},
+			[]onnx.Tensor{scales}, map[string]*Tensor{"x": x}, "y")
+		assertClose(t, out[0], []int{1, 1, 1, 4}, tc.want)
+	}
+
+	// Upsample with an attribute, as in older exports
+	out := run(t, 7, []onnx.Node{{OpType: "Upsample", Inputs: []string{"x"}, Outputs: []string{"y"},
+		Attributes: []onnx.Attribute{{Name: "scales", Type: onnx.AttrFloats, Floats: []float32{1, 1, 2, 2}}}}},
+		nil, map[string]*Tensor{"x": x}, "y")
+	assertClose(t, out[0], []int{1, 1, 2, 4}, []float32{0, 0, 1, 1, 0, 0, 1, 1})
+}
+
+// TestResizeToShapeOf runs the pattern U2Net exports use to upsample a side
+// output to the size of another: Shape, Slice, Concat and Resize with sizes.
+func TestResizeToShapeOf(t *testing.T) {
+	inits := []onnx.Tensor{
+		int64Tensor("start", 2), int64Tensor("end", 4), int64Tensor("nc", 1, 1),
+	}
+	nodes := []onnx.Node{
+		{OpType: "Shape", Inputs: []string{"ref"}, Outputs: []string{"shape"}},
+		{OpType: "Slice", Inputs: []string{"shape", "start", "end"}, Outputs: []string{"hw"}},
+		{OpType: "Concat", Inputs: []string{"nc", "hw"}, Outputs: []string{"sizes"}, Attributes: []onnx.Attribute{{Name: "axis", Type: onnx.AttrInt}}},
+		{OpType: "Resize", Inputs: []string{"x", "", "", "sizes"}, Outputs: []string{"up"}, Attributes: []onnx.Attribute{str("mode", "linear")}},
+		{OpType: "Concat", Inputs: []string{"up", "ref"}, Outputs: []string{"cat"}, Attributes: []onnx.Attribute{{Name: "axis", Type: onnx.AttrInt, I: 1}}},
+		{OpType: "Sigmoid", Inputs: []string{"cat"}, Outputs: []string{"y"}},
+	}
+	out := run(t, 13, nodes, inits, map[string]*Tensor{
+		"x":   NewTensor([]int{1, 1, 2, 2}, []float32{0, 0, 0, 0}),
+		"ref": NewTensor([]int{1, 1, 4, 4}, make([]float32, 16)),
+	}, "y")
+	want := make([]float32, 32)
+	for i := range want {
+		want[i] = 0.5
+	}
+	assertClose(t, out[0], []int{1, 2, 4, 4}, want)
+}
+
+func TestShapeOps(t *testing.T) {
+	x := NewTensor([]int{2, 3}, seq(6))
+	out := run(t, 13, []onnx.Node{
+		{OpType: "Slice", Inputs: []string{"x", "starts", "ends", "axes", "steps"}, Outputs: []string{"s"}},
+		{OpType: "Reshape", Inputs: []string{"x", "shape"}, Outputs: []string{"r"}},
+		{OpType: "Gather", Inputs: []string{"x", "idx"}, Outputs: []string{"g"}, Attributes: []onnx.Attribute{{Name: "axis", Type: onnx.AttrInt, I: 1}}},
+		{OpType: "Unsqueeze", Inputs: []string{"x", "ax"}, Outputs: []string{"u"}},
+		{OpType: "Transpose", Inputs: []string{"x"}, Outputs: []string{"tr"}},
+		{OpType: "Pad", Inputs: []string{"x", "pads"}, Outputs: []string{"p"}, Attributes: []onnx.Attribute{str("mode", "reflect")}},
+	}, []onnx.Tensor{
+		int64Tensor("starts", -1), int64Tensor("ends", math.MinInt64), int64Tensor("axes", 1), int64Tensor("steps", -2),
+		int64Tensor("shape", 0, -1, 1),
+		int64Tensor("idx", -1, 0),
+		int64Tensor("ax", 0, -1),
+		int64Tensor("pads", 0, 1, 0, 1),
+	}, map[string]*Tensor{"x": x}, "s", "r", "g", "u", "tr", "p")
+	assertClose(t, out[0], []int{2, 2}, []float32{3, 1, 6, 4})
+	assertClose(t, out[1], []int{2, 3, 1}, seq(6))
+	assertClose(t, out[2], []int{2, 2}, []float32{3, 1, 6, 4})
+	assertClose(t, out[3], []int{1, 2, 3, 1}, seq(6))
+	assertClose(t, out[4], []int{3, 2}, []float32{1, 4, 2, 5, 3, 6})
+	assertClose(t, out[5], []int{2, 5}, []float32{2, 1, 2, 3, 2, 5, 4, 5, 6, 5})
+}
+
+func TestRunChecksInputs(t *testing.T) {
+	m := &onnx.Model{OpsetImports: []onnx.OpsetID{{Version: 13}}, Graph: onnx.Graph{
+		Nodes:   []onnx.Node{{OpType: "Relu", Inputs: []string{"x"}, Outputs: []string{"y"}}},
+		Inputs:  []onnx.ValueInfo{{Name: "x", ElemType: onnx.Float, Shape: []onnx.Dim{{Param: "n"}, {Value: 2}}}},
+		Outputs: []onnx.ValueInfo{{Name: "y", ElemType: onnx.Float}},
+	}}
+	e, err := New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := e.Run(ctx, map[string]*Tensor{"x": NewTensor([]int{1, 3}, seq(3))}); err == nil {
+		t.Fatal("expected a shape error")
+	}
+	if _, err := e.Run(ctx, map[string]*Tensor{}); err == nil {
+		t.Fatal("expected a missing input error")
+	}
+	out, err := e.Run(ctx, map[string]*Tensor{"x": NewTensor([]int{2, 2}, []float32{-1, 2, -3, 4})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, out[0], []int{2, 2}, []float32{0, 2, 0, 4})
+}
+
+// convBNRelu builds Conv -> BatchNormalization -> Relu -> Reshape over a
+// 2x32x32 input, large enough for the intermediates to be recycled.
+func convBNRelu() *onnx.Model {
+	m := &onnx.Model{IRVersion: 7, OpsetImports: []onnx.OpsetID{{Version: 13}}}
+	m.Graph.Nodes = []onnx.Node{
+		{OpType: "Conv", Inputs: []string{"x", "w", "b"}, Outputs: []string{"c"}, Attributes: []onnx.Attribute{ints("pads", 1, 1, 1, 1)}},
+		{OpType: "BatchNormalization", Inputs: []string{"c", "scale", "shift", "mean", "var"}, Outputs: []string{"n"}},
+		{OpType: "Relu", Inputs: []string{"n"}, Outputs: []string{"r"}},
+		{OpType: "Reshape", Inputs: []string{"r", "shape"}, Outputs: []string{"y"}},
+	}
+	w := make([]float32, 3*2*3*3)
+	for i := range w {
+		w[i] = float32(i%7) - 3
+	}
+	m.Graph.Initializers = []onnx.Tensor{
+		onnx.NewFloatTensor("w", []int64{3, 2, 3, 3}, w),
+		onnx.NewFloatTensor("b", []int64{3}, []float32{0.5, -1, 0}),
+		onnx.NewFloatTensor("scale", []int64{3}, []float32{2, 0.5, 1}),
+		onnx.NewFloatTensor("shift", []int64{3}, []float32{0, 1, -2}),
+		onnx.NewFloatTensor("mean", []int64{3}, []float32{1, 0, 3}),
+		onnx.NewFloatTensor("var", []int64{3}, []float32{4, 1, 0.25}),
+		int64Tensor("shape", 3, -1),
+	}
+	m.Graph.Inputs = []onnx.ValueInfo{{Name: "x", ElemType: onnx.Float}}
+	m.Graph.Outputs = []onnx.ValueInfo{{Name: "y", ElemType: onnx.Float}}
+	return m
+}
+
+func TestFusion(t *testing.T) {
+	m := convBNRelu()
+	x := NewTensor([]int{1, 2, 32, 32}, seq(2*32*32))
+	for i := range x.Data {
+		x.Data[i] = float32(i%11) - 5
+	}
+	plain, err := NewWithOptions(m, Options{NoFusion: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fused, err := New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.nodes) != 4 || len(fused.nodes) != 2 {
+		t.Fatalf("nodes = %d unfused, %d fused; want 4 and 2", len(plain.nodes), len(fused.nodes))
+	}
+	if fused.consts["w"] != nil || fused.consts["scale"] != nil {
+		t.Fatal("folded parameters are still held")
+	}
+	want, err := plain.Run(context.Background(), map[string]*Tensor{"x": x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fused.Run(context.Background(), map[string]*Tensor{"x": x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, got[0], []int{3, 1024}, want[0].Data)
+}
+
+func TestRunRecyclesBuffers(t *testing.T) {
+	e, err := NewWithOptions(convBNRelu(), Options{NoFusion: true, Threads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := NewTensor([]int{1, 2, 32, 32}, seq(2*32*32))
+	first, err := e.Run(context.Background(), map[string]*Tensor{"x": x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// later runs reuse the arrays released by earlier ones; neither the
+	// input nor an earlier result may be overwritten
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				out, err := e.Run(context.Background(), map[string]*Tensor{"x": x})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(out[0].Data, first[0].Data) {
+					t.Error("results differ between runs")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if !reflect.DeepEqual(x.Data, seq(2*32*32)) {
+		t.Fatal("input was modified")
+	}
+}
+
+func uint8Tensor(name string, dims []int64, v ...byte) onnx.Tensor {
+	return onnx.Tensor{Name: name, Dims: dims, DataType: onnx.Uint8, RawData: v}
+}
+
+func int8Tensor(name string, dims []int64, v ...int8) onnx.Tensor {
+	raw := make([]byte, len(v))
+	for i, x := range v {
+		raw[i] = byte(x)
+	}
+	return onnx.Tensor{Name: name, Dims: dims, DataType: onnx.Int8, RawData: raw}
+}
+
+func TestQuantizeDequantize(t *testing.T) {
+	scale := onnx.NewFloatTensor("s", nil, []float32{0.5})
+	zero := uint8Tensor("z", nil, 10)
+	x := NewTensor([]int{5}, []float32{-10, -1.25, 0, 1.25, 200})
+	out := run(t, 13, []onnx.Node{
+		{OpType: "QuantizeLinear", Inputs: []string{"x", "s", "z"}, Outputs: []string{"q"}},
+		{OpType: "DequantizeLinear", Inputs: []string{"q", "s", "z"}, Outputs: []string{"y"}},
+	}, []onnx.Tensor{scale, zero}, map[string]*Tensor{"x": x}, "q", "y")
+	// -1.25/0.5 rounds half to even (-2), saturating at 0 and 255
+	if !reflect.DeepEqual(out[0].Bytes, []byte{0, 8, 10, 12, 255}) || out[0].DType != onnx.Uint8 {
+		t.Fatalf("q = %v (%v)", out[0].Bytes, out[0].DType)
+	}
+	assertClose(t, out[1], []int{5}, []float32{-5, -1, 0, 1, 122.5})
+
+	// per-channel INT8 weights along axis 0
+	w := int8Tensor("w", []int64{2, 2}, -128, 3, 127, -1)
+	ws := onnx.NewFloatTensor("ws", []int64{2}, []float32{0.5, 2})
+	wz := int8Tensor("wz", []int64{2}, 0, -1)
+	out = run(t, 13, []onnx.Node{
+		{OpType: "DequantizeLinear", Inputs: []string{"w", "ws", "wz"}, Outputs: []string{"y"},
+			Attributes: []onnx.Attribute{{Name: "axis", Type: onnx.AttrInt, I: 0}}},
+	}, []onnx.Tensor{w, ws, wz}, map[string]*Tensor{}, "y")
+	assertClose(t, out[0], []int{2, 2}, []float32{-64, 1.5, 256, 0})
+}
+
+func TestQLinearConv(t *testing.T) {
+	// x = (q - 2) * 0.5, w = q * [1, 0.25] per output channel
+	xq := []byte{2, 4, 6, 8, 10, 12, 14, 16, 18}
+	wq := []int8{1, 0, 0, 1, 4, 4, 4, 4}
+	inits := []onnx.Tensor{
+		uint8Tensor("x", []int64{1, 1, 3, 3}, xq...),
+		onnx.NewFloatTensor("xs", nil, []float32{0.5}), uint8Tensor("xz", nil, 2),
+		int8Tensor("w", []int64{2, 1, 2, 2}, wq...),
+		onnx.NewFloatTensor("ws", []int64{2}, []float32{1, 0.25}), int8Tensor("wz", []int64{2}, 0, 0),
+		onnx.NewFloatTensor("ys", nil, []float32{0.25}), uint8Tensor("yz", nil, 5),
+		{Name: "b", Dims: []int64{2}, DataType: onnx.Int32, Int32Data: []int32{4, -8}},
+	}
+	out := run(t, 13, []onnx.Node{
+		{OpType: "QLinearConv", Inputs: []string{"x", "xs", "xz", "w", "ws", "wz", "ys", "yz", "b"}, Outputs: []string{"q"}},
+		{OpType: "DequantizeLinear", Inputs: []string{"q", "ys", "yz"}, Outputs: []string{"y"}},
+	}, inits, map[string]*Tensor{}, "y")
+	// float reference: x = [0 1 2; 3 4 5; 6 7 8], bias = [4*0.5, -8*0.125]
+	assertClose(t, out[0], []int{1, 2, 2, 2}, []float32{
+		0 + 4 + 2, 1 + 5 + 2, 3 + 7 + 2, 4 + 8 + 2,
+		8 - 1, 12 - 1, 20 - 1, 24 - 1,
+	})
+}
+
+func TestMatMulInteger(t *testing.T) {
+	a := uint8Tensor("a", []int64{2, 3}, 1, 2, 3, 4, 5, 6)
+	b := int8Tensor("b", []int64{3, 2}, 1, -1, 0, 2, -3, 1)
+	az := uint8Tensor("az", []int64{2}, 1, 4)
+	out := run(t, 13, []onnx.Node{
+		{OpType: "MatMulInteger", Inputs: []string{"a", "b", "az"}, Outputs: []string{"y"}},
+	}, []onnx.Tensor{a, b, az}, map[string]*Tensor{}, "y")
+	// rows of A less their zero points: [0 1 2] and [0 1 2]
+	if !reflect.DeepEqual(out[0].Shape, []int{2, 2}) || out[0].DType != onnx.Int32 ||
+		!reflect.DeepEqual(out[0].Ints, []int64{-6, 4, -6, 4}) {
+		t.Fatalf("y = %v %v %v", out[0].Shape, out[0].DType, out[0].Ints)
+	}
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"math"
+	"slices"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// fuse rewrites Conv -> BatchNormalization -> Relu chains, the building
+// block of U2Net and ISNet, into a single convolution. The normalization is
+// folded into the convolution's weights and bias and the Relu is applied
+// as the convolution finishes, so the fused layer makes one pass over its
+// output instead of three. Either follower may be absent. Intermediate
+// values that are graph outputs or read by more than one node are left
+// alone.
+func (e *Engine) fuse() {
+	readers := map[string][]int{}
+	for i, n := range e.nodes {
+		for _, name := range n.Inputs {
+			readers[name] = append(readers[name], i)
+		}
+	}
+	for _, o := range e.graph.Outputs {
+		readers[o.Name] = append(readers[o.Name], -1)
+	}
+	// next returns the only reader of name if it is an op node.
+	next := func(name, op string) (int, bool) {
+		r := readers[name]
+		if len(r) != 1 || r[0] < 0 || e.nodes[r[0]].OpType != op || e.nodes[r[0]].Domain != "" {
+			return 0, false
+		}
+		return r[0], true
+	}
+
+	nodes := make([]onnx.Node, 0, len(e.nodes))
+	kerns := make([]kernel, 0, len(e.nodes))
+	dropped := map[int]bool{}
+	folded := map[string]bool{}
+	for i := range e.nodes {
+		if dropped[i] {
+			continue
+		}
+		n := e.nodes[i]
+		if n.OpType != "Conv" || n.Domain != "" || len(n.Outputs) != 1 {
+			nodes, kerns = append(nodes, n), append(kerns, e.kernels[i])
+			continue
+		}
+		fused, out := n, n.Outputs[0]
+		if j, ok := next(out, "BatchNormalization"); ok {
+			if w, b, ok := e.foldBatchNorm(&n, &e.nodes[j]); ok {
+				for _, name := range slices.Concat(n.Inputs[1:], e.nodes[j].Inputs[1:]) {
+					folded[name] = true
+				}
+				fused.Inputs = []string{n.Inputs[0], w, b}
+				out = e.nodes[j].Outputs[0]
+				dropped[j] = true
+			}
+		}
+		relu := false
+		if j, ok := next(out, "Relu"); ok {
+			out, relu = e.nodes[j].Outputs[0], true
+			dropped[j] = true
+		}
+		fused.Outputs = []string{out}
+		nodes = append(nodes, fused)
+		if relu {
+			kerns = append(kerns, func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+				return convolve(c, in, true)
+			})
+		} else {
+			kerns = append(kerns, conv)
+		}
+	}
+	e.nodes, e.kernels = nodes, kerns
+
+	// release the original parameters unless something else reads them
+	for _, n := range e.nodes {
+		for _, name := range n.Inputs {
+			delete(folded, name)
+		}
+	}
+	for _, o := range e.graph.Outputs {
+		delete(folded, o.Name)
+	}
+	for name := range folded {
+		delete(e.consts, name)
+	}
+}
+
+// foldBatchNorm computes the weights and bias of conv followed by the
+// inference-mode normalization bn, registering them as constants. It
+// reports false, leaving both nodes to run separately, unless every
+// parameter involved is an initializer of matching size.
+func (e *Engine) foldBatchNorm(conv, bn *onnx.Node) (w, b string, ok bool) {
+	if len(conv.Inputs) < 2 || len(bn.Inputs) != 5 || len(bn.Outputs) != 1 {
+		return "", "", false
+	}
+	if (&nodeContext{Node: bn}).int("training_mode", 0) != 0 {
+		return "", "", false
+	}
+	weight := e.consts[conv.Inputs[1]]
+	if weight == nil || weight.IsInt() || len(weight.Shape) != 4 {
+		return "", "", false
+	}
+	oc := weight.Shape[0]
+	var bias []float32
+	if len(conv.Inputs) > 2 && conv.Inputs[2] != "" {
+		t := e.consts[conv.Inputs[2]]
+		if t == nil || t.IsInt() || t.Len() != oc {
+			return "", "", false
+		}
+		bias = t.Data
+	}
+	params := make([][]float32, 4)
+	for k, name := range bn.Inputs[1:] {
+		t := e.consts[name]
+		if t == nil || t.Len() != oc {
+			return "", "", false
+		}
+		params[k] = t.Float32s()
+	}
+	scale, shift, mean, variance := params[0], params[1], params[2], params[3]
+	eps := float64((&nodeContext{Node: bn}).float("epsilon", 1e-5))
+
+	per := weight.Len() / oc
+	fw := make([]float32, weight.Len())
+	fb := make([]float32, oc)
+	for m := 0; m < oc; m++ {
+		k := scale[m] / float32(math.Sqrt(float64(variance[m])+eps))
+		for i, v := range weight.Data[m*per : (m+1)*per] {
+			fw[m*per+i] = v * k
+		}
+		var b0 float32
+		if bias != nil {
+			b0 = bias[m]
+		}
+		fb[m] = (b0-mean[m])*k + shift[m]
+	}
+	w, b = bn.Outputs[0]+"#fused_weight", bn.Outputs[0]+"#fused_bias"
+	e.consts[w] = NewTensor(weight.Shape, fw)
+	e.consts[b] = NewTensor([]int{oc}, fb)
+	return w, b, true
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Cache blocking for sgemm: a blockK x blockN panel of B (128 KiB) stays in
+// L2 while four rows of C are updated from it.
+const (
+	blockK = 128
+	blockN = 256
+)
+
+// sgemm accumulates the m x k by k x n product of a and b into c. All three
+// are row-major with leading dimensions lda, ldb and ldc, so the operands
+// may be windows of larger matrices.
+func sgemm(m, n, k int, a []float32, lda int, b []float32, ldb int, c []float32, ldc int) {
+	for p0 := 0; p0 < k; p0 += blockK {
+		p1 := min(k, p0+blockK)
+		for j0 := 0; j0 < n; j0 += blockN {
+			j1 := min(n, j0+blockN)
+			i := 0
+			// four rows of C share every load of B
+			for ; i+4 <= m; i += 4 {
+				c0 := c[i*ldc+j0 : i*ldc+j1]
+				c1 := c[(i+1)*ldc+j0 : (i+1)*ldc+j1]
+				c2 := c[(i+2)*ldc+j0 : (i+2)*ldc+j1]
+				c3 := c[(i+3)*ldc+j0 : (i+3)*ldc+j1]
+				for p := p0; p < p1; p++ {
+					a0, a1, a2, a3 := a[i*lda+p], a[(i+1)*lda+p], a[(i+2)*lda+p], a[(i+3)*lda+p]
+					if a0 == 0 && a1 == 0 && a2 == 0 && a3 == 0 {
+						continue
+					}
+					br := b[p*ldb+j0 : p*ldb+j1]
+					c0, c1, c2, c3 := c0[:len(br)], c1[:len(br)], c2[:len(br)], c3[:len(br)]
+					for j, bv := range br {
+						c0[j] += a0 * bv
+						c1[j] += a1 * bv
+						c2[j] += a2 * bv
+						c3[j] += a3 * bv
+					}
+				}
+			}
+			for ; i < m; i++ {
+				cr := c[i*ldc+j0 : i*ldc+j1]
+				for p := p0; p < p1; p++ {
+					av := a[i*lda+p]
+					if av == 0 {
+						continue
+					}
+					br := b[p*ldb+j0 : p*ldb+j1]
+					cr := cr[:len(br)]
+					for j, bv := range br {
+						cr[j] += av * bv
+					}
+				}
+			}
+		}
+	}
+}
+
+// parallelSgemm splits sgemm across up to threads goroutines, by rows of c
+// (output channels, for a convolution) when there are enough of them and
+// by columns otherwise.
+func parallelSgemm(threads, m, n, k int, a []float32, lda int, b []float32, ldb int, c []float32, ldc int) {
+	// below this many multiply-adds a goroutine costs more than it saves
+	const minWork = 1 << 16
+	if m >= 4*threads || n < blockN {
+		parallelFor(threads, m, max(1, minWork/max(1, n*k)), func(lo, hi int) {
+			sgemm(hi-lo, n, k, a[lo*lda:], lda, b, ldb, c[lo*ldc:], ldc)
+		})
+		return
+	}
+	parallelFor(threads, n, max(blockN/4, minWork/max(1, m*k)), func(lo, hi int) {
+		sgemm(m, hi-lo, k, a, lda, b[lo:], ldb, c[lo:], ldc)
+	})
+}
+
+// parallelFor calls fn over consecutive chunks of [0, n) on up to threads
+// goroutines, giving each chunk at least grain items. It returns once
+// every chunk is done.
+func parallelFor(threads, n, grain int, fn func(lo, hi int)) {
+	if threads < 1 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	chunks := min(threads, n/max(1, grain))
+	if chunks <= 1 {
+		if n > 0 {
+			fn(0, n)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < chunks; i++ {
+		lo, hi := i*n/chunks, (i+1)*n/chunks
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(lo, hi)
+		}()
+	}
+	wg.Wait()
+}
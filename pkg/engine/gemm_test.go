@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+func random(r *rand.Rand, n int) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = r.Float32()*2 - 1
+	}
+	return v
+}
+
+func maxDiff(a, b []float32) float64 {
+	var d float64
+	for i := range a {
+		d = max(d, math.Abs(float64(a[i]-b[i])))
+	}
+	return d
+}
+
+func TestSgemm(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// sizes straddle the 4-row unroll and the K and N blocks
+	for _, s := range [][3]int{{1, 1, 1}, {3, 5, 7}, {9, 300, 130}, {64, 257, 129}} {
+		m, n, k := s[0], s[1], s[2]
+		a, b := random(r, m*k), random(r, k*n)
+		want := make([]float32, m*n)
+		for i := 0; i < m; i++ {
+			for j := 0; j < n; j++ {
+				var acc float32
+				for p := 0; p < k; p++ {
+					acc += a[i*k+p] * b[p*n+j]
+				}
+				want[i*n+j] = acc
+			}
+		}
+		for _, threads := range []int{1, 4} {
+			got := make([]float32, m*n)
+			parallelSgemm(threads, m, n, k, a, k, b, n, got, n)
+			if d := maxDiff(got, want); d > 1e-4 {
+				t.Fatalf("%dx%dx%d on %d threads: max difference %g", m, n, k, threads, d)
+			}
+		}
+	}
+}
+
+func TestConvGEMMMatchesDirect(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	const ch, ih, iw, oc = 5, 13, 11, 6
+	x := random(r, ch*ih*iw)
+	for _, attrs := range [][]onnx.Attribute{
+		{ints("pads", 1, 1, 1, 1)},
+		{ints("strides", 2, 2), ints("pads", 0, 1, 2, 1)},
+		{ints("dilations", 2, 3), str("auto_pad", "SAME_UPPER")},
+	} {
+		for _, k := range []int{1, 3} {
+			w := random(r, oc*ch*k*k)
+			win, err := newWindow(&nodeContext{Node: &onnx.Node{Attributes: attrs}}, ih, iw, k, k, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oplane := win.oh * win.ow
+			want := make([]float32, oc*oplane)
+			for m := 0; m < oc; m++ {
+				convDirect(want[m*oplane:][:oplane], x, w[m*ch*k*k:][:ch*k*k], ch, ih, iw, win)
+			}
+			got := make([]float32, oc*oplane)
+			convGEMM(3, got, x, w, ch, ih, iw, oc, win)
+			if d := maxDiff(got, want); d > 1e-4 {
+				t.Fatalf("%v with %dx%d kernel: max difference %g", attrs, k, k, d)
+			}
+		}
+	}
+}
+
+func BenchmarkConv3x3(b *testing.B) {
+	r := rand.New(rand.NewSource(3))
+	const ch, size, oc = 64, 80, 64
+	x := NewTensor([]int{1, ch, size, size}, random(r, ch*size*size))
+	w := NewTensor([]int{oc, ch, 3, 3}, random(r, oc*ch*9))
+	c := &nodeContext{Node: &onnx.Node{OpType: "Conv", Attributes: []onnx.Attribute{ints("pads", 1, 1, 1, 1)}}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out, err := conv(c, []*Tensor{x, w})
+		if err != nil {
+			b.Fatal(err)
+		}
+		recycle(out[0].Data)
+	}
+}
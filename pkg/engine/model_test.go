@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// TestU2NetBlock runs a small residual U-block built the way U2Net exports
+// build theirs and checks it against a plain float64 implementation of the
+// same layers. It covers the ops and patterns a real model chains together:
+// Conv+BatchNormalization+Relu (fused), dilated convolution, MaxPool with
+// ceil_mode on an odd size, upsampling to the shape of a skip connection,
+// Concat, the residual Add and the Sigmoid side output.
+func TestU2NetBlock(t *testing.T) {
+	const size = 7
+	b := &blockGraph{}
+	b.rebnconv("hxin", "x", 3, 4, 1)
+	b.rebnconv("hx1", "hxin", 4, 4, 1)
+	b.nodes = append(b.nodes, onnx.Node{OpType: "MaxPool", Inputs: []string{"hx1"}, Outputs: []string{"pool"},
+		Attributes: []onnx.Attribute{ints("kernel_shape", 2, 2), ints("strides", 2, 2), {Name: "ceil_mode", Type: onnx.AttrInt, I: 1}}})
+	b.rebnconv("hx2", "pool", 4, 4, 1)
+	b.rebnconv("hx3", "hx2", 4, 4, 2)
+	b.concat("cat2", "hx3", "hx2")
+	b.rebnconv("hx2d", "cat2", 8, 4, 1)
+	b.inits = append(b.inits, int64Tensor("start", 2), int64Tensor("end", 4), int64Tensor("nc", 1, 4))
+	b.nodes = append(b.nodes,
+		onnx.Node{OpType: "Shape", Inputs: []string{"hx1"}, Outputs: []string{"shape"}},
+		onnx.Node{OpType: "Slice", Inputs: []string{"shape", "start", "end"}, Outputs: []string{"hw"}},
+		onnx.Node{OpType: "Concat", Inputs: []string{"nc", "hw"}, Outputs: []string{"sizes"}, Attributes: []onnx.Attribute{{Name: "axis", Type: onnx.AttrInt}}},
+		onnx.Node{OpType: "Resize", Inputs: []string{"hx2d", "", "", "sizes"}, Outputs: []string{"up"}, Attributes: []onnx.Attribute{str("mode", "linear")}},
+	)
+	b.concat("cat1", "up", "hx1")
+	b.rebnconv("hx1d", "cat1", 8, 4, 1)
+	b.nodes = append(b.nodes, onnx.Node{OpType: "Add", Inputs: []string{"hx1d", "hxin"}, Outputs: []string{"res"}})
+	b.conv("side", "res", 4, 1, 1)
+	b.nodes = append(b.nodes, onnx.Node{OpType: "Sigmoid", Inputs: []string{"side"}, Outputs: []string{"y"}})
+
+	x := params(3*size*size, 0, 0.5, 0.5)
+	out := run(t, 11, b.nodes, b.inits, map[string]*Tensor{"x": NewTensor([]int{1, 3, size, size}, x)}, "y")
+
+	// the same block, layer by layer in float64
+	ref := &blockRef{b: b}
+	hxin := ref.rebnconv("hxin", refMap{3, size, size, float64s(x)}, 1)
+	hx1 := ref.rebnconv("hx1", hxin, 1)
+	hx2 := ref.rebnconv("hx2", maxPoolCeil(hx1), 1)
+	hx3 := ref.rebnconv("hx3", hx2, 2)
+	hx2d := ref.rebnconv("hx2d", concatRef(hx3, hx2), 1)
+	hx1d := ref.rebnconv("hx1d", concatRef(upsampleRef(hx2d, hx1.h, hx1.w), hx1), 1)
+	res := hx1d
+	res.v = make([]float64, len(hx1d.v))
+	for i := range res.v {
+		res.v[i] = hx1d.v[i] + hxin.v[i]
+	}
+	side := ref.conv("side", res, 1)
+	want := make([]float32, len(side.v))
+	for i, v := range side.v {
+		want[i] = float32(1 / (1 + math.Exp(-v)))
+	}
+	assertClose(t, out[0], []int{1, 1, size, size}, want)
+
+	// the mask must not be flat, or the comparison above proves little
+	lo, hi := want[0], want[0]
+	for _, v := range want {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	if hi-lo < 0.05 {
+		t.Fatalf("reference output spans only [%v, %v]", lo, hi)
+	}
+}
+
+// params returns n deterministic values in [offset-scale, offset+scale].
+func params(n, seed int, offset, scale float32) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = offset + scale*float32(math.Sin(float64(seed*131+i)*0.7+float64(seed)))
+	}
+	return v
+}
+
+func float64s(v []float32) []float64 {
+	d := make([]float64, len(v))
+	for i, f := range v {
+		d[i] = float64(f)
+	}
+	return d
+}
+
+// blockGraph collects the nodes and initializers of a test graph, giving
+// each layer deterministic weights.
+type blockGraph struct {
+	nodes []onnx.Node
+	inits []onnx.Tensor
+	seed  int
+}
+
+func (b *blockGraph) tensor(name string, dims []int64, offset, scale float32) {
+	n := 1
+	for _, d := range dims {
+		n *= int(d)
+	}
+	b.seed++
+	b.inits = append(b.inits, onnx.NewFloatTensor(name, dims, params(n, b.seed, offset, scale)))
+}
+
+func (b *blockGraph) init(name string) []float32 {
+	for _, t := range b.inits {
+		if t.Name == name {
+			v, err := t.Float32s()
+			if err != nil {
+				panic(err)
+			}
+			return v
+		}
+	}
+	panic("no initializer " + name)
+}
+
+// conv adds a 3x3 convolution with padding equal to its dilation, as
+// U2Net's REBNCONV uses.
+func (b *blockGraph) conv(out, in string, cin, cout int, dil int64) {
+	b.tensor(out+".w", []int64{int64(cout), int64(cin), 3, 3}, 0, 0.6/float32(cin))
+	b.tensor(out+".b", []int64{int64(cout)}, 0, 0.1)
+	b.nodes = append(b.nodes, onnx.Node{OpType: "Conv", Inputs: []string{in, out + ".w", out + ".b"}, Outputs: []string{out},
+		Attributes: []onnx.Attribute{ints("kernel_shape", 3, 3), ints("pads", dil, dil, dil, dil), ints("dilations", dil, dil)}})
+}
+
+// rebnconv adds Conv, BatchNormalization and Relu.
+func (b *blockGraph) rebnconv(out, in string, cin, cout int, dil int64) {
+	b.conv(out+".conv", in, cin, cout, dil)
+	b.tensor(out+".scale", []int64{int64(cout)}, 1, 0.3)
+	b.tensor(out+".bias", []int64{int64(cout)}, 0, 0.2)
+	b.tensor(out+".mean", []int64{int64(cout)}, 0, 0.1)
+	b.tensor(out+".var", []int64{int64(cout)}, 0.8, 0.4)
+	b.nodes = append(b.nodes,
+		onnx.Node{OpType: "BatchNormalization", Inputs: []string{out + ".conv", out + ".scale", out + ".bias", out + ".mean", out + ".var"}, Outputs: []string{out + ".bn"}},
+		onnx.Node{OpType: "Relu", Inputs: []string{out + ".bn"}, Outputs: []string{out}},
+	)
+}
+
+func (b *blockGraph) concat(out string, in ...string) {
+	b.nodes = append(b.nodes, onnx.Node{OpType: "Concat", Inputs: in, Outputs: []string{out}, Attributes: []onnx.Attribute{{Name: "axis", Type: onnx.AttrInt, I: 1}}})
+}
+
+// refMap is a c x h x w feature map for the reference implementation.
+type refMap struct {
+	c, h, w int
+	v       []float64
+}
+
+func (m refMap) at(c, y, x int) float64 { return m.v[(c*m.h+y)*m.w+x] }
+
+// blockRef evaluates the layers of a blockGraph in float64.
+type blockRef struct{ b *blockGraph }
+
+func (r *blockRef) conv(name string, in refMap, dil int) refMap {
+	w, bias := r.b.init(name+".w"), r.b.init(name+".b")
+	cout := len(bias)
+	out := refMap{cout, in.h, in.w, make([]float64, cout*in.h*in.w)}
+	for o := 0; o < cout; o++ {
+		for y := 0; y < in.h; y++ {
+			for x := 0; x < in.w; x++ {
+				sum := float64(bias[o])
+				for c := 0; c < in.c; c++ {
+					for ky := 0; ky < 3; ky++ {
+						for kx := 0; kx < 3; kx++ {
+							iy, ix := y+(ky-1)*dil, x+(kx-1)*dil
+							if iy < 0 || iy >= in.h || ix < 0 || ix >= in.w {
+								continue
+							}
+							sum += float64(w[((o*in.c+c)*3+ky)*3+kx]) * in.at(c, iy, ix)
+						}
+					}
+				}
+				out.v[(o*in.h+y)*in.w+x] = sum
+			}
+		}
+	}
+	return out
+}
+
+func (r *blockRef) rebnconv(name string, in refMap, dil int) refMap {
+	out := r.conv(name+".conv", in, dil)
+	scale, bias := r.b.init(name+".scale"), r.b.init(name+".bias")
+	mean, variance := r.b.init(name+".mean"), r.b.init(name+".var")
+	plane := out.h * out.w
+	for i, v := range out.v {
+		c := i / plane
+		v = (v-float64(mean[c]))/math.Sqrt(float64(variance[c])+1e-5)*float64(scale[c]) + float64(bias[c])
+		out.v[i] = math.Max(v, 0)
+	}
+	return out
+}
+
+// maxPoolCeil is a 2x2, stride 2 max pool that keeps the partial windows
+// at odd edges.
+func maxPoolCeil(in refMap) refMap {
+	h, w := (in.h+1)/2, (in.w+1)/2
+	out := refMap{in.c, h, w, make([]float64, in.c*h*w)}
+	for c := 0; c < in.c; c++ {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				m := math.Inf(-1)
+				for iy := 2 * y; iy < min(2*y+2, in.h); iy++ {
+					for ix := 2 * x; ix < min(2*x+2, in.w); ix++ {
+						m = math.Max(m, in.at(c, iy, ix))
+					}
+				}
+				out.v[(c*h+y)*w+x] = m
+			}
+		}
+	}
+	return out
+}
+
+// upsampleRef resizes bilinearly to h x w with half-pixel coordinates
+// clamped to the input, as F.upsample(mode="bilinear") does.
+func upsampleRef(in refMap, h, w int) refMap {
+	src := func(o, inLen, outLen int) (int, int, float64) {
+		f := (float64(o)+0.5)*float64(inLen)/float64(outLen) - 0.5
+		f = math.Min(math.Max(f, 0), float64(inLen-1))
+		i0 := int(f)
+		return i0, min(i0+1, inLen-1), f - float64(i0)
+	}
+	out := refMap{in.c, h, w, make([]float64, in.c*h*w)}
+	for c := 0; c < in.c; c++ {
+		for y := 0; y < h; y++ {
+			y0, y1, fy := src(y, in.h, h)
+			for x := 0; x < w; x++ {
+				x0, x1, fx := src(x, in.w, w)
+				top := in.at(c, y0, x0)*(1-fx) + in.at(c, y0, x1)*fx
+				bottom := in.at(c, y1, x0)*(1-fx) + in.at(c, y1, x1)*fx
+				out.v[(c*h+y)*w+x] = top*(1-fy) + bottom*fy
+			}
+		}
+	}
+	return out
+}
+
+func concatRef(maps ...refMap) refMap {
+	out := refMap{h: maps[0].h, w: maps[0].w}
+	for _, m := range maps {
+		if m.h != out.h || m.w != out.w {
+			panic(fmt.Sprintf("concat %dx%d with %dx%d", out.h, out.w, m.h, m.w))
+		}
+		out.c += m.c
+		out.v = append(out.v, m.v...)
+	}
+	return out
+}
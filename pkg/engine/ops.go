@@ -0,0 +1,506 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// kernel computes the outputs of one node from its inputs; omitted optional
+// inputs are nil.
+type kernel func(c *nodeContext, in []*Tensor) ([]*Tensor, error)
+
+// nodeContext gives kernels the node's attributes, the model opset and the
+// number of goroutines they may use.
+type nodeContext struct {
+	*onnx.Node
+	opset   int64
+	threads int
+}
+
+func (c *nodeContext) int(name string, def int64) int64 {
+	if a, ok := c.Attr(name); ok {
+		return a.I
+	}
+	return def
+}
+
+func (c *nodeContext) float(name string, def float32) float32 {
+	if a, ok := c.Attr(name); ok {
+		return a.F
+	}
+	return def
+}
+
+func (c *nodeContext) ints(name string, def []int64) []int64 {
+	if a, ok := c.Attr(name); ok {
+		return a.Ints
+	}
+	return def
+}
+
+func (c *nodeContext) floats(name string) []float32 {
+	if a, ok := c.Attr(name); ok {
+		return a.Floats
+	}
+	return nil
+}
+
+func (c *nodeContext) str(name, def string) string {
+	if a, ok := c.Attr(name); ok {
+		return string(a.S)
+	}
+	return def
+}
+
+// need returns an error unless the first n inputs are present.
+func need(in []*Tensor, n int) error {
+	if len(in) < n {
+		return fmt.Errorf("%d inputs, need %d", len(in), n)
+	}
+	for i := 0; i < n; i++ {
+		if in[i] == nil {
+			return fmt.Errorf("input %d is required", i)
+		}
+	}
+	return nil
+}
+
+// optional returns in[i] if present.
+func optional(in []*Tensor, i int) *Tensor {
+	if i < len(in) {
+		return in[i]
+	}
+	return nil
+}
+
+func one(t *Tensor) ([]*Tensor, error) {
+	return []*Tensor{t}, nil
+}
+
+var kernels map[string]kernel
+
+func init() {
+	kernels = map[string]kernel{
+		// elementwise
+		"Abs":        unary(math.Abs),
+		"Ceil":       unary(math.Ceil),
+		"Exp":        unary(math.Exp),
+		"Floor":      unary(math.Floor),
+		"Log":        unary(math.Log),
+		"Neg":        unary(func(x float64) float64 { return -x }),
+		"Reciprocal": unary(func(x float64) float64 { return 1 / x }),
+		"Relu":       unary(func(x float64) float64 { return max(x, 0) }),
+		"Round":      unary(math.RoundToEven),
+		"Sigmoid":    unary(func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }),
+		"Sqrt":       unary(math.Sqrt),
+		"Tanh":       unary(math.Tanh),
+		"Erf":        unary(math.Erf),
+		"LeakyRelu": func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+			alpha := float64(c.float("alpha", 0.01))
+			return unary(func(x float64) float64 {
+				if x < 0 {
+					return alpha * x
+				}
+				return x
+			})(c, in)
+		},
+		"HardSigmoid": func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+			alpha, beta := float64(c.float("alpha", 0.2)), float64(c.float("beta", 0.5))
+			return unary(func(x float64) float64 { return max(0, min(1, alpha*x+beta)) })(c, in)
+		},
+		"Clip":     clip,
+		"Identity": identity,
+		"Dropout":  identity,
+
+		"Add": binary(func(a, b float32) float32 { return a + b }, func(a, b int64) int64 { return a + b }),
+		"Sub": binary(func(a, b float32) float32 { return a - b }, func(a, b int64) int64 { return a - b }),
+		"Mul": binary(func(a, b float32) float32 { return a * b }, func(a, b int64) int64 { return a * b }),
+		"Div": binary(func(a, b float32) float32 { return a / b }, func(a, b int64) int64 {
+			if b == 0 {
+				return 0
+			}
+			return a / b
+		}),
+		"Pow": binary(func(a, b float32) float32 { return float32(math.Pow(float64(a), float64(b))) },
+			func(a, b int64) int64 { return int64(math.Pow(float64(a), float64(b))) }),
+		"Max": variadic(func(a, b float32) float32 { return max(a, b) }, func(a, b int64) int64 { return max(a, b) }),
+		"Min": variadic(func(a, b float32) float32 { return min(a, b) }, func(a, b int64) int64 { return min(a, b) }),
+		"Sum": variadic(func(a, b float32) float32 { return a + b }, func(a, b int64) int64 { return a + b }),
+
+		"Equal":   compare(func(a, b float64) bool { return a == b }),
+		"Greater": compare(func(a, b float64) bool { return a > b }),
+		"Less":    compare(func(a, b float64) bool { return a < b }),
+		"Not":     not,
+		"Where":   where,
+
+		// shapes and indexing
+		"Cast":            cast,
+		"Concat":          concat,
+		"Constant":        constant,
+		"ConstantOfShape": constantOfShape,
+		"Expand":          expand,
+		"Flatten":         flatten,
+		"Gather":          gather,
+		"Pad":             pad,
+		"Range":           rangeOp,
+		"Reshape":         reshape,
+		"Shape":           shapeOp,
+		"Slice":           slice,
+		"Split":           split,
+		"Squeeze":         squeeze,
+		"Transpose":       transpose,
+		"Unsqueeze":       unsqueeze,
+
+		// neural network layers
+		"AveragePool":        averagePool,
+		"BatchNormalization": batchNormalization,
+		"Conv":               conv,
+		"ConvTranspose":      convTranspose,
+		"Gemm":               gemm,
+		"GlobalAveragePool":  globalAveragePool,
+		"GlobalMaxPool":      globalMaxPool,
+		"MatMul":             matMul,
+		"MaxPool":            maxPool,
+		"ReduceMean":         reduce(func(acc []float64, n int) { scaleAll(acc, 1/float64(n)) }, 0, func(a, b float64) float64 { return a + b }),
+		"ReduceMax":          reduce(nil, math.Inf(-1), math.Max),
+		"ReduceSum":          reduce(nil, 0, func(a, b float64) float64 { return a + b }),
+		"Resize":             resize,
+		"Softmax":            softmax,
+		"Upsample":           upsample,
+
+		// 8-bit quantization
+		"DequantizeLinear": dequantizeLinear,
+		"MatMulInteger":    matMulInteger,
+		"QLinearConv":      qlinearConv,
+		"QuantizeLinear":   quantizeLinear,
+	}
+}
+
+// packedKernels take UINT8 and INT8 inputs packed in Tensor.Bytes; every
+// other kernel sees them widened to Ints.
+var packedKernels = map[string]bool{
+	"DequantizeLinear": true,
+	"MatMulInteger":    true,
+	"QLinearConv":      true,
+	"QuantizeLinear":   true,
+	// these only reshape their input and keep it packed
+	"Dropout":   true,
+	"Flatten":   true,
+	"Identity":  true,
+	"Reshape":   true,
+	"Squeeze":   true,
+	"Unsqueeze": true,
+}
+
+// unary applies f to every element; integer tensors keep their type.
+func unary(f func(float64) float64) kernel {
+	return func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+		if err := need(in, 1); err != nil {
+			return nil, err
+		}
+		x := in[0]
+		out := x.like(x.Shape)
+		if x.IsInt() {
+			for i, v := range x.Ints {
+				out.Ints[i] = int64(f(float64(v)))
+			}
+		} else {
+			for i, v := range x.Data {
+				out.Data[i] = float32(f(float64(v)))
+			}
+		}
+		return one(out)
+	}
+}
+
+func identity(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	return one(in[0])
+}
+
+// clip bounds values by the min and max attributes (opset < 11) or the
+// optional scalar inputs 1 and 2.
+func clip(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	lo, hi := math.Inf(-1), math.Inf(1)
+	if c.opset < 11 {
+		lo = float64(c.float("min", float32(lo)))
+		hi = float64(c.float("max", float32(hi)))
+	} else {
+		if t := optional(in, 1); t != nil && t.Len() > 0 {
+			lo = float64(t.Float32s()[0])
+		}
+		if t := optional(in, 2); t != nil && t.Len() > 0 {
+			hi = float64(t.Float32s()[0])
+		}
+	}
+	return unary(func(x float64) float64 { return max(lo, min(hi, x)) })(c, in)
+}
+
+// binary applies a broadcasting arithmetic operator, with fi used when both
+// operands are integer tensors.
+func binary(f func(a, b float32) float32, fi func(a, b int64) int64) kernel {
+	return func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+		if err := need(in, 2); err != nil {
+			return nil, err
+		}
+		out, err := applyBinary(in[0], in[1], f, fi)
+		if err != nil {
+			return nil, err
+		}
+		return one(out)
+	}
+}
+
+// variadic folds a binary operator over any number of inputs.
+func variadic(f func(a, b float32) float32, fi func(a, b int64) int64) kernel {
+	return func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+		if err := need(in, 1); err != nil {
+			return nil, err
+		}
+		acc := in[0]
+		for _, t := range in[1:] {
+			var err error
+			if acc, err = applyBinary(acc, t, f, fi); err != nil {
+				return nil, err
+			}
+		}
+		return one(acc)
+	}
+}
+
+func applyBinary(a, b *Tensor, f func(a, b float32) float32, fi func(a, b int64) int64) (*Tensor, error) {
+	shape, err := broadcastShape(a.Shape, b.Shape)
+	if err != nil {
+		return nil, err
+	}
+	if a.IsInt() && b.IsInt() {
+		out := a.like(shape)
+		x, y := a.Ints, b.Ints
+		switch {
+		case len(x) == len(out.Ints) && len(y) == len(out.Ints):
+			for i := range out.Ints {
+				out.Ints[i] = fi(x[i], y[i])
+			}
+		default:
+			broadcastIndex(shape, [][]int{broadcastStrides(a.Shape, shape), broadcastStrides(b.Shape, shape)}, func(o int, idx []int) {
+				out.Ints[o] = fi(x[idx[0]], y[idx[1]])
+			})
+		}
+		return out, nil
+	}
+	out := zeros(shape)
+	x, y := a.Float32s(), b.Float32s()
+	switch {
+	case len(x) == len(out.Data) && len(y) == len(out.Data):
+		for i := range out.Data {
+			out.Data[i] = f(x[i], y[i])
+		}
+	case len(y) == 1:
+		for i := range out.Data {
+			out.Data[i] = f(x[i], y[0])
+		}
+	default:
+		broadcastIndex(shape, [][]int{broadcastStrides(a.Shape, shape), broadcastStrides(b.Shape, shape)}, func(o int, idx []int) {
+			out.Data[o] = f(x[idx[0]], y[idx[1]])
+		})
+	}
+	return out, nil
+}
+
+// compare applies a broadcasting comparison returning a BOOL tensor.
+func compare(f func(a, b float64) bool) kernel {
+	return func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+		if err := need(in, 2); err != nil {
+			return nil, err
+		}
+		a, b := in[0], in[1]
+		shape, err := broadcastShape(a.Shape, b.Shape)
+		if err != nil {
+			return nil, err
+		}
+		out := &Tensor{Shape: shape, DType: onnx.Bool, Ints: make([]int64, numElements(shape))}
+		x, y := values64(a), values64(b)
+		broadcastIndex(shape, [][]int{broadcastStrides(a.Shape, shape), broadcastStrides(b.Shape, shape)}, func(o int, idx []int) {
+			if f(x[idx[0]], y[idx[1]]) {
+				out.Ints[o] = 1
+			}
+		})
+		return one(out)
+	}
+}
+
+func values64(t *Tensor) []float64 {
+	out := make([]float64, t.Len())
+	if t.IsInt() {
+		for i, v := range t.Ints {
+			out[i] = float64(v)
+		}
+	} else {
+		for i, v := range t.Data {
+			out[i] = float64(v)
+		}
+	}
+	return out
+}
+
+func not(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	out := &Tensor{Shape: in[0].Shape, DType: onnx.Bool, Ints: make([]int64, in[0].Len())}
+	for i, v := range in[0].Int64s() {
+		if v == 0 {
+			out.Ints[i] = 1
+		}
+	}
+	return one(out)
+}
+
+// where selects from x where cond is true and from y elsewhere.
+func where(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 3); err != nil {
+		return nil, err
+	}
+	cond, x, y := in[0], in[1], in[2]
+	shape, err := broadcastShape(cond.Shape, x.Shape, y.Shape)
+	if err != nil {
+		return nil, err
+	}
+	st := [][]int{broadcastStrides(cond.Shape, shape), broadcastStrides(x.Shape, shape), broadcastStrides(y.Shape, shape)}
+	cv := cond.Int64s()
+	out := x.like(shape)
+	if out.IsInt() {
+		xv, yv := x.Int64s(), y.Int64s()
+		broadcastIndex(shape, st, func(o int, idx []int) {
+			if cv[idx[0]] != 0 {
+				out.Ints[o] = xv[idx[1]]
+			} else {
+				out.Ints[o] = yv[idx[2]]
+			}
+		})
+	} else {
+		xv, yv := x.Float32s(), y.Float32s()
+		broadcastIndex(shape, st, func(o int, idx []int) {
+			if cv[idx[0]] != 0 {
+				out.Data[o] = xv[idx[1]]
+			} else {
+				out.Data[o] = yv[idx[2]]
+			}
+		})
+	}
+	return one(out)
+}
+
+// reduce builds a ReduceXxx kernel folding with f from init; finish, if set,
+// adjusts the accumulated values given the number of reduced elements.
+func reduce(finish func(acc []float64, n int), init float64, f func(a, b float64) float64) kernel {
+	return func(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+		if err := need(in, 1); err != nil {
+			return nil, err
+		}
+		x := in[0]
+		axes := c.ints("axes", nil)
+		// ReduceSum takes axes as an input from opset 13, the others from 18
+		if t := optional(in, 1); t != nil {
+			axes = t.Int64s()
+		}
+		reduced := make([]bool, len(x.Shape))
+		if len(axes) == 0 {
+			if c.int("noop_with_empty_axes", 0) != 0 {
+				return one(x)
+			}
+			for i := range reduced {
+				reduced[i] = true
+			}
+		}
+		for _, a := range axes {
+			i, err := normAxis(a, len(x.Shape))
+			if err != nil {
+				return nil, err
+			}
+			reduced[i] = true
+		}
+		keep := c.int("keepdims", 1) != 0
+		var shape, kept []int
+		for i, d := range x.Shape {
+			if reduced[i] {
+				kept = append(kept, 1)
+				if keep {
+					shape = append(shape, 1)
+				}
+			} else {
+				kept = append(kept, d)
+				shape = append(shape, d)
+			}
+		}
+		acc := make([]float64, numElements(kept))
+		for i := range acc {
+			acc[i] = init
+		}
+		xv := values64(x)
+		broadcastIndex(x.Shape, [][]int{broadcastStrides(kept, x.Shape)}, func(o int, idx []int) {
+			acc[idx[0]] = f(acc[idx[0]], xv[o])
+		})
+		if finish != nil && len(acc) > 0 {
+			finish(acc, len(xv)/len(acc))
+		}
+		out := zeros(shape)
+		for i, v := range acc {
+			out.Data[i] = float32(v)
+		}
+		return one(out)
+	}
+}
+
+func scaleAll(v []float64, s float64) {
+	for i := range v {
+		v[i] *= s
+	}
+}
+
+// softmax normalises along axis (default -1; from opset 13 only that axis,
+// before it the input is flattened to 2-D at axis, default 1).
+func softmax(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	def := int64(-1)
+	if c.opset < 13 {
+		def = 1
+	}
+	axis, err := normAxis(c.int("axis", def), len(x.Shape))
+	if err != nil {
+		return nil, err
+	}
+	outer := numElements(x.Shape[:axis])
+	n, inner := x.Shape[axis], numElements(x.Shape[axis+1:])
+	if c.opset < 13 {
+		n, inner = n*inner, 1
+	}
+	xv := x.Float32s()
+	out := zeros(x.Shape)
+	for o := 0; o < outer; o++ {
+		for i := 0; i < inner; i++ {
+			base := o*n*inner + i
+			m := float32(math.Inf(-1))
+			for k := 0; k < n; k++ {
+				m = max(m, xv[base+k*inner])
+			}
+			var sum float64
+			for k := 0; k < n; k++ {
+				e := math.Exp(float64(xv[base+k*inner] - m))
+				out.Data[base+k*inner] = float32(e)
+				sum += e
+			}
+			for k := 0; k < n; k++ {
+				out.Data[base+k*inner] /= float32(sum)
+			}
+		}
+	}
+	return one(out)
+}
@@ -0,0 +1,653 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// window is the resolved geometry of a 2-D convolution or pooling window
+// over an ih x iw input.
+type window struct {
+	kh, kw, sh, sw, dh, dw int
+	// padding: top, left, bottom, right
+	pt, pl, pb, pr int
+	oh, ow         int
+}
+
+// newWindow resolves kernel_shape, strides, dilations, pads and auto_pad
+// for a kh x kw kernel; ceil selects ceil_mode output sizes for pooling.
+func newWindow(c *nodeContext, ih, iw, kh, kw int, ceil bool) (window, error) {
+	w := window{kh: kh, kw: kw, sh: 1, sw: 1, dh: 1, dw: 1}
+	if s := c.ints("strides", nil); len(s) == 2 {
+		w.sh, w.sw = int(s[0]), int(s[1])
+	}
+	if d := c.ints("dilations", nil); len(d) == 2 {
+		w.dh, w.dw = int(d[0]), int(d[1])
+	}
+	if w.sh < 1 || w.sw < 1 || w.dh < 1 || w.dw < 1 {
+		return w, fmt.Errorf("strides and dilations must be positive")
+	}
+	ekh, ekw := (kh-1)*w.dh+1, (kw-1)*w.dw+1
+	switch pad := c.str("auto_pad", "NOTSET"); pad {
+	case "NOTSET":
+		if p := c.ints("pads", nil); len(p) == 4 {
+			w.pt, w.pl, w.pb, w.pr = int(p[0]), int(p[1]), int(p[2]), int(p[3])
+		} else if p != nil {
+			return w, fmt.Errorf("pads %v, want 4 values", p)
+		}
+	case "VALID":
+	case "SAME_UPPER", "SAME_LOWER":
+		oh, ow := (ih+w.sh-1)/w.sh, (iw+w.sw-1)/w.sw
+		th := max(0, (oh-1)*w.sh+ekh-ih)
+		tw := max(0, (ow-1)*w.sw+ekw-iw)
+		w.pt, w.pl = th/2, tw/2
+		if pad == "SAME_LOWER" {
+			w.pt, w.pl = th-th/2, tw-tw/2
+		}
+		w.pb, w.pr = th-w.pt, tw-w.pl
+	default:
+		return w, fmt.Errorf("unsupported auto_pad %q", pad)
+	}
+	outSize := func(in, pb, pe, ek, s int) int {
+		span := in + pb + pe - ek
+		if span < 0 {
+			return 0
+		}
+		if !ceil {
+			return span/s + 1
+		}
+		out := (span+s-1)/s + 1
+		// the last window must start inside the input or left padding
+		if (out-1)*s >= in+pb {
+			out--
+		}
+		return out
+	}
+	w.oh = outSize(ih, w.pt, w.pb, ekh, w.sh)
+	w.ow = outSize(iw, w.pl, w.pr, ekw, w.sw)
+	return w, nil
+}
+
+// span returns the range [lo, hi) of output positions o whose input
+// coordinate o*stride+off lies in [0, n).
+func span(off, stride, n, outN int) (lo, hi int) {
+	if off < 0 {
+		lo = (-off + stride - 1) / stride
+	}
+	if n-1-off < 0 {
+		return lo, lo
+	}
+	hi = min(outN, (n-1-off)/stride+1)
+	return lo, max(lo, hi)
+}
+
+// image4 checks that x is an NCHW tensor.
+func image4(x *Tensor) (n, c, h, w int, err error) {
+	if len(x.Shape) != 4 || x.IsInt() {
+		return 0, 0, 0, 0, fmt.Errorf("input shape %v: only 2-D (NCHW) float tensors are supported", x.Shape)
+	}
+	return x.Shape[0], x.Shape[1], x.Shape[2], x.Shape[3], nil
+}
+
+// conv computes a grouped, strided and dilated 2-D convolution.
+func conv(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	return convolve(c, in, false)
+}
+
+// convolve runs Conv, clamping the result at zero when relu is set (the
+// fused Conv, BatchNormalization and Relu). Ungrouped convolutions lower to
+// im2col and a blocked GEMM, grouped ones are computed directly; both split
+// the output channels across goroutines.
+func convolve(c *nodeContext, in []*Tensor, relu bool) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	x, w, bias := in[0], in[1], optional(in, 2)
+	n, ch, ih, iw, err := image4(x)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.Shape) != 4 {
+		return nil, fmt.Errorf("weight shape %v, want [M, C/group, kH, kW]", w.Shape)
+	}
+	group := int(c.int("group", 1))
+	oc, icg, kh, kw := w.Shape[0], w.Shape[1], w.Shape[2], w.Shape[3]
+	if group < 1 || ch != icg*group || oc%group != 0 {
+		return nil, fmt.Errorf("weight shape %v does not fit %d input channels in %d groups", w.Shape, ch, group)
+	}
+	if bias != nil && bias.Len() != oc {
+		return nil, fmt.Errorf("bias has %d values for %d output channels", bias.Len(), oc)
+	}
+	win, err := newWindow(c, ih, iw, kh, kw, false)
+	if err != nil {
+		return nil, err
+	}
+	out := zeros([]int{n, oc, win.oh, win.ow})
+	ocg := oc / group
+	plane, oplane := ih*iw, win.oh*win.ow
+	for b := 0; b < n; b++ {
+		src := x.Data[b*ch*plane:][:ch*plane]
+		dst := out.Data[b*oc*oplane:][:oc*oplane]
+		if bias != nil {
+			for m, bv := range bias.Data {
+				fill(dst[m*oplane:][:oplane], bv)
+			}
+		}
+		if group == 1 {
+			convGEMM(c.threads, dst, src, w.Data, ch, ih, iw, oc, win)
+			continue
+		}
+		parallelFor(c.threads, oc, 1, func(lo, hi int) {
+			for m := lo; m < hi; m++ {
+				g := m / ocg
+				convDirect(dst[m*oplane:][:oplane], src[g*icg*plane:][:icg*plane], w.Data[m*icg*kh*kw:][:icg*kh*kw], icg, ih, iw, win)
+			}
+		})
+	}
+	if relu {
+		for i, v := range out.Data {
+			if v < 0 {
+				out.Data[i] = 0
+			}
+		}
+	}
+	return one(out)
+}
+
+// convGEMM accumulates an ungrouped convolution of one ch x ih x iw image
+// into dst, laid out as output channels x output pixels. A 1x1 unit-stride
+// unpadded kernel multiplies the image directly; otherwise the image is
+// unfolded (im2col) a strip of output rows at a time, which bounds the
+// scratch buffer for large inputs.
+func convGEMM(threads int, dst, src, w []float32, ch, ih, iw, oc int, win window) {
+	k := ch * win.kh * win.kw
+	oplane := win.oh * win.ow
+	if win.kh == 1 && win.kw == 1 && win.sh == 1 && win.sw == 1 && win.pt == 0 && win.pl == 0 && win.pb == 0 && win.pr == 0 {
+		parallelSgemm(threads, oc, oplane, k, w, k, src, oplane, dst, oplane)
+		return
+	}
+	// strips of whole output rows, about 256 Ki unfolded values each
+	rows := max(1, min(win.oh, (1<<18)/max(1, k*win.ow)))
+	cols := alloc(k * rows * win.ow)
+	defer recycle(cols)
+	for y0 := 0; y0 < win.oh; y0 += rows {
+		y1 := min(win.oh, y0+rows)
+		n := (y1 - y0) * win.ow
+		parallelFor(threads, ch, max(1, 4096/max(1, win.kh*win.kw*n)), func(lo, hi int) {
+			im2col(cols[:k*n], src, lo, hi, ih, iw, y0, y1, win)
+		})
+		parallelSgemm(threads, oc, n, k, w, k, cols, n, dst[y0*win.ow:], oplane)
+	}
+}
+
+// im2col writes the input patches of channels [c0, c1) for output rows
+// [y0, y1) into cols: one row per (channel, ky, kx) and one column per
+// output pixel, with taps that fall in the padding read as zero.
+func im2col(cols, src []float32, c0, c1, ih, iw, y0, y1 int, win window) {
+	n := (y1 - y0) * win.ow
+	r := c0 * win.kh * win.kw
+	for ic := c0; ic < c1; ic++ {
+		plane := src[ic*ih*iw:][:ih*iw]
+		for ky := 0; ky < win.kh; ky++ {
+			offY := ky*win.dh - win.pt
+			for kx := 0; kx < win.kw; kx++ {
+				offX := kx*win.dw - win.pl
+				x0, x1 := span(offX, win.sw, iw, win.ow)
+				x0, x1 = min(x0, win.ow), min(x1, win.ow)
+				row := cols[r*n:][:n]
+				r++
+				for oy := y0; oy < y1; oy++ {
+					d := row[(oy-y0)*win.ow:][:win.ow]
+					iy := oy*win.sh + offY
+					if iy < 0 || iy >= ih {
+						clear(d)
+						continue
+					}
+					clear(d[:x0])
+					clear(d[x1:])
+					s := plane[iy*iw:][:iw]
+					if win.sw == 1 {
+						copy(d[x0:x1], s[x0+offX:x1+offX])
+						continue
+					}
+					for ox := x0; ox < x1; ox++ {
+						d[ox] = s[ox*win.sw+offX]
+					}
+				}
+			}
+		}
+	}
+}
+
+// convDirect accumulates one output channel of a grouped convolution into
+// dst from the icg input planes of its group in src and its weights w.
+func convDirect(dst, src, w []float32, icg, ih, iw int, win window) {
+	plane := ih * iw
+	for ic := 0; ic < icg; ic++ {
+		in := src[ic*plane:][:plane]
+		for ky := 0; ky < win.kh; ky++ {
+			offY := ky*win.dh - win.pt
+			y0, y1 := span(offY, win.sh, ih, win.oh)
+			for kx := 0; kx < win.kw; kx++ {
+				wv := w[(ic*win.kh+ky)*win.kw+kx]
+				if wv == 0 {
+					continue
+				}
+				offX := kx*win.dw - win.pl
+				x0, x1 := span(offX, win.sw, iw, win.ow)
+				for oy := y0; oy < y1; oy++ {
+					row := in[(oy*win.sh+offY)*iw:]
+					drow := dst[oy*win.ow:]
+					if win.sw == 1 {
+						r := row[x0+offX : x1+offX]
+						for i, v := range r {
+							drow[x0+i] += wv * v
+						}
+						continue
+					}
+					for ox := x0; ox < x1; ox++ {
+						drow[ox] += wv * row[ox*win.sw+offX]
+					}
+				}
+			}
+		}
+	}
+}
+
+// fill sets every value of v to x.
+func fill(v []float32, x float32) {
+	for i := range v {
+		v[i] = x
+	}
+}
+
+// convTranspose computes a grouped, strided and dilated 2-D transposed
+// convolution, honouring output_padding, output_shape and auto_pad.
+func convTranspose(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	x, w, bias := in[0], in[1], optional(in, 2)
+	n, ch, ih, iw, err := image4(x)
+	if err != nil {
+		return nil, err
+	}
+	group := int(c.int("group", 1))
+	if len(w.Shape) != 4 || w.Shape[0] != ch || group < 1 || ch%group != 0 {
+		return nil, fmt.Errorf("weight shape %v does not fit %d input channels in %d groups", w.Shape, ch, group)
+	}
+	ocg, kh, kw := w.Shape[1], w.Shape[2], w.Shape[3]
+	oc, icg := ocg*group, ch/group
+	if bias != nil && bias.Len() != oc {
+		return nil, fmt.Errorf("bias has %d values for %d output channels", bias.Len(), oc)
+	}
+	sh, sw, dh, dw := 1, 1, 1, 1
+	if s := c.ints("strides", nil); len(s) == 2 {
+		sh, sw = int(s[0]), int(s[1])
+	}
+	if d := c.ints("dilations", nil); len(d) == 2 {
+		dh, dw = int(d[0]), int(d[1])
+	}
+	var oph, opw int
+	if p := c.ints("output_padding", nil); len(p) == 2 {
+		oph, opw = int(p[0]), int(p[1])
+	}
+	var pt, pl, pb, pr int
+	if p := c.ints("pads", nil); len(p) == 4 {
+		pt, pl, pb, pr = int(p[0]), int(p[1]), int(p[2]), int(p[3])
+	}
+	full := func(in, s, k, d, op int) int { return s*(in-1) + op + (k-1)*d + 1 }
+	oh := full(ih, sh, kh, dh, oph) - pt - pb
+	ow := full(iw, sw, kw, dw, opw) - pl - pr
+	autoPad := c.str("auto_pad", "NOTSET")
+	target := c.ints("output_shape", nil)
+	if len(target) >= 2 || autoPad == "SAME_UPPER" || autoPad == "SAME_LOWER" {
+		if len(target) >= 2 {
+			oh, ow = int(target[len(target)-2]), int(target[len(target)-1])
+		} else {
+			oh, ow = ih*sh, iw*sw
+		}
+		th := full(ih, sh, kh, dh, oph) - oh
+		tw := full(iw, sw, kw, dw, opw) - ow
+		if autoPad == "SAME_UPPER" {
+			pt, pl = th/2, tw/2
+		} else {
+			pt, pl = th-th/2, tw-tw/2
+		}
+	}
+	if oh <= 0 || ow <= 0 {
+		return nil, fmt.Errorf("output size %dx%d is empty", oh, ow)
+	}
+	out := zeros([]int{n, oc, oh, ow})
+	plane, oplane := ih*iw, oh*ow
+	for b := 0; b < n; b++ {
+		// each goroutine owns the output planes of its channels
+		parallelFor(c.threads, oc, 1, func(lo, hi int) {
+			for m := lo; m < hi; m++ {
+				dst := out.Data[(b*oc+m)*oplane:][:oplane]
+				if bias != nil {
+					fill(dst, bias.Data[m])
+				}
+				g, mg := m/ocg, m%ocg
+				for ic := 0; ic < icg; ic++ {
+					cin := g*icg + ic
+					src := x.Data[(b*ch+cin)*plane:][:plane]
+					for ky := 0; ky < kh; ky++ {
+						offY := ky*dh - pt
+						for kx := 0; kx < kw; kx++ {
+							wv := w.Data[((cin*ocg+mg)*kh+ky)*kw+kx]
+							if wv == 0 {
+								continue
+							}
+							offX := kx*dw - pl
+							for iy := 0; iy < ih; iy++ {
+								oy := iy*sh + offY
+								if oy < 0 || oy >= oh {
+									continue
+								}
+								row := src[iy*iw:][:iw]
+								drow := dst[oy*ow:][:ow]
+								for ix, v := range row {
+									if ox := ix*sw + offX; ox >= 0 && ox < ow {
+										drow[ox] += wv * v
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		})
+	}
+	return one(out)
+}
+
+// batchNormalization applies inference-mode normalization per channel
+// (axis 1) of an input of any rank.
+func batchNormalization(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 5); err != nil {
+		return nil, err
+	}
+	if c.int("training_mode", 0) != 0 {
+		return nil, fmt.Errorf("training mode is not supported")
+	}
+	x := in[0]
+	if len(x.Shape) < 2 || x.IsInt() {
+		return nil, fmt.Errorf("input shape %v: want a float tensor [N, C, ...]", x.Shape)
+	}
+	channels := x.Shape[1]
+	scale, bias, mean, variance := in[1].Float32s(), in[2].Float32s(), in[3].Float32s(), in[4].Float32s()
+	for _, p := range [][]float32{scale, bias, mean, variance} {
+		if len(p) != channels {
+			return nil, fmt.Errorf("parameters have %d values for %d channels", len(p), channels)
+		}
+	}
+	eps := float64(c.float("epsilon", 1e-5))
+	inner := numElements(x.Shape[2:])
+	out := zeros(x.Shape)
+	for i := 0; i < x.NumElements(); i += inner {
+		ch := (i / inner) % channels
+		k := scale[ch] / float32(math.Sqrt(float64(variance[ch])+eps))
+		off := bias[ch] - mean[ch]*k
+		dst, src := out.Data[i:i+inner], x.Data[i:i+inner]
+		for j, v := range src {
+			dst[j] = v*k + off
+		}
+	}
+	return one(out)
+}
+
+// pool2d runs a max or average pooling window over an NCHW input.
+func pool2d(c *nodeContext, in []*Tensor, average bool) (*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	n, ch, ih, iw, err := image4(x)
+	if err != nil {
+		return nil, err
+	}
+	k := c.ints("kernel_shape", nil)
+	if len(k) != 2 {
+		return nil, fmt.Errorf("kernel_shape %v, want 2 values", k)
+	}
+	if len(c.Outputs) > 1 && c.Outputs[1] != "" {
+		return nil, fmt.Errorf("the Indices output is not supported")
+	}
+	win, err := newWindow(c, ih, iw, int(k[0]), int(k[1]), c.int("ceil_mode", 0) != 0)
+	if err != nil {
+		return nil, err
+	}
+	includePad := c.int("count_include_pad", 0) != 0
+	out := zeros([]int{n, ch, win.oh, win.ow})
+	plane, oplane := ih*iw, win.oh*win.ow
+	for p := 0; p < n*ch; p++ {
+		src, dst := x.Data[p*plane:][:plane], out.Data[p*oplane:][:oplane]
+		for oy := 0; oy < win.oh; oy++ {
+			for ox := 0; ox < win.ow; ox++ {
+				acc := float32(math.Inf(-1))
+				if average {
+					acc = 0
+				}
+				count := 0
+				for ky := 0; ky < win.kh; ky++ {
+					y := oy*win.sh - win.pt + ky*win.dh
+					for kx := 0; kx < win.kw; kx++ {
+						x := ox*win.sw - win.pl + kx*win.dw
+						if y < 0 || y >= ih || x < 0 || x >= iw {
+							// padding counts only inside the padded input
+							if includePad && y < ih+win.pb && x < iw+win.pr {
+								count++
+							}
+							continue
+						}
+						v := src[y*iw+x]
+						if average {
+							acc += v
+						} else {
+							acc = max(acc, v)
+						}
+						count++
+					}
+				}
+				if average && count > 0 {
+					acc /= float32(count)
+				}
+				dst[oy*win.ow+ox] = acc
+			}
+		}
+	}
+	return out, nil
+}
+
+func maxPool(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	out, err := pool2d(c, in, false)
+	if err != nil {
+		return nil, err
+	}
+	return one(out)
+}
+
+func averagePool(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	out, err := pool2d(c, in, true)
+	if err != nil {
+		return nil, err
+	}
+	return one(out)
+}
+
+// globalPool reduces every spatial dimension of an [N, C, ...] input.
+func globalPool(in []*Tensor, average bool) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	if len(x.Shape) < 3 || x.IsInt() {
+		return nil, fmt.Errorf("input shape %v: want a float tensor [N, C, ...]", x.Shape)
+	}
+	shape := slices.Clone(x.Shape)
+	for i := 2; i < len(shape); i++ {
+		shape[i] = 1
+	}
+	inner := numElements(x.Shape[2:])
+	out := zeros(shape)
+	for p := range out.Data {
+		src := x.Data[p*inner:][:inner]
+		acc := float32(math.Inf(-1))
+		if average {
+			acc = 0
+		}
+		for _, v := range src {
+			if average {
+				acc += v
+			} else {
+				acc = max(acc, v)
+			}
+		}
+		if average && inner > 0 {
+			acc /= float32(inner)
+		}
+		out.Data[p] = acc
+	}
+	return one(out)
+}
+
+func globalAveragePool(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	return globalPool(in, true)
+}
+
+func globalMaxPool(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	return globalPool(in, false)
+}
+
+// matmulInto accumulates the m x k by k x n product of a and b into out,
+// on up to threads goroutines.
+func matmulInto(threads int, out, a, b []float32, m, k, n int) {
+	parallelSgemm(threads, m, n, k, a, k, b, n, out, n)
+}
+
+// matmulShape resolves numpy matmul shapes: 1-D operands are promoted to
+// matrices and leading batch dimensions broadcast.
+type matmulShape struct {
+	m, k, n int
+	batch   []int
+	// batch strides of each operand, counted in matrices
+	ast, bst []int
+	// out is the result shape, without the promoted dimensions
+	out []int
+}
+
+func newMatmulShape(a, b []int) (matmulShape, error) {
+	var s matmulShape
+	as, bs := slices.Clone(a), slices.Clone(b)
+	if len(as) == 0 || len(bs) == 0 {
+		return s, fmt.Errorf("scalar operands are not allowed")
+	}
+	if len(as) == 1 {
+		as = []int{1, as[0]}
+	}
+	if len(bs) == 1 {
+		bs = []int{bs[0], 1}
+	}
+	s.m, s.k, s.n = as[len(as)-2], as[len(as)-1], bs[len(bs)-1]
+	if bs[len(bs)-2] != s.k {
+		return s, fmt.Errorf("shapes %v and %v do not multiply", a, b)
+	}
+	batch, err := broadcastShape(as[:len(as)-2], bs[:len(bs)-2])
+	if err != nil {
+		return s, err
+	}
+	s.batch = batch
+	s.ast = broadcastStrides(as[:len(as)-2], batch)
+	s.bst = broadcastStrides(bs[:len(bs)-2], batch)
+	s.out = append(slices.Clone(batch), s.m, s.n)
+	// drop the promoted dimensions again
+	if len(a) == 1 {
+		s.out = append(s.out[:len(s.out)-2], s.out[len(s.out)-1])
+	}
+	if len(b) == 1 {
+		s.out = s.out[:len(s.out)-1]
+	}
+	return s, nil
+}
+
+// each calls fn with the index of every product in the batch and the
+// matrices of a and b it multiplies.
+func (s matmulShape) each(fn func(o, ai, bi int)) {
+	if len(s.batch) == 0 {
+		fn(0, 0, 0)
+		return
+	}
+	broadcastIndex(s.batch, [][]int{s.ast, s.bst}, func(o int, idx []int) {
+		fn(o, idx[0], idx[1])
+	})
+}
+
+// matMul multiplies with numpy semantics.
+func matMul(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	s, err := newMatmulShape(in[0].Shape, in[1].Shape)
+	if err != nil {
+		return nil, err
+	}
+	m, k, n := s.m, s.k, s.n
+	out := zeros(s.out)
+	av, bv := in[0].Float32s(), in[1].Float32s()
+	s.each(func(o, ai, bi int) {
+		matmulInto(c.threads, out.Data[o*m*n:][:m*n], av[ai*m*k:][:m*k], bv[bi*k*n:][:k*n], m, k, n)
+	})
+	return one(out)
+}
+
+// gemm computes alpha*A'*B' + beta*C for 2-D A and B, optionally
+// transposed, with C broadcast to the result.
+func gemm(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	a, b := in[0], in[1]
+	if len(a.Shape) != 2 || len(b.Shape) != 2 {
+		return nil, fmt.Errorf("shapes %v and %v: want matrices", a.Shape, b.Shape)
+	}
+	av, bv := a.Float32s(), b.Float32s()
+	m, k := a.Shape[0], a.Shape[1]
+	if c.int("transA", 0) != 0 {
+		av, m, k = transpose2(av, m, k), k, m
+	}
+	kb, n := b.Shape[0], b.Shape[1]
+	if c.int("transB", 0) != 0 {
+		bv, kb, n = transpose2(bv, kb, n), n, kb
+	}
+	if kb != k {
+		return nil, fmt.Errorf("shapes %v and %v do not multiply", a.Shape, b.Shape)
+	}
+	out := zeros([]int{m, n})
+	matmulInto(c.threads, out.Data, av, bv, m, k, n)
+	if alpha := c.float("alpha", 1); alpha != 1 {
+		for i := range out.Data {
+			out.Data[i] *= alpha
+		}
+	}
+	if t := optional(in, 2); t != nil {
+		beta := c.float("beta", 1)
+		sum, err := applyBinary(out, t, func(x, y float32) float32 { return x + beta*y }, nil)
+		if err != nil {
+			return nil, err
+		}
+		out = sum
+	}
+	return one(out)
+}
+
+func transpose2(v []float32, rows, cols int) []float32 {
+	out := make([]float32, len(v))
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			out[j*rows+i] = v[i*cols+j]
+		}
+	}
+	return out
+}
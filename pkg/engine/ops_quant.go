@@ -0,0 +1,286 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// quantParams is the scale and zero point of a quantized tensor, either
+// per tensor or per slice along one axis.
+type quantParams struct {
+	scale []float32
+	zero  []int32
+	// inner is the length of each run of elements sharing a channel, or 0
+	// for per-tensor parameters.
+	inner int
+}
+
+// newQuantParams reads scale and the optional zero point for a tensor of
+// shape. A scale of more than one value applies along axis.
+func newQuantParams(shape []int, axis int64, scale, zero *Tensor) (quantParams, error) {
+	q := quantParams{scale: scale.Float32s()}
+	if len(q.scale) == 0 {
+		return q, fmt.Errorf("empty scale")
+	}
+	q.zero = make([]int32, len(q.scale))
+	if zero != nil {
+		z := zero.Int64s()
+		if len(z) != len(q.scale) {
+			return q, fmt.Errorf("%d zero points for %d scales", len(z), len(q.scale))
+		}
+		for i, v := range z {
+			q.zero[i] = int32(v)
+		}
+	}
+	if len(q.scale) == 1 {
+		return q, nil
+	}
+	a, err := normAxis(axis, len(shape))
+	if err != nil {
+		return q, err
+	}
+	if shape[a] != len(q.scale) {
+		return q, fmt.Errorf("%d scales for axis %d of shape %v", len(q.scale), a, shape)
+	}
+	q.inner = numElements(shape[a+1:])
+	return q, nil
+}
+
+// runs calls fn for each run [lo, hi) of n elements sharing channel ch.
+func (q quantParams) runs(n int, fn func(lo, hi, ch int)) {
+	if q.inner == 0 {
+		fn(0, n, 0)
+		return
+	}
+	for lo, ch := 0, 0; lo < n; lo, ch = lo+q.inner, (ch+1)%len(q.scale) {
+		fn(lo, lo+q.inner, ch)
+	}
+}
+
+// quantRange returns the values an 8-bit type holds.
+func quantRange(dtype onnx.DataType) (lo, hi float64, err error) {
+	switch dtype {
+	case onnx.Uint8:
+		return 0, 255, nil
+	case onnx.Int8:
+		return -128, 127, nil
+	}
+	return 0, 0, fmt.Errorf("quantized type %s is not supported, want UINT8 or INT8", dtype.TritonName())
+}
+
+// quantizeInto rounds v/scale + zero to even, saturating to [lo, hi].
+func quantizeInto(dst []byte, v []float32, scale float32, zero int32, lo, hi float64) {
+	inv := 1 / float64(scale)
+	for i, x := range v {
+		r := math.RoundToEven(float64(x)*inv) + float64(zero)
+		dst[i] = byte(int32(max(lo, min(hi, r))))
+	}
+}
+
+// dequantizeInto writes (x - zero) for each integer value of t in [lo, hi)
+// to dst, optionally times scale.
+func dequantizeInto(dst []float32, t *Tensor, lo, hi int, zero int32, scale float32) {
+	if t.packed() {
+		for i := lo; i < hi; i++ {
+			dst[i-lo] = float32(t.byteAt(i)-zero) * scale
+		}
+		return
+	}
+	for i, v := range t.Ints[lo:hi] {
+		dst[i] = float32(int32(v)-zero) * scale
+	}
+}
+
+// linearParams reads the scale and zero point of QuantizeLinear and
+// DequantizeLinear, per tensor or along the axis attribute.
+func linearParams(c *nodeContext, shape []int, in []*Tensor) (quantParams, error) {
+	if c.int("block_size", 0) != 0 {
+		return quantParams{}, fmt.Errorf("blocked quantization is not supported")
+	}
+	return newQuantParams(shape, c.int("axis", 1), in[1], optional(in, 2))
+}
+
+// quantizeLinear implements QuantizeLinear to UINT8 (the default) or INT8.
+func quantizeLinear(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	x, zero := in[0], optional(in, 2)
+	dtype := onnx.DataType(c.int("output_dtype", int64(onnx.Uint8)))
+	if zero != nil {
+		dtype = zero.DType
+	}
+	lo, hi, err := quantRange(dtype)
+	if err != nil {
+		return nil, err
+	}
+	q, err := linearParams(c, x.Shape, in)
+	if err != nil {
+		return nil, err
+	}
+	xv := x.Float32s()
+	out := &Tensor{Shape: x.Shape, DType: dtype, Bytes: make([]byte, len(xv))}
+	q.runs(len(xv), func(l, h, ch int) {
+		quantizeInto(out.Bytes[l:h], xv[l:h], q.scale[ch], q.zero[ch], lo, hi)
+	})
+	return one(out)
+}
+
+// dequantizeLinear implements DequantizeLinear of UINT8, INT8 and INT32
+// tensors.
+func dequantizeLinear(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	if !x.IsInt() {
+		return nil, fmt.Errorf("input must be an integer tensor")
+	}
+	q, err := linearParams(c, x.Shape, in)
+	if err != nil {
+		return nil, err
+	}
+	out := zeros(x.Shape)
+	q.runs(x.Len(), func(l, h, ch int) {
+		dequantizeInto(out.Data[l:h], x, l, h, q.zero[ch], q.scale[ch])
+	})
+	return one(out)
+}
+
+// qlinearConv implements QLinearConv. The zero points are subtracted and
+// the integer convolution runs on the float32 GEMM path, which is exact
+// while partial sums stay below 2^24, before requantizing to y_scale.
+func qlinearConv(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 8); err != nil {
+		return nil, err
+	}
+	x, w, bias := in[0], in[3], optional(in, 8)
+	if !x.IsInt() || !w.IsInt() {
+		return nil, fmt.Errorf("x and w must be quantized tensors")
+	}
+	if len(w.Shape) != 4 {
+		return nil, fmt.Errorf("weight shape %v, want [M, C/group, kH, kW]", w.Shape)
+	}
+	xq, err := newQuantParams(nil, 0, in[1], in[2])
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	// weights may be quantized per output channel
+	wq, err := newQuantParams(w.Shape, 0, in[4], in[5])
+	if err != nil {
+		return nil, fmt.Errorf("w: %w", err)
+	}
+	yq, err := newQuantParams(nil, 0, in[6], in[7])
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	dtype := in[7].DType
+	lo, hi, err := quantRange(dtype)
+	if err != nil {
+		return nil, err
+	}
+
+	xf := zeros(x.Shape)
+	defer recycle(xf.Data)
+	dequantizeInto(xf.Data, x, 0, x.Len(), xq.zero[0], 1)
+	wf := zeros(w.Shape)
+	defer recycle(wf.Data)
+	wq.runs(w.Len(), func(l, h, ch int) {
+		dequantizeInto(wf.Data[l:h], w, l, h, wq.zero[ch], 1)
+	})
+	args := []*Tensor{xf, wf}
+	if bias != nil {
+		args = append(args, NewTensor(bias.Shape, bias.Float32s()))
+	}
+	acc, err := convolve(c, args, false)
+	if err != nil {
+		return nil, err
+	}
+	defer recycle(acc[0].Data)
+
+	y := acc[0]
+	out := &Tensor{Shape: y.Shape, DType: dtype, Bytes: make([]byte, y.Len())}
+	oc, plane := w.Shape[0], numElements(y.Shape[2:])
+	for p := 0; p*plane < y.Len(); p++ {
+		// y = acc * x_scale * w_scale / y_scale + y_zero
+		scale := yq.scale[0] / (xq.scale[0] * wq.scale[p%oc%len(wq.scale)])
+		quantizeInto(out.Bytes[p*plane:(p+1)*plane], y.Data[p*plane:(p+1)*plane], scale, yq.zero[0], lo, hi)
+	}
+	return one(out)
+}
+
+// matMulInteger implements MatMulInteger: the INT32 product of 8-bit
+// matrices less their zero points, per tensor, per row of A or per column
+// of B.
+func matMulInteger(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	a, b := in[0], in[1]
+	if !a.IsInt() || !b.IsInt() {
+		return nil, fmt.Errorf("operands must be integer tensors")
+	}
+	s, err := newMatmulShape(a.Shape, b.Shape)
+	if err != nil {
+		return nil, err
+	}
+	m, k, n := s.m, s.k, s.n
+	az, err := zeroPoints(optional(in, 2), m)
+	if err != nil {
+		return nil, fmt.Errorf("a_zero_point: %w", err)
+	}
+	bz, err := zeroPoints(optional(in, 3), n)
+	if err != nil {
+		return nil, fmt.Errorf("b_zero_point: %w", err)
+	}
+	av, bv := a.Int64s(), b.Int64s()
+	ai := make([]int32, len(av))
+	for i, v := range av {
+		ai[i] = int32(v) - az[(i/k)%len(az)]
+	}
+	bi := make([]int32, len(bv))
+	for i, v := range bv {
+		bi[i] = int32(v) - bz[i%n%len(bz)]
+	}
+	out := &Tensor{Shape: s.out, DType: onnx.Int32, Ints: make([]int64, numElements(s.out))}
+	s.each(func(o, ao, bo int) {
+		dst, am, bm := out.Ints[o*m*n:][:m*n], ai[ao*m*k:][:m*k], bi[bo*k*n:][:k*n]
+		parallelFor(c.threads, m, 1, func(lo, hi int) {
+			row := make([]int32, n)
+			for i := lo; i < hi; i++ {
+				clear(row)
+				for p, x := range am[i*k : (i+1)*k] {
+					if x == 0 {
+						continue
+					}
+					for j, y := range bm[p*n : (p+1)*n] {
+						row[j] += x * y
+					}
+				}
+				for j, v := range row {
+					dst[i*n+j] = int64(v)
+				}
+			}
+		})
+	})
+	return one(out)
+}
+
+// zeroPoints reads an optional MatMulInteger zero point: a scalar, or one
+// value per row of A (per column of B), of which there are n.
+func zeroPoints(t *Tensor, n int) ([]int32, error) {
+	if t == nil {
+		return []int32{0}, nil
+	}
+	v := t.Int64s()
+	if len(v) != 1 && len(v) != n {
+		return nil, fmt.Errorf("%d values, want 1 or %d", len(v), n)
+	}
+	out := make([]int32, len(v))
+	for i, x := range v {
+		out[i] = int32(x)
+	}
+	return out, nil
+}
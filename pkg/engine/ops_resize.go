@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// resizeMode holds the Resize attributes that shape the per-axis sampling.
+type resizeMode struct {
+	mode           string // nearest, linear or cubic
+	coordinates    string // coordinate_transformation_mode
+	nearest        string // nearest_mode
+	cubicA         float64
+	excludeOutside bool
+}
+
+// tap is one weighted input coordinate contributing to an output coordinate.
+type tap struct {
+	index  int
+	weight float32
+}
+
+// resize implements Resize for opsets 10 (X, scales) and 11+ (X, roi,
+// scales, sizes) in nearest, linear and cubic modes. Interpolation is
+// separable, so each resized axis is processed in turn.
+func resize(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	if c.int("antialias", 0) != 0 || len(c.ints("axes", nil)) > 0 || c.str("keep_aspect_ratio_policy", "stretch") != "stretch" {
+		return nil, fmt.Errorf("antialias, axes and keep_aspect_ratio_policy are not supported")
+	}
+	m := resizeMode{
+		mode:           c.str("mode", "nearest"),
+		coordinates:    c.str("coordinate_transformation_mode", "half_pixel"),
+		nearest:        c.str("nearest_mode", "round_prefer_floor"),
+		cubicA:         float64(c.float("cubic_coeff_a", -0.75)),
+		excludeOutside: c.int("exclude_outside", 0) != 0,
+	}
+	scales, sizes := optional(in, 2), optional(in, 3)
+	if c.opset < 11 {
+		// opset 10 has no roi and rounds asymmetric coordinates down
+		scales, sizes = optional(in, 1), nil
+		m.coordinates, m.nearest = "asymmetric", "floor"
+	}
+	return resampleInput(in[0], scales, sizes, m)
+}
+
+// upsample implements the deprecated Upsample (opsets 7 to 9), which is
+// Resize with asymmetric coordinates and scales as an attribute or input 1.
+func upsample(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	m := resizeMode{mode: c.str("mode", "nearest"), coordinates: "asymmetric", nearest: "floor"}
+	scales := optional(in, 1)
+	if scales == nil {
+		s := c.floats("scales")
+		scales = NewTensor([]int{len(s)}, s)
+	}
+	return resampleInput(in[0], scales, nil, m)
+}
+
+func resampleInput(x *Tensor, scales, sizes *Tensor, m resizeMode) ([]*Tensor, error) {
+	rank := len(x.Shape)
+	outShape := make([]int, rank)
+	axisScale := make([]float64, rank)
+	switch {
+	case sizes != nil && sizes.Len() > 0:
+		s := sizes.Int64s()
+		if len(s) != rank {
+			return nil, fmt.Errorf("%d sizes for rank %d", len(s), rank)
+		}
+		for i, d := range s {
+			outShape[i] = int(d)
+			axisScale[i] = float64(d) / float64(x.Shape[i])
+		}
+	case scales != nil && scales.Len() > 0:
+		s := scales.Float32s()
+		if len(s) != rank {
+			return nil, fmt.Errorf("%d scales for rank %d", len(s), rank)
+		}
+		for i, v := range s {
+			if v <= 0 {
+				return nil, fmt.Errorf("scale %v must be positive", v)
+			}
+			axisScale[i] = float64(v)
+			outShape[i] = int(math.Floor(float64(x.Shape[i]) * float64(v)))
+		}
+	default:
+		return nil, fmt.Errorf("scales or sizes required")
+	}
+	dtype := x.DType
+	if x.IsInt() {
+		if m.mode != "nearest" {
+			return nil, fmt.Errorf("%s interpolation of integer tensors is not supported", m.mode)
+		}
+		x = NewTensor(x.Shape, x.Float32s())
+	}
+	out := x
+	for axis := 0; axis < rank; axis++ {
+		if outShape[axis] == x.Shape[axis] && axisScale[axis] == 1 {
+			continue
+		}
+		taps, err := m.taps(x.Shape[axis], outShape[axis], axisScale[axis])
+		if err != nil {
+			return nil, err
+		}
+		out = resampleAxis(out, axis, taps)
+	}
+	if dtype != out.DType && dtype != 0 {
+		out = &Tensor{Shape: out.Shape, DType: dtype, Ints: out.Int64s()}
+	}
+	return one(out)
+}
+
+// resampleAxis computes out[..., j, ...] = sum of weight * x[..., index, ...]
+// over taps[j] along axis.
+func resampleAxis(x *Tensor, axis int, taps [][]tap) *Tensor {
+	shape := slices.Clone(x.Shape)
+	shape[axis] = len(taps)
+	out := zeros(shape)
+	outer, inner := numElements(x.Shape[:axis]), numElements(x.Shape[axis+1:])
+	n := x.Shape[axis]
+	for o := 0; o < outer; o++ {
+		src := x.Data[o*n*inner:][:n*inner]
+		dst := out.Data[o*len(taps)*inner:][:len(taps)*inner]
+		for j, ts := range taps {
+			row := dst[j*inner:][:inner]
+			for _, t := range ts {
+				s := src[t.index*inner:][:inner]
+				for i, v := range s {
+					row[i] += t.weight * v
+				}
+			}
+		}
+	}
+	return out
+}
+
+// original maps output coordinate x to the input coordinate it samples.
+func (m resizeMode) original(x float64, inLen, outLen int, scale float64) (float64, error) {
+	switch m.coordinates {
+	case "half_pixel":
+		return (x+0.5)/scale - 0.5, nil
+	case "pytorch_half_pixel":
+		if outLen > 1 {
+			return (x+0.5)/scale - 0.5, nil
+		}
+		return 0, nil
+	case "align_corners":
+		if outLen == 1 {
+			return 0, nil
+		}
+		return x * float64(inLen-1) / float64(outLen-1), nil
+	case "asymmetric":
+		return x / scale, nil
+	case "tf_half_pixel_for_nn":
+		return (x + 0.5) / scale, nil
+	}
+	return 0, fmt.Errorf("unsupported coordinate_transformation_mode %q", m.coordinates)
+}
+
+// taps returns, for each of outLen output coordinates, the input
+// coordinates and weights it interpolates.
+func (m resizeMode) taps(inLen, outLen int, scale float64) ([][]tap, error) {
+	taps := make([][]tap, outLen)
+	for j := range taps {
+		x, err := m.original(float64(j), inLen, outLen, scale)
+		if err != nil {
+			return nil, err
+		}
+		switch m.mode {
+		case "nearest":
+			i, err := m.round(x)
+			if err != nil {
+				return nil, err
+			}
+			taps[j] = []tap{{index: max(0, min(inLen-1, i)), weight: 1}}
+		case "linear":
+			x = max(0, min(float64(inLen-1), x))
+			i0 := int(math.Floor(x))
+			i1 := min(i0+1, inLen-1)
+			w := float32(x - float64(i0))
+			taps[j] = []tap{{index: i0, weight: 1 - w}, {index: i1, weight: w}}
+		case "cubic":
+			taps[j] = m.cubic(x, inLen)
+		default:
+			return nil, fmt.Errorf("unsupported mode %q", m.mode)
+		}
+	}
+	return taps, nil
+}
+
+// round picks the nearest input coordinate according to nearest_mode.
+func (m resizeMode) round(x float64) (int, error) {
+	switch m.nearest {
+	case "round_prefer_floor":
+		if x == math.Floor(x)+0.5 {
+			return int(math.Floor(x)), nil
+		}
+		return int(math.Round(x)), nil
+	case "round_prefer_ceil":
+		return int(math.Floor(x + 0.5)), nil
+	case "floor":
+		return int(math.Floor(x)), nil
+	case "ceil":
+		return int(math.Ceil(x)), nil
+	}
+	return 0, fmt.Errorf("unsupported nearest_mode %q", m.nearest)
+}
+
+// cubic returns the four Keys cubic-convolution taps around x; coordinates
+// outside the input are clamped, or dropped and the weights renormalised
+// with exclude_outside.
+func (m resizeMode) cubic(x float64, inLen int) []tap {
+	a := m.cubicA
+	kernel := func(d float64) float64 {
+		d = math.Abs(d)
+		switch {
+		case d <= 1:
+			return ((a+2)*d-(a+3))*d*d + 1
+		case d < 2:
+			return ((a*d-5*a)*d+8*a)*d - 4*a
+		}
+		return 0
+	}
+	i0 := int(math.Floor(x))
+	ts := make([]tap, 0, 4)
+	var sum float64
+	for i := i0 - 1; i <= i0+2; i++ {
+		w := kernel(x - float64(i))
+		if m.excludeOutside && (i < 0 || i >= inLen) {
+			continue
+		}
+		sum += w
+		ts = append(ts, tap{index: max(0, min(inLen-1, i)), weight: float32(w)})
+	}
+	if m.excludeOutside && sum != 0 {
+		for k := range ts {
+			ts[k].weight = float32(float64(ts[k].weight) / sum)
+		}
+	}
+	return ts
+}
@@ -0,0 +1,644 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+	"github.com/unrealandychan/rembg-go/pkg/tensor"
+)
+
+// intsInput returns input i as int64 values, or def when it is absent, for
+// the axes, pads and shapes later opsets moved from attributes to inputs.
+func intsInput(in []*Tensor, i int, def []int64) []int64 {
+	if t := optional(in, i); t != nil {
+		return t.Int64s()
+	}
+	return def
+}
+
+// copyRange copies n values from src[si:] to dst[di:].
+func copyRange(dst *Tensor, di int, src *Tensor, si, n int) {
+	if dst.IsInt() {
+		copy(dst.Ints[di:di+n], src.Int64s()[si:si+n])
+	} else {
+		copy(dst.Data[di:di+n], src.Float32s()[si:si+n])
+	}
+}
+
+// selectIndices builds a tensor whose coordinate j along axis d is read from
+// coordinate idx[d][j] of x; a negative index reads fill instead.
+func selectIndices(x *Tensor, idx [][]int, fill float32) *Tensor {
+	shape := make([]int, len(idx))
+	for d := range idx {
+		shape[d] = len(idx[d])
+	}
+	out := x.like(shape)
+	n := out.NumElements()
+	st := strides(x.Shape)
+	counter := make([]int, len(shape))
+	for o := 0; o < n; o++ {
+		src := 0
+		for d, c := range counter {
+			s := idx[d][c]
+			if s < 0 {
+				src = -1
+				break
+			}
+			src += s * st[d]
+		}
+		switch {
+		case out.IsInt() && src >= 0:
+			out.Ints[o] = x.Ints[src]
+		case out.IsInt():
+			out.Ints[o] = int64(fill)
+		case src >= 0:
+			out.Data[o] = x.Data[src]
+		default:
+			out.Data[o] = fill
+		}
+		for d := len(counter) - 1; d >= 0; d-- {
+			if counter[d]++; counter[d] < shape[d] {
+				break
+			}
+			counter[d] = 0
+		}
+	}
+	return out
+}
+
+func shapeTensor(shape []int) *Tensor {
+	ints := make([]int64, len(shape))
+	for i, d := range shape {
+		ints[i] = int64(d)
+	}
+	return NewInts([]int{len(ints)}, ints)
+}
+
+func cast(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	to := onnx.DataType(c.int("to", int64(onnx.Float)))
+	switch to {
+	case onnx.Float, onnx.Double:
+		return one(NewTensor(x.Shape, slices.Clone(x.Float32s())))
+	case onnx.Float16, onnx.BFloat16:
+		// round to the target precision, then compute in float32 again
+		data := slices.Clone(x.Float32s())
+		for i, v := range data {
+			if to == onnx.Float16 {
+				data[i] = tensor.Float16ToFloat32(tensor.Float32ToFloat16(v))
+			} else {
+				data[i] = tensor.BFloat16ToFloat32(tensor.Float32ToBFloat16(v))
+			}
+		}
+		return one(NewTensor(x.Shape, data))
+	case onnx.String, onnx.Complex64, onnx.Complex128, onnx.Undefined:
+		return nil, fmt.Errorf("cast to data type %d is not supported", to)
+	}
+	out := &Tensor{Shape: x.Shape, DType: to, Ints: slices.Clone(x.Int64s())}
+	if to == onnx.Bool {
+		for i, v := range out.Ints {
+			if v != 0 {
+				out.Ints[i] = 1
+			}
+		}
+		if !x.IsInt() {
+			// fractions such as 0.5 are true too
+			for i, v := range x.Data {
+				if v != 0 {
+					out.Ints[i] = 1
+				}
+			}
+		}
+	}
+	return one(out)
+}
+
+func concat(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	first := in[0]
+	axis, err := normAxis(c.int("axis", 0), len(first.Shape))
+	if err != nil {
+		return nil, err
+	}
+	shape := slices.Clone(first.Shape)
+	shape[axis] = 0
+	for _, t := range in {
+		if t == nil || len(t.Shape) != len(shape) {
+			return nil, fmt.Errorf("inputs must all have rank %d", len(shape))
+		}
+		for d := range shape {
+			if d != axis && t.Shape[d] != first.Shape[d] {
+				return nil, fmt.Errorf("shapes %v and %v differ off axis %d", first.Shape, t.Shape, axis)
+			}
+		}
+		shape[axis] += t.Shape[axis]
+	}
+	out := first.like(shape)
+	outer, inner := numElements(shape[:axis]), numElements(shape[axis+1:])
+	row := shape[axis] * inner
+	off := 0
+	for _, t := range in {
+		n := t.Shape[axis] * inner
+		for o := 0; o < outer; o++ {
+			copyRange(out, o*row+off, t, o*n, n)
+		}
+		off += n
+	}
+	return one(out)
+}
+
+func constant(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	for _, a := range c.Attributes {
+		switch a.Name {
+		case "value":
+			if a.T == nil {
+				return nil, fmt.Errorf("value attribute has no tensor")
+			}
+			t, err := FromONNX(a.T)
+			if err != nil {
+				return nil, err
+			}
+			return one(t)
+		case "value_float":
+			return one(NewTensor([]int{}, []float32{a.F}))
+		case "value_floats":
+			return one(NewTensor([]int{len(a.Floats)}, a.Floats))
+		case "value_int":
+			return one(NewInts([]int{}, []int64{a.I}))
+		case "value_ints":
+			return one(NewInts([]int{len(a.Ints)}, a.Ints))
+		}
+	}
+	return nil, fmt.Errorf("no supported value attribute")
+}
+
+func constantOfShape(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	shape := make([]int, in[0].Len())
+	for i, d := range in[0].Int64s() {
+		shape[i] = int(d)
+	}
+	value := NewTensor([]int{1}, []float32{0})
+	if a, ok := c.Attr("value"); ok && a.T != nil {
+		var err error
+		if value, err = FromONNX(a.T); err != nil {
+			return nil, err
+		}
+	}
+	out := value.like(shape)
+	if out.IsInt() {
+		for i := range out.Ints {
+			out.Ints[i] = value.Ints[0]
+		}
+	} else {
+		for i := range out.Data {
+			out.Data[i] = value.Data[0]
+		}
+	}
+	return one(out)
+}
+
+func expand(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	target := make([]int, in[1].Len())
+	for i, d := range in[1].Int64s() {
+		target[i] = int(d)
+	}
+	shape, err := broadcastShape(x.Shape, target)
+	if err != nil {
+		return nil, err
+	}
+	out := x.like(shape)
+	xs := broadcastStrides(x.Shape, shape)
+	broadcastIndex(shape, [][]int{xs}, func(o int, idx []int) {
+		copyRange(out, o, x, idx[0], 1)
+	})
+	return one(out)
+}
+
+func flatten(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axis := int(c.int("axis", 1))
+	if axis < 0 {
+		axis += len(x.Shape)
+	}
+	if axis < 0 || axis > len(x.Shape) {
+		return nil, fmt.Errorf("axis %d out of range for rank %d", axis, len(x.Shape))
+	}
+	return one(x.reshaped([]int{numElements(x.Shape[:axis]), numElements(x.Shape[axis:])}))
+}
+
+func gather(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 2); err != nil {
+		return nil, err
+	}
+	x, indices := in[0], in[1]
+	axis, err := normAxis(c.int("axis", 0), len(x.Shape))
+	if err != nil {
+		return nil, err
+	}
+	shape := append(append(slices.Clone(x.Shape[:axis]), indices.Shape...), x.Shape[axis+1:]...)
+	out := x.like(shape)
+	outer, inner := numElements(x.Shape[:axis]), numElements(x.Shape[axis+1:])
+	dim := x.Shape[axis]
+	idx := indices.Int64s()
+	for o := 0; o < outer; o++ {
+		for j, i := range idx {
+			if i < 0 {
+				i += int64(dim)
+			}
+			if i < 0 || i >= int64(dim) {
+				return nil, fmt.Errorf("index %d out of range for dimension %d", idx[j], dim)
+			}
+			copyRange(out, (o*len(idx)+j)*inner, x, (o*dim+int(i))*inner, inner)
+		}
+	}
+	return one(out)
+}
+
+// pad supports the constant, edge, reflect and wrap modes, with pads as an
+// attribute (opset < 11) or input 1 and the optional axes input 3.
+func pad(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	rank := len(x.Shape)
+	pads := c.ints("pads", nil)
+	value := c.float("value", 0)
+	if c.opset >= 11 {
+		pads = intsInput(in, 1, nil)
+		if t := optional(in, 2); t != nil && t.Len() > 0 {
+			value = t.Float32s()[0]
+		}
+	}
+	axes := make([]int, rank)
+	for i := range axes {
+		axes[i] = i
+	}
+	if t := optional(in, 3); t != nil {
+		axes = axes[:0]
+		for _, a := range t.Int64s() {
+			i, err := normAxis(a, rank)
+			if err != nil {
+				return nil, err
+			}
+			axes = append(axes, i)
+		}
+	}
+	if len(pads) != 2*len(axes) {
+		return nil, fmt.Errorf("%d pads for %d axes", len(pads), len(axes))
+	}
+	begin, end := make([]int, rank), make([]int, rank)
+	for k, a := range axes {
+		begin[a], end[a] = int(pads[k]), int(pads[k+len(axes)])
+	}
+	mode := c.str("mode", "constant")
+	idx := make([][]int, rank)
+	for d, n := range x.Shape {
+		size := n + begin[d] + end[d]
+		if size < 0 {
+			return nil, fmt.Errorf("pads %v remove more than dimension %d holds", pads, d)
+		}
+		idx[d] = make([]int, size)
+		for j := range idx[d] {
+			i := j - begin[d]
+			if i >= 0 && i < n {
+				idx[d][j] = i
+				continue
+			}
+			switch {
+			case mode == "constant" || n == 0:
+				i = -1
+			case mode == "edge":
+				i = max(0, min(n-1, i))
+			case mode == "reflect":
+				if n == 1 {
+					i = 0
+					break
+				}
+				period := 2 * (n - 1)
+				i = ((i % period) + period) % period
+				if i >= n {
+					i = period - i
+				}
+			case mode == "wrap":
+				i = ((i % n) + n) % n
+			default:
+				return nil, fmt.Errorf("unsupported mode %q", mode)
+			}
+			idx[d][j] = i
+		}
+	}
+	return one(selectIndices(x, idx, value))
+}
+
+func rangeOp(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 3); err != nil {
+		return nil, err
+	}
+	start, limit, delta := values64(in[0]), values64(in[1]), values64(in[2])
+	if len(start) != 1 || len(limit) != 1 || len(delta) != 1 || delta[0] == 0 {
+		return nil, fmt.Errorf("start, limit and delta must be scalars, delta non-zero")
+	}
+	n := max(0, int(math.Ceil((limit[0]-start[0])/delta[0])))
+	out := in[0].like([]int{n})
+	for i := 0; i < n; i++ {
+		v := start[0] + float64(i)*delta[0]
+		if out.IsInt() {
+			out.Ints[i] = int64(v)
+		} else {
+			out.Data[i] = float32(v)
+		}
+	}
+	return one(out)
+}
+
+func reshape(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	spec := c.ints("shape", nil)
+	if c.opset >= 5 {
+		if err := need(in, 2); err != nil {
+			return nil, err
+		}
+		spec = in[1].Int64s()
+	}
+	allowZero := c.int("allowzero", 0) != 0
+	shape := make([]int, len(spec))
+	infer := -1
+	known := 1
+	for i, d := range spec {
+		switch {
+		case d == 0 && !allowZero:
+			if i >= len(x.Shape) {
+				return nil, fmt.Errorf("shape %v copies dimension %d of %v", spec, i, x.Shape)
+			}
+			shape[i] = x.Shape[i]
+		case d == -1:
+			if infer >= 0 {
+				return nil, fmt.Errorf("shape %v has more than one -1", spec)
+			}
+			infer = i
+			continue
+		case d < 0:
+			return nil, fmt.Errorf("invalid shape %v", spec)
+		default:
+			shape[i] = int(d)
+		}
+		known *= shape[i]
+	}
+	n := x.NumElements()
+	if infer >= 0 {
+		if known == 0 || n%known != 0 {
+			return nil, fmt.Errorf("cannot reshape %v to %v", x.Shape, spec)
+		}
+		shape[infer] = n / known
+	}
+	if numElements(shape) != n {
+		return nil, fmt.Errorf("cannot reshape %v to %v", x.Shape, spec)
+	}
+	return one(x.reshaped(shape))
+}
+
+func shapeOp(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	rank := len(in[0].Shape)
+	clamp := func(i int64) int {
+		if i < 0 {
+			i += int64(rank)
+		}
+		return max(0, min(rank, int(i)))
+	}
+	start, end := clamp(c.int("start", 0)), clamp(c.int("end", int64(rank)))
+	return one(shapeTensor(in[0].Shape[start:max(start, end)]))
+}
+
+// slice takes starts, ends, axes and steps as attributes (opset < 10) or
+// inputs 1 to 4.
+func slice(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	starts, ends, axes := c.ints("starts", nil), c.ints("ends", nil), c.ints("axes", nil)
+	var steps []int64
+	if c.opset >= 10 {
+		if err := need(in, 3); err != nil {
+			return nil, err
+		}
+		starts, ends = in[1].Int64s(), in[2].Int64s()
+		axes, steps = intsInput(in, 3, nil), intsInput(in, 4, nil)
+	}
+	if len(ends) != len(starts) || (axes != nil && len(axes) != len(starts)) || (steps != nil && len(steps) != len(starts)) {
+		return nil, fmt.Errorf("starts, ends, axes and steps differ in length")
+	}
+	idx := make([][]int, len(x.Shape))
+	for d, n := range x.Shape {
+		idx[d] = make([]int, n)
+		for i := range idx[d] {
+			idx[d][i] = i
+		}
+	}
+	for k := range starts {
+		axis := k
+		if axes != nil {
+			var err error
+			if axis, err = normAxis(axes[k], len(x.Shape)); err != nil {
+				return nil, err
+			}
+		}
+		step := int64(1)
+		if steps != nil {
+			step = steps[k]
+		}
+		if step == 0 {
+			return nil, fmt.Errorf("slice step is 0")
+		}
+		n := int64(x.Shape[axis])
+		start, end := starts[k], ends[k]
+		if start < 0 {
+			start += n
+		}
+		if end < 0 {
+			end += n
+		}
+		if step > 0 {
+			start, end = max(0, min(n, start)), max(0, min(n, end))
+		} else {
+			start, end = max(0, min(n-1, start)), max(-1, min(n-1, end))
+		}
+		idx[axis] = idx[axis][:0:0]
+		for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+			idx[axis] = append(idx[axis], int(i))
+		}
+	}
+	return one(selectIndices(x, idx, 0))
+}
+
+// split divides input 0 along axis by the split attribute (opset < 13) or
+// input 1, or into equal parts, one per output.
+func split(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axis, err := normAxis(c.int("axis", 0), len(x.Shape))
+	if err != nil {
+		return nil, err
+	}
+	dim := x.Shape[axis]
+	sizes := c.ints("split", nil)
+	if c.opset >= 13 {
+		sizes = intsInput(in, 1, nil)
+	}
+	if sizes == nil {
+		parts := len(c.Outputs)
+		if n := c.int("num_outputs", 0); n > 0 {
+			parts = int(n)
+		}
+		chunk := (dim + parts - 1) / parts
+		for left := dim; len(sizes) < parts; left -= chunk {
+			sizes = append(sizes, int64(min(chunk, left)))
+		}
+	}
+	total := 0
+	for _, s := range sizes {
+		total += int(s)
+	}
+	if total != dim {
+		return nil, fmt.Errorf("split %v does not sum to dimension %d", sizes, dim)
+	}
+	outer, inner := numElements(x.Shape[:axis]), numElements(x.Shape[axis+1:])
+	outs := make([]*Tensor, len(sizes))
+	off := 0
+	for k, s := range sizes {
+		shape := slices.Clone(x.Shape)
+		shape[axis] = int(s)
+		out := x.like(shape)
+		n := int(s) * inner
+		for o := 0; o < outer; o++ {
+			copyRange(out, o*n, x, o*dim*inner+off, n)
+		}
+		off += n
+		outs[k] = out
+	}
+	return outs, nil
+}
+
+func squeeze(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axes := c.ints("axes", nil)
+	if c.opset >= 13 {
+		axes = intsInput(in, 1, nil)
+	}
+	drop := make([]bool, len(x.Shape))
+	for _, a := range axes {
+		i, err := normAxis(a, len(x.Shape))
+		if err != nil {
+			return nil, err
+		}
+		if x.Shape[i] != 1 {
+			return nil, fmt.Errorf("cannot squeeze dimension %d of %v", i, x.Shape)
+		}
+		drop[i] = true
+	}
+	shape := []int{}
+	for i, d := range x.Shape {
+		if !drop[i] && (axes != nil || d != 1) {
+			shape = append(shape, d)
+		}
+	}
+	return one(x.reshaped(shape))
+}
+
+func unsqueeze(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axes := c.ints("axes", nil)
+	if c.opset >= 13 {
+		axes = intsInput(in, 1, nil)
+	}
+	rank := len(x.Shape) + len(axes)
+	insert := make([]bool, rank)
+	for _, a := range axes {
+		i, err := normAxis(a, rank)
+		if err != nil {
+			return nil, err
+		}
+		if insert[i] {
+			return nil, fmt.Errorf("axis %d repeated", a)
+		}
+		insert[i] = true
+	}
+	shape := make([]int, 0, rank)
+	j := 0
+	for i := 0; i < rank; i++ {
+		if insert[i] {
+			shape = append(shape, 1)
+		} else {
+			shape = append(shape, x.Shape[j])
+			j++
+		}
+	}
+	return one(x.reshaped(shape))
+}
+
+func transpose(c *nodeContext, in []*Tensor) ([]*Tensor, error) {
+	if err := need(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	rank := len(x.Shape)
+	perm := c.ints("perm", nil)
+	if perm == nil {
+		for i := rank - 1; i >= 0; i-- {
+			perm = append(perm, int64(i))
+		}
+	}
+	if len(perm) != rank {
+		return nil, fmt.Errorf("perm %v for rank %d", perm, rank)
+	}
+	st := strides(x.Shape)
+	shape, pst := make([]int, rank), make([]int, rank)
+	for i, p := range perm {
+		a, err := normAxis(p, rank)
+		if err != nil {
+			return nil, err
+		}
+		shape[i], pst[i] = x.Shape[a], st[a]
+	}
+	out := x.like(shape)
+	broadcastIndex(shape, [][]int{pst}, func(o int, idx []int) {
+		if out.IsInt() {
+			out.Ints[o] = x.Ints[idx[0]]
+		} else {
+			out.Data[o] = x.Data[idx[0]]
+		}
+	})
+	return one(out)
+}
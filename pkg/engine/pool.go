@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"math/bits"
+	"sync"
+	"unsafe"
+)
+
+// minPooled is the smallest buffer worth recycling; shape and scalar
+// tensors are cheaper to allocate than to pool.
+const minPooled = 1024
+
+// buffers recycles float32 backing arrays between layers and across runs.
+// Bucket b holds arrays with a capacity of at least 1<<b.
+var buffers [48]sync.Pool
+
+// alloc returns n zeroed float32 values, reusing a recycled array when one
+// is large enough.
+func alloc(n int) []float32 {
+	if n < minPooled {
+		return make([]float32, n)
+	}
+	b := bits.Len(uint(n - 1))
+	if p, ok := buffers[b].Get().(*[]float32); ok {
+		s := (*p)[:n]
+		clear(s)
+		return s
+	}
+	return make([]float32, n, 1<<b)
+}
+
+// recycle hands s back for reuse. The caller must hold the only reference.
+func recycle(s []float32) {
+	if cap(s) < minPooled {
+		return
+	}
+	s = s[:0]
+	buffers[bits.Len(uint(cap(s)))-1].Put(&s)
+}
+
+// arrayOf identifies the backing array of a float tensor, or nil if it has
+// none worth recycling.
+func arrayOf(t *Tensor) *float32 {
+	if t == nil || t.IsInt() || cap(t.Data) < minPooled {
+		return nil
+	}
+	return unsafe.SliceData(t.Data)
+}
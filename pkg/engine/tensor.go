@@ -0,0 +1,287 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+	"github.com/unrealandychan/rembg-go/pkg/tensor"
+)
+
+// Tensor is a dense row-major tensor. Floating-point tensors hold their
+// values in Data; integer and boolean tensors hold them in Ints, with DType
+// recording the ONNX element type. UINT8 and INT8 initializers, and the
+// outputs of the quantization operators, are packed one byte per value in
+// Bytes instead (INT8 as two's complement), so quantized weights and
+// activations take a quarter of the memory of float ones.
+type Tensor struct {
+	Shape []int
+	DType onnx.DataType
+	Data  []float32
+	Ints  []int64
+	Bytes []byte
+}
+
+// NewTensor returns a float tensor of shape backed by data.
+func NewTensor(shape []int, data []float32) *Tensor {
+	return &Tensor{Shape: shape, DType: onnx.Float, Data: data}
+}
+
+// NewInts returns an INT64 tensor of shape backed by ints.
+func NewInts(shape []int, ints []int64) *Tensor {
+	return &Tensor{Shape: shape, DType: onnx.Int64, Ints: ints}
+}
+
+// zeros returns a float tensor of shape filled with zeros, possibly backed
+// by a recycled array.
+func zeros(shape []int) *Tensor {
+	return NewTensor(shape, alloc(numElements(shape)))
+}
+
+// FromONNX converts an initializer or constant to a Tensor. Floating-point
+// types (FLOAT, DOUBLE, FLOAT16, BFLOAT16) become float32.
+func FromONNX(t *onnx.Tensor) (*Tensor, error) {
+	shape := make([]int, len(t.Dims))
+	for i, d := range t.Dims {
+		shape[i] = int(d)
+	}
+	var out *Tensor
+	switch t.DataType {
+	case onnx.Float, onnx.Double:
+		data, err := t.Float32s()
+		if err != nil {
+			return nil, err
+		}
+		out = NewTensor(shape, data)
+	case onnx.Float16, onnx.BFloat16:
+		datatype := t.DataType.TritonName()
+		if t.RawData != nil {
+			data, err := tensor.Decode[float32](datatype, t.RawData)
+			if err != nil {
+				return nil, err
+			}
+			out = NewTensor(shape, data)
+			break
+		}
+		// half-precision values are stored as their bits in int32_data
+		data := make([]float32, len(t.Int32Data))
+		for i, v := range t.Int32Data {
+			if t.DataType == onnx.Float16 {
+				data[i] = tensor.Float16ToFloat32(uint16(v))
+			} else {
+				data[i] = tensor.BFloat16ToFloat32(uint16(v))
+			}
+		}
+		out = NewTensor(shape, data)
+	case onnx.Uint8, onnx.Int8:
+		out = &Tensor{Shape: shape, DType: t.DataType, Bytes: t.RawData}
+		if t.RawData == nil {
+			out.Bytes = make([]byte, len(t.Int32Data))
+			for i, v := range t.Int32Data {
+				out.Bytes[i] = byte(v)
+			}
+		}
+	default:
+		ints, err := t.Int64s()
+		if err != nil {
+			return nil, err
+		}
+		out = &Tensor{Shape: shape, DType: t.DataType, Ints: ints}
+	}
+	if out.Len() != out.NumElements() {
+		return nil, fmt.Errorf("shape %v needs %d values, got %d", shape, out.NumElements(), out.Len())
+	}
+	return out, nil
+}
+
+// IsInt reports whether t holds integer or boolean values.
+func (t *Tensor) IsInt() bool {
+	return t.DType != onnx.Float && t.DType != onnx.Undefined
+}
+
+// packed reports whether t holds its values in Bytes.
+func (t *Tensor) packed() bool {
+	return t.Bytes != nil
+}
+
+// unpacked returns t with packed values widened to Ints, for the
+// operators that only handle the general integer layout.
+func (t *Tensor) unpacked() *Tensor {
+	if !t.packed() {
+		return t
+	}
+	return &Tensor{Shape: t.Shape, DType: t.DType, Ints: t.Int64s()}
+}
+
+// byteAt returns packed value i, sign-extended for INT8.
+func (t *Tensor) byteAt(i int) int32 {
+	if t.DType == onnx.Int8 {
+		return int32(int8(t.Bytes[i]))
+	}
+	return int32(t.Bytes[i])
+}
+
+// Len returns the number of values held.
+func (t *Tensor) Len() int {
+	if t.packed() {
+		return len(t.Bytes)
+	}
+	if t.IsInt() {
+		return len(t.Ints)
+	}
+	return len(t.Data)
+}
+
+// NumElements returns the number of elements of Shape (1 for a scalar).
+func (t *Tensor) NumElements() int {
+	return numElements(t.Shape)
+}
+
+// Float32s returns the values as float32, converting integer tensors.
+func (t *Tensor) Float32s() []float32 {
+	if !t.IsInt() {
+		return t.Data
+	}
+	if t.packed() {
+		out := make([]float32, len(t.Bytes))
+		for i := range out {
+			out[i] = float32(t.byteAt(i))
+		}
+		return out
+	}
+	out := make([]float32, len(t.Ints))
+	for i, v := range t.Ints {
+		out[i] = float32(v)
+	}
+	return out
+}
+
+// Int64s returns the values as int64, truncating float tensors.
+func (t *Tensor) Int64s() []int64 {
+	if t.packed() {
+		out := make([]int64, len(t.Bytes))
+		for i := range out {
+			out[i] = int64(t.byteAt(i))
+		}
+		return out
+	}
+	if t.IsInt() {
+		return t.Ints
+	}
+	out := make([]int64, len(t.Data))
+	for i, v := range t.Data {
+		out[i] = int64(v)
+	}
+	return out
+}
+
+// like returns an empty tensor of shape with t's element type.
+func (t *Tensor) like(shape []int) *Tensor {
+	n := numElements(shape)
+	if t.IsInt() {
+		return &Tensor{Shape: shape, DType: t.DType, Ints: make([]int64, n)}
+	}
+	return zeros(shape)
+}
+
+// reshaped returns a tensor sharing t's values with a new shape.
+func (t *Tensor) reshaped(shape []int) *Tensor {
+	return &Tensor{Shape: shape, DType: t.DType, Data: t.Data, Ints: t.Ints, Bytes: t.Bytes}
+}
+
+func numElements(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+// strides returns the row-major element strides of shape.
+func strides(shape []int) []int {
+	s := make([]int, len(shape))
+	n := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		s[i] = n
+		n *= shape[i]
+	}
+	return s
+}
+
+// broadcastShape returns the numpy-style broadcast of shapes.
+func broadcastShape(shapes ...[]int) ([]int, error) {
+	rank := 0
+	for _, s := range shapes {
+		rank = max(rank, len(s))
+	}
+	out := make([]int, rank)
+	for i := range out {
+		out[i] = 1
+	}
+	for _, s := range shapes {
+		off := rank - len(s)
+		for i, d := range s {
+			switch {
+			case d == out[off+i] || d == 1:
+			case out[off+i] == 1:
+				out[off+i] = d
+			default:
+				return nil, fmt.Errorf("shapes %v cannot be broadcast", shapes)
+			}
+		}
+	}
+	return out, nil
+}
+
+// broadcastStrides returns the strides for reading a tensor of shape as if
+// it had been broadcast to out: broadcast dimensions get stride 0.
+func broadcastStrides(shape, out []int) []int {
+	s := make([]int, len(out))
+	st := strides(shape)
+	off := len(out) - len(shape)
+	for i, d := range shape {
+		if d != 1 {
+			s[off+i] = st[i]
+		}
+	}
+	return s
+}
+
+// broadcastIndex calls fn with each flat output index of shape and the
+// matching flat index into every operand, given their broadcast strides.
+func broadcastIndex(shape []int, operands [][]int, fn func(out int, idx []int)) {
+	n := numElements(shape)
+	if n == 0 {
+		return
+	}
+	idx := make([]int, len(operands))
+	counter := make([]int, len(shape))
+	for out := 0; out < n; out++ {
+		fn(out, idx)
+		// advance the odometer, updating operand offsets incrementally
+		for d := len(shape) - 1; d >= 0; d-- {
+			counter[d]++
+			for k, st := range operands {
+				idx[k] += st[d]
+			}
+			if counter[d] < shape[d] {
+				break
+			}
+			for k, st := range operands {
+				idx[k] -= st[d] * shape[d]
+			}
+			counter[d] = 0
+		}
+	}
+}
+
+// normAxis maps a possibly negative axis into [0, rank).
+func normAxis(axis int64, rank int) (int, error) {
+	a := int(axis)
+	if a < 0 {
+		a += rank
+	}
+	if a < 0 || a >= rank {
+		return 0, fmt.Errorf("axis %d out of range for rank %d", axis, rank)
+	}
+	return a, nil
+}
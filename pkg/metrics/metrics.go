@@ -0,0 +1,162 @@
+// Package metrics holds the Prometheus collectors shared by the backends,
+// the worker pool and the background removal pipeline.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rembg"
+
+// Registry is the registry all rembg collectors are registered with.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// BackendRequests counts Backend.Infer calls per backend.
+	BackendRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "backend",
+		Name:      "requests_total",
+		Help:      "Number of inference requests sent to a backend.",
+	}, []string{"backend"})
+
+	// BackendErrors counts failed Backend.Infer calls per backend and error type.
+	BackendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "backend",
+		Name:      "errors_total",
+		Help:      "Number of failed inference requests by error type.",
+	}, []string{"backend", "type"})
+
+	// BackendLatency observes Backend.Infer latency in seconds.
+	BackendLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "backend",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of inference requests.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"backend"})
+
+	// BackendInFlight tracks requests currently being served by a backend.
+	BackendInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backend",
+		Name:      "in_flight_requests",
+		Help:      "Number of inference requests currently in flight.",
+	}, []string{"backend"})
+
+	// StageDuration observes the time spent in each pipeline stage
+	// (decode, preprocess, infer, postprocess, encode).
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "stage_duration_seconds",
+		Help:      "Time spent in each stage of the background removal pipeline.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"stage"})
+)
+
+func init() {
+	Registry.MustRegister(
+		BackendRequests,
+		BackendErrors,
+		BackendLatency,
+		BackendInFlight,
+		StageDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ObserveStage records the time elapsed since start for the given pipeline stage.
+// It is meant to be used as `defer metrics.ObserveStage("decode", time.Now())`
+// or called directly once a stage is done.
+func ObserveStage(stage string, start time.Time) {
+	StageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// ObserveBackend records a request to backend name that started at start
+// and ended with err, as InstrumentedBackend does for every Infer call.
+func ObserveBackend(name string, start time.Time, err error) {
+	BackendRequests.WithLabelValues(name).Inc()
+	BackendLatency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		BackendErrors.WithLabelValues(name, ErrorType(err)).Inc()
+	}
+}
+
+// ErrorType classifies err into a small, fixed set of label values so the
+// errors_total series stays bounded.
+func ErrorType(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "backend"
+	}
+}
+
+// RegisterPool exposes the queue length and busy worker count of a worker pool
+// under the given name. queued and busy are sampled on every scrape.
+func RegisterPool(name string, queued, busy func() float64) error {
+	labels := prometheus.Labels{"pool": name}
+	q := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "pool",
+		Name:        "queue_length",
+		Help:        "Number of jobs waiting for a pool worker.",
+		ConstLabels: labels,
+	}, queued)
+	b := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "pool",
+		Name:        "busy_workers",
+		Help:        "Number of pool workers currently running a job.",
+		ConstLabels: labels,
+	}, busy)
+	if err := Registry.Register(q); err != nil {
+		return fmt.Errorf("register pool %q: %w", name, err)
+	}
+	if err := Registry.Register(b); err != nil {
+		Registry.Unregister(q)
+		return fmt.Errorf("register pool %q: %w", name, err)
+	}
+	return nil
+}
+
+// Handler returns an http.Handler serving the rembg metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Serve starts an HTTP server exposing /metrics on addr in the background.
+// The returned server should be shut down by the caller when the job is done.
+func Serve(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics listen: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(os.Stderr, "metrics server:", err)
+		}
+	}()
+	return srv, nil
+}
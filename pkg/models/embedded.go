@@ -0,0 +1,28 @@
+package models
+
+import "fmt"
+
+// EmbeddedModelName names the model built into binaries compiled with
+// -tags embedmodel.
+const EmbeddedModelName = "u2netp.onnx"
+
+// HasEmbeddedModel reports whether this binary was built with
+// -tags embedmodel and carries EmbeddedModelName.
+func HasEmbeddedModel() bool {
+	return len(embeddedModel) > 0
+}
+
+// NewEmbeddedSession creates a session for the embedded model, so
+// single-binary deployments need no model file. It fails unless the binary
+// was built with -tags embedmodel.
+func NewEmbeddedSession(opts SessionOptions) (*Session, error) {
+	if !HasEmbeddedModel() {
+		return nil, fmt.Errorf("no embedded model: build with -tags embedmodel, or give a model path")
+	}
+	s, err := NewSessionFromBytes(embeddedModel, opts)
+	if err != nil {
+		return nil, fmt.Errorf("embedded model %s: %w", EmbeddedModelName, err)
+	}
+	s.ModelPath = "embedded:" + EmbeddedModelName
+	return s, nil
+}
@@ -0,0 +1,11 @@
+//go:build embedmodel
+
+package models
+
+import _ "embed"
+
+// embeddedModel is u2netp.onnx, which must be placed next to this file
+// before building (make build-embedded downloads it).
+//
+//go:embed u2netp.onnx
+var embeddedModel []byte
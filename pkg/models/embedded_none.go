@@ -0,0 +1,6 @@
+//go:build !embedmodel
+
+package models
+
+// embeddedModel is empty unless the binary is built with -tags embedmodel.
+var embeddedModel []byte
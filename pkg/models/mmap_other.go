@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package models
+
+import "os"
+
+// mapFile reads the file at path; memory mapping is only implemented on
+// Linux and macOS.
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// DefaultMaxBatch is the number of images PredictBatch stacks into one
+// forward pass unless SessionOptions.MaxBatch says otherwise.
+const DefaultMaxBatch = 8
+
+// defaultSize is the input side of U2Net-style models, used when the model
+// does not fix its input size.
+const defaultSize = 320
+
+// MaxBatch returns the most images PredictBatch stacks into one forward
+// pass: the model's batch dimension if it is fixed, else
+// SessionOptions.MaxBatch or DefaultMaxBatch.
+func (s *Session) MaxBatch() int {
+	if dims := s.inputDims(); dims[0] > 0 {
+		return int(dims[0])
+	}
+	if s.maxBatch > 0 {
+		return s.maxBatch
+	}
+	return DefaultMaxBatch
+}
+
+// inputDims returns the [N, C, H, W] dimensions of the first model input,
+// -1 where they are not fixed.
+func (s *Session) inputDims() [4]int64 {
+	dims := [4]int64{-1, -1, -1, -1}
+	if in := s.Inputs(); len(in) > 0 {
+		if d := in[0].Dims(); len(d) == 4 {
+			copy(dims[:], d)
+		}
+	}
+	return dims
+}
+
+// PredictBatch computes the mask of each image: the images are resized and
+// stacked into [N, 3, H, W] tensors of at most MaxBatch images, each run
+// in one forward pass, and the first output, of shape [N, 1, H, W], is
+// split into one mask per image, scaled to 0-255 and resized back to the
+// image's size. Masks are returned in input order.
+func (s *Session) PredictBatch(ctx context.Context, imgs []image.Image) ([]*image.Gray, error) {
+	dims := s.inputDims()
+	w, h := int(dims[3]), int(dims[2])
+	if w <= 0 || h <= 0 {
+		w, h = defaultSize, defaultSize
+	}
+	plane := w * h
+	masks := make([]*image.Gray, 0, len(imgs))
+	for start := 0; start < len(imgs); start += s.MaxBatch() {
+		chunk := imgs[start:min(len(imgs), start+s.MaxBatch())]
+		n := len(chunk)
+		if dims[0] > 0 && n < int(dims[0]) {
+			// a fixed batch dimension is padded with blank images
+			n = int(dims[0])
+		}
+		data := make([]float32, n*3*plane)
+		for i, img := range chunk {
+			imageInto(data[i*3*plane:(i+1)*3*plane], img, w, h)
+		}
+		outs, err := s.Run(ctx, Tensor{Shape: []int{n, 3, h, w}, Data: data})
+		if err != nil {
+			return nil, err
+		}
+		if len(outs) == 0 || len(outs[0].Data) != n*plane {
+			return nil, fmt.Errorf("mask output has %d values, want %d for %d images of %dx%d", outputLen(outs), n*plane, n, w, h)
+		}
+		for i, img := range chunk {
+			b := img.Bounds()
+			masks = append(masks, MaskImage(outs[0].Data[i*plane:(i+1)*plane], w, h, b.Dx(), b.Dy()))
+		}
+	}
+	return masks, nil
+}
+
+func outputLen(outs []Tensor) int {
+	if len(outs) == 0 {
+		return 0
+	}
+	return len(outs[0].Data)
+}
+
+// ImageTensor converts img to a [1, 3, h, w] tensor: resized with nearest
+// neighbour sampling, RGB planes scaled to [0, 1].
+func ImageTensor(img image.Image, w, h int) Tensor {
+	data := make([]float32, 3*w*h)
+	imageInto(data, img, w, h)
+	return Tensor{Shape: []int{1, 3, h, w}, Data: data}
+}
+
+// imageInto writes the planes ImageTensor computes to dst.
+func imageInto(dst []float32, img image.Image, w, h int) {
+	b := img.Bounds()
+	plane := w * h
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			pix := color.NRGBAModel.Convert(img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h)).(color.NRGBA)
+			i := y*w + x
+			dst[i] = float32(pix.R) / 255
+			dst[plane+i] = float32(pix.G) / 255
+			dst[2*plane+i] = float32(pix.B) / 255
+		}
+	}
+}
+
+// MaskImage turns a w x h saliency map into a grayscale mask of width x
+// height: values are min-max normalized to 0-255 and resized with nearest
+// neighbour sampling.
+func MaskImage(data []float32, w, h, width, height int) *image.Gray {
+	lo, hi := data[0], data[0]
+	for _, v := range data[:w*h] {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	scale := float32(0)
+	if hi > lo {
+		scale = 255 / (hi - lo)
+	}
+	mask := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := data[(y*h/height)*w:]
+		for x := 0; x < width; x++ {
+			mask.Pix[y*mask.Stride+x] = uint8((row[x*w/width] - lo) * scale)
+		}
+	}
+	return mask
+}
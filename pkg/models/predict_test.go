@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// writeGrayModel writes a model averaging the RGB planes of [N,3,4,4]
+// images into [N,1,4,4] masks, with a symbolic batch dimension unless
+// batch is positive.
+func writeGrayModel(t *testing.T, batch int64) string {
+	t.Helper()
+	n := onnx.Dim{Param: "batch"}
+	if batch > 0 {
+		n = onnx.Dim{Value: batch}
+	}
+	m := &onnx.Model{
+		IRVersion:    7,
+		OpsetImports: []onnx.OpsetID{{Version: 11}},
+		Graph: onnx.Graph{
+			Name:         "gray",
+			Nodes:        []onnx.Node{{OpType: "Conv", Inputs: []string{"x", "w"}, Outputs: []string{"y"}}},
+			Initializers: []onnx.Tensor{onnx.NewFloatTensor("w", []int64{1, 3, 1, 1}, []float32{1. / 3, 1. / 3, 1. / 3})},
+			Inputs:       []onnx.ValueInfo{{Name: "x", ElemType: onnx.Float, Shape: []onnx.Dim{n, {Value: 3}, {Value: 4}, {Value: 4}}}},
+			Outputs:      []onnx.ValueInfo{{Name: "y", ElemType: onnx.Float}},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "gray.onnx")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// halves returns a w x h image, black on the left and white on the right.
+func halves(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := w / 2; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+	}
+	return img
+}
+
+func TestPredictBatch(t *testing.T) {
+	imgs := []image.Image{halves(8, 6), halves(2, 2), halves(10, 3)}
+	for _, tc := range []struct {
+		batch    int64
+		maxBatch int
+		want     int
+	}{
+		{batch: 0, maxBatch: 2, want: 2},
+		{batch: 0, maxBatch: 0, want: DefaultMaxBatch},
+		{batch: 2, maxBatch: 8, want: 2},
+	} {
+		s, err := NewSessionWithOptions(writeGrayModel(t, tc.batch), SessionOptions{MaxBatch: tc.maxBatch})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.MaxBatch(); got != tc.want {
+			t.Fatalf("batch %d, MaxBatch %d: MaxBatch() = %d, want %d", tc.batch, tc.maxBatch, got, tc.want)
+		}
+		masks, err := s.PredictBatch(context.Background(), imgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(masks) != len(imgs) {
+			t.Fatalf("%d masks for %d images", len(masks), len(imgs))
+		}
+		for i, mask := range masks {
+			b := imgs[i].Bounds()
+			if mask.Bounds() != b {
+				t.Fatalf("mask %d bounds %v, want %v", i, mask.Bounds(), b)
+			}
+			if l, r := mask.GrayAt(0, 0).Y, mask.GrayAt(b.Dx()-1, b.Dy()-1).Y; l != 0 || r != 255 {
+				t.Fatalf("mask %d: left %d, right %d", i, l, r)
+			}
+		}
+	}
+}
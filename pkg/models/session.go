@@ -1,17 +1,239 @@
 package models
 
-import "fmt"
+import (
+    "context"
+    "fmt"
+    "io"
+    "os"
+    "sync"
 
-// Session represents a loaded ONNX model session.
+    "github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// Session represents a loaded ONNX model session. Models run on the
+// pure-Go engine package by default; building with -tags onnxruntime runs
+// them on ONNX Runtime instead, with the same API (see Runtime).
 type Session struct {
+    // ModelPath is the file the model was loaded from. It is empty for
+    // sessions created from memory, and "embedded:" followed by
+    // EmbeddedModelName for NewEmbeddedSession.
     ModelPath string
+    // Model is the decoded model, used for input/output metadata. Close
+    // sets it to nil, as its tensors may live in the memory Close frees;
+    // use LoadedModel where the session may be closed concurrently.
+    Model *onnx.Model
+
+    // mu is held for reading by Run and for writing by Close, so the
+    // runner and the memory backing Model outlive every running Run.
+    mu       sync.RWMutex
+    runner   runner
+    maxBatch int
+    // release frees the memory backing Model, e.g. unmaps the file.
+    release func() error
+}
+
+// runner is the runtime-specific half of a Session. Inputs reach run
+// named and checked against the model; outputs come back in graph order.
+type runner interface {
+    run(ctx context.Context, inputs []Tensor) ([]Tensor, error)
+    close() error
+}
+
+// Tensor is a named float32 tensor exchanged with Session.Run.
+type Tensor struct {
+    Name  string
+    Shape []int
+    Data  []float32
 }
 
-// NewSession initializes a new model session from a local model path.
+// SessionOptions tunes local execution. Options that only one runtime
+// understands are ignored by the other.
+type SessionOptions struct {
+    // Threads bounds the goroutines each operator uses, or ONNX Runtime's
+    // intra-op threads; zero uses every available CPU.
+    Threads int
+    // InterOpThreads sizes ONNX Runtime's inter-op pool, which runs
+    // independent operators in parallel; zero lets ONNX Runtime decide.
+    InterOpThreads int
+    // OptimizationLevel is the graph optimization level: "disable",
+    // "basic", "extended" or "all" (the default). The pure-Go engine only
+    // distinguishes "disable", which turns fusion off.
+    OptimizationLevel string
+    // NoFusion disables Conv+BatchNormalization+Relu fusion.
+    NoFusion bool
+    // NoMemArena disables ONNX Runtime's CPU memory arena, trading some
+    // speed for a smaller resident set.
+    NoMemArena bool
+    // MaxBatch bounds the images PredictBatch stacks into one forward
+    // pass; zero means DefaultMaxBatch. Models with a fixed batch
+    // dimension always use it.
+    MaxBatch int
+    // MemoryMap maps the model file read-only instead of reading it onto
+    // the heap. The mapped pages live in the page cache, shared by every
+    // process serving the same file, and back the weights the runtime
+    // uses in place (INT8 weights on the pure-Go engine). The mapping is
+    // released by Close, after which Model must not be used. It falls
+    // back to reading the file on systems other than Linux and macOS.
+    MemoryMap bool
+}
+
+var optimizationLevels = map[string]bool{"": true, "disable": true, "basic": true, "extended": true, "all": true}
+
+// NewSession initializes a new model session from a local model path. It
+// fails, listing them, if the model uses operators the engine cannot run.
 func NewSession(modelPath string) (*Session, error) {
-    // TODO: integrate ONNX runtime; return stub for now.
+    return NewSessionWithOptions(modelPath, SessionOptions{})
+}
+
+// NewSessionWithOptions is NewSession with explicit execution options.
+func NewSessionWithOptions(modelPath string, opts SessionOptions) (*Session, error) {
     if modelPath == "" {
         return nil, fmt.Errorf("modelPath required")
     }
-    return &Session{ModelPath: modelPath}, nil
+    read := func(path string) ([]byte, func() error, error) {
+        data, err := os.ReadFile(path)
+        return data, nil, err
+    }
+    if opts.MemoryMap {
+        read = mapFile
+    }
+    data, release, err := read(modelPath)
+    if err != nil {
+        return nil, fmt.Errorf("model read error: %w", err)
+    }
+    s, err := newSession(data, opts)
+    if err != nil {
+        if release != nil {
+            release()
+        }
+        return nil, fmt.Errorf("model %s: %w", modelPath, err)
+    }
+    s.ModelPath, s.release = modelPath, release
+    return s, nil
+}
+
+// NewSessionFromBytes creates a session for the serialized model in data,
+// e.g. one embedded in the binary. The session references data, which
+// must not be modified afterwards.
+func NewSessionFromBytes(data []byte, opts SessionOptions) (*Session, error) {
+    return newSession(data, opts)
+}
+
+// NewSessionFromReader creates a session for the serialized model read
+// from r.
+func NewSessionFromReader(r io.Reader, opts SessionOptions) (*Session, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, fmt.Errorf("model read error: %w", err)
+    }
+    return newSession(data, opts)
+}
+
+func newSession(data []byte, opts SessionOptions) (*Session, error) {
+    if !optimizationLevels[opts.OptimizationLevel] {
+        return nil, fmt.Errorf("unknown optimization level %q", opts.OptimizationLevel)
+    }
+    model, err := onnx.Decode(data)
+    if err != nil {
+        return nil, err
+    }
+    r, err := newRunner(model, data, opts)
+    if err != nil {
+        return nil, err
+    }
+    return &Session{Model: model, runner: r, maxBatch: opts.MaxBatch}, nil
+}
+
+// LoadedModel returns Model, or nil if the session is not loaded or has
+// been closed.
+func (s *Session) LoadedModel() *onnx.Model {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    if s.runner == nil {
+        return nil
+    }
+    return s.Model
+}
+
+// Inputs describes the tensors Run expects, or nothing once the session is
+// closed.
+func (s *Session) Inputs() []onnx.ValueInfo {
+    if m := s.LoadedModel(); m != nil {
+        return m.Graph.RuntimeInputs()
+    }
+    return nil
+}
+
+// Outputs describes the tensors Run returns, in order, or nothing once the
+// session is closed.
+func (s *Session) Outputs() []onnx.ValueInfo {
+    if m := s.LoadedModel(); m != nil {
+        return m.Graph.Outputs
+    }
+    return nil
+}
+
+// Run feeds inputs to the model and returns every graph output. Inputs are
+// matched by name; a single unnamed input feeds the first model input.
+// Run is safe for concurrent use.
+func (s *Session) Run(ctx context.Context, inputs ...Tensor) ([]Tensor, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    if s.Model == nil || s.runner == nil {
+        return nil, fmt.Errorf("session for %q is not loaded", s.ModelPath)
+    }
+    runtimeInputs := s.Model.Graph.RuntimeInputs()
+    declared := map[string]bool{}
+    for _, in := range runtimeInputs {
+        declared[in.Name] = true
+    }
+    named := make([]Tensor, len(inputs))
+    for i, in := range inputs {
+        if in.Name == "" && len(inputs) == 1 {
+            if rt := runtimeInputs; len(rt) > 0 {
+                in.Name = rt[0].Name
+            }
+        }
+        if !declared[in.Name] {
+            return nil, fmt.Errorf("model has no input %q", in.Name)
+        }
+        n := 1
+        for _, d := range in.Shape {
+            n *= d
+        }
+        if n != len(in.Data) {
+            return nil, fmt.Errorf("input %q: shape %v needs %d values, got %d", in.Name, in.Shape, n, len(in.Data))
+        }
+        named[i] = in
+    }
+    outs, err := s.runner.run(ctx, named)
+    if err != nil {
+        return nil, fmt.Errorf("inference error: %w", err)
+    }
+    for i := range outs {
+        outs[i].Name = s.Model.Graph.Outputs[i].Name
+    }
+    return outs, nil
+}
+
+// Close releases the runtime's resources. It is only needed with ONNX
+// Runtime, whose sessions hold native memory, and with
+// SessionOptions.MemoryMap; the session is unusable afterwards. Close
+// waits for running calls to Run to return.
+func (s *Session) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var err error
+    if s.runner != nil {
+        err = s.runner.close()
+        s.runner = nil
+    }
+    if s.release != nil {
+        if rerr := s.release(); err == nil {
+            err = rerr
+        }
+        s.release = nil
+    }
+    s.Model = nil
+    return err
 }
@@ -0,0 +1,52 @@
+//go:build !onnxruntime
+
+package models
+
+import (
+	"context"
+
+	"github.com/unrealandychan/rembg-go/pkg/engine"
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// Runtime names the inference runtime sessions use in this build.
+const Runtime = "pure-go"
+
+// engineRunner runs models on the pure-Go engine.
+type engineRunner struct {
+	engine *engine.Engine
+}
+
+func newRunner(model *onnx.Model, _ []byte, opts SessionOptions) (runner, error) {
+	e, err := engine.NewWithOptions(model, engine.Options{
+		Threads:  opts.Threads,
+		NoFusion: opts.NoFusion || opts.OptimizationLevel == "disable",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &engineRunner{engine: e}, nil
+}
+
+func (r *engineRunner) run(ctx context.Context, inputs []Tensor) ([]Tensor, error) {
+	feeds := make(map[string]*engine.Tensor, len(inputs))
+	for _, in := range inputs {
+		feeds[in.Name] = engine.NewTensor(in.Shape, in.Data)
+	}
+	outs, err := r.engine.Run(ctx, feeds)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Tensor, len(outs))
+	for i, o := range outs {
+		result[i] = Tensor{
+			Shape: append([]int(nil), o.Shape...),
+			Data:  append([]float32(nil), o.Float32s()...),
+		}
+	}
+	return result, nil
+}
+
+func (r *engineRunner) close() error {
+	return nil
+}
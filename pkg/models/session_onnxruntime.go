@@ -0,0 +1,159 @@
+//go:build onnxruntime
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// Runtime names the inference runtime sessions use in this build.
+const Runtime = "onnxruntime"
+
+// ortLibraryEnv names the environment variable locating the ONNX Runtime
+// shared library (e.g. /usr/local/lib/libonnxruntime.so) when it is not on
+// the default library path.
+const ortLibraryEnv = "ONNXRUNTIME_SHARED_LIBRARY_PATH"
+
+var (
+	ortOnce sync.Once
+	ortErr  error
+)
+
+// initORT loads the shared library and creates the process-wide ONNX
+// Runtime environment on first use.
+func initORT() error {
+	ortOnce.Do(func() {
+		if path := os.Getenv(ortLibraryEnv); path != "" {
+			ort.SetSharedLibraryPath(path)
+		}
+		if err := ort.InitializeEnvironment(); err != nil {
+			ortErr = fmt.Errorf("initialize onnxruntime (set %s to the shared library): %w", ortLibraryEnv, err)
+		}
+	})
+	return ortErr
+}
+
+var ortOptimizationLevels = map[string]ort.GraphOptimizationLevel{
+	"":         ort.GraphOptimizationLevelEnableAll,
+	"disable":  ort.GraphOptimizationLevelDisableAll,
+	"basic":    ort.GraphOptimizationLevelEnableBasic,
+	"extended": ort.GraphOptimizationLevelEnableExtended,
+	"all":      ort.GraphOptimizationLevelEnableAll,
+}
+
+// ortRunner runs models on ONNX Runtime's CPU execution provider.
+type ortRunner struct {
+	session *ort.DynamicAdvancedSession
+	inputs  []string
+	outputs []string
+}
+
+func newRunner(model *onnx.Model, data []byte, opts SessionOptions) (runner, error) {
+	if err := initORT(); err != nil {
+		return nil, err
+	}
+	so, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	defer so.Destroy()
+	if opts.Threads > 0 {
+		if err := so.SetIntraOpNumThreads(opts.Threads); err != nil {
+			return nil, fmt.Errorf("intra-op threads: %w", err)
+		}
+	}
+	if opts.InterOpThreads > 0 {
+		// the inter-op pool is only used in parallel execution mode
+		if err := so.SetExecutionMode(ort.ExecutionModeParallel); err != nil {
+			return nil, fmt.Errorf("execution mode: %w", err)
+		}
+		if err := so.SetInterOpNumThreads(opts.InterOpThreads); err != nil {
+			return nil, fmt.Errorf("inter-op threads: %w", err)
+		}
+	}
+	if err := so.SetGraphOptimizationLevel(ortOptimizationLevels[opts.OptimizationLevel]); err != nil {
+		return nil, fmt.Errorf("optimization level: %w", err)
+	}
+	if err := so.SetCpuMemArena(!opts.NoMemArena); err != nil {
+		return nil, fmt.Errorf("memory arena: %w", err)
+	}
+
+	r := &ortRunner{}
+	for _, in := range model.Graph.RuntimeInputs() {
+		r.inputs = append(r.inputs, in.Name)
+	}
+	for _, out := range model.Graph.Outputs {
+		r.outputs = append(r.outputs, out.Name)
+	}
+	r.session, err = ort.NewDynamicAdvancedSessionWithONNXData(data, r.inputs, r.outputs, so)
+	if err != nil {
+		return nil, fmt.Errorf("create onnxruntime session: %w", err)
+	}
+	return r, nil
+}
+
+func (r *ortRunner) run(ctx context.Context, inputs []Tensor) ([]Tensor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Tensor, len(inputs))
+	for _, in := range inputs {
+		byName[in.Name] = in
+	}
+	values := make([]ort.Value, len(r.inputs))
+	defer destroyAll(values)
+	for i, name := range r.inputs {
+		in, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %q", name)
+		}
+		dims := make([]int64, len(in.Shape))
+		for j, d := range in.Shape {
+			dims[j] = int64(d)
+		}
+		t, err := ort.NewTensor(ort.NewShape(dims...), in.Data)
+		if err != nil {
+			return nil, fmt.Errorf("input %q: %w", name, err)
+		}
+		values[i] = t
+	}
+	// nil outputs are allocated by onnxruntime with the shapes it infers
+	outs := make([]ort.Value, len(r.outputs))
+	defer destroyAll(outs)
+	if err := r.session.Run(values, outs); err != nil {
+		return nil, err
+	}
+	result := make([]Tensor, len(outs))
+	for i, v := range outs {
+		t, ok := v.(*ort.Tensor[float32])
+		if !ok {
+			return nil, fmt.Errorf("output %q: only float32 outputs are supported", r.outputs[i])
+		}
+		shape := t.GetShape()
+		result[i].Shape = make([]int, len(shape))
+		for j, d := range shape {
+			result[i].Shape[j] = int(d)
+		}
+		result[i].Data = append([]float32(nil), t.GetData()...)
+	}
+	return result, nil
+}
+
+func (r *ortRunner) close() error {
+	return r.session.Destroy()
+}
+
+func destroyAll(values []ort.Value) {
+	for _, v := range values {
+		if v != nil {
+			v.Destroy()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// writeSigmoidModel writes a one-node model computing y = Sigmoid(x) for x of shape [1,1,2,2].
+func writeSigmoidModel(t *testing.T) string {
+	t.Helper()
+	shape := []onnx.Dim{{Value: 1}, {Value: 1}, {Value: 2}, {Value: 2}}
+	m := &onnx.Model{
+		IRVersion:    7,
+		OpsetImports: []onnx.OpsetID{{Version: 11}},
+		Graph: onnx.Graph{
+			Name:    "sigmoid",
+			Nodes:   []onnx.Node{{OpType: "Sigmoid", Inputs: []string{"x"}, Outputs: []string{"y"}}},
+			Inputs:  []onnx.ValueInfo{{Name: "x", ElemType: onnx.Float, Shape: shape}},
+			Outputs: []onnx.ValueInfo{{Name: "y", ElemType: onnx.Float, Shape: shape}},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "sigmoid.onnx")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSessionRun(t *testing.T) {
+	s, err := NewSession(writeSigmoidModel(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in := s.Inputs(); len(in) != 1 || in[0].Name != "x" {
+		t.Fatalf("inputs = %+v", in)
+	}
+	for run := 0; run < 2; run++ {
+		x := []float32{0, 1, -1, float32(run)}
+		out, err := s.Run(context.Background(), Tensor{Shape: []int{1, 1, 2, 2}, Data: x})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 || out[0].Name != "y" {
+			t.Fatalf("outputs = %+v", out)
+		}
+		for i, v := range out[0].Data {
+			want := 1 / (1 + math.Exp(-float64(x[i])))
+			if math.Abs(float64(v)-want) > 1e-5 {
+				t.Fatalf("run %d: y[%d] = %v, want %v", run, i, v, want)
+			}
+		}
+	}
+	if _, err := s.Run(context.Background(), Tensor{Name: "nope", Shape: []int{1}, Data: []float32{0}}); err == nil {
+		t.Fatal("expected error for unknown input")
+	}
+}
+
+func TestSessionOptions(t *testing.T) {
+	path := writeSigmoidModel(t)
+	if _, err := NewSessionWithOptions(path, SessionOptions{OptimizationLevel: "max"}); err == nil {
+		t.Fatal("expected error for unknown optimization level")
+	}
+	s, err := NewSessionWithOptions(path, SessionOptions{Threads: 2, InterOpThreads: 2, OptimizationLevel: "disable", NoMemArena: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(context.Background(), Tensor{Shape: []int{1, 1, 2, 2}, Data: make([]float32, 4)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(context.Background(), Tensor{Shape: []int{1, 1, 2, 2}, Data: make([]float32, 4)}); err == nil {
+		t.Fatal("expected error after Close")
+	}
+}
+
+func TestSessionSources(t *testing.T) {
+	path := writeSigmoidModel(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := map[string]func() (*Session, error){
+		"bytes":  func() (*Session, error) { return NewSessionFromBytes(data, SessionOptions{}) },
+		"reader": func() (*Session, error) { return NewSessionFromReader(bytes.NewReader(data), SessionOptions{}) },
+		"mmap":   func() (*Session, error) { return NewSessionWithOptions(path, SessionOptions{MemoryMap: true}) },
+	}
+	for name, fn := range open {
+		s, err := fn()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := s.Run(context.Background(), Tensor{Shape: []int{1, 1, 2, 2}, Data: make([]float32, 4)})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out[0].Data[0] != 0.5 {
+			t.Fatalf("%s: y = %v", name, out[0].Data)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if _, err := NewSessionFromBytes([]byte("not a model"), SessionOptions{}); err == nil {
+		t.Fatal("expected error for invalid model bytes")
+	}
+	if _, err := NewSessionWithOptions(filepath.Join(t.TempDir(), "missing.onnx"), SessionOptions{MemoryMap: true}); err == nil {
+		t.Fatal("expected error for a missing file")
+	}
+	if _, err := NewEmbeddedSession(SessionOptions{}); HasEmbeddedModel() == (err != nil) {
+		t.Fatalf("HasEmbeddedModel() = %v, NewEmbeddedSession error %v", HasEmbeddedModel(), err)
+	}
+}
+
+func TestSessionCloseWhileRunning(t *testing.T) {
+	s, err := NewSessionWithOptions(writeSigmoidModel(t), SessionOptions{MemoryMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// run until Close makes the session unusable
+			for {
+				if _, err := s.Run(context.Background(), Tensor{Shape: []int{1, 1, 2, 2}, Data: make([]float32, 4)}); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if s.Model != nil || s.LoadedModel() != nil || len(s.Inputs()) != 0 {
+		t.Fatal("the closed session still exposes its model")
+	}
+}
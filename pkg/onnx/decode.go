@@ -0,0 +1,393 @@
+package onnx
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Decode parses a serialized ModelProto. Raw tensor data in the returned
+// model references data, which must not be modified afterwards.
+func Decode(data []byte) (*Model, error) {
+	m := &Model{}
+	if err := decodeModel(data, m); err != nil {
+		return nil, fmt.Errorf("decode onnx model: %w", err)
+	}
+	return m, nil
+}
+
+// Read decodes a model from r.
+func Read(r io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read onnx model: %w", err)
+	}
+	return Decode(data)
+}
+
+// ReadFile decodes the model stored at path.
+func ReadFile(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read onnx model: %w", err)
+	}
+	return Decode(data)
+}
+
+// field is one decoded protobuf field: scalar holds varint and fixed-width
+// values, bytes holds length-delimited ones.
+type field struct {
+	num    protowire.Number
+	typ    protowire.Type
+	scalar uint64
+	bytes  []byte
+}
+
+func (f field) str() string    { return string(f.bytes) }
+func (f field) int64() int64   { return int64(f.scalar) }
+func (f field) float() float32 { return math.Float32frombits(uint32(f.scalar)) }
+func (f field) clone() []byte  { return append([]byte(nil), f.bytes...) }
+func (f field) wrongType() error {
+	return fmt.Errorf("field %d: unexpected wire type %d", f.num, f.typ)
+}
+
+// eachField calls fn for every field of the message encoded in b.
+func eachField(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.scalar, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.scalar = uint64(v)
+		case protowire.Fixed64Type:
+			f.scalar, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendVarints appends a repeated varint field, packed or not.
+func appendVarints[T int32 | int64 | uint64](dst []T, f field) ([]T, error) {
+	switch f.typ {
+	case protowire.VarintType:
+		return append(dst, T(f.scalar)), nil
+	case protowire.BytesType:
+		b := f.bytes
+		for len(b) > 0 {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			dst = append(dst, T(v))
+			b = b[n:]
+		}
+		return dst, nil
+	default:
+		return nil, f.wrongType()
+	}
+}
+
+// appendFloats appends a repeated float field, packed or not.
+func appendFloats(dst []float32, f field) ([]float32, error) {
+	switch f.typ {
+	case protowire.Fixed32Type:
+		return append(dst, f.float()), nil
+	case protowire.BytesType:
+		if len(f.bytes)%4 != 0 {
+			return nil, fmt.Errorf("field %d: packed floats of %d bytes", f.num, len(f.bytes))
+		}
+		for b := f.bytes; len(b) > 0; b = b[4:] {
+			v, _ := protowire.ConsumeFixed32(b)
+			dst = append(dst, math.Float32frombits(v))
+		}
+		return dst, nil
+	default:
+		return nil, f.wrongType()
+	}
+}
+
+// appendDoubles appends a repeated double field, packed or not.
+func appendDoubles(dst []float64, f field) ([]float64, error) {
+	switch f.typ {
+	case protowire.Fixed64Type:
+		return append(dst, math.Float64frombits(f.scalar)), nil
+	case protowire.BytesType:
+		if len(f.bytes)%8 != 0 {
+			return nil, fmt.Errorf("field %d: packed doubles of %d bytes", f.num, len(f.bytes))
+		}
+		for b := f.bytes; len(b) > 0; b = b[8:] {
+			v, _ := protowire.ConsumeFixed64(b)
+			dst = append(dst, math.Float64frombits(v))
+		}
+		return dst, nil
+	default:
+		return nil, f.wrongType()
+	}
+}
+
+func decodeModel(b []byte, m *Model) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.IRVersion = f.int64()
+		case 2:
+			m.ProducerName = f.str()
+		case 3:
+			m.ProducerVersion = f.str()
+		case 4:
+			m.Domain = f.str()
+		case 5:
+			m.ModelVersion = f.int64()
+		case 6:
+			m.DocString = f.str()
+		case 7:
+			if err := decodeGraph(f.bytes, &m.Graph); err != nil {
+				return fmt.Errorf("graph: %w", err)
+			}
+		case 8:
+			var o OpsetID
+			err := eachField(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					o.Domain = f.str()
+				case 2:
+					o.Version = f.int64()
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("opset_import: %w", err)
+			}
+			m.OpsetImports = append(m.OpsetImports, o)
+		case 14:
+			var key, value string
+			err := eachField(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					key = f.str()
+				case 2:
+					value = f.str()
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("metadata_props: %w", err)
+			}
+			if m.MetadataProps == nil {
+				m.MetadataProps = map[string]string{}
+			}
+			m.MetadataProps[key] = value
+		}
+		return nil
+	})
+}
+
+func decodeGraph(b []byte, g *Graph) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			var n Node
+			if err := decodeNode(f.bytes, &n); err != nil {
+				return fmt.Errorf("node %d: %w", len(g.Nodes), err)
+			}
+			g.Nodes = append(g.Nodes, n)
+		case 2:
+			g.Name = f.str()
+		case 5:
+			var t Tensor
+			if err := decodeTensor(f.bytes, &t); err != nil {
+				return fmt.Errorf("initializer %d: %w", len(g.Initializers), err)
+			}
+			g.Initializers = append(g.Initializers, t)
+		case 10:
+			g.DocString = f.str()
+		case 11, 12, 13:
+			var v ValueInfo
+			if err := decodeValueInfo(f.bytes, &v); err != nil {
+				return fmt.Errorf("value info: %w", err)
+			}
+			switch f.num {
+			case 11:
+				g.Inputs = append(g.Inputs, v)
+			case 12:
+				g.Outputs = append(g.Outputs, v)
+			default:
+				g.ValueInfo = append(g.ValueInfo, v)
+			}
+		}
+		return nil
+	})
+}
+
+func decodeNode(b []byte, n *Node) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			n.Inputs = append(n.Inputs, f.str())
+		case 2:
+			n.Outputs = append(n.Outputs, f.str())
+		case 3:
+			n.Name = f.str()
+		case 4:
+			n.OpType = f.str()
+		case 5:
+			var a Attribute
+			if err := decodeAttribute(f.bytes, &a); err != nil {
+				return fmt.Errorf("attribute: %w", err)
+			}
+			n.Attributes = append(n.Attributes, a)
+		case 6:
+			n.DocString = f.str()
+		case 7:
+			n.Domain = f.str()
+		}
+		return nil
+	})
+}
+
+func decodeAttribute(b []byte, a *Attribute) error {
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			a.Name = f.str()
+		case 20:
+			a.Type = AttributeType(f.scalar)
+		case 2:
+			a.F = f.float()
+		case 3:
+			a.I = f.int64()
+		case 4:
+			a.S = f.clone()
+		case 5:
+			a.T = &Tensor{}
+			err = decodeTensor(f.bytes, a.T)
+		case 6:
+			a.G = &Graph{}
+			err = decodeGraph(f.bytes, a.G)
+		case 7:
+			a.Floats, err = appendFloats(a.Floats, f)
+		case 8:
+			a.Ints, err = appendVarints(a.Ints, f)
+		case 9:
+			a.Strings = append(a.Strings, f.clone())
+		case 10:
+			var t Tensor
+			err = decodeTensor(f.bytes, &t)
+			a.Tensors = append(a.Tensors, t)
+		case 11:
+			var g Graph
+			err = decodeGraph(f.bytes, &g)
+			a.Graphs = append(a.Graphs, g)
+		}
+		if err != nil {
+			return fmt.Errorf("%q: %w", a.Name, err)
+		}
+		return nil
+	})
+}
+
+func decodeTensor(b []byte, t *Tensor) error {
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			t.Dims, err = appendVarints(t.Dims, f)
+		case 2:
+			t.DataType = DataType(f.scalar)
+		case 4:
+			t.FloatData, err = appendFloats(t.FloatData, f)
+		case 5:
+			t.Int32Data, err = appendVarints(t.Int32Data, f)
+		case 6:
+			t.StringData = append(t.StringData, f.clone())
+		case 7:
+			t.Int64Data, err = appendVarints(t.Int64Data, f)
+		case 8:
+			t.Name = f.str()
+		case 9:
+			// alias the input so large weights are not copied
+			t.RawData = f.bytes
+		case 10:
+			t.DoubleData, err = appendDoubles(t.DoubleData, f)
+		case 11:
+			t.Uint64Data, err = appendVarints(t.Uint64Data, f)
+		case 12:
+			t.DocString = f.str()
+		case 14:
+			if f.scalar != 0 {
+				err = fmt.Errorf("tensor %q: external data is not supported", t.Name)
+			}
+		}
+		return err
+	})
+}
+
+func decodeValueInfo(b []byte, v *ValueInfo) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			v.Name = f.str()
+		case 2:
+			// TypeProto: only tensor_type (1) is of interest
+			return eachField(f.bytes, func(f field) error {
+				if f.num != 1 {
+					return nil
+				}
+				return decodeTensorType(f.bytes, v)
+			})
+		case 3:
+			v.DocString = f.str()
+		}
+		return nil
+	})
+}
+
+func decodeTensorType(b []byte, v *ValueInfo) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			v.ElemType = DataType(f.scalar)
+		case 2:
+			v.Shape = []Dim{}
+			return eachField(f.bytes, func(f field) error {
+				if f.num != 1 {
+					return nil
+				}
+				var d Dim
+				err := eachField(f.bytes, func(f field) error {
+					switch f.num {
+					case 1:
+						d.Value = f.int64()
+					case 2:
+						d.Param = f.str()
+					}
+					return nil
+				})
+				v.Shape = append(v.Shape, d)
+				return err
+			})
+		}
+		return nil
+	})
+}
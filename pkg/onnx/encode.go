@@ -0,0 +1,231 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Encode serializes m as a ModelProto.
+func (m *Model) Encode() []byte {
+	var b []byte
+	b = appendInt(b, 1, m.IRVersion)
+	b = appendString(b, 2, m.ProducerName)
+	b = appendString(b, 3, m.ProducerVersion)
+	b = appendString(b, 4, m.Domain)
+	b = appendInt(b, 5, m.ModelVersion)
+	b = appendString(b, 6, m.DocString)
+	b = appendMessage(b, 7, encodeGraph(&m.Graph))
+	for _, o := range m.OpsetImports {
+		var ob []byte
+		ob = appendString(ob, 1, o.Domain)
+		ob = protowire.AppendTag(ob, 2, protowire.VarintType)
+		ob = protowire.AppendVarint(ob, uint64(o.Version))
+		b = appendMessage(b, 8, ob)
+	}
+	keys := make([]string, 0, len(m.MetadataProps))
+	for k := range m.MetadataProps {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var pb []byte
+		pb = appendString(pb, 1, k)
+		pb = appendString(pb, 2, m.MetadataProps[k])
+		b = appendMessage(b, 14, pb)
+	}
+	return b
+}
+
+// WriteFile writes m to path.
+func (m *Model) WriteFile(path string) error {
+	if err := os.WriteFile(path, m.Encode(), 0o644); err != nil {
+		return fmt.Errorf("write onnx model: %w", err)
+	}
+	return nil
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	return appendBytes(b, num, msg)
+}
+
+func appendPackedVarints[T int32 | int64 | uint64](b []byte, num protowire.Number, vs []T) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+	var p []byte
+	for _, v := range vs {
+		p = protowire.AppendVarint(p, uint64(v))
+	}
+	return appendBytes(b, num, p)
+}
+
+func encodeGraph(g *Graph) []byte {
+	var b []byte
+	for i := range g.Nodes {
+		b = appendMessage(b, 1, encodeNode(&g.Nodes[i]))
+	}
+	b = appendString(b, 2, g.Name)
+	for i := range g.Initializers {
+		b = appendMessage(b, 5, encodeTensor(&g.Initializers[i]))
+	}
+	b = appendString(b, 10, g.DocString)
+	for _, v := range g.Inputs {
+		b = appendMessage(b, 11, encodeValueInfo(v))
+	}
+	for _, v := range g.Outputs {
+		b = appendMessage(b, 12, encodeValueInfo(v))
+	}
+	for _, v := range g.ValueInfo {
+		b = appendMessage(b, 13, encodeValueInfo(v))
+	}
+	return b
+}
+
+func encodeNode(n *Node) []byte {
+	var b []byte
+	// empty names mark omitted optional inputs and must be kept
+	for _, in := range n.Inputs {
+		b = appendBytes(b, 1, []byte(in))
+	}
+	for _, out := range n.Outputs {
+		b = appendBytes(b, 2, []byte(out))
+	}
+	b = appendString(b, 3, n.Name)
+	b = appendString(b, 4, n.OpType)
+	for i := range n.Attributes {
+		b = appendMessage(b, 5, encodeAttribute(&n.Attributes[i]))
+	}
+	b = appendString(b, 6, n.DocString)
+	b = appendString(b, 7, n.Domain)
+	return b
+}
+
+func encodeAttribute(a *Attribute) []byte {
+	var b []byte
+	b = appendString(b, 1, a.Name)
+	switch a.Type {
+	case AttrFloat:
+		b = protowire.AppendTag(b, 2, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(a.F))
+	case AttrInt:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(a.I))
+	case AttrString:
+		b = appendBytes(b, 4, a.S)
+	case AttrTensor:
+		if a.T != nil {
+			b = appendMessage(b, 5, encodeTensor(a.T))
+		}
+	case AttrGraph:
+		if a.G != nil {
+			b = appendMessage(b, 6, encodeGraph(a.G))
+		}
+	case AttrFloats:
+		for _, f := range a.Floats {
+			b = protowire.AppendTag(b, 7, protowire.Fixed32Type)
+			b = protowire.AppendFixed32(b, math.Float32bits(f))
+		}
+	case AttrInts:
+		for _, v := range a.Ints {
+			b = protowire.AppendTag(b, 8, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		}
+	case AttrStrings:
+		for _, s := range a.Strings {
+			b = appendBytes(b, 9, s)
+		}
+	case AttrTensors:
+		for i := range a.Tensors {
+			b = appendMessage(b, 10, encodeTensor(&a.Tensors[i]))
+		}
+	case AttrGraphs:
+		for i := range a.Graphs {
+			b = appendMessage(b, 11, encodeGraph(&a.Graphs[i]))
+		}
+	}
+	b = protowire.AppendTag(b, 20, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(a.Type))
+}
+
+func encodeTensor(t *Tensor) []byte {
+	var b []byte
+	for _, d := range t.Dims {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(d))
+	}
+	b = appendInt(b, 2, int64(t.DataType))
+	if len(t.FloatData) > 0 {
+		p := make([]byte, 0, 4*len(t.FloatData))
+		for _, f := range t.FloatData {
+			p = protowire.AppendFixed32(p, math.Float32bits(f))
+		}
+		b = appendBytes(b, 4, p)
+	}
+	b = appendPackedVarints(b, 5, t.Int32Data)
+	for _, s := range t.StringData {
+		b = appendBytes(b, 6, s)
+	}
+	b = appendPackedVarints(b, 7, t.Int64Data)
+	b = appendString(b, 8, t.Name)
+	if t.RawData != nil {
+		b = appendBytes(b, 9, t.RawData)
+	}
+	if len(t.DoubleData) > 0 {
+		p := make([]byte, 0, 8*len(t.DoubleData))
+		for _, f := range t.DoubleData {
+			p = protowire.AppendFixed64(p, math.Float64bits(f))
+		}
+		b = appendBytes(b, 10, p)
+	}
+	b = appendPackedVarints(b, 11, t.Uint64Data)
+	b = appendString(b, 12, t.DocString)
+	return b
+}
+
+func encodeValueInfo(v ValueInfo) []byte {
+	var tt []byte
+	tt = appendInt(tt, 1, int64(v.ElemType))
+	if v.Shape != nil {
+		var sb []byte
+		for _, d := range v.Shape {
+			var db []byte
+			if d.Param != "" {
+				db = appendString(db, 2, d.Param)
+			} else if d.Value > 0 {
+				db = appendInt(db, 1, d.Value)
+			}
+			sb = appendMessage(sb, 1, db)
+		}
+		tt = appendMessage(tt, 2, sb)
+	}
+	var b []byte
+	b = appendString(b, 1, v.Name)
+	b = appendMessage(b, 2, appendMessage(nil, 1, tt))
+	b = appendString(b, 3, v.DocString)
+	return b
+}
@@ -0,0 +1,376 @@
+// Package onnx reads and writes the subset of the ONNX model format rembg-go
+// needs to inspect and run segmentation models: the graph, its nodes and
+// attributes, initializers and the typed inputs and outputs. It decodes the
+// protobuf wire format directly and has no generated code.
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DataType is the element type of a tensor (TensorProto.DataType).
+type DataType int32
+
+const (
+	Undefined  DataType = 0
+	Float      DataType = 1
+	Uint8      DataType = 2
+	Int8       DataType = 3
+	Uint16     DataType = 4
+	Int16      DataType = 5
+	Int32      DataType = 6
+	Int64      DataType = 7
+	String     DataType = 8
+	Bool       DataType = 9
+	Float16    DataType = 10
+	Double     DataType = 11
+	Uint32     DataType = 12
+	Uint64     DataType = 13
+	Complex64  DataType = 14
+	Complex128 DataType = 15
+	BFloat16   DataType = 16
+)
+
+var tritonNames = map[DataType]string{
+	Float:    "FP32",
+	Uint8:    "UINT8",
+	Int8:     "INT8",
+	Uint16:   "UINT16",
+	Int16:    "INT16",
+	Int32:    "INT32",
+	Int64:    "INT64",
+	String:   "BYTES",
+	Bool:     "BOOL",
+	Float16:  "FP16",
+	Double:   "FP64",
+	Uint32:   "UINT32",
+	Uint64:   "UINT64",
+	BFloat16: "BF16",
+}
+
+// TritonName returns the Triton / KServe v2 datatype string for d ("FP32",
+// "UINT8", ...), or "" if Triton has no equivalent.
+func (d DataType) TritonName() string {
+	return tritonNames[d]
+}
+
+// DataTypeFromTriton maps a Triton datatype string back to a DataType.
+func DataTypeFromTriton(name string) (DataType, error) {
+	for d, n := range tritonNames {
+		if n == name {
+			return d, nil
+		}
+	}
+	return Undefined, fmt.Errorf("unknown triton datatype %q", name)
+}
+
+// Size returns the size in bytes of one element of d, or 0 for variable-size
+// and unsupported types.
+func (d DataType) Size() int {
+	switch d {
+	case Uint8, Int8, Bool:
+		return 1
+	case Uint16, Int16, Float16, BFloat16:
+		return 2
+	case Float, Int32, Uint32:
+		return 4
+	case Int64, Uint64, Double, Complex64:
+		return 8
+	case Complex128:
+		return 16
+	default:
+		return 0
+	}
+}
+
+// Model is a decoded ModelProto.
+type Model struct {
+	IRVersion       int64
+	OpsetImports    []OpsetID
+	ProducerName    string
+	ProducerVersion string
+	Domain          string
+	ModelVersion    int64
+	DocString       string
+	Graph           Graph
+	MetadataProps   map[string]string
+}
+
+// OpsetID names an operator set a model depends on; an empty Domain is the
+// default ai.onnx domain.
+type OpsetID struct {
+	Domain  string
+	Version int64
+}
+
+// Graph is a decoded GraphProto.
+type Graph struct {
+	Name         string
+	Nodes        []Node
+	Initializers []Tensor
+	Inputs       []ValueInfo
+	Outputs      []ValueInfo
+	ValueInfo    []ValueInfo
+	DocString    string
+}
+
+// Node is one operator invocation in a graph.
+type Node struct {
+	Name       string
+	OpType     string
+	Domain     string
+	Inputs     []string
+	Outputs    []string
+	Attributes []Attribute
+	DocString  string
+}
+
+// AttributeType is the type tag of an Attribute.
+type AttributeType int32
+
+const (
+	AttrUndefined AttributeType = 0
+	AttrFloat     AttributeType = 1
+	AttrInt       AttributeType = 2
+	AttrString    AttributeType = 3
+	AttrTensor    AttributeType = 4
+	AttrGraph     AttributeType = 5
+	AttrFloats    AttributeType = 6
+	AttrInts      AttributeType = 7
+	AttrStrings   AttributeType = 8
+	AttrTensors   AttributeType = 9
+	AttrGraphs    AttributeType = 10
+)
+
+// Attribute is a named operator attribute; the field matching Type is set.
+type Attribute struct {
+	Name    string
+	Type    AttributeType
+	F       float32
+	I       int64
+	S       []byte
+	T       *Tensor
+	G       *Graph
+	Floats  []float32
+	Ints    []int64
+	Strings [][]byte
+	Tensors []Tensor
+	Graphs  []Graph
+}
+
+// Tensor is a decoded TensorProto. Values are held either in the typed
+// fields or in RawData (little-endian), as in the file.
+type Tensor struct {
+	Name       string
+	Dims       []int64
+	DataType   DataType
+	FloatData  []float32
+	Int32Data  []int32
+	StringData [][]byte
+	Int64Data  []int64
+	DoubleData []float64
+	Uint64Data []uint64
+	RawData    []byte
+	DocString  string
+}
+
+// ValueInfo describes a graph input, output or intermediate value.
+type ValueInfo struct {
+	Name     string
+	ElemType DataType
+	// Shape is nil when the rank is unknown.
+	Shape     []Dim
+	DocString string
+}
+
+// Dim is one dimension of a shape: a fixed Value, a symbolic Param such as
+// "batch", or neither when unknown.
+type Dim struct {
+	Value int64
+	Param string
+}
+
+// Dims returns the shape with symbolic and unknown dimensions as -1.
+func (v ValueInfo) Dims() []int64 {
+	if v.Shape == nil {
+		return nil
+	}
+	out := make([]int64, len(v.Shape))
+	for i, d := range v.Shape {
+		if d.Param != "" || d.Value <= 0 {
+			out[i] = -1
+		} else {
+			out[i] = d.Value
+		}
+	}
+	return out
+}
+
+// Opset returns the version of the operator set imported for domain ("" or
+// "ai.onnx" for the default domain), or 0 if it is not imported.
+func (m *Model) Opset(domain string) int64 {
+	if domain == "ai.onnx" {
+		domain = ""
+	}
+	for _, o := range m.OpsetImports {
+		d := o.Domain
+		if d == "ai.onnx" {
+			d = ""
+		}
+		if d == domain {
+			return o.Version
+		}
+	}
+	return 0
+}
+
+// Operators returns the sorted, de-duplicated op types used by the main graph
+// and its subgraphs.
+func (m *Model) Operators() []string {
+	seen := map[string]bool{}
+	var walk func(g *Graph)
+	walk = func(g *Graph) {
+		for _, n := range g.Nodes {
+			seen[n.OpType] = true
+			for _, a := range n.Attributes {
+				if a.G != nil {
+					walk(a.G)
+				}
+				for i := range a.Graphs {
+					walk(&a.Graphs[i])
+				}
+			}
+		}
+	}
+	walk(&m.Graph)
+	ops := make([]string, 0, len(seen))
+	for op := range seen {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// RuntimeInputs returns the graph inputs that must be fed at run time. Models
+// exported with IR version < 4 also list their initializers as inputs; those
+// are skipped.
+func (g *Graph) RuntimeInputs() []ValueInfo {
+	inits := make(map[string]bool, len(g.Initializers))
+	for _, t := range g.Initializers {
+		inits[t.Name] = true
+	}
+	var out []ValueInfo
+	for _, in := range g.Inputs {
+		if !inits[in.Name] {
+			out = append(out, in)
+		}
+	}
+	return out
+}
+
+// Attr returns the attribute called name, if present.
+func (n *Node) Attr(name string) (*Attribute, bool) {
+	for i := range n.Attributes {
+		if n.Attributes[i].Name == name {
+			return &n.Attributes[i], true
+		}
+	}
+	return nil, false
+}
+
+// NumElements returns the product of t.Dims (1 for a scalar).
+func (t *Tensor) NumElements() int {
+	n := 1
+	for _, d := range t.Dims {
+		n *= int(d)
+	}
+	return n
+}
+
+// Float32s returns the values of a FLOAT or DOUBLE tensor as float32.
+func (t *Tensor) Float32s() ([]float32, error) {
+	switch t.DataType {
+	case Float:
+		if t.RawData != nil {
+			if len(t.RawData) != 4*t.NumElements() {
+				return nil, fmt.Errorf("tensor %q: %d raw bytes for %d floats", t.Name, len(t.RawData), t.NumElements())
+			}
+			out := make([]float32, len(t.RawData)/4)
+			for i := range out {
+				out[i] = math.Float32frombits(binary.LittleEndian.Uint32(t.RawData[4*i:]))
+			}
+			return out, nil
+		}
+		return t.FloatData, nil
+	case Double:
+		src := t.DoubleData
+		if t.RawData != nil {
+			src = make([]float64, len(t.RawData)/8)
+			for i := range src {
+				src[i] = math.Float64frombits(binary.LittleEndian.Uint64(t.RawData[8*i:]))
+			}
+		}
+		out := make([]float32, len(src))
+		for i, v := range src {
+			out[i] = float32(v)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("tensor %q: cannot read data type %d as float32", t.Name, t.DataType)
+	}
+}
+
+// Int64s returns the values of an integer tensor as int64, e.g. a Reshape
+// shape or Resize sizes.
+func (t *Tensor) Int64s() ([]int64, error) {
+	n := t.NumElements()
+	switch t.DataType {
+	case Int64:
+		if t.RawData != nil {
+			out := make([]int64, len(t.RawData)/8)
+			for i := range out {
+				out[i] = int64(binary.LittleEndian.Uint64(t.RawData[8*i:]))
+			}
+			return out, nil
+		}
+		return t.Int64Data, nil
+	case Int32, Int16, Int8, Uint16, Uint8, Bool:
+		out := make([]int64, 0, n)
+		if t.RawData == nil {
+			for _, v := range t.Int32Data {
+				out = append(out, int64(v))
+			}
+			return out, nil
+		}
+		size := t.DataType.Size()
+		for i := 0; i+size <= len(t.RawData); i += size {
+			switch t.DataType {
+			case Int32:
+				out = append(out, int64(int32(binary.LittleEndian.Uint32(t.RawData[i:]))))
+			case Int16:
+				out = append(out, int64(int16(binary.LittleEndian.Uint16(t.RawData[i:]))))
+			case Uint16:
+				out = append(out, int64(binary.LittleEndian.Uint16(t.RawData[i:])))
+			case Int8:
+				out = append(out, int64(int8(t.RawData[i])))
+			default:
+				out = append(out, int64(t.RawData[i]))
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("tensor %q: cannot read data type %d as int64", t.Name, t.DataType)
+	}
+}
+
+// NewFloatTensor returns a FLOAT tensor holding data as raw little-endian bytes.
+func NewFloatTensor(name string, dims []int64, data []float32) Tensor {
+	raw := make([]byte, 4*len(data))
+	for i, v := range data {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(v))
+	}
+	return Tensor{Name: name, Dims: dims, DataType: Float, RawData: raw}
+}
@@ -0,0 +1,75 @@
+package onnx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testModel() *Model {
+	return &Model{
+		IRVersion:    7,
+		ProducerName: "rembg-go-test",
+		OpsetImports: []OpsetID{{Version: 11}},
+		Graph: Graph{
+			Name: "g",
+			Nodes: []Node{
+				{OpType: "Mul", Inputs: []string{"x", "w"}, Outputs: []string{"y"}},
+				{Name: "act", OpType: "LeakyRelu", Inputs: []string{"y"}, Outputs: []string{"z"}, Attributes: []Attribute{
+					{Name: "alpha", Type: AttrFloat, F: 0.25},
+					{Name: "pads", Type: AttrInts, Ints: []int64{0, -1, 2}},
+				}},
+			},
+			Initializers: []Tensor{NewFloatTensor("w", []int64{1}, []float32{2})},
+			Inputs: []ValueInfo{
+				{Name: "x", ElemType: Float, Shape: []Dim{{Param: "batch"}, {Value: 3}, {Value: 320}, {Value: 320}}},
+				{Name: "w", ElemType: Float, Shape: []Dim{{Value: 1}}},
+			},
+			Outputs: []ValueInfo{{Name: "z", ElemType: Float, Shape: []Dim{{Param: "batch"}, {Value: 3}, {Value: 320}, {Value: 320}}}},
+		},
+		MetadataProps: map[string]string{"author": "test"},
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	want := testModel()
+	got, err := Decode(want.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestModelHelpers(t *testing.T) {
+	m := testModel()
+	if ops := m.Operators(); !reflect.DeepEqual(ops, []string{"LeakyRelu", "Mul"}) {
+		t.Fatalf("operators = %v", ops)
+	}
+	if v := m.Opset("ai.onnx"); v != 11 {
+		t.Fatalf("opset = %d", v)
+	}
+	in := m.Graph.RuntimeInputs()
+	if len(in) != 1 || in[0].Name != "x" {
+		t.Fatalf("runtime inputs = %+v", in)
+	}
+	if dims := in[0].Dims(); !reflect.DeepEqual(dims, []int64{-1, 3, 320, 320}) {
+		t.Fatalf("dims = %v", dims)
+	}
+	w, err := m.Graph.Initializers[0].Float32s()
+	if err != nil || !reflect.DeepEqual(w, []float32{2}) {
+		t.Fatalf("initializer = %v, %v", w, err)
+	}
+	if Float.TritonName() != "FP32" {
+		t.Fatal("FP32 mapping")
+	}
+	if d, err := DataTypeFromTriton("UINT8"); err != nil || d != Uint8 {
+		t.Fatalf("UINT8 mapping: %v %v", d, err)
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	if _, err := Decode([]byte{0x3a, 0xff}); err == nil {
+		t.Fatal("expected error for truncated message")
+	}
+}
@@ -0,0 +1,139 @@
+// Package parallel runs a function over a slice with bounded concurrency and
+// delivers results in input order.
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+)
+
+// Mode selects how a fan-out reacts to a failing item.
+type Mode int
+
+const (
+	// FailFast cancels the remaining items on the first error.
+	FailFast Mode = iota
+	// CollectAll runs every item and reports each error with its result.
+	CollectAll
+)
+
+// Result is the outcome of one input item.
+type Result[T any] struct {
+	Index int
+	Value T
+	Err   error
+}
+
+// Stream calls fn for every input with at most concurrency calls running and
+// yields the results in input order as soon as each next one is ready, so
+// callers can start consuming before the batch completes. At most
+// 2*concurrency results are computed ahead of the consumer.
+//
+// In FailFast mode the first error cancels the context passed to the other
+// calls and the stream ends after yielding a result carrying that error.
+// Breaking out of the loop cancels the remaining calls. Stream waits for all
+// started calls to return before the loop ends.
+func Stream[In, Out any](ctx context.Context, inputs []In, concurrency int, mode Mode, fn func(ctx context.Context, i int, in In) (Out, error)) iter.Seq[Result[Out]] {
+	return func(yield func(Result[Out]) bool) {
+		if concurrency <= 0 {
+			concurrency = 1
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		var (
+			wg       sync.WaitGroup
+			errOnce  sync.Once
+			firstErr error
+		)
+		defer func() {
+			cancel()
+			wg.Wait()
+		}()
+
+		slots := make([]chan Result[Out], len(inputs))
+		for i := range slots {
+			slots[i] = make(chan Result[Out], 1)
+		}
+		workers := make(chan struct{}, concurrency)
+		window := make(chan struct{}, 2*concurrency)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, in := range inputs {
+				if !acquire(ctx, window) || !acquire(ctx, workers) {
+					// fill the slots that will never run so the consumer does not block
+					for j := i; j < len(inputs); j++ {
+						slots[j] <- Result[Out]{Index: j, Err: ctx.Err()}
+					}
+					return
+				}
+				wg.Add(1)
+				go func(i int, in In) {
+					defer wg.Done()
+					out, err := fn(ctx, i, in)
+					<-workers
+					if err != nil && mode == FailFast {
+						errOnce.Do(func() {
+							firstErr = err
+							cancel()
+						})
+					}
+					slots[i] <- Result[Out]{Index: i, Value: out, Err: err}
+				}(i, in)
+			}
+		}()
+
+		for i := range slots {
+			r := <-slots[i]
+			// slots filled after cancellation never took a window token
+			select {
+			case <-window:
+			default:
+			}
+			if r.Err != nil && mode == FailFast {
+				// report the error that caused the cancellation rather than
+				// the context error it produced in other items
+				errOnce.Do(func() {
+					firstErr = r.Err
+					cancel()
+				})
+				r.Err = firstErr
+				yield(r)
+				return
+			}
+			if !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// Map is Stream collected into a slice indexed like inputs. In FailFast mode
+// it returns the first error; in CollectAll mode it returns every result and
+// an error joining the failed items (nil if none failed).
+func Map[In, Out any](ctx context.Context, inputs []In, concurrency int, mode Mode, fn func(ctx context.Context, i int, in In) (Out, error)) ([]Result[Out], error) {
+	out := make([]Result[Out], len(inputs))
+	var errs []error
+	for r := range Stream(ctx, inputs, concurrency, mode, fn) {
+		out[r.Index] = r
+		if r.Err != nil {
+			if mode == FailFast {
+				return out, r.Err
+			}
+			errs = append(errs, fmt.Errorf("item %d: %w", r.Index, r.Err))
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,108 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func square(ctx context.Context, i int, in int) (int, error) {
+	// later items finish first to exercise reordering
+	time.Sleep(time.Duration(10-in%10) * time.Millisecond)
+	return in * in, nil
+}
+
+func TestStreamPreservesOrder(t *testing.T) {
+	inputs := make([]int, 20)
+	for i := range inputs {
+		inputs[i] = i
+	}
+	next := 0
+	for r := range Stream(context.Background(), inputs, 4, FailFast, square) {
+		if r.Index != next || r.Value != next*next || r.Err != nil {
+			t.Fatalf("unexpected result at %d: %+v", next, r)
+		}
+		next++
+	}
+	if next != len(inputs) {
+		t.Fatalf("got %d results, want %d", next, len(inputs))
+	}
+}
+
+func TestStreamBoundsConcurrency(t *testing.T) {
+	var cur, peak atomic.Int64
+	fn := func(ctx context.Context, i int, in int) (int, error) {
+		n := cur.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(2 * time.Millisecond)
+		cur.Add(-1)
+		return in, nil
+	}
+	if _, err := Map(context.Background(), make([]int, 30), 3, FailFast, fn); err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() > 3 {
+		t.Fatalf("concurrency exceeded: %d", peak.Load())
+	}
+}
+
+func TestMapFailFastReturnsCause(t *testing.T) {
+	boom := errors.New("boom")
+	var calls atomic.Int64
+	fn := func(ctx context.Context, i int, in int) (int, error) {
+		calls.Add(1)
+		if i == 3 {
+			return 0, boom
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return in, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	_, err := Map(context.Background(), make([]int, 100), 4, FailFast, fn)
+	if !errors.Is(err, boom) {
+		t.Fatalf("want boom, got %v", err)
+	}
+	if calls.Load() >= 100 {
+		t.Fatal("remaining items were not cancelled")
+	}
+}
+
+func TestMapCollectAll(t *testing.T) {
+	fn := func(ctx context.Context, i int, in int) (int, error) {
+		if i%2 == 1 {
+			return 0, errors.New("odd")
+		}
+		return in, nil
+	}
+	res, err := Map(context.Background(), []int{10, 11, 12, 13}, 2, CollectAll, fn)
+	if err == nil {
+		t.Fatal("expected joined error")
+	}
+	if res[0].Value != 10 || res[2].Value != 12 || res[1].Err == nil || res[3].Err == nil {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+}
+
+func TestStreamBreakCancels(t *testing.T) {
+	var cancelled atomic.Int64
+	fn := func(ctx context.Context, i int, in int) (int, error) {
+		if i == 0 {
+			return 0, nil
+		}
+		<-ctx.Done()
+		cancelled.Add(1)
+		return 0, ctx.Err()
+	}
+	for range Stream(context.Background(), make([]int, 10), 2, CollectAll, fn) {
+		break
+	}
+	if cancelled.Load() == 0 {
+		t.Fatal("in-flight items were not cancelled on break")
+	}
+}
@@ -1,14 +1,17 @@
 package processing
 
 import (
-	"flag"
+	"context"
 	"fmt"
-	"github.com/owulveryck/onnx-go"
-	"github.com/owulveryck/onnx-go/backend/x/gorgonnx"
-	"gorgonia.org/tensor"
 	"image"
 	"image/color"
-	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/tracing"
 )
 
 // RemoveBackgroundOptions holds options for background removal.
@@ -23,72 +26,129 @@ type RemoveBackgroundOptions struct {
 	BackgroundColor                 *color.Color
 	ReturnType                      string // "image", "bytes"
 	ModelPath                       string // Path to ONNX model
+	// Session, if set, runs the model instead of loading ModelPath, so
+	// callers can load a model once, from a file, memory or the binary.
+	Session *models.Session
 }
 
 // RemoveBackground applies U2Net ONNX model to an image and returns RGBA with alpha mask.
+// The model is opts.Session, or loaded from opts.ModelPath for this call.
 func RemoveBackground(img image.Image, opts RemoveBackgroundOptions) (image.Image, error) {
+	return RemoveBackgroundContext(context.Background(), img, opts)
+}
+
+// RemoveBackgroundContext is RemoveBackground with a context used to parent the
+// tracing spans of each pipeline stage.
+func RemoveBackgroundContext(ctx context.Context, img image.Image, opts RemoveBackgroundOptions) (cutout image.Image, err error) {
+	ctx, span := startRemoveBackground(ctx, img)
+	defer func() { tracing.End(span, err) }()
+
 	// 1. Load ONNX model
-	var modelPath = flag.String("model", "u2net.onnx", "path to the model file")
-	fmt.Println("Using model:", *modelPath)
-	// read the onnx model
-	b, err := os.ReadFile(*modelPath)
-	fmt.Printf("Model size: %d bytes\n", len(b))
-	if err != nil {
-		return nil, fmt.Errorf("model read error: %w", err)
+	session := opts.Session
+	if session == nil {
+		_, loadSpan := tracing.StartStage(ctx, "load_model")
+		session, err = loadSession(opts.ModelPath)
+		tracing.End(loadSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
 	}
+	span.SetAttributes(tracing.AttrModel.String(session.ModelPath))
+	return removeBackground(ctx, session, img, opts)
+}
 
-	backend := gorgonnx.NewGraph()
-	model := onnx.NewModel(backend)
-	err = model.UnmarshalBinary(b)
-	if err != nil {
-		return nil, fmt.Errorf("Model unmarshal error: %w \n", err)
+// loadSession loads modelPath, or without one the model embedded in the
+// binary if there is one, else u2net.onnx from the working directory.
+func loadSession(modelPath string) (*models.Session, error) {
+	if modelPath == "" && models.HasEmbeddedModel() {
+		return models.NewEmbeddedSession(models.SessionOptions{})
 	}
+	if modelPath == "" {
+		modelPath = "u2net.onnx"
+	}
+	return models.NewSession(modelPath)
+}
+
+// RemoveBackgroundWithSession is RemoveBackgroundContext using an already
+// loaded session, so long-running callers such as servers load the model once.
+func RemoveBackgroundWithSession(ctx context.Context, session *models.Session, img image.Image, opts RemoveBackgroundOptions) (cutout image.Image, err error) {
+	ctx, span := startRemoveBackground(ctx, img)
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(tracing.AttrModel.String(session.ModelPath))
+	return removeBackground(ctx, session, img, opts)
+}
+
+func startRemoveBackground(ctx context.Context, img image.Image) (context.Context, trace.Span) {
+	return tracing.StartStage(ctx, "remove_background",
+		tracing.AttrBackend.String("local"),
+		tracing.AttrImageWidth.Int(img.Bounds().Dx()),
+		tracing.AttrImageHeight.Int(img.Bounds().Dy()),
+	)
+}
+
+func removeBackground(ctx context.Context, session *models.Session, img image.Image, opts RemoveBackgroundOptions) (image.Image, error) {
 	// 2. Preprocess image: resize to 320x320, normalize
-	inputTensor, err := preprocessImage(img)
+	stageStart := time.Now()
+	_, preSpan := tracing.StartStage(ctx, "preprocess")
+	inputTensor, err := PreprocessImage(img)
+	tracing.End(preSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("preprocess error: %w \n", err)
 	}
+	metrics.ObserveStage("preprocess", stageStart)
 
 	// 3. Run inference
-	err = model.SetInput(0, inputTensor)
-	if err != nil {
-		return nil, fmt.Errorf("set input error: %w", err)
-	}
-	err = backend.Run()
+	stageStart = time.Now()
+	inferCtx, inferSpan := tracing.StartStage(ctx, "infer")
+	output, err := session.Run(inferCtx, inputTensor)
+	tracing.End(inferSpan, err)
 	if err != nil {
-		return nil, fmt.Errorf("inference error: %w", err)
-	}
-	output, err := model.GetOutputTensors()
-	if err != nil {
-		return nil, fmt.Errorf("get output error: %w", err)
+		return nil, err
 	}
+	metrics.ObserveStage("infer", stageStart)
 
 	// 4. Postprocess mask: normalize, resize to original size
-	maskImg, err := postprocessMask(output[0], img.Bounds().Dx(), img.Bounds().Dy())
+	stageStart = time.Now()
+	_, maskSpan := tracing.StartStage(ctx, "mask_decode")
+	maskImg, err := postprocessMask(output[0].Data, img.Bounds().Dx(), img.Bounds().Dy())
+	if err == nil && opts.PostProcessMask {
+		// 5. Post-process mask if requested
+		maskImg = PostProcessMaskGo(maskImg)
+	}
+	tracing.End(maskSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("mask postprocess error: %w", err)
 	}
 
-	// 5. Post-process mask if requested
-	if opts.PostProcessMask {
-		maskImg = PostProcessMaskGo(maskImg)
+	cutout := Composite(ctx, img, maskImg, opts)
+	metrics.ObserveStage("postprocess", stageStart)
+
+	return cutout, nil
+}
+
+// Composite turns img and its mask into the final cutout according to opts:
+// the mask itself, an alpha-matted or plain cutout, optionally flattened onto
+// opts.BackgroundColor. Matting and compositing are traced as separate spans.
+func Composite(ctx context.Context, img, maskImg image.Image, opts RemoveBackgroundOptions) image.Image {
+	if opts.OnlyMask {
+		return maskImg
 	}
 
 	var cutout image.Image
-	if opts.OnlyMask {
-		cutout = maskImg
-	} else if opts.AlphaMatting {
+	if opts.AlphaMatting {
+		_, mattingSpan := tracing.StartStage(ctx, "matting")
 		am, err := AlphaMattingCutoutGo(img, maskImg, opts.AlphaMattingForegroundThreshold, opts.AlphaMattingBackgroundThreshold, opts.AlphaMattingErodeSize)
-		if err != nil {
-			if opts.PutAlpha {
-				cutout = PutAlphaCutoutGo(img, maskImg)
-			} else {
-				cutout = NaiveCutoutGo(img, maskImg)
-			}
-		} else {
+		// matting failures fall back to a plain cutout below
+		tracing.End(mattingSpan, err)
+		if err == nil {
 			cutout = am
 		}
-	} else {
+	}
+
+	_, compositeSpan := tracing.StartStage(ctx, "composite")
+	defer compositeSpan.End()
+	if cutout == nil {
 		if opts.PutAlpha {
 			cutout = PutAlphaCutoutGo(img, maskImg)
 		} else {
@@ -96,82 +156,26 @@ func RemoveBackground(img image.Image, opts RemoveBackgroundOptions) (image.Imag
 		}
 	}
 
-	// Apply background color if requested and not only mask
-	if opts.BackgroundColor != nil && !opts.OnlyMask {
+	// Apply background color if requested
+	if opts.BackgroundColor != nil {
 		cutout = ApplyBackgroundColorGo(cutout, opts.BackgroundColor)
 	}
-
-	return cutout, nil
+	return cutout
 }
 
-// preprocessImage resizes and normalizes the image for U2Net input.
-func preprocessImage(img image.Image) (*tensor.Dense, error) {
-	// Resize to 320x320
-	width, height := 320, 320
-	resized := image.NewRGBA(image.Rect(0, 0, width, height))
-	origBounds := img.Bounds()
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// Nearest neighbor
-			srcX := origBounds.Min.X + x*(origBounds.Dx())/width
-			srcY := origBounds.Min.Y + y*(origBounds.Dy())/height
-			resized.Set(x, y, img.At(srcX, srcY))
-		}
-	}
-
-	// Normalize to [0,1] and convert to float32 tensor [1,3,320,320]
-	data := make([]float32, 3*width*height)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			pix := color.NRGBAModel.Convert(resized.At(x, y)).(color.NRGBA)
-			idx := y*width + x
-			data[idx] = float32(pix.R) / 255.0                // Red
-			data[width*height+idx] = float32(pix.G) / 255.0   // Green
-			data[2*width*height+idx] = float32(pix.B) / 255.0 // Blue
-		}
-	}
-
-	shape := []int{1, 3, width, height}
-	t := tensor.New(tensor.WithShape(shape...), tensor.WithBacking(data))
-	return t, nil
+// PreprocessImage resizes and normalizes the image into the [1,3,320,320]
+// U2Net input tensor.
+func PreprocessImage(img image.Image) (models.Tensor, error) {
+	return models.ImageTensor(img, 320, 320), nil
 }
 
 // postprocessMask normalizes and resizes the mask to original image size.
-func postprocessMask(t tensor.Tensor, width, height int) (image.Image, error) {
-	// Assume t is [1,1,320,320] float32
-	data := t.Data().([]float32)
-	if len(data) == 0 {
-		return nil, fmt.Errorf("empty mask tensor")
-	}
-	// Normalize to [0,255]
-	minVal, maxVal := data[0], data[0]
-	for _, v := range data {
-		if v < minVal {
-			minVal = v
-		}
-		if v > maxVal {
-			maxVal = v
-		}
-	}
-	img320 := image.NewGray(image.Rect(0, 0, 320, 320))
-	for y := 0; y < 320; y++ {
-		for x := 0; x < 320; x++ {
-			idx := y*320 + x
-			val := (data[idx] - minVal) / (maxVal - minVal)
-			img320.SetGray(x, y, color.Gray{Y: uint8(val * 255)})
-		}
-	}
-	// Resize to original size
-	imgResized := image.NewGray(image.Rect(0, 0, width, height))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// Nearest neighbor
-			srcX := x * 320 / width
-			srcY := y * 320 / height
-			imgResized.SetGray(x, y, img320.GrayAt(srcX, srcY))
-		}
+func postprocessMask(data []float32, width, height int) (image.Image, error) {
+	// Assume data is [1,1,320,320] float32
+	if len(data) < 320*320 {
+		return nil, fmt.Errorf("mask tensor has %d values, want 320x320", len(data))
 	}
-	return imgResized, nil
+	return models.MaskImage(data, 320, 320, width, height), nil
 }
 
 // postProcessMaskGo is a no-op for now
@@ -0,0 +1,95 @@
+package processing
+
+import (
+	"context"
+	"image"
+	"iter"
+	"time"
+
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/parallel"
+	"github.com/unrealandychan/rembg-go/pkg/tracing"
+)
+
+// ImageResult is the outcome of removing the background of one image.
+type ImageResult struct {
+	Image image.Image
+	Err   error
+}
+
+// RemoveBackgroundMany runs RemoveBackgroundContext over imgs with at most
+// concurrency images in flight and returns the cutouts in input order. The
+// first error cancels the remaining images and is returned.
+func RemoveBackgroundMany(ctx context.Context, imgs []image.Image, opts RemoveBackgroundOptions, concurrency int) ([]image.Image, error) {
+	results, err := parallel.Map(ctx, imgs, concurrency, parallel.FailFast, removeFunc(opts))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]image.Image, len(results))
+	for i, r := range results {
+		out[i] = r.Value
+	}
+	return out, nil
+}
+
+// RemoveBackgroundBatch removes the backgrounds of imgs with batched
+// inference on session: up to session.MaxBatch() images share each forward
+// pass (see models.Session.PredictBatch). Cutouts are returned in input
+// order.
+func RemoveBackgroundBatch(ctx context.Context, session *models.Session, imgs []image.Image, opts RemoveBackgroundOptions) (cutouts []image.Image, err error) {
+	ctx, span := tracing.StartStage(ctx, "remove_background_batch",
+		tracing.AttrBackend.String("local"),
+		tracing.AttrModel.String(session.ModelPath),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	stageStart := time.Now()
+	inferCtx, inferSpan := tracing.StartStage(ctx, "infer")
+	masks, err := session.PredictBatch(inferCtx, imgs)
+	tracing.End(inferSpan, err)
+	// one request of the backend the onnx:// scheme names
+	metrics.ObserveBackend("onnx", stageStart, err)
+	if err != nil {
+		return nil, err
+	}
+	metrics.ObserveStage("infer", stageStart)
+
+	stageStart = time.Now()
+	cutouts = make([]image.Image, len(imgs))
+	for i, img := range imgs {
+		var mask image.Image = masks[i]
+		if opts.PostProcessMask {
+			mask = PostProcessMaskGo(mask)
+		}
+		cutouts[i] = Composite(ctx, img, mask, opts)
+	}
+	metrics.ObserveStage("postprocess", stageStart)
+	return cutouts, nil
+}
+
+// RemoveBackgroundStream yields (index, result) pairs in input order as soon
+// as each cutout is ready. With failFast the stream stops after the first
+// error; breaking out of the loop cancels the outstanding images.
+func RemoveBackgroundStream(ctx context.Context, imgs []image.Image, opts RemoveBackgroundOptions, concurrency int, failFast bool) iter.Seq2[int, ImageResult] {
+	mode := parallel.CollectAll
+	if failFast {
+		mode = parallel.FailFast
+	}
+	return func(yield func(int, ImageResult) bool) {
+		for r := range parallel.Stream(ctx, imgs, concurrency, mode, removeFunc(opts)) {
+			if !yield(r.Index, ImageResult{Image: r.Value, Err: r.Err}) {
+				return
+			}
+		}
+	}
+}
+
+func removeFunc(opts RemoveBackgroundOptions) func(ctx context.Context, i int, img image.Image) (image.Image, error) {
+	return func(ctx context.Context, i int, img image.Image) (image.Image, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return RemoveBackgroundContext(ctx, img, opts)
+	}
+}
@@ -1,6 +1,7 @@
 package processing
 
 import (
+    "image"
     "image/color"
     "image/draw"
     "testing"
@@ -0,0 +1,534 @@
+// Package quantize converts float32 ONNX models such as U2Net to INT8, the
+// format package engine and ONNX Runtime run with a quarter of the weight
+// memory.
+//
+// Dynamic quantization only stores the convolution weights as INT8, per
+// output channel, and dequantizes them as the model runs; it needs no data.
+// Static quantization also runs the convolutions themselves in 8 bits,
+// using activation ranges measured by running the float model on
+// calibration samples, which should resemble the images the model will see.
+package quantize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/unrealandychan/rembg-go/pkg/engine"
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// Mode selects what Quantize converts to INT8.
+type Mode string
+
+const (
+	// Dynamic quantizes convolution weights only.
+	Dynamic Mode = "dynamic"
+	// Static quantizes convolution weights and activations, rewriting each
+	// convolution as a QLinearConv.
+	Static Mode = "static"
+)
+
+// Options configures Quantize.
+type Options struct {
+	// Mode is Dynamic (the default) or Static.
+	Mode Mode
+	// Calibration returns the next calibration sample, keyed by model input
+	// name, and io.EOF after the last. Static mode requires it.
+	Calibration func() (map[string]*engine.Tensor, error)
+	// Threads bounds the goroutines each operator uses while calibrating;
+	// zero uses every available CPU.
+	Threads int
+}
+
+// minOpset is the first opset with QuantizeLinear, DequantizeLinear and
+// QLinearConv.
+const minOpset = 10
+
+// Quantize returns a quantized copy of m; m itself is not modified.
+// BatchNormalization nodes following a convolution are folded into its
+// weights first. Convolutions whose weights are not initializers are left
+// in float32.
+func Quantize(m *onnx.Model, opts Options) (*onnx.Model, error) {
+	opset := m.Opset("")
+	if opset < minOpset {
+		return nil, fmt.Errorf("opset %d predates the quantization operators, want %d or later", opset, minOpset)
+	}
+	out := *m
+	out.Graph = m.Graph
+	out.Graph.Nodes = slices.Clone(m.Graph.Nodes)
+	out.Graph.Initializers = slices.Clone(m.Graph.Initializers)
+	q := &quantizer{graph: &out.Graph, opset: opset, inits: map[string]int{}, done: map[string]string{}}
+	for i, t := range q.graph.Initializers {
+		q.inits[t.Name] = i
+	}
+	q.foldBatchNorm()
+
+	switch opts.Mode {
+	case "", Dynamic:
+		q.dynamic()
+	case Static:
+		if opts.Calibration == nil {
+			return nil, fmt.Errorf("static quantization needs calibration samples")
+		}
+		ranges, err := calibrate(&out, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.static(ranges); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown quantization mode %q, want %s or %s", opts.Mode, Dynamic, Static)
+	}
+	q.prune()
+	return &out, nil
+}
+
+// quantizer rewrites one graph in place.
+type quantizer struct {
+	graph *onnx.Graph
+	opset int64
+	// inits indexes graph.Initializers by name.
+	inits map[string]int
+	// done maps float weights to the value replacing them.
+	done map[string]string
+}
+
+// floats returns the values of the float32 initializer name.
+func (q *quantizer) floats(name string) (*onnx.Tensor, []float32, bool) {
+	i, ok := q.inits[name]
+	if !ok || q.graph.Initializers[i].DataType != onnx.Float {
+		return nil, nil, false
+	}
+	t := &q.graph.Initializers[i]
+	v, err := t.Float32s()
+	if err != nil {
+		return nil, nil, false
+	}
+	return t, v, true
+}
+
+// add appends an initializer, replacing any of the same name.
+func (q *quantizer) add(t onnx.Tensor) {
+	if i, ok := q.inits[t.Name]; ok {
+		q.graph.Initializers[i] = t
+		return
+	}
+	q.inits[t.Name] = len(q.graph.Initializers)
+	q.graph.Initializers = append(q.graph.Initializers, t)
+}
+
+// readers counts the nodes and graph outputs reading each value.
+func (q *quantizer) readers() map[string][]int {
+	r := map[string][]int{}
+	for i, n := range q.graph.Nodes {
+		for _, name := range n.Inputs {
+			r[name] = append(r[name], i)
+		}
+	}
+	for _, o := range q.graph.Outputs {
+		r[o.Name] = append(r[o.Name], -1)
+	}
+	return r
+}
+
+// follower returns the only reader of name if it is an op node.
+func (q *quantizer) follower(readers map[string][]int, name, op string) (int, bool) {
+	r := readers[name]
+	if len(r) != 1 || r[0] < 0 {
+		return 0, false
+	}
+	n := &q.graph.Nodes[r[0]]
+	return r[0], n.OpType == op && n.Domain == "" && len(n.Outputs) == 1
+}
+
+// convWeights returns the weight shape and values of a Conv whose weights
+// are a 4-D float32 initializer.
+func (q *quantizer) convWeights(n *onnx.Node) ([]int64, []float32, bool) {
+	if n.OpType != "Conv" || n.Domain != "" || len(n.Inputs) < 2 || len(n.Outputs) != 1 {
+		return nil, nil, false
+	}
+	t, w, ok := q.floats(n.Inputs[1])
+	if !ok || len(t.Dims) != 4 || t.Dims[0] == 0 {
+		return nil, nil, false
+	}
+	return t.Dims, w, true
+}
+
+// foldBatchNorm merges inference-mode BatchNormalization nodes into the
+// convolution feeding them, when every parameter is an initializer.
+func (q *quantizer) foldBatchNorm() {
+	readers := q.readers()
+	drop := map[int]bool{}
+	for i := range q.graph.Nodes {
+		n := &q.graph.Nodes[i]
+		dims, w, ok := q.convWeights(n)
+		if !ok {
+			continue
+		}
+		j, ok := q.follower(readers, n.Outputs[0], "BatchNormalization")
+		if !ok {
+			continue
+		}
+		bn := &q.graph.Nodes[j]
+		if len(bn.Inputs) != 5 || intAttr(bn, "training_mode", 0) != 0 {
+			continue
+		}
+		oc := int(dims[0])
+		params, ok := q.channelParams(bn.Inputs[1:], oc)
+		if !ok {
+			continue
+		}
+		bias := make([]float32, oc)
+		if len(n.Inputs) > 2 && n.Inputs[2] != "" {
+			b, ok := q.channelParams(n.Inputs[2:3], oc)
+			if !ok {
+				continue
+			}
+			copy(bias, b[0])
+		}
+		scale, shift, mean, variance := params[0], params[1], params[2], params[3]
+		eps := float64(floatAttr(bn, "epsilon", 1e-5))
+		per := len(w) / oc
+		fw := make([]float32, len(w))
+		for m := 0; m < oc; m++ {
+			k := scale[m] / float32(math.Sqrt(float64(variance[m])+eps))
+			for p, v := range w[m*per : (m+1)*per] {
+				fw[m*per+p] = v * k
+			}
+			bias[m] = (bias[m]-mean[m])*k + shift[m]
+		}
+		out := bn.Outputs[0]
+		q.add(onnx.NewFloatTensor(out+"_folded_weight", dims, fw))
+		q.add(onnx.NewFloatTensor(out+"_folded_bias", []int64{int64(oc)}, bias))
+		n.Inputs = []string{n.Inputs[0], out + "_folded_weight", out + "_folded_bias"}
+		n.Outputs = []string{out}
+		drop[j] = true
+	}
+	nodes := q.graph.Nodes[:0]
+	for i, n := range q.graph.Nodes {
+		if !drop[i] {
+			nodes = append(nodes, n)
+		}
+	}
+	q.graph.Nodes = nodes
+}
+
+// channelParams returns the float32 initializers names, each of which must
+// hold n values.
+func (q *quantizer) channelParams(names []string, n int) ([][]float32, bool) {
+	params := make([][]float32, len(names))
+	for k, name := range names {
+		_, v, ok := q.floats(name)
+		if !ok || len(v) != n {
+			return nil, false
+		}
+		params[k] = v
+	}
+	return params, true
+}
+
+// dynamic stores convolution weights as INT8 and dequantizes them in the
+// graph: per output channel with DequantizeLinear's axis from opset 13,
+// and before that by a per-tensor DequantizeLinear and a Mul by the
+// channel scales.
+func (q *quantizer) dynamic() {
+	nodes := make([]onnx.Node, 0, len(q.graph.Nodes))
+	for _, n := range q.graph.Nodes {
+		dims, w, ok := q.convWeights(&n)
+		if !ok {
+			nodes = append(nodes, n)
+			continue
+		}
+		name, oc := n.Inputs[1], int(dims[0])
+		if deq, ok := q.done[name]; ok {
+			n.Inputs = slices.Clone(n.Inputs)
+			n.Inputs[1] = deq
+			nodes = append(nodes, n)
+			continue
+		}
+		wq, ws, wz := q.addWeights(name, dims, w)
+		deq := name + "_dequantized"
+		if q.opset >= 13 {
+			nodes = append(nodes, onnx.Node{
+				Name:       deq,
+				OpType:     "DequantizeLinear",
+				Inputs:     []string{wq, ws, wz},
+				Outputs:    []string{deq},
+				Attributes: []onnx.Attribute{{Name: "axis", Type: onnx.AttrInt, I: 0}},
+			})
+		} else {
+			// the channel scales broadcast as [M, 1, 1, 1]
+			i := q.inits[ws]
+			q.graph.Initializers[i].Dims = []int64{int64(oc), 1, 1, 1}
+			q.add(onnx.NewFloatTensor(name+"_unit_scale", nil, []float32{1}))
+			q.add(int8Tensor(name+"_unit_zero_point", nil, []int8{0}))
+			ints := name + "_integers"
+			nodes = append(nodes,
+				onnx.Node{
+					Name:    ints,
+					OpType:  "DequantizeLinear",
+					Inputs:  []string{wq, name + "_unit_scale", name + "_unit_zero_point"},
+					Outputs: []string{ints},
+				},
+				onnx.Node{Name: deq, OpType: "Mul", Inputs: []string{ints, ws}, Outputs: []string{deq}},
+			)
+		}
+		q.done[name] = deq
+		n.Inputs = slices.Clone(n.Inputs)
+		n.Inputs[1] = deq
+		nodes = append(nodes, n)
+	}
+	q.graph.Nodes = nodes
+}
+
+// quantized names a UINT8 activation and its parameters.
+type quantized struct {
+	value, scale, zero string
+	// s is the scale's value.
+	s float32
+}
+
+// static rewrites each convolution, absorbing a Relu that follows it, into
+// QuantizeLinear -> QLinearConv -> DequantizeLinear. A convolution reading
+// another's output takes its quantized value directly, so chains of
+// convolutions stay in 8 bits; the DequantizeLinear nodes nothing reads
+// are pruned afterwards.
+func (q *quantizer) static(ranges map[string][2]float32) error {
+	readers := q.readers()
+	acts := map[string]quantized{}
+	activation := func(name string) (quantized, bool) {
+		if a, ok := acts[name]; ok {
+			return a, true
+		}
+		r, ok := ranges[name]
+		if !ok {
+			return quantized{}, false
+		}
+		s, z := activationParams(r[0], r[1])
+		a := quantized{value: name + "_quantized", scale: name + "_scale", zero: name + "_zero_point", s: s}
+		q.add(onnx.NewFloatTensor(a.scale, nil, []float32{s}))
+		q.add(onnx.Tensor{Name: a.zero, DataType: onnx.Uint8, RawData: []byte{z}})
+		return a, true
+	}
+
+	drop := map[int]bool{}
+	nodes := make([]onnx.Node, 0, len(q.graph.Nodes))
+	for i, n := range q.graph.Nodes {
+		if drop[i] {
+			continue
+		}
+		dims, w, ok := q.convWeights(&n)
+		if !ok {
+			nodes = append(nodes, n)
+			continue
+		}
+		out, oc := n.Outputs[0], int(dims[0])
+		relu, absorb := q.follower(readers, out, "Relu")
+		if absorb {
+			// UINT8 saturation at a zero point of 0 applies the Relu
+			out = q.graph.Nodes[relu].Outputs[0]
+		}
+		x, xok := activation(n.Inputs[0])
+		y, yok := activation(out)
+		if !xok || !yok {
+			nodes = append(nodes, n)
+			continue
+		}
+		if _, ok := acts[n.Inputs[0]]; !ok {
+			nodes = append(nodes, onnx.Node{
+				Name:    x.value,
+				OpType:  "QuantizeLinear",
+				Inputs:  []string{n.Inputs[0], x.scale, x.zero},
+				Outputs: []string{x.value},
+			})
+			acts[n.Inputs[0]] = x
+		}
+		wq, ws, wz := q.addWeights(n.Inputs[1], dims, w)
+		inputs := []string{x.value, x.scale, x.zero, wq, ws, wz, y.scale, y.zero}
+		if len(n.Inputs) > 2 && n.Inputs[2] != "" {
+			_, b, ok := q.floats(n.Inputs[2])
+			if !ok || len(b) != oc {
+				return fmt.Errorf("conv %q: bias %q is not a float32 initializer of %d values", n.Name, n.Inputs[2], oc)
+			}
+			_, scales, _ := q.floats(ws)
+			bq := make([]int32, oc)
+			for m, v := range b {
+				bq[m] = int32(max(math.MinInt32, min(math.MaxInt32, math.RoundToEven(float64(v)/float64(x.s*scales[m])))))
+			}
+			q.add(onnx.Tensor{Name: out + "_bias_quantized", Dims: []int64{int64(oc)}, DataType: onnx.Int32, Int32Data: bq})
+			inputs = append(inputs, out+"_bias_quantized")
+		}
+		nodes = append(nodes,
+			onnx.Node{
+				Name:       n.Name + "_quant",
+				OpType:     "QLinearConv",
+				Inputs:     inputs,
+				Outputs:    []string{y.value},
+				Attributes: n.Attributes,
+			},
+			onnx.Node{
+				Name:    out + "_dequantize",
+				OpType:  "DequantizeLinear",
+				Inputs:  []string{y.value, y.scale, y.zero},
+				Outputs: []string{out},
+			},
+		)
+		acts[out] = y
+		if absorb {
+			drop[relu] = true
+		}
+	}
+	q.graph.Nodes = nodes
+	return nil
+}
+
+// addWeights adds the INT8 weights of the float initializer name,
+// quantized symmetrically per output channel, returning the names of the
+// weights, scales and zero points. Repeated calls reuse them.
+func (q *quantizer) addWeights(name string, dims []int64, w []float32) (wq, ws, wz string) {
+	wq, ws, wz = name+"_quantized", name+"_scale", name+"_zero_point"
+	if _, ok := q.inits[wq]; ok {
+		return wq, ws, wz
+	}
+	oc := int(dims[0])
+	per := len(w) / oc
+	values := make([]int8, len(w))
+	scales := make([]float32, oc)
+	for m := 0; m < oc; m++ {
+		var peak float32
+		for _, v := range w[m*per : (m+1)*per] {
+			peak = max(peak, float32(math.Abs(float64(v))))
+		}
+		scales[m] = peak / 127
+		if peak == 0 {
+			scales[m] = 1
+		}
+		for p, v := range w[m*per : (m+1)*per] {
+			values[m*per+p] = int8(max(-127, min(127, math.RoundToEven(float64(v/scales[m])))))
+		}
+	}
+	q.add(int8Tensor(wq, dims, values))
+	q.add(onnx.NewFloatTensor(ws, []int64{int64(oc)}, scales))
+	q.add(int8Tensor(wz, []int64{int64(oc)}, make([]int8, oc)))
+	return wq, ws, wz
+}
+
+// prune removes the nodes and initializers no graph output depends on.
+func (q *quantizer) prune() {
+	live := map[string]bool{}
+	for _, o := range q.graph.Outputs {
+		live[o.Name] = true
+	}
+	keep := make([]bool, len(q.graph.Nodes))
+	for i := len(q.graph.Nodes) - 1; i >= 0; i-- {
+		n := q.graph.Nodes[i]
+		for _, name := range n.Outputs {
+			keep[i] = keep[i] || live[name]
+		}
+		if keep[i] {
+			for _, name := range n.Inputs {
+				live[name] = true
+			}
+		}
+	}
+	nodes := q.graph.Nodes[:0]
+	for i, n := range q.graph.Nodes {
+		if keep[i] {
+			nodes = append(nodes, n)
+		}
+	}
+	q.graph.Nodes = nodes
+	q.graph.Initializers = slices.DeleteFunc(q.graph.Initializers, func(t onnx.Tensor) bool {
+		return !live[t.Name]
+	})
+	// older exporters also list initializers as graph inputs
+	q.graph.Inputs = slices.DeleteFunc(slices.Clone(q.graph.Inputs), func(v onnx.ValueInfo) bool {
+		_, init := q.inits[v.Name]
+		return init && !live[v.Name]
+	})
+	q.graph.ValueInfo = slices.DeleteFunc(slices.Clone(q.graph.ValueInfo), func(v onnx.ValueInfo) bool {
+		return !live[v.Name]
+	})
+}
+
+// calibrate runs the float model on every calibration sample and returns
+// the range of each float value it computes.
+func calibrate(m *onnx.Model, opts Options) (map[string][2]float32, error) {
+	ranges := map[string][2]float32{}
+	e, err := engine.NewWithOptions(m, engine.Options{
+		Threads:  opts.Threads,
+		NoFusion: true,
+		Observe: func(name string, t *engine.Tensor) {
+			if t.IsInt() || t.Len() == 0 {
+				return
+			}
+			r, ok := ranges[name]
+			if !ok {
+				r = [2]float32{t.Data[0], t.Data[0]}
+			}
+			for _, v := range t.Data {
+				r[0], r[1] = min(r[0], v), max(r[1], v)
+			}
+			ranges[name] = r
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("calibration model: %w", err)
+	}
+	samples := 0
+	for {
+		feeds, err := opts.Calibration()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("calibration sample %d: %w", samples+1, err)
+		}
+		if _, err := e.Run(context.Background(), feeds); err != nil {
+			return nil, fmt.Errorf("calibration sample %d: %w", samples+1, err)
+		}
+		samples++
+	}
+	if samples == 0 {
+		return nil, fmt.Errorf("no calibration samples")
+	}
+	return ranges, nil
+}
+
+// activationParams returns the UINT8 scale and zero point covering
+// [lo, hi], widened to include zero so that zero padding stays exact.
+func activationParams(lo, hi float32) (float32, byte) {
+	lo, hi = min(lo, 0), max(hi, 0)
+	if hi == lo {
+		return 1, 0
+	}
+	scale := (hi - lo) / 255
+	return scale, byte(max(0, min(255, math.Round(float64(-lo/scale)))))
+}
+
+func int8Tensor(name string, dims []int64, v []int8) onnx.Tensor {
+	raw := make([]byte, len(v))
+	for i, x := range v {
+		raw[i] = byte(x)
+	}
+	return onnx.Tensor{Name: name, Dims: dims, DataType: onnx.Int8, RawData: raw}
+}
+
+func intAttr(n *onnx.Node, name string, def int64) int64 {
+	if a, ok := n.Attr(name); ok {
+		return a.I
+	}
+	return def
+}
+
+func floatAttr(n *onnx.Node, name string, def float32) float32 {
+	if a, ok := n.Attr(name); ok {
+		return a.F
+	}
+	return def
+}
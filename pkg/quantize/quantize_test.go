@@ -0,0 +1,140 @@
+package quantize
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unrealandychan/rembg-go/pkg/engine"
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+func random(r *rand.Rand, n int, scale float32) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = (r.Float32()*2 - 1) * scale
+	}
+	return v
+}
+
+// convBlock returns x -> Conv -> BatchNormalization -> Relu -> Conv (1x1)
+// -> y, the shape of a U2Net layer feeding the next.
+func convBlock(opset int64) *onnx.Model {
+	r := rand.New(rand.NewSource(1))
+	m := &onnx.Model{IRVersion: 7, OpsetImports: []onnx.OpsetID{{Version: opset}}}
+	m.Graph.Inputs = []onnx.ValueInfo{{Name: "x", ElemType: onnx.Float}}
+	m.Graph.Outputs = []onnx.ValueInfo{{Name: "y", ElemType: onnx.Float}}
+	m.Graph.Initializers = []onnx.Tensor{
+		onnx.NewFloatTensor("w", []int64{4, 3, 3, 3}, random(r, 4*3*9, 0.5)),
+		onnx.NewFloatTensor("b", []int64{4}, random(r, 4, 0.1)),
+		onnx.NewFloatTensor("gamma", []int64{4}, []float32{1, 0.5, 2, 1.5}),
+		onnx.NewFloatTensor("beta", []int64{4}, []float32{0.1, -0.2, 0, 0.3}),
+		onnx.NewFloatTensor("mean", []int64{4}, random(r, 4, 0.2)),
+		onnx.NewFloatTensor("var", []int64{4}, []float32{1, 0.5, 2, 0.8}),
+		onnx.NewFloatTensor("w2", []int64{2, 4, 1, 1}, random(r, 8, 1)),
+	}
+	m.Graph.Nodes = []onnx.Node{
+		{Name: "conv", OpType: "Conv", Inputs: []string{"x", "w", "b"}, Outputs: []string{"c"},
+			Attributes: []onnx.Attribute{{Name: "pads", Type: onnx.AttrInts, Ints: []int64{1, 1, 1, 1}}}},
+		{Name: "bn", OpType: "BatchNormalization", Inputs: []string{"c", "gamma", "beta", "mean", "var"}, Outputs: []string{"n"}},
+		{Name: "relu", OpType: "Relu", Inputs: []string{"n"}, Outputs: []string{"a"}},
+		{Name: "proj", OpType: "Conv", Inputs: []string{"a", "w2"}, Outputs: []string{"y"}},
+	}
+	return m
+}
+
+func infer(t *testing.T, m *onnx.Model, x *engine.Tensor) []float32 {
+	t.Helper()
+	// round trip through the encoder, as the quantize command writes models
+	m, err := onnx.Decode(m.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := engine.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := e.Run(context.Background(), map[string]*engine.Tensor{"x": x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out[0].Float32s()
+}
+
+func relativeError(got, want []float32) float64 {
+	var d, peak float64
+	for i := range want {
+		d = max(d, math.Abs(float64(got[i]-want[i])))
+		peak = max(peak, math.Abs(float64(want[i])))
+	}
+	return d / peak
+}
+
+func count(m *onnx.Model, op string) int {
+	n := 0
+	for _, node := range m.Graph.Nodes {
+		if node.OpType == op {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDynamic(t *testing.T) {
+	x := engine.NewTensor([]int{1, 3, 8, 8}, random(rand.New(rand.NewSource(2)), 3*64, 1))
+	for _, opset := range []int64{11, 13} {
+		m := convBlock(opset)
+		want := infer(t, m, x)
+		qm, err := Quantize(m, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Graph.Nodes) != 4 || count(m, "BatchNormalization") != 1 {
+			t.Fatalf("opset %d: the input model was modified", opset)
+		}
+		if count(qm, "BatchNormalization") != 0 || count(qm, "DequantizeLinear") != 2 {
+			t.Fatalf("opset %d: operators %v", opset, qm.Operators())
+		}
+		// only biases and per-channel scales stay in float32
+		for _, init := range qm.Graph.Initializers {
+			if init.DataType == onnx.Float && init.NumElements() > 4 {
+				t.Fatalf("opset %d: float32 initializer %q of shape %v", opset, init.Name, init.Dims)
+			}
+		}
+		if d := relativeError(infer(t, qm, x), want); d > 0.02 {
+			t.Fatalf("opset %d: relative error %g", opset, d)
+		}
+	}
+}
+
+func TestStatic(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	m := convBlock(13)
+	samples := 0
+	calibration := func() (map[string]*engine.Tensor, error) {
+		if samples == 4 {
+			return nil, io.EOF
+		}
+		samples++
+		return map[string]*engine.Tensor{"x": engine.NewTensor([]int{1, 3, 8, 8}, random(r, 3*64, 1))}, nil
+	}
+	if _, err := Quantize(m, Options{Mode: Static}); err == nil {
+		t.Fatal("static quantization without calibration succeeded")
+	}
+	qm, err := Quantize(m, Options{Mode: Static, Calibration: calibration})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both convolutions run quantized, the second reading the first's
+	// UINT8 output, with the Relu absorbed
+	if count(qm, "QLinearConv") != 2 || count(qm, "QuantizeLinear") != 1 || count(qm, "DequantizeLinear") != 1 ||
+		count(qm, "Relu") != 0 || count(qm, "Conv") != 0 {
+		t.Fatalf("operators %v", qm.Operators())
+	}
+	x := engine.NewTensor([]int{1, 3, 8, 8}, random(r, 3*64, 1))
+	if d := relativeError(infer(t, qm, x), infer(t, m, x)); d > 0.05 {
+		t.Fatalf("relative error %g", d)
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/unrealandychan/rembg-go/pkg/backends"
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/tensor"
+	"github.com/unrealandychan/rembg-go/pkg/tracing"
+)
+
+// KServeServer serves local model sessions over the Open Inference Protocol
+// (KServe v2 / Triton HTTP) REST API:
+//
+//	GET  /v2/health/live, /v2/health/ready
+//	GET  /v2/models/{model}[/versions/{version}]           model metadata
+//	GET  /v2/models/{model}[/versions/{version}]/ready     model readiness
+//	POST /v2/models/{model}[/versions/{version}]/infer     inference
+//
+// Tensors can be sent as JSON data or with the binary tensor data extension,
+// so InferTritonHTTP and TritonHTTPBackend can talk to it directly. Every
+// model is served as version "1".
+type KServeServer struct {
+	// Models maps model names to sessions.
+	Models map[string]*models.Session
+	// MaxBodyBytes bounds the request body (default 64 MiB).
+	MaxBodyBytes int64
+}
+
+// NewKServeServer returns a server for the given sessions, keyed by model name.
+func NewKServeServer(sessions map[string]*models.Session) (*KServeServer, error) {
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("at least one model session required")
+	}
+	for name, s := range sessions {
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid model name %q", name)
+		}
+		if s == nil {
+			return nil, fmt.Errorf("model %q: nil session", name)
+		}
+	}
+	return &KServeServer{Models: sessions}, nil
+}
+
+// Handler returns the HTTP handler serving the v2 REST endpoints.
+func (s *KServeServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2", s.serverMetadata)
+	mux.HandleFunc("GET /v2/health/live", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /v2/health/ready", s.serverReady)
+	for _, prefix := range []string{"/v2/models/{model}", "/v2/models/{model}/versions/{version}"} {
+		mux.HandleFunc("GET "+prefix, s.modelMetadata)
+		mux.HandleFunc("GET "+prefix+"/ready", s.modelReady)
+		mux.HandleFunc("POST "+prefix+"/infer", s.infer)
+	}
+	return mux
+}
+
+func (s *KServeServer) serverMetadata(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":       "rembg-go",
+		"version":    "1",
+		"extensions": []string{"binary_tensor_data"},
+	})
+}
+
+func (s *KServeServer) serverReady(w http.ResponseWriter, r *http.Request) {
+	for name, session := range s.Models {
+		if session.LoadedModel() == nil {
+			writeError(w, errorf(http.StatusServiceUnavailable, "model %q is not ready", name))
+			return
+		}
+	}
+}
+
+// session resolves the {model} and {version} path values.
+func (s *KServeServer) session(r *http.Request) (string, *models.Session, error) {
+	name := r.PathValue("model")
+	session, ok := s.Models[name]
+	if !ok {
+		return "", nil, errorf(http.StatusNotFound, "unknown model %q", name)
+	}
+	if v := r.PathValue("version"); v != "" && v != "1" {
+		return "", nil, errorf(http.StatusNotFound, "model %q has no version %q", name, v)
+	}
+	return name, session, nil
+}
+
+func (s *KServeServer) modelReady(w http.ResponseWriter, r *http.Request) {
+	name, session, err := s.session(r)
+	if err == nil && session.LoadedModel() == nil {
+		err = errorf(http.StatusServiceUnavailable, "model %q is not ready", name)
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+func (s *KServeServer) modelMetadata(w http.ResponseWriter, r *http.Request) {
+	name, session, err := s.session(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	m := session.LoadedModel()
+	if m == nil {
+		writeError(w, errorf(http.StatusServiceUnavailable, "model %q is not ready", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, backends.TritonModelMetadataFromONNX(name, m))
+}
+
+func (s *KServeServer) infer(w http.ResponseWriter, r *http.Request) {
+	ctx := tracing.ExtractHTTP(r.Context(), r.Header)
+	name, session, err := s.session(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	maxBytes := s.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "read body: %w", err))
+		return
+	}
+	if int64(len(body)) > maxBytes {
+		writeError(w, errorf(http.StatusRequestEntityTooLarge, "body exceeds %d bytes", maxBytes))
+		return
+	}
+	header, data, err := backends.SplitInferBody(body, r.Header.Get(backends.InferHeaderContentLength))
+	if err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "%w", err))
+		return
+	}
+	var req backends.TritonInferRequest
+	if err := json.Unmarshal(header, &req); err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "decode request: %w", err))
+		return
+	}
+	contents, err := backends.TensorContents(req.Inputs, data)
+	if err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "%w", err))
+		return
+	}
+
+	known := map[string]bool{}
+	for _, v := range session.Inputs() {
+		known[v.Name] = true
+	}
+	inputs := make([]models.Tensor, len(req.Inputs))
+	for i, in := range req.Inputs {
+		if !known[in.Name] {
+			writeError(w, errorf(http.StatusBadRequest, "model %q has no input %q", name, in.Name))
+			return
+		}
+		values, err := tensor.Decode[float32](in.Datatype, contents[i])
+		if err != nil {
+			writeError(w, errorf(http.StatusBadRequest, "input %q: %w", in.Name, err))
+			return
+		}
+		shape := make([]int, len(in.Shape))
+		for j, d := range in.Shape {
+			shape[j] = int(d)
+		}
+		inputs[i] = models.Tensor{Name: in.Name, Shape: shape, Data: values}
+	}
+	outputs, err := session.Run(ctx, inputs...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp, chunks, err := buildInferResponse(name, req, outputs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(chunks) == 0 {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	out, headerLen, err := backends.EncodeInferBody(resp, chunks...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(backends.InferHeaderContentLength, headerLen)
+	w.Write(out)
+}
+
+// buildInferResponse selects the requested outputs (all when none are named)
+// and encodes each as binary data or JSON according to its binary_data
+// parameter or the request-wide binary_data_output parameter.
+func buildInferResponse(model string, req backends.TritonInferRequest, outputs []models.Tensor) (backends.TritonInferResponse, [][]byte, error) {
+	resp := backends.TritonInferResponse{ModelName: model, ModelVersion: "1", ID: req.ID}
+	allBinary, _ := req.Parameters["binary_data_output"].(bool)
+
+	byName := make(map[string]models.Tensor, len(outputs))
+	for _, o := range outputs {
+		byName[o.Name] = o
+	}
+	requested := req.Outputs
+	if len(requested) == 0 {
+		for _, o := range outputs {
+			requested = append(requested, backends.TritonTensor{Name: o.Name})
+		}
+	}
+
+	var chunks [][]byte
+	for _, ro := range requested {
+		o, ok := byName[ro.Name]
+		if !ok {
+			return resp, nil, errorf(http.StatusBadRequest, "unknown output %q", ro.Name)
+		}
+		t := backends.TritonTensor{Name: o.Name, Datatype: "FP32", Shape: make([]int64, len(o.Shape))}
+		for i, d := range o.Shape {
+			t.Shape[i] = int64(d)
+		}
+		binaryOut, ok := ro.Parameters["binary_data"].(bool)
+		if !ok {
+			binaryOut = allBinary
+		}
+		if binaryOut {
+			raw := backends.Float32sToBytes(o.Data)
+			t.Parameters = map[string]interface{}{"binary_data_size": len(raw)}
+			chunks = append(chunks, raw)
+		} else {
+			t.Data = make([]interface{}, len(o.Data))
+			for i, v := range o.Data {
+				t.Data[i] = v
+			}
+		}
+		resp.Outputs = append(resp.Outputs, t)
+	}
+	return resp, chunks, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError reports err in the protocol's {"error": "..."} form.
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusOf(err), map[string]string{"error": err.Error()})
+}
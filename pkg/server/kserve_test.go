@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/unrealandychan/rembg-go/pkg/backends"
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// sigmoidSession loads a one-node model computing y = Sigmoid(x) for x of shape [1,1,2,2].
+func sigmoidSession(t *testing.T) *models.Session {
+	t.Helper()
+	shape := []onnx.Dim{{Value: 1}, {Value: 1}, {Value: 2}, {Value: 2}}
+	m := &onnx.Model{
+		IRVersion:    7,
+		OpsetImports: []onnx.OpsetID{{Version: 11}},
+		Graph: onnx.Graph{
+			Nodes:   []onnx.Node{{OpType: "Sigmoid", Inputs: []string{"x"}, Outputs: []string{"y"}}},
+			Inputs:  []onnx.ValueInfo{{Name: "x", ElemType: onnx.Float, Shape: shape}},
+			Outputs: []onnx.ValueInfo{{Name: "y", ElemType: onnx.Float, Shape: shape}},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "sigmoid.onnx")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	s, err := models.NewSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestKServeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s, err := NewKServeServer(map[string]*models.Session{"u2net": sigmoidSession(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func sigmoid(x float32) float64 { return 1 / (1 + math.Exp(-float64(x))) }
+
+func TestKServeMetadataAndHealth(t *testing.T) {
+	srv := newTestKServeServer(t)
+	for path, want := range map[string]int{
+		"/v2/health/live":                   http.StatusOK,
+		"/v2/health/ready":                  http.StatusOK,
+		"/v2/models/u2net/ready":            http.StatusOK,
+		"/v2/models/u2net/versions/1/ready": http.StatusOK,
+		"/v2/models/u2net/versions/2/ready": http.StatusNotFound,
+		"/v2/models/missing":                http.StatusNotFound,
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/v2/models/u2net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var meta backends.TritonModelMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Inputs) != 1 || meta.Inputs[0].Name != "x" || meta.Inputs[0].Datatype != "FP32" || len(meta.Inputs[0].Shape) != 4 {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+}
+
+func TestKServeClosedModel(t *testing.T) {
+	session := sigmoidSession(t)
+	s, err := NewKServeServer(map[string]*models.Session{"u2net": session})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/v2/health/ready", "/v2/models/u2net/ready", "/v2/models/u2net"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s: status %d after Close, want %d", path, resp.StatusCode, http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func TestKServeJSONInfer(t *testing.T) {
+	srv := newTestKServeServer(t)
+	body := `{"id":"42","inputs":[{"name":"x","shape":[1,1,2,2],"datatype":"FP32","data":[[0,1],[-1,2]]}]}`
+	resp, err := http.Post(srv.URL+"/v2/models/u2net/infer", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	var out backends.TritonInferResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != "42" || len(out.Outputs) != 1 || out.Outputs[0].Name != "y" {
+		t.Fatalf("unexpected response: %+v", out)
+	}
+	for i, x := range []float32{0, 1, -1, 2} {
+		if got := out.Outputs[0].Data[i].(float64); math.Abs(got-sigmoid(x)) > 1e-5 {
+			t.Fatalf("y[%d] = %v, want %v", i, got, sigmoid(x))
+		}
+	}
+
+	bad := `{"inputs":[{"name":"nope","shape":[1],"datatype":"FP32","data":[0]}]}`
+	resp, err = http.Post(srv.URL+"/v2/models/u2net/infer", "application/json", bytes.NewBufferString(bad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown input: status %d", resp.StatusCode)
+	}
+}
+
+func TestTritonHTTPBackendAgainstKServeServer(t *testing.T) {
+	srv := newTestKServeServer(t)
+	addr := srv.Listener.Addr().String()
+
+	x := []float32{0, 1, -1, 2}
+	raw, err := backends.InferTritonHTTP(context.Background(), addr, "u2net", "x", backends.Float32sToBytes(x), []int{1, 1, 2, 2}, "FP32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range backends.BytesToFloat32s(raw) {
+		if math.Abs(float64(v)-sigmoid(x[i])) > 1e-5 {
+			t.Fatalf("y[%d] = %v, want %v", i, v, sigmoid(x[i]))
+		}
+	}
+
+	b := backends.NewTritonHTTPBackend(addr, "u2net", "x", []int{1, 1, 2, 2}, "FP32")
+	b.Decoder = backends.FloatTensorDecoder{Width: 2, Height: 2}
+	mask, err := b.Infer(context.Background(), backends.Float32sToBytes(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(mask))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sigmoid is monotonic: the largest input is the brightest mask pixel
+	if r, _, _, _ := img.At(1, 1).RGBA(); r>>8 != 255 {
+		t.Fatalf("mask(1,1) = %d, want 255", r>>8)
+	}
+}
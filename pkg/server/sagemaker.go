@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/processing"
+	"github.com/unrealandychan/rembg-go/pkg/tracing"
+)
+
+// CustomAttributesHeader is the header SageMaker uses to forward the
+// CustomAttributes of an InvokeEndpoint call to the container.
+const CustomAttributesHeader = "X-Amzn-SageMaker-Custom-Attributes"
+
+// SageMakerServer implements the SageMaker inference container contract:
+// GET /ping reports health and POST /invocations removes the background of
+// the image in the request body using a local model session.
+//
+// The response format follows the Accept header: image/png (default) returns
+// the PNG image, application/json returns {"mask": "<base64 png>"} or
+// {"image": "<base64 png>"}. CustomAttributes are ";"-separated key=value
+// pairs overriding Options per request:
+//
+//	output=mask|cutout        return the mask or the cutout (default cutout)
+//	post_process_mask=bool    smooth the mask
+//	alpha_matting=bool        use alpha matting for the cutout
+//	bgcolor=rrggbb            flatten the cutout onto a solid colour
+type SageMakerServer struct {
+	Session *models.Session
+	// Options are the defaults applied to every invocation.
+	Options processing.RemoveBackgroundOptions
+	// MaxBodyBytes bounds the request body (default 64 MiB).
+	MaxBodyBytes int64
+
+	// predict computes the mask for img; tests replace it to avoid loading a model.
+	predict func(ctx context.Context, img image.Image, opts processing.RemoveBackgroundOptions) (image.Image, error)
+}
+
+// NewSageMakerServer returns a server running inference with session.
+func NewSageMakerServer(session *models.Session, opts processing.RemoveBackgroundOptions) (*SageMakerServer, error) {
+	if session == nil {
+		return nil, fmt.Errorf("model session required")
+	}
+	return &SageMakerServer{Session: session, Options: opts}, nil
+}
+
+// Handler returns the HTTP handler serving /ping and /invocations.
+func (s *SageMakerServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ping", s.ping)
+	mux.HandleFunc("POST /invocations", s.invocations)
+	return mux
+}
+
+func (s *SageMakerServer) ping(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *SageMakerServer) invocations(w http.ResponseWriter, r *http.Request) {
+	ctx := tracing.ExtractHTTP(r.Context(), r.Header)
+	body, contentType, err := s.invoke(ctx, r)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func (s *SageMakerServer) invoke(ctx context.Context, r *http.Request) (body []byte, contentType string, err error) {
+	accept, err := negotiate(r.Header.Get("Accept"))
+	if err != nil {
+		return nil, "", err
+	}
+	opts, err := parseCustomAttributes(r.Header.Get(CustomAttributesHeader), s.Options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	maxBytes := s.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", errorf(http.StatusBadRequest, "read body: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", errorf(http.StatusRequestEntityTooLarge, "body exceeds %d bytes", maxBytes)
+	}
+
+	stageStart := time.Now()
+	_, decodeSpan := tracing.StartStage(ctx, "decode")
+	img, _, err := image.Decode(bytes.NewReader(data))
+	tracing.End(decodeSpan, err)
+	if err != nil {
+		return nil, "", errorf(http.StatusBadRequest, "decode image: %w", err)
+	}
+	metrics.ObserveStage("decode", stageStart)
+
+	predict := s.predict
+	if predict == nil {
+		predict = func(ctx context.Context, img image.Image, opts processing.RemoveBackgroundOptions) (image.Image, error) {
+			return processing.RemoveBackgroundWithSession(ctx, s.Session, img, opts)
+		}
+	}
+	maskOpts := opts
+	maskOpts.OnlyMask = true
+	mask, err := predict(ctx, img, maskOpts)
+	if err != nil {
+		return nil, "", fmt.Errorf("remove background: %w", err)
+	}
+	out := processing.Composite(ctx, img, mask, opts)
+
+	stageStart = time.Now()
+	_, encodeSpan := tracing.StartStage(ctx, "encode")
+	body, err = encodeResult(out, accept, opts.OnlyMask)
+	tracing.End(encodeSpan, err)
+	if err != nil {
+		return nil, "", err
+	}
+	metrics.ObserveStage("encode", stageStart)
+	return body, accept, nil
+}
+
+// encodeResult encodes img as PNG, wrapped in a JSON object for application/json.
+func encodeResult(img image.Image, accept string, isMask bool) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	if accept != "application/json" {
+		return buf.Bytes(), nil
+	}
+	key := "image"
+	if isMask {
+		key = "mask"
+	}
+	body, err := json.Marshal(map[string]string{key: base64.StdEncoding.EncodeToString(buf.Bytes())})
+	if err != nil {
+		return nil, fmt.Errorf("encode json: %w", err)
+	}
+	return body, nil
+}
+
+// negotiate picks the response media type from an Accept header.
+func negotiate(accept string) (string, error) {
+	if strings.TrimSpace(accept) == "" {
+		return "image/png", nil
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "image/png", "image/*", "*/*":
+			return "image/png", nil
+		case "application/json":
+			return mediaType, nil
+		}
+	}
+	return "", errorf(http.StatusNotAcceptable, "unsupported Accept %q; use image/png or application/json", accept)
+}
+
+// parseCustomAttributes applies the key=value pairs of attrs to opts.
+func parseCustomAttributes(attrs string, opts processing.RemoveBackgroundOptions) (processing.RemoveBackgroundOptions, error) {
+	for _, pair := range strings.Split(attrs, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return opts, errorf(http.StatusBadRequest, "custom attribute %q: want key=value", pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "output":
+			switch value {
+			case "mask":
+				opts.OnlyMask = true
+			case "cutout", "image":
+				opts.OnlyMask = false
+			default:
+				err = fmt.Errorf("want mask or cutout")
+			}
+		case "post_process_mask":
+			opts.PostProcessMask, err = strconv.ParseBool(value)
+		case "alpha_matting":
+			opts.AlphaMatting, err = strconv.ParseBool(value)
+		case "bgcolor":
+			var c color.Color
+			c, err = parseHexColor(value)
+			opts.BackgroundColor = &c
+		default:
+			err = fmt.Errorf("unknown attribute")
+		}
+		if err != nil {
+			return opts, errorf(http.StatusBadRequest, "custom attribute %q: %v", pair, err)
+		}
+	}
+	return opts, nil
+}
+
+func parseHexColor(s string) (color.Color, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(b) != 3 {
+		return nil, fmt.Errorf("want rrggbb hex colour")
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: 255}, nil
+}
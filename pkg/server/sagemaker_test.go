@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sagemakerruntime"
+	"github.com/unrealandychan/rembg-go/pkg/backends"
+	"github.com/unrealandychan/rembg-go/pkg/models"
+	"github.com/unrealandychan/rembg-go/pkg/processing"
+)
+
+// halfMask marks the left half of the image as foreground.
+func halfMask(ctx context.Context, img image.Image, opts processing.RemoveBackgroundOptions) (image.Image, error) {
+	b := img.Bounds()
+	mask := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Min.X+b.Dx()/2; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	return mask, nil
+}
+
+func newTestSageMakerServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s, err := NewSageMakerServer(&models.Session{ModelPath: "u2net.onnx"}, processing.RemoveBackgroundOptions{PutAlpha: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.predict = halfMask
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func invoke(t *testing.T, url string, body []byte, accept, attrs string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/invocations", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("Accept", accept)
+	req.Header.Set(CustomAttributesHeader, attrs)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestSageMakerServerPing(t *testing.T) {
+	srv := newTestSageMakerServer(t)
+	resp, err := http.Get(srv.URL + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ping status %d", resp.StatusCode)
+	}
+}
+
+func TestSageMakerServerCutoutAndMask(t *testing.T) {
+	srv := newTestSageMakerServer(t)
+
+	resp := invoke(t, srv.URL, testPNG(t, 4, 2), "image/png", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a == 0 {
+		t.Fatal("foreground pixel is transparent")
+	}
+	if _, _, _, a := img.At(3, 0).RGBA(); a != 0 {
+		t.Fatal("background pixel is opaque")
+	}
+
+	resp = invoke(t, srv.URL, testPNG(t, 4, 2), "application/json", "output=mask; post_process_mask=true")
+	var doc map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(doc["mask"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mask.(*image.Gray); !ok {
+		t.Fatalf("mask is %T, want *image.Gray", mask)
+	}
+}
+
+func TestSageMakerServerRejectsBadRequests(t *testing.T) {
+	srv := newTestSageMakerServer(t)
+	cases := []struct {
+		body          []byte
+		accept, attrs string
+		want          int
+	}{
+		{[]byte("not an image"), "", "", http.StatusBadRequest},
+		{testPNG(t, 2, 2), "text/csv", "", http.StatusNotAcceptable},
+		{testPNG(t, 2, 2), "", "output=both", http.StatusBadRequest},
+		{testPNG(t, 2, 2), "", "colour=red", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		resp := invoke(t, srv.URL, c.body, c.accept, c.attrs)
+		if resp.StatusCode != c.want {
+			msg, _ := io.ReadAll(resp.Body)
+			t.Errorf("accept=%q attrs=%q: status %d (%s), want %d", c.accept, c.attrs, resp.StatusCode, msg, c.want)
+		}
+	}
+}
+
+// httpRuntime forwards InvokeEndpoint calls to a container URL the way the
+// SageMaker runtime does.
+type httpRuntime struct{ url string }
+
+func (h httpRuntime) InvokeEndpoint(ctx context.Context, params *sagemakerruntime.InvokeEndpointInput, optFns ...func(*sagemakerruntime.Options)) (*sagemakerruntime.InvokeEndpointOutput, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url+"/invocations", bytes.NewReader(params.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", aws.ToString(params.ContentType))
+	req.Header.Set("Accept", aws.ToString(params.Accept))
+	req.Header.Set(CustomAttributesHeader, aws.ToString(params.CustomAttributes))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &backends.HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+	}
+	return &sagemakerruntime.InvokeEndpointOutput{Body: body, ContentType: aws.String(resp.Header.Get("Content-Type"))}, nil
+}
+
+func TestSageMakerBackendAgainstServer(t *testing.T) {
+	srv := newTestSageMakerServer(t)
+	b, err := backends.NewSageMakerBackendWithOptions(context.Background(), "local", backends.SageMakerOptions{
+		Client:           httpRuntime{url: srv.URL},
+		ContentType:      "image/png",
+		Accept:           "application/json",
+		CustomAttributes: "output=mask",
+		Decoder:          backends.JSONMaskDecoder{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := backends.RemoveBackgroundWithBackend(context.Background(), b, testPNG(t, 4, 2), processing.RemoveBackgroundOptions{PutAlpha: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, ok := out.(image.Image)
+	if !ok {
+		t.Fatalf("result is %T", out)
+	}
+	if _, _, _, a := img.At(3, 1).RGBA(); a != 0 {
+		t.Fatal("background pixel is opaque")
+	}
+}
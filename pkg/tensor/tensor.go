@@ -0,0 +1,339 @@
+// Package tensor converts between Go slices and the little-endian byte
+// layout Triton and the KServe v2 protocol use for tensor contents, for every
+// numeric datatype ("BOOL", "UINT8" ... "UINT64", "INT8" ... "INT64", "FP16",
+// "BF16", "FP32" and "FP64"), and encodes "BYTES" tensors, whose elements
+// are each a 4-byte little-endian length followed by that many bytes.
+//
+// Converting floating-point values to an integer datatype rounds to the
+// nearest integer (halves away from zero) and saturates at the type's range;
+// "BOOL" stores 1 for any non-zero value. FP16 and BF16 round to nearest even.
+package tensor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/unrealandychan/rembg-go/pkg/onnx"
+)
+
+// Number is the set of element types Encode and Decode convert.
+type Number interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~int |
+		~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uint |
+		~float32 | ~float64
+}
+
+// ElementSize returns the size in bytes of one element of datatype.
+func ElementSize(datatype string) (int, error) {
+	dt, err := onnx.DataTypeFromTriton(datatype)
+	if err != nil {
+		return 0, err
+	}
+	size := dt.Size()
+	if size == 0 {
+		return 0, fmt.Errorf("datatype %q has no fixed element size", datatype)
+	}
+	return size, nil
+}
+
+// NumElements returns the number of elements of shape, which must not have
+// negative (dynamic) dimensions.
+func NumElements(shape []int64) (int, error) {
+	n := 1
+	for _, d := range shape {
+		if d < 0 {
+			return 0, fmt.Errorf("shape %v has a dynamic dimension", shape)
+		}
+		n *= int(d)
+	}
+	return n, nil
+}
+
+// CheckSize returns an error unless n bytes hold exactly one tensor of
+// datatype and shape.
+func CheckSize(datatype string, shape []int64, n int) error {
+	size, err := ElementSize(datatype)
+	if err != nil {
+		return err
+	}
+	elems, err := NumElements(shape)
+	if err != nil {
+		return err
+	}
+	if n != elems*size {
+		return fmt.Errorf("%s tensor of shape %v needs %d bytes, got %d", datatype, shape, elems*size, n)
+	}
+	return nil
+}
+
+// Check returns an error unless b holds exactly one tensor of datatype and
+// shape; for BYTES the number of elements is checked.
+func Check(datatype string, shape []int64, b []byte) error {
+	if datatype != "BYTES" {
+		return CheckSize(datatype, shape, len(b))
+	}
+	elems, err := NumElements(shape)
+	if err != nil {
+		return err
+	}
+	values, err := DecodeBytes(b)
+	if err != nil {
+		return err
+	}
+	if len(values) != elems {
+		return fmt.Errorf("BYTES tensor of shape %v needs %d elements, got %d", shape, elems, len(values))
+	}
+	return nil
+}
+
+// EncodeBytes serializes elems as the contents of a BYTES tensor.
+func EncodeBytes(elems ...[]byte) []byte {
+	n := 0
+	for _, e := range elems {
+		n += 4 + len(e)
+	}
+	out := make([]byte, 0, n)
+	for _, e := range elems {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(e)))
+		out = append(out, e...)
+	}
+	return out
+}
+
+// DecodeBytes splits the contents of a BYTES tensor into its elements, which
+// alias b.
+func DecodeBytes(b []byte) ([][]byte, error) {
+	var elems [][]byte
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("BYTES tensor: %d trailing bytes", len(b))
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, fmt.Errorf("BYTES tensor: element of %d bytes exceeds the remaining %d", n, len(b)-4)
+		}
+		elems = append(elems, b[4:4+n])
+		b = b[4+n:]
+	}
+	return elems, nil
+}
+
+// Encode converts values to little-endian bytes of datatype.
+func Encode[T Number](datatype string, values []T) ([]byte, error) {
+	dt, err := onnx.DataTypeFromTriton(datatype)
+	if err != nil {
+		return nil, err
+	}
+	size := dt.Size()
+	if size == 0 {
+		return nil, fmt.Errorf("cannot encode datatype %q", datatype)
+	}
+	float := isFloat[T]()
+	out := make([]byte, len(values)*size)
+	for i, v := range values {
+		b := out[i*size:]
+		switch dt {
+		case onnx.Float:
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+		case onnx.Double:
+			binary.LittleEndian.PutUint64(b, math.Float64bits(float64(v)))
+		case onnx.Float16:
+			binary.LittleEndian.PutUint16(b, Float32ToFloat16(float32(v)))
+		case onnx.BFloat16:
+			binary.LittleEndian.PutUint16(b, Float32ToBFloat16(float32(v)))
+		case onnx.Bool:
+			if v != 0 {
+				b[0] = 1
+			}
+		case onnx.Uint8, onnx.Uint16, onnx.Uint32, onnx.Uint64:
+			var x uint64
+			if float {
+				x = saturateUint(float64(v), size)
+			} else if v > 0 {
+				x = min(uint64(v), maxUint(size))
+			}
+			putUint(b, x, size)
+		case onnx.Int8, onnx.Int16, onnx.Int32, onnx.Int64:
+			var x int64
+			if float {
+				x = saturateInt(float64(v), size)
+			} else if v < 0 {
+				x = max(int64(v), -maxInt(size)-1)
+			} else {
+				x = int64(min(uint64(v), uint64(maxInt(size))))
+			}
+			putUint(b, uint64(x), size)
+		}
+	}
+	return out, nil
+}
+
+// Decode converts little-endian bytes of datatype to values of type T. When T
+// is an integer type, floating-point elements are rounded to the nearest
+// integer.
+func Decode[T Number](datatype string, b []byte) ([]T, error) {
+	dt, err := onnx.DataTypeFromTriton(datatype)
+	if err != nil {
+		return nil, err
+	}
+	size := dt.Size()
+	if size == 0 {
+		return nil, fmt.Errorf("cannot decode datatype %q", datatype)
+	}
+	if len(b)%size != 0 {
+		return nil, fmt.Errorf("%d bytes is not a multiple of the %s element size", len(b), datatype)
+	}
+	float := isFloat[T]()
+	out := make([]T, len(b)/size)
+	for i := range out {
+		e := b[i*size:]
+		var f float64
+		switch dt {
+		case onnx.Float:
+			f = float64(math.Float32frombits(binary.LittleEndian.Uint32(e)))
+		case onnx.Double:
+			f = math.Float64frombits(binary.LittleEndian.Uint64(e))
+		case onnx.Float16:
+			f = float64(Float16ToFloat32(binary.LittleEndian.Uint16(e)))
+		case onnx.BFloat16:
+			f = float64(BFloat16ToFloat32(binary.LittleEndian.Uint16(e)))
+		case onnx.Uint8, onnx.Bool, onnx.Uint16, onnx.Uint32, onnx.Uint64:
+			out[i] = T(getUint(e, size))
+			continue
+		case onnx.Int8, onnx.Int16, onnx.Int32, onnx.Int64:
+			// sign-extend from size bytes
+			shift := 64 - 8*size
+			out[i] = T(int64(getUint(e, size)<<shift) >> shift)
+			continue
+		}
+		if !float {
+			f = math.Round(f)
+		}
+		out[i] = T(f)
+	}
+	return out, nil
+}
+
+// isFloat reports whether T is a floating-point type.
+func isFloat[T Number]() bool {
+	half := 0.5
+	return T(half) != 0
+}
+
+func maxUint(size int) uint64 { return math.MaxUint64 >> (64 - 8*size) }
+
+func maxInt(size int) int64 { return math.MaxInt64 >> (64 - 8*size) }
+
+func saturateUint(f float64, size int) uint64 {
+	f = math.Round(f)
+	switch {
+	case f != f || f <= 0:
+		return 0
+	case f >= float64(maxUint(size)):
+		return maxUint(size)
+	}
+	return uint64(f)
+}
+
+func saturateInt(f float64, size int) int64 {
+	f = math.Round(f)
+	hi, lo := maxInt(size), -maxInt(size)-1
+	switch {
+	case f != f:
+		return 0
+	case f >= float64(hi):
+		return hi
+	case f <= float64(lo):
+		return lo
+	}
+	return int64(f)
+}
+
+func putUint(b []byte, v uint64, size int) {
+	for i := 0; i < size; i++ {
+		b[i] = byte(v >> (8 * i))
+	}
+}
+
+func getUint(b []byte, size int) uint64 {
+	var v uint64
+	for i := 0; i < size; i++ {
+		v |= uint64(b[i]) << (8 * i)
+	}
+	return v
+}
+
+// Float32ToFloat16 converts f to IEEE 754 half precision, rounding to
+// nearest even; out-of-range values become infinity.
+func Float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+	switch {
+	case exp == 0xff: // Inf or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp-127 > 15:
+		return sign | 0x7c00
+	case exp-127 >= -14: // normal
+		h := uint32(exp-127+15)<<10 | mant>>13
+		// round to nearest even; a carry into the exponent is correct
+		if rem := mant & 0x1fff; rem > 0x1000 || (rem == 0x1000 && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	case exp-127 >= -25: // subnormal
+		mant |= 0x800000
+		shift := uint(-(exp - 127) - 14 + 13)
+		h := mant >> shift
+		rem := mant & (1<<shift - 1)
+		half := uint32(1) << (shift - 1)
+		if rem > half || (rem == half && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	default:
+		return sign
+	}
+}
+
+// Float16ToFloat32 converts an IEEE 754 half-precision value to float32.
+func Float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp == 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// subnormal: mant * 2^-24
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// Float32ToBFloat16 converts f to bfloat16, rounding to nearest even.
+func Float32ToBFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	if f != f {
+		return uint16(bits>>16) | 0x40
+	}
+	bits += 0x7fff + (bits>>16)&1
+	return uint16(bits >> 16)
+}
+
+// BFloat16ToFloat32 converts a bfloat16 value to float32.
+func BFloat16ToFloat32(b uint16) float32 {
+	return math.Float32frombits(uint32(b) << 16)
+}
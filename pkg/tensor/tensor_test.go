@@ -0,0 +1,125 @@
+package tensor
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	values := []float32{-2, -0.5, 0, 0.25, 1, 3}
+	for _, dt := range []string{"FP16", "BF16", "FP32", "FP64"} {
+		b, err := Encode(dt, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, _ := ElementSize(dt)
+		if len(b) != len(values)*size {
+			t.Fatalf("%s: %d bytes", dt, len(b))
+		}
+		got, err := Decode[float32](dt, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range values {
+			if got[i] != values[i] {
+				t.Fatalf("%s: got %v, want %v", dt, got, values)
+			}
+		}
+	}
+}
+
+func TestEncodeIntegerSaturates(t *testing.T) {
+	for _, tc := range []struct {
+		dt   string
+		in   []float32
+		want []byte
+	}{
+		{"UINT8", []float32{-3, 0.4, 0.6, 254.4, 300}, []byte{0, 0, 1, 254, 255}},
+		{"INT8", []float32{-200, -1.6, 1.4, 127.4, 500}, []byte{0x80, 0xfe, 1, 127, 127}},
+		{"BOOL", []float32{0, 0.5, -1}, []byte{0, 1, 1}},
+		{"INT16", []float32{-2}, []byte{0xfe, 0xff}},
+	} {
+		got, err := Encode(tc.dt, tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.dt, got, tc.want)
+		}
+	}
+	got, err := Decode[int]("INT8", []byte{0x80, 0xfe, 0x7f})
+	if err != nil || got[0] != -128 || got[1] != -2 || got[2] != 127 {
+		t.Fatalf("decode INT8: %v %v", got, err)
+	}
+	ints, _ := Encode("UINT16", []int{-1, 70000, 513})
+	if !bytes.Equal(ints, []byte{0, 0, 0xff, 0xff, 1, 2}) {
+		t.Fatalf("encode UINT16 from ints: %v", ints)
+	}
+}
+
+func TestFloat16(t *testing.T) {
+	for _, tc := range []struct {
+		f float32
+		h uint16
+	}{
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{65504, 0x7bff},
+		{1e6, 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		{6.1035156e-05, 0x0400}, // smallest normal
+		{5.9604645e-08, 0x0001}, // smallest subnormal
+		{1.0009765625, 0x3c01},  // 1 + 2^-10
+		{1.00048828125, 0x3c00}, // tie rounds to even
+		{1.00146484375, 0x3c02}, // tie rounds to even
+	} {
+		if got := Float32ToFloat16(tc.f); got != tc.h {
+			t.Errorf("Float32ToFloat16(%v) = %#04x, want %#04x", tc.f, got, tc.h)
+		}
+	}
+	if f := Float16ToFloat32(0x0001); f != 5.9604645e-08 {
+		t.Errorf("subnormal: %v", f)
+	}
+	if f := Float16ToFloat32(Float32ToFloat16(float32(math.NaN()))); f == f {
+		t.Errorf("NaN became %v", f)
+	}
+	if b := Float32ToBFloat16(1.00390625); b != 0x3f80 { // tie rounds to even
+		t.Errorf("bf16 = %#04x", b)
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	if err := CheckSize("FP16", []int64{1, 3, 2, 2}, 24); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSize("FP32", []int64{1, 3, 2, 2}, 24); err == nil {
+		t.Fatal("expected a size mismatch")
+	}
+	if err := CheckSize("FP32", []int64{-1, 3}, 12); err == nil {
+		t.Fatal("expected an error for a dynamic dimension")
+	}
+	if _, err := Decode[float32]("FP32", make([]byte, 6)); err == nil {
+		t.Fatal("expected an error for a partial element")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	b := EncodeBytes([]byte("png"), nil, []byte("x"))
+	if !bytes.Equal(b, []byte{3, 0, 0, 0, 'p', 'n', 'g', 0, 0, 0, 0, 1, 0, 0, 0, 'x'}) {
+		t.Fatalf("encoded %v", b)
+	}
+	elems, err := DecodeBytes(b)
+	if err != nil || len(elems) != 3 || string(elems[0]) != "png" || len(elems[1]) != 0 || string(elems[2]) != "x" {
+		t.Fatalf("decoded %q, %v", elems, err)
+	}
+	if err := Check("BYTES", []int64{1, 3}, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check("BYTES", []int64{1}, b); err == nil {
+		t.Fatal("expected an element count error")
+	}
+	if _, err := DecodeBytes([]byte{9, 0, 0, 0, 1}); err == nil {
+		t.Fatal("expected a truncation error")
+	}
+}
@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// fileClient is an otlptrace.Client that writes every upload as a single line
+// of OTLP/JSON (the same encoding the collector's file exporter uses).
+type fileClient struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newFileClient(w io.Writer) *fileClient {
+	return &fileClient{w: w}
+}
+
+func (c *fileClient) Start(ctx context.Context) error { return nil }
+
+func (c *fileClient) Stop(ctx context.Context) error { return nil }
+
+func (c *fileClient) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	b, err := protojson.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return fmt.Errorf("marshal otlp spans: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write otlp spans: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package tracing wires OpenTelemetry spans through the background removal
+// pipeline and propagates trace context to remote backends.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/unrealandychan/rembg-go"
+
+// Attribute keys shared by the pipeline spans.
+var (
+	AttrImageWidth  = attribute.Key("rembg.image.width")
+	AttrImageHeight = attribute.Key("rembg.image.height")
+	AttrModel       = attribute.Key("rembg.model")
+	AttrBackend     = attribute.Key("rembg.backend")
+)
+
+// Tracer returns the tracer used for all rembg spans. It resolves the global
+// TracerProvider on every call so Setup can be called after package init.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// StartStage starts a child span named "rembg.<stage>".
+func StartStage(ctx context.Context, stage string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "rembg."+stage, trace.WithAttributes(attrs...))
+}
+
+// End records err on span (if any) and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Setup installs a global TracerProvider and W3C trace-context propagator.
+// exporter is "stdout" (human readable JSON) or "otlp-file" (OTLP/JSON lines,
+// one ExportTraceServiceRequest per batch); output is the destination file,
+// with "" or "-" meaning stdout. No collector is required for either.
+// The returned function flushes and shuts the provider down.
+func Setup(ctx context.Context, exporter, output string) (func(context.Context) error, error) {
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if output != "" && output != "-" {
+		var err error
+		f, err = os.Create(output)
+		if err != nil {
+			return nil, fmt.Errorf("open trace output: %w", err)
+		}
+		w = f
+	}
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+	case "otlp-file":
+		exp, err = otlptrace.New(ctx, newFileClient(w))
+	default:
+		err = fmt.Errorf("unknown trace exporter %q; choose stdout or otlp-file", exporter)
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+
+	res := resource.NewSchemaless(semconv.ServiceName("rembg-go"))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if f != nil {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSetupOTLPFileAndPropagation(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), "otlp-file", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, span := StartStage(context.Background(), "decode", AttrModel.String("u2net"))
+
+	h := http.Header{}
+	InjectHTTP(ctx, h)
+	if h.Get("traceparent") == "" {
+		t.Fatalf("traceparent header not injected: %v", h)
+	}
+	md, _ := metadata.FromOutgoingContext(InjectGRPC(ctx))
+	if len(md.Get("traceparent")) == 0 {
+		t.Fatalf("traceparent metadata not injected: %v", md)
+	}
+	End(span, nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		t.Fatal("no spans written")
+	}
+	if line := sc.Text(); !strings.Contains(line, `"rembg.decode"`) || !strings.Contains(line, "resourceSpans") {
+		t.Fatalf("unexpected otlp line: %s", line)
+	}
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), "zipkin", ""); err == nil {
+		t.Fatal("expected error for unknown exporter")
+	}
+}
@@ -1,10 +1,13 @@
 package utils
 
 import (
+    "fmt"
     "image"
     "image/draw"
 
     "github.com/nfnt/resize"
+
+    "github.com/unrealandychan/rembg-go/pkg/tensor"
 )
 
 // NormalizeImage is a compatibility wrapper that returns an NRGBA-converted/resized image.
@@ -53,3 +56,30 @@ func NormalizeToFloat32CHW(img image.Image, width, height int, mean [3]float32,
     }
     return out, nil
 }
+
+// NormalizeToTensor prepares img as the little-endian contents of a
+// [1,3,height,width] tensor of datatype (a Triton datatype string such as
+// "FP32", "FP16" or "UINT8"). Floating-point datatypes receive the
+// mean/std-normalised values of NormalizeToFloat32CHW; integer datatypes, as
+// used by quantized models, receive the raw 0..255 pixel values and ignore
+// mean and std, except INT8, which receives them shifted by a -128 zero
+// point to -128..127.
+func NormalizeToTensor(img image.Image, width, height int, mean [3]float32, std [3]float32, datatype string) ([]byte, error) {
+    raw := [3]float32{1.0 / 255, 1.0 / 255, 1.0 / 255}
+    switch datatype {
+    case "FP16", "BF16", "FP32", "FP64":
+    case "INT8":
+        mean, std = [3]float32{128.0 / 255, 128.0 / 255, 128.0 / 255}, raw
+    default:
+        mean, std = [3]float32{}, raw
+    }
+    data, err := NormalizeToFloat32CHW(img, width, height, mean, std)
+    if err != nil {
+        return nil, err
+    }
+    b, err := tensor.Encode(datatype, data)
+    if err != nil {
+        return nil, fmt.Errorf("encode input tensor: %w", err)
+    }
+    return b, nil
+}
@@ -25,7 +25,39 @@ func TestNormalizeToFloat32CHW(t *testing.T) {
     if out[0] < 0.99 || out[0] > 1.01 {
         t.Fatalf("unexpected red value: %v", out[0])
     }
-    if out[1] != 0.0 || out[2] != 0.0 {
-        t.Fatalf("unexpected green/blue values: %v %v", out[1], out[2])
+    // CHW layout: the green and blue planes start at 4 and 8
+    if out[4] != 0.0 || out[8] != 0.0 {
+        t.Fatalf("unexpected green/blue values: %v %v", out[4], out[8])
+    }
+}
+
+func TestNormalizeToTensor(t *testing.T) {
+    img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+    draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 255, G: 128, B: 0, A: 255}}, image.Point{}, draw.Src)
+
+    mean := [3]float32{0.5, 0.5, 0.5}
+    std := [3]float32{0.5, 0.5, 0.5}
+    fp16, err := NormalizeToTensor(img, 2, 2, mean, std, "FP16")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // red (1-0.5)/0.5 = 1.0 is 0x3c00 in half precision
+    if len(fp16) != 2*3*2*2 || fp16[0] != 0x00 || fp16[1] != 0x3c {
+        t.Fatalf("unexpected fp16 tensor: %v", fp16)
+    }
+    u8, err := NormalizeToTensor(img, 2, 2, mean, std, "UINT8")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(u8) != 3*2*2 || u8[0] != 255 || u8[4] != 128 || u8[8] != 0 {
+        t.Fatalf("unexpected uint8 tensor: %v", u8)
+    }
+    i8, err := NormalizeToTensor(img, 2, 2, mean, std, "INT8")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // 255, 128 and 0 shifted by the -128 zero point
+    if len(i8) != 3*2*2 || int8(i8[0]) != 127 || int8(i8[4]) != 0 || int8(i8[8]) != -128 {
+        t.Fatalf("unexpected int8 tensor: %v", i8)
     }
 }
@@ -14,6 +14,8 @@ import (
 	"time"
 
 	"github.com/unrealandychan/rembg-go/pkg/backends"
+	"github.com/unrealandychan/rembg-go/pkg/metrics"
+	"github.com/unrealandychan/rembg-go/pkg/models"
 	"github.com/unrealandychan/rembg-go/pkg/processing"
 )
 
@@ -148,11 +150,13 @@ func RemoveBackgroundForVideo(ctx context.Context, backend backends.Backend, inp
 				case []byte:
 					outBytes = v
 				case image.Image:
+					encodeStart := time.Now()
 					buf := new(bytes.Buffer)
 					if err := png.Encode(buf, v); err != nil {
 						fmt.Printf("encode png: %v\n", err)
 						continue
 					}
+					metrics.ObserveStage("encode", encodeStart)
 					outBytes = buf.Bytes()
 				default:
 					fmt.Printf("unknown result type for %s\n", framePath)
@@ -171,3 +175,56 @@ func RemoveBackgroundForVideo(ctx context.Context, backend backends.Backend, inp
 	wg.Wait()
 	return nil
 }
+
+// RemoveBackgroundForVideoBatch is RemoveBackgroundForVideo with a local
+// session, running up to session.MaxBatch() frames per forward pass.
+// Frames that fail to decode are skipped; an inference error stops the run.
+func RemoveBackgroundForVideoBatch(ctx context.Context, session *models.Session, inputDir, outputDir string, opts processing.RemoveBackgroundOptions) error {
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return err
+	}
+	frames, err := filepath.Glob(filepath.Join(inputDir, "frame_*.png"))
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames found in %s", inputDir)
+	}
+	tasks := make(chan frameTask, session.MaxBatch())
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go saveFrameWorker(tasks, &wg)
+	}
+	defer func() {
+		close(tasks)
+		wg.Wait()
+	}()
+	for start := 0; start < len(frames); start += session.MaxBatch() {
+		var imgs []image.Image
+		var paths []string
+		for _, framePath := range frames[start:min(len(frames), start+session.MaxBatch())] {
+			f, err := os.Open(framePath)
+			if err != nil {
+				fmt.Printf("read frame: %v\n", err)
+				continue
+			}
+			img, err := png.Decode(f)
+			f.Close()
+			if err != nil {
+				fmt.Printf("decode frame %s: %v\n", framePath, err)
+				continue
+			}
+			imgs = append(imgs, img)
+			paths = append(paths, filepath.Join(outputDir, filepath.Base(framePath)))
+		}
+		cutouts, err := processing.RemoveBackgroundBatch(ctx, session, imgs, opts)
+		if err != nil {
+			return fmt.Errorf("frames %d-%d: %w", start, start+len(imgs)-1, err)
+		}
+		for i, cutout := range cutouts {
+			tasks <- frameTask{img: cutout, path: paths[i]}
+		}
+	}
+	return nil
+}
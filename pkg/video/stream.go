@@ -1,10 +1,32 @@
 package video
 
-// StreamProcessor would accept RGB24 frames and forward them to the background removal pipeline.
-type StreamProcessor struct{
-    // TODO: add fields for session, workers, channels
+import (
+    "context"
+
+    "github.com/unrealandychan/rembg-go/pkg/backends"
+)
+
+// StreamProcessor forwards encoded frames to a backend as they are produced
+// and returns the masks in frame order, keeping up to Window requests in
+// flight. With a TritonGRPCBackend in streaming mode the frames are pipelined
+// over a single ModelStreamInfer stream.
+type StreamProcessor struct {
+    Backend backends.Backend
+    Window  int
+}
+
+// NewStreamProcessor returns a processor for b with window requests in
+// flight (default 8).
+func NewStreamProcessor(b backends.Backend, window int) *StreamProcessor {
+    if window <= 0 {
+        window = 8
+    }
+    return &StreamProcessor{Backend: b, Window: window}
 }
 
-func NewStreamProcessor() *StreamProcessor {
-    return &StreamProcessor{}
+// Process sends every frame read from frames and yields one result per
+// frame, in order. The result channel is closed after frames is closed and
+// all results were delivered, or when ctx is done.
+func (p *StreamProcessor) Process(ctx context.Context, frames <-chan []byte) <-chan backends.InferResult {
+    return backends.InferPipeline(ctx, p.Backend, frames, p.Window)
 }